@@ -0,0 +1,197 @@
+package drum
+
+import (
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// abletonValue is an element of a Live set holding its value in a Value
+// attribute, as nearly all of them do
+type abletonValue struct {
+	Value string `xml:"Value,attr"`
+}
+
+// abletonString returns the element holding s
+func abletonString(s string) abletonValue {
+
+	return abletonValue{s}
+}
+
+// abletonFloat returns the element holding f, in the shortest form that
+// reads back as f
+func abletonFloat(f float64) abletonValue {
+
+	return abletonValue{strconv.FormatFloat(f, 'f', -1, 64)}
+}
+
+// abletonInt returns the element holding n
+func abletonInt(n int) abletonValue {
+
+	return abletonValue{strconv.Itoa(n)}
+}
+
+// The elements of the Live set ExportAbleton writes, named as Live names
+// them. Live fills in the many elements left out with their defaults.
+type (
+	abletonDocument struct {
+		XMLName      xml.Name       `xml:"Ableton"`
+		MajorVersion string         `xml:"MajorVersion,attr"`
+		MinorVersion string         `xml:"MinorVersion,attr"`
+		Creator      string         `xml:"Creator,attr"`
+		LiveSet      abletonLiveSet `xml:"LiveSet"`
+	}
+
+	abletonLiveSet struct {
+		Tracks      []abletonMidiTrack `xml:"Tracks>MidiTrack"`
+		MasterTempo abletonValue       `xml:"MasterTrack>DeviceChain>Mixer>Tempo>Manual"`
+	}
+
+	abletonMidiTrack struct {
+		ID           int                 `xml:"Id,attr"`
+		Name         abletonValue        `xml:"Name>EffectiveName"`
+		UserName     abletonValue        `xml:"Name>UserName"`
+		ClipSlots    []abletonClipSlot   `xml:"DeviceChain>MainSequencer>ClipSlotList>ClipSlot"`
+		DrumBranches []abletonDrumBranch `xml:"DeviceChain>DeviceChain>Devices>DrumGroupDevice>Branches>DrumBranch"`
+	}
+
+	abletonClipSlot struct {
+		ID   int             `xml:"Id,attr"`
+		Clip abletonMidiClip `xml:"ClipSlot>Value>MidiClip"`
+	}
+
+	abletonMidiClip struct {
+		ID        int               `xml:"Id,attr"`
+		Time      string            `xml:"Time,attr"`
+		Start     abletonValue      `xml:"CurrentStart"`
+		End       abletonValue      `xml:"CurrentEnd"`
+		LoopStart abletonValue      `xml:"Loop>LoopStart"`
+		LoopEnd   abletonValue      `xml:"Loop>LoopEnd"`
+		LoopOn    abletonValue      `xml:"Loop>LoopOn"`
+		Name      abletonValue      `xml:"Name"`
+		KeyTracks []abletonKeyTrack `xml:"Notes>KeyTracks>KeyTrack"`
+	}
+
+	abletonKeyTrack struct {
+		ID    int                    `xml:"Id,attr"`
+		Notes []abletonMidiNoteEvent `xml:"Notes>MidiNoteEvent"`
+		Key   abletonValue           `xml:"MidiKey"`
+	}
+
+	abletonMidiNoteEvent struct {
+		Time        string `xml:"Time,attr"`
+		Duration    string `xml:"Duration,attr"`
+		Velocity    int    `xml:"Velocity,attr"`
+		OffVelocity int    `xml:"OffVelocity,attr"`
+		IsEnabled   bool   `xml:"IsEnabled,attr"`
+	}
+
+	abletonDrumBranch struct {
+		ID            int          `xml:"Id,attr"`
+		Name          abletonValue `xml:"Name>EffectiveName"`
+		UserName      abletonValue `xml:"Name>UserName"`
+		ReceivingNote abletonValue `xml:"BranchInfo>ReceivingNote"`
+	}
+)
+
+// ExportAbleton writes the pattern to w as an Ableton Live set, the
+// gzipped XML of an .als file, holding one MIDI track with a Drum Rack. The
+// track's first clip slot holds a looping clip of the pattern, in which
+// each instrument plays the note its name has in DefaultGMDrumMap, looked up
+// as ToMIDI does. The Drum Rack has a pad named after each instrument on
+// that note, so samples dropped on the pads play the pattern. Hits are
+// placed at the pattern's resolution, at the velocity and offset set by
+// their Expression scaled by the instrument's Gain. The notes of
+// instruments that aren't Audible are written disabled, so they can be
+// turned back on in Live. The set carries the pattern's tempo. An error is
+// returned before anything is written if an instrument with hits has no
+// note or the tempo isn't positive.
+func ExportAbleton(p Pattern, w io.Writer) error {
+
+	if !(p.tempo > 0) {
+		return fmt.Errorf("cannot export to Ableton Live at a tempo of %v", p.tempo)
+	}
+
+	beats := float64(p.loopSteps()) / float64(p.beatSteps())
+	if beats == 0 {
+		beats = beatsPerBar
+	}
+
+	clip := abletonMidiClip{Time: "0", Start: abletonFloat(0), End: abletonFloat(beats),
+		LoopStart: abletonFloat(0), LoopEnd: abletonFloat(beats), LoopOn: abletonString("true"),
+		Name: abletonString(p.version)}
+	track := abletonMidiTrack{Name: abletonString(p.version), UserName: abletonString(p.version)}
+
+	keys := make(map[uint8]*abletonKeyTrack)
+	soloing := p.soloing()
+
+	for _, inst := range p.instruments {
+		note, ok := gmNote(DefaultGMDrumMap, inst.name)
+		if !ok {
+			if inst.hits() > 0 {
+				return fmt.Errorf("no drum rack note for instrument %d %q", inst.num, inst.name)
+			}
+			continue
+		}
+
+		key := keys[note]
+		if key == nil {
+			key = &abletonKeyTrack{Key: abletonInt(int(note))}
+			keys[note] = key
+
+			// Live stores a pad's note counting down from 128
+			track.DrumBranches = append(track.DrumBranches, abletonDrumBranch{ID: len(track.DrumBranches),
+				Name: abletonString(inst.name), UserName: abletonString(inst.name),
+				ReceivingNote: abletonInt(128 - int(note))})
+		}
+
+		step := 1 / float64(p.beatSteps())
+		for s, value := range inst.steps() {
+			if !isOn(value) {
+				continue
+			}
+
+			e := inst.expressionAt(s)
+			time := (float64(s) + e.Offset) * step
+			if time < 0 {
+				time = 0
+			}
+			key.Notes = append(key.Notes, abletonMidiNoteEvent{
+				Time:        strconv.FormatFloat(time, 'f', -1, 64),
+				Duration:    strconv.FormatFloat(step, 'f', -1, 64),
+				Velocity:    int(scaleVelocity(e.EffectiveVelocity(), float64(inst.Gain()))),
+				OffVelocity: 64,
+				IsEnabled:   p.audible(inst, soloing),
+			})
+		}
+	}
+
+	notes := make([]int, 0, len(keys))
+	for note := range keys {
+		notes = append(notes, int(note))
+	}
+	sort.Ints(notes)
+	for i, note := range notes {
+		key := keys[uint8(note)]
+		key.ID = i
+		clip.KeyTracks = append(clip.KeyTracks, *key)
+	}
+	track.ClipSlots = []abletonClipSlot{{Clip: clip}}
+
+	doc := abletonDocument{MajorVersion: "5", MinorVersion: "11.0_433", Creator: "Ableton Live 11.0",
+		LiveSet: abletonLiveSet{Tracks: []abletonMidiTrack{track}, MasterTempo: abletonValue{strconv.FormatFloat(float64(p.tempo), 'f', -1, 32)}}}
+
+	zw := gzip.NewWriter(w)
+	if _, err := io.WriteString(zw, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(zw)
+	enc.Indent("", "\t")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	return zw.Close()
+}
@@ -0,0 +1,86 @@
+package drum
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"testing"
+)
+
+func TestExportAbleton(t *testing.T) {
+
+	p := NewPattern("0.808-alpha", 98.4)
+	p.AddInstrument(1, "Kick").SetSteps("x---x---x---x---")
+	p.AddInstrument(2, "snare").SetSteps("----x-------x---")
+	p.AddInstrument(3, "hihat").SetSteps("x-x-x-x-x-x-x-x-")
+	p.AddInstrument(4, "hh-closed").SetSteps("-x--------------")
+	p.AddInstrument(5, "theremin")
+	p.SetMuted(2, true)
+	p.SetGain(3, 0.5)
+	p.SetVelocity(1, 4, 120)
+
+	var buf bytes.Buffer
+	if err := ExportAbleton(*p, &buf); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatalf("expected gzipped XML, got %v", err)
+	}
+	var doc abletonDocument
+	if err := xml.NewDecoder(zr).Decode(&doc); err != nil {
+		t.Fatalf("expected a Live set, got %v", err)
+	}
+
+	set := doc.LiveSet
+	if set.MasterTempo.Value != "98.4" || len(set.Tracks) != 1 || len(set.Tracks[0].ClipSlots) != 1 {
+		t.Fatalf("expected one track with a clip at 98.4 bpm, got %+v", set)
+	}
+	track := set.Tracks[0]
+	clip := track.ClipSlots[0].Clip
+	if clip.LoopEnd.Value != "4" || clip.LoopOn.Value != "true" || clip.Name.Value != "0.808-alpha" {
+		t.Errorf("expected a looping clip of 4 beats, got %+v", clip)
+	}
+
+	// the hihats share a key and a pad, and the silent theremin is left out
+	if len(clip.KeyTracks) != 3 || len(track.DrumBranches) != 3 {
+		t.Fatalf("expected 3 keys and pads, got %d and %d", len(clip.KeyTracks), len(track.DrumBranches))
+	}
+	pads := map[string]string{"Kick": "92", "snare": "90", "hihat": "86"}
+	for _, pad := range track.DrumBranches {
+		if want := pads[pad.Name.Value]; pad.ReceivingNote.Value != want {
+			t.Errorf("expected the %s pad to receive %s, got %s", pad.Name.Value, want, pad.ReceivingNote.Value)
+		}
+	}
+
+	tests := []struct {
+		key      string
+		notes    int
+		time     string
+		velocity int
+		enabled  bool
+	}{
+		{"36", 4, "1", 120, true},
+		{"38", 2, "3", 100, false},
+		{"42", 9, "0.5", 50, true},
+	}
+	for i, tt := range tests {
+		key := clip.KeyTracks[i]
+		if key.Key.Value != tt.key || len(key.Notes) != tt.notes {
+			t.Errorf("key %d: expected note %s with %d hits, got %s with %d", i, tt.key, tt.notes, key.Key.Value, len(key.Notes))
+			continue
+		}
+		note := key.Notes[1]
+		if note.Time != tt.time || note.Duration != "0.25" || note.Velocity != tt.velocity || note.IsEnabled != tt.enabled {
+			t.Errorf("key %d: expected its second hit at %s, velocity %d, enabled %v, got %+v",
+				i, tt.time, tt.velocity, tt.enabled, note)
+		}
+	}
+
+	p.AddInstrument(6, "cymbal").SetSteps("x---------------")
+	buf.Reset()
+	if err := ExportAbleton(*p, &buf); err == nil || buf.Len() != 0 {
+		t.Errorf("expected an error and nothing written for an unmapped instrument, got %v and %d bytes", err, buf.Len())
+	}
+}
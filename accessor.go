@@ -0,0 +1,60 @@
+package drum
+
+// Version returns the hardware version the pattern was saved with
+func (p Pattern) Version() string {
+
+	return p.version
+}
+
+// SetVersion sets the hardware version the pattern is saved with. Encode
+// rejects versions longer than 32 bytes.
+func (p *Pattern) SetVersion(version string) {
+
+	p.version = version
+	p.notify(Change{Kind: ChangeVersion})
+}
+
+// Tempo returns the pattern's tempo in beats per minute
+func (p Pattern) Tempo() float32 {
+
+	return p.tempo
+}
+
+// Instruments returns copies of the pattern's instruments in order. The
+// copies share no memory with the pattern, so changing them leaves the
+// pattern as it was; use the Pattern methods such as SetStep to edit it.
+func (p Pattern) Instruments() []Instrument {
+
+	instruments := make([]Instrument, 0, len(p.instruments))
+
+	for _, inst := range p.instruments {
+		instruments = append(instruments, inst.clone())
+	}
+	return instruments
+}
+
+// ID returns the instrument's id
+func (i Instrument) ID() uint32 {
+
+	return i.num
+}
+
+// Name returns the instrument's name
+func (i Instrument) Name() string {
+
+	return i.name
+}
+
+// Steps returns the instrument's steps across every measure in play order,
+// where true is a hit
+func (i Instrument) Steps() []bool {
+
+	steps := make([]bool, 0, i.stepCount())
+
+	for _, measure := range i.measure {
+		for _, step := range measure {
+			steps = append(steps, isOn(step))
+		}
+	}
+	return steps
+}
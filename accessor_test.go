@@ -0,0 +1,53 @@
+package drum
+
+import (
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestAccessors(t *testing.T) {
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_2.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_2.splice - %v", err)
+	}
+
+	if decoded.Version() != "0.808-alpha" || decoded.Tempo() != 98.4 {
+		t.Errorf("got version %q and tempo %v", decoded.Version(), decoded.Tempo())
+	}
+
+	instruments := decoded.Instruments()
+	if len(instruments) != 4 {
+		t.Fatalf("expected 4 instruments, got %d", len(instruments))
+	}
+
+	kick := instruments[0]
+	if kick.ID() != 0 || kick.Name() != "kick" {
+		t.Errorf("got instrument (%d) %s, expected (0) kick", kick.ID(), kick.Name())
+	}
+
+	on, off := true, false
+	expected := []bool{on, off, off, off, off, off, off, off, on, off, off, off, off, off, off, off}
+	if steps := kick.Steps(); !reflect.DeepEqual(steps, expected) {
+		t.Errorf("got steps %v, expected %v", steps, expected)
+	}
+
+	if err := kick.SetStepAt(1, true); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if decoded.instruments[0].measure[0][1] != StepOff {
+		t.Errorf("changing a returned instrument changed the pattern")
+	}
+
+	var changes []Change
+	decoded.OnChange(func(c Change) { changes = append(changes, c) })
+	decoded.SetVersion("0.909")
+	decoded.SetTempo(120)
+	if decoded.Version() != "0.909" || decoded.Tempo() != 120 {
+		t.Errorf("got version %q and tempo %v after setting them", decoded.Version(), decoded.Tempo())
+	}
+	if len(changes) != 2 || changes[0].Kind != ChangeVersion || changes[1].Kind != ChangeTempo {
+		t.Errorf("expected a ChangeVersion and a ChangeTempo, got %+v", changes)
+	}
+}
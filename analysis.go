@@ -0,0 +1,276 @@
+package drum
+
+import (
+	"math"
+	"strings"
+)
+
+// InstrumentPeriods returns the period of every instrument's hits, keyed by
+// instrument id. An instrument's period is the smallest shift after which its
+// steps repeat for the rest of the sequence; a kick on every quarter note of
+// a 16 step bar has period 4, and one on every third step has period 3 even
+// though 3 doesn't divide 16. A shift only counts if the steps repeat at
+// least twice over it, so an instrument that doesn't repeat has its whole
+// step count as its period. A silent instrument has period 1. When ids are
+// shared the last instrument with the id wins.
+func (p Pattern) InstrumentPeriods() map[uint32]int {
+
+	periods := make(map[uint32]int, len(p.instruments))
+
+	for _, inst := range p.instruments {
+		periods[inst.num] = period(inst.steps())
+	}
+	return periods
+}
+
+// HasPolyrhythm reports whether the pattern plays two or more instruments
+// against each other where at least one repeats with a period that doesn't
+// divide its step count evenly, so its cycle drifts against the bar the
+// others keep.
+func (p Pattern) HasPolyrhythm() bool {
+
+	sounding := 0
+	uneven := false
+
+	for _, inst := range p.instruments {
+		if inst.hits() == 0 {
+			continue
+		}
+		sounding++
+
+		if n := inst.stepCount(); n%period(inst.steps()) != 0 {
+			uneven = true
+		}
+	}
+	return sounding > 1 && uneven
+}
+
+// period returns the smallest shift s, no more than half of steps, for
+// which steps[i] == steps[i+s] for every i where both exist, treating any
+// step other than StepOff as on, or len(steps) if there isn't one.
+func period(steps []byte) int {
+
+	for s := 1; s <= len(steps)/2; s++ {
+		repeats := true
+
+		for i := 0; i+s < len(steps); i++ {
+			if isOn(steps[i]) != isOn(steps[i+s]) {
+				repeats = false
+				break
+			}
+		}
+		if repeats {
+			return s
+		}
+	}
+	return len(steps)
+}
+
+// BeatHistogram returns, for each step position, how many instruments have a
+// hit there. It has as many entries as the longest instrument has steps.
+func (p Pattern) BeatHistogram() []int {
+
+	var histogram []int
+
+	for _, inst := range p.instruments {
+		for s, step := range inst.steps() {
+			if s >= len(histogram) {
+				histogram = append(histogram, 0)
+			}
+			if isOn(step) {
+				histogram[s]++
+			}
+		}
+	}
+	return histogram
+}
+
+// InstrumentsOnBeat returns the instruments with a hit on the given step,
+// indexed across measures. An index outside every instrument returns an
+// empty slice.
+func (p Pattern) InstrumentsOnBeat(global int) []Instrument {
+
+	playing := []Instrument{}
+
+	for _, inst := range p.instruments {
+		if step, err := inst.step(global); err == nil && isOn(step) {
+			playing = append(playing, inst)
+		}
+	}
+	return playing
+}
+
+// meters are the bar lengths, in beats, GuessMeter chooses between, in the
+// order it prefers them when they fit equally well
+var meters = []int{4, 3, 2}
+
+// GuessMeter guesses how many beats make up a bar of the pattern, along with
+// a confidence between 0 and 1. It takes the gaps between hits of the first
+// kick that plays, falling back to the hits of every instrument together, and
+// scores each meter by the share of gaps that fit its bar: a gap fits when it
+// divides the bar or is a whole number of bars. Meters that fit equally well
+// are broken in favour of 4, then 3, then 2, and the confidence is the
+// winning score. A pattern with no hits gives 0, 0.
+func (p Pattern) GuessMeter() (beatsPerBar int, confidence float64) {
+
+	var reference Instrument
+
+	for _, inst := range p.instruments {
+		if strings.Contains(strings.ToLower(inst.name), "kick") && inst.hits() > 0 {
+			reference = inst
+			break
+		}
+	}
+
+	if reference.hits() == 0 {
+		var steps []byte
+		for _, hits := range p.BeatHistogram() {
+			if hits > 0 {
+				steps = append(steps, StepOn)
+			} else {
+				steps = append(steps, StepOff)
+			}
+		}
+		reference.setSteps(steps)
+	}
+
+	intervals := reference.Intervals()
+	if len(intervals) == 0 {
+		return 0, 0
+	}
+
+	for _, beats := range meters {
+		bar := beats * p.beatSteps()
+		fits := 0
+
+		for _, gap := range intervals {
+			if bar%gap == 0 || gap%bar == 0 {
+				fits++
+			}
+		}
+
+		if score := float64(fits) / float64(len(intervals)); score > confidence {
+			beatsPerBar, confidence = beats, score
+		}
+	}
+	return beatsPerBar, confidence
+}
+
+// EstimateSwing estimates how swung the pattern is, from 0 for straight to 1
+// for fully swung. Steps are quantized to sixteenths, so swing can only show
+// up as off-beat eighths pushed one step late: within a beat a hit on the
+// third step and not the fourth plays the off-beat straight, and a hit on the
+// fourth and not the third plays it late. The estimate is the share of late
+// off-beats across every beat of every instrument. Beats with both steps or
+// neither say nothing about swing and are skipped, as is every beat when the
+// pattern has no off-beats at all, which gives 0. Swing that's subtler than a
+// whole step, or that isn't expressed on eighth note off-beats, can't be seen.
+func (p Pattern) EstimateSwing() float64 {
+
+	straight, late := 0, 0
+
+	for _, inst := range p.instruments {
+		steps := inst.steps()
+
+		for beat := 0; beat+stepsPerBeat <= len(steps); beat += stepsPerBeat {
+			onBeat := isOn(steps[beat+2])
+			pushed := isOn(steps[beat+3])
+
+			switch {
+			case onBeat && !pushed:
+				straight++
+			case pushed && !onBeat:
+				late++
+			}
+		}
+	}
+
+	if straight+late == 0 {
+		return 0
+	}
+	return float64(late) / float64(straight+late)
+}
+
+// IsPalindrome reports whether every instrument's steps, read across
+// measures, are the same forwards and backwards. A pattern without
+// instruments is trivially a palindrome.
+func (p Pattern) IsPalindrome() bool {
+
+	for _, inst := range p.instruments {
+		steps := inst.steps()
+
+		for a, b := 0, len(steps)-1; a < b; a, b = a+1, b-1 {
+			if isOn(steps[a]) != isOn(steps[b]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// HiHatOffbeats counts the hi-hat hits that land on a beat, the first step
+// of every beat at the pattern's resolution, and those that land between
+// beats. Every instrument with "hh" or "hat" in its name, ignoring case,
+// counts as a hi-hat, so open and closed hats are added together. A pattern
+// without a hi-hat gives 0, 0.
+func (p Pattern) HiHatOffbeats() (onBeats, offBeats int) {
+
+	for _, inst := range p.instruments {
+		name := strings.ToLower(inst.name)
+		if !strings.Contains(name, "hh") && !strings.Contains(name, "hat") {
+			continue
+		}
+
+		for s, step := range inst.steps() {
+			switch {
+			case !isOn(step):
+			case s%p.beatSteps() == 0:
+				onBeats++
+			default:
+				offBeats++
+			}
+		}
+	}
+	return onBeats, offBeats
+}
+
+// Entropy returns the Shannon entropy, in bits, of whether each of the
+// instrument's steps is a hit:
+//
+//	H = -p·log2(p) - (1-p)·log2(1-p)
+//
+// where p is the share of steps that are hits. It is 0 for an instrument
+// that always or never hits and peaks at 1 when exactly half its steps are
+// hits. Only the balance of hits and rests counts, not where they fall. An
+// instrument without steps has no entropy.
+func (i Instrument) Entropy() float64 {
+
+	n := i.stepCount()
+	if n == 0 {
+		return 0
+	}
+
+	h := 0.0
+	for _, share := range []float64{float64(i.hits()) / float64(n), float64(n-i.hits()) / float64(n)} {
+		if share > 0 {
+			h -= share * math.Log2(share)
+		}
+	}
+	return h
+}
+
+// Complexity returns the mean Entropy of the pattern's instruments, a score
+// from 0 to 1 for sorting patterns by how busy yet varied they are. A
+// pattern without instruments scores 0.
+func (p Pattern) Complexity() float64 {
+
+	if len(p.instruments) == 0 {
+		return 0
+	}
+
+	total := 0.0
+	for _, inst := range p.instruments {
+		total += inst.Entropy()
+	}
+	return total / float64(len(p.instruments))
+}
@@ -0,0 +1,337 @@
+// Package analysis describes how patterns feel with Features, numbers such
+// as how busy and how syncopated they are, and groups a library of patterns
+// by feel with Cluster. Features' Vector suits other uses of the same
+// numbers, such as picking patterns to train the generate package on.
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+
+	drum "github.com/chrishiestand/golang-challenge-1-drum_machine"
+)
+
+// beatsPerBar is the bar syncopation is measured against, as 4/4
+const beatsPerBar = 4
+
+// onsetBuckets is the number of parts of the beat Vector shares hits out
+// between, whatever the patterns' resolutions
+const onsetBuckets = 4
+
+// InstrumentFeatures describes how one instrument plays
+type InstrumentFeatures struct {
+	ID       uint32
+	Name     string
+	Category drum.Category
+	// Density is the share of the instrument's steps that are hits.
+	Density float64
+	// Syncopation is from 0 for hits only on strong beats, or none at all,
+	// to 1 for hits that all fall just before rests on the strongest
+	// beats, from the metrical weights of Longuet-Higgins and Lee.
+	Syncopation float64
+	// Onsets holds the share of the instrument's hits that fall on each
+	// step of the beat, one for each of the pattern's steps per beat, or
+	// zeros if it has no hits.
+	Onsets []float64
+}
+
+// Features describes how a pattern plays: the same measures as
+// InstrumentFeatures taken over all its instruments, and each of theirs
+type Features struct {
+	Density     float64
+	Syncopation float64
+	Onsets      []float64
+	Instruments []InstrumentFeatures
+}
+
+// Extract measures the features of p. Each instrument is measured over
+// its own steps, so instruments with loops of their own count as they
+// cycle.
+func Extract(p drum.Pattern) Features {
+
+	res := p.StepsPerBeat()
+	f := Features{Onsets: make([]float64, res)}
+
+	var steps, hits int
+	var syncopation, maxSyncopation float64
+
+	for _, inst := range p.Instruments() {
+		on := inst.Steps()
+		n := count(on)
+
+		fi := InstrumentFeatures{ID: inst.ID(), Name: inst.Name(), Category: inst.Categorize(), Onsets: make([]float64, res)}
+		if len(on) > 0 {
+			fi.Density = float64(n) / float64(len(on))
+		}
+
+		score := syncopationScore(on, res)
+		if n > 0 {
+			fi.Syncopation = score / (maxWeight * float64(n))
+		}
+		for s, hit := range on {
+			if hit {
+				fi.Onsets[s%res]++
+				f.Onsets[s%res]++
+			}
+		}
+		normalize(fi.Onsets)
+
+		steps += len(on)
+		hits += n
+		syncopation += score
+		maxSyncopation += maxWeight * float64(n)
+		f.Instruments = append(f.Instruments, fi)
+	}
+
+	if steps > 0 {
+		f.Density = float64(hits) / float64(steps)
+	}
+	if maxSyncopation > 0 {
+		f.Syncopation = syncopation / maxSyncopation
+	}
+	normalize(f.Onsets)
+	return f
+}
+
+// count returns the number of hits in steps
+func count(steps []bool) int {
+
+	n := 0
+	for _, hit := range steps {
+		if hit {
+			n++
+		}
+	}
+	return n
+}
+
+// normalize scales shares so they sum to 1, leaving them if they're all 0
+func normalize(shares []float64) {
+
+	total := 0.0
+	for _, v := range shares {
+		total += v
+	}
+	if total == 0 {
+		return
+	}
+	for i := range shares {
+		shares[i] /= total
+	}
+}
+
+// maxWeight is the most a single hit can add to a syncopation score, as
+// the difference between the weights of the bar's first step and the
+// weakest subdivision
+const maxWeight = 4
+
+// metricalWeight returns the weight of a step in a 4/4 bar at res steps
+// per beat, from 0 for the first beat down to -4 for the weakest steps
+func metricalWeight(step, res int) int {
+
+	step %= beatsPerBar * res
+	switch {
+	case step == 0:
+		return 0
+	case step == 2*res:
+		return -1
+	case step%res == 0:
+		return -2
+	case res%2 == 0 && step%res == res/2:
+		return -3
+	}
+	return -4
+}
+
+// syncopationScore sums, over the hits followed by a rest on a stronger
+// step before the next hit, how much stronger the strongest of those rests
+// is. The steps loop, so the last hit is followed by the first.
+func syncopationScore(steps []bool, res int) float64 {
+
+	n := len(steps)
+	score := 0
+	for s, hit := range steps {
+		if !hit {
+			continue
+		}
+
+		strongest := math.MinInt32
+		for r := 1; r < n && !steps[(s+r)%n]; r++ {
+			if w := metricalWeight((s+r)%n, res); w > strongest {
+				strongest = w
+			}
+		}
+		if w := metricalWeight(s, res); strongest > w {
+			score += strongest - w
+		}
+	}
+	return float64(score)
+}
+
+// Vector returns the features as numbers to compare patterns by: the
+// density and syncopation, the share of hits in each quarter of the beat
+// and the density of each category of instrument, counting each category's
+// instruments together. Patterns at different resolutions have vectors of
+// the same length.
+func (f Features) Vector() []float64 {
+
+	v := []float64{f.Density, f.Syncopation}
+
+	onsets := make([]float64, onsetBuckets)
+	for s, share := range f.Onsets {
+		onsets[s*onsetBuckets/len(f.Onsets)] += share
+	}
+	v = append(v, onsets...)
+
+	categories := []drum.Category{drum.CategoryDrum, drum.CategoryCymbal, drum.CategoryPercussion, drum.CategoryUnknown}
+	for _, c := range categories {
+		var density float64
+		var n int
+		for _, inst := range f.Instruments {
+			if inst.Category == c {
+				density += inst.Density
+				n++
+			}
+		}
+		if n > 0 {
+			density /= float64(n)
+		}
+		v = append(v, density)
+	}
+	return v
+}
+
+// Distance returns how differently a and b feel, the Euclidean distance
+// between their Vectors
+func Distance(a, b Features) float64 {
+
+	return distance(a.Vector(), b.Vector())
+}
+
+// Similarity returns how alike a and b feel, from 1 for patterns with the
+// same features towards 0 as their Distance grows
+func Similarity(a, b drum.Pattern) float64 {
+
+	return 1 / (1 + Distance(Extract(a), Extract(b)))
+}
+
+// distance returns the Euclidean distance between two vectors of the same
+// length
+func distance(a, b []float64) float64 {
+
+	var sum float64
+	for i := range a {
+		d := a[i] - b[i]
+		sum += d * d
+	}
+	return math.Sqrt(sum)
+}
+
+// Group is a cluster of patterns found by Cluster: the indexes of its
+// patterns, in ascending order, and the mean of their feature Vectors
+type Group struct {
+	Members  []int
+	Centroid []float64
+}
+
+// ErrClusterCount means Cluster was asked for more groups than there are
+// patterns, or fewer than one.
+var ErrClusterCount = errors.New("invalid cluster count")
+
+// maxIterations bounds how long Cluster refines its groups
+const maxIterations = 100
+
+// Cluster groups patterns by feel into k groups with k-means over their
+// feature Vectors. It starts from the first pattern and the patterns
+// furthest from those already picked, so the same patterns always give the
+// same groups, in the order their first patterns were picked. Patterns with
+// identical features can leave a group empty; empty groups are left out, so
+// fewer than k may be returned. It returns an error wrapping
+// ErrClusterCount if k is less than 1 or more than the number of patterns.
+func Cluster(patterns []drum.Pattern, k int) ([]Group, error) {
+
+	if k < 1 || k > len(patterns) {
+		return nil, fmt.Errorf("%w: can't make %d groups of %d patterns", ErrClusterCount, k, len(patterns))
+	}
+
+	vectors := make([][]float64, len(patterns))
+	for i, p := range patterns {
+		vectors[i] = Extract(p).Vector()
+	}
+
+	centroids := [][]float64{append([]float64(nil), vectors[0]...)}
+	for len(centroids) < k {
+		furthest, best := 0, -1.0
+		for i, v := range vectors {
+			if _, d := nearest(v, centroids); d > best {
+				furthest, best = i, d
+			}
+		}
+		centroids = append(centroids, append([]float64(nil), vectors[furthest]...))
+	}
+
+	assignment := make([]int, len(vectors))
+	for iteration := 0; iteration < maxIterations; iteration++ {
+		changed := iteration == 0
+		for i, v := range vectors {
+			if c, _ := nearest(v, centroids); c != assignment[i] {
+				assignment[i] = c
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+
+		for c := range centroids {
+			mean := make([]float64, len(centroids[c]))
+			n := 0
+			for i, v := range vectors {
+				if assignment[i] != c {
+					continue
+				}
+				for d := range mean {
+					mean[d] += v[d]
+				}
+				n++
+			}
+			if n == 0 {
+				continue
+			}
+			for d := range mean {
+				mean[d] /= float64(n)
+			}
+			centroids[c] = mean
+		}
+	}
+
+	var groups []Group
+	for c, centroid := range centroids {
+		g := Group{Centroid: centroid}
+		for i := range vectors {
+			if assignment[i] == c {
+				g.Members = append(g.Members, i)
+			}
+		}
+		if len(g.Members) > 0 {
+			sort.Ints(g.Members)
+			groups = append(groups, g)
+		}
+	}
+	return groups, nil
+}
+
+// nearest returns the index of the centroid closest to v, the first of any
+// that are as close, and its distance from v
+func nearest(v []float64, centroids [][]float64) (index int, dist float64) {
+
+	dist = math.Inf(1)
+	for c, centroid := range centroids {
+		if d := distance(v, centroid); d < dist {
+			index, dist = c, d
+		}
+	}
+	return index, dist
+}
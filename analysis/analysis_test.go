@@ -0,0 +1,126 @@
+package analysis
+
+import (
+	"errors"
+	"math"
+	"path"
+	"reflect"
+	"testing"
+
+	drum "github.com/chrishiestand/golang-challenge-1-drum_machine"
+	"github.com/chrishiestand/golang-challenge-1-drum_machine/drumtest"
+)
+
+// tracks returns a kick and a closed hi-hat playing the given grids
+func tracks(kick, hat string) []drumtest.Track {
+
+	return []drumtest.Track{{ID: 0, Name: "kick", Steps: kick}, {ID: 1, Name: "hh-closed", Steps: hat}}
+}
+
+func TestExtract(t *testing.T) {
+
+	f := Extract(drumtest.Pattern(t, "analysis", 120, tracks("x---x---x---x---", "--x---x---x---x-")...))
+
+	if f.Density != 0.25 {
+		t.Errorf("expected a density of 0.25, got %v", f.Density)
+	}
+
+	tests := []struct {
+		name        string
+		category    drum.Category
+		syncopation float64
+		onsets      []float64
+	}{
+		// on the beat, the kick never lands before a stronger rest
+		{"kick", drum.CategoryDrum, 0, []float64{1, 0, 0, 0}},
+		// each off beat hat rests into a beat, the second into the half
+		// bar and the last into the bar
+		{"hh-closed", drum.CategoryCymbal, 7.0 / 16, []float64{0, 0, 1, 0}},
+	}
+	for i, tt := range tests {
+		inst := f.Instruments[i]
+		if inst.Name != tt.name || inst.Category != tt.category || inst.Density != 0.25 ||
+			inst.Syncopation != tt.syncopation || !reflect.DeepEqual(inst.Onsets, tt.onsets) {
+			t.Errorf("instrument %d: expected %s syncopated %v with onsets %v, got %+v", i, tt.name, tt.syncopation, tt.onsets, inst)
+		}
+	}
+	if f.Syncopation != 7.0/32 || !reflect.DeepEqual(f.Onsets, []float64{0.5, 0, 0.5, 0}) {
+		t.Errorf("expected the pattern's syncopation and onsets across both, got %v and %v", f.Syncopation, f.Onsets)
+	}
+
+	if v := f.Vector(); len(v) != 10 || v[0] != f.Density || v[6] != 0.25 || v[7] != 0.25 {
+		t.Errorf("expected a vector of density, syncopation, onsets and category densities, got %v", v)
+	}
+
+	if empty := Extract(drum.Pattern{}); empty.Density != 0 || empty.Syncopation != 0 || len(empty.Vector()) != 10 {
+		t.Errorf("expected zero features for an empty pattern, got %+v", empty)
+	}
+}
+
+func TestExtractFixtures(t *testing.T) {
+
+	for _, name := range []string{"pattern_1.splice", "pattern_2.splice", "pattern_3.splice", "pattern_4.splice", "pattern_5.splice"} {
+		p, err := drum.DecodeFile(path.Join("..", "fixtures", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f := Extract(*p)
+		for _, v := range f.Vector() {
+			if math.IsNaN(v) || v < 0 || v > 1 {
+				t.Errorf("%s: expected features between 0 and 1, got %v", name, f.Vector())
+				break
+			}
+		}
+		if s := Similarity(*p, *p); s != 1 {
+			t.Errorf("%s: expected a pattern to be exactly like itself, got %v", name, s)
+		}
+	}
+}
+
+func TestCluster(t *testing.T) {
+
+	patterns := []drum.Pattern{
+		drumtest.Pattern(t, "analysis", 120, tracks("x---x---x---x---", "x---x---x---x---")...),
+		drumtest.Pattern(t, "analysis", 120, tracks("x-x-x-x-x-x-x-x-", "x-x-x-x-x-x-x-x-")...),
+		drumtest.Pattern(t, "analysis", 120, tracks("x-------x-------", "x---x---x---x---")...),
+		drumtest.Pattern(t, "analysis", 120, tracks("x-x-x-x-x-x-x-xx", "xxxxxxxxxxxxxxxx")...),
+		drumtest.Pattern(t, "analysis", 120, tracks("-x--x--x-x--x--x", "xx-x--xx-xx-x-x-")...),
+		drumtest.Pattern(t, "analysis", 120, tracks("---x--x---x--x--", "-x-x-x-x-x-x-x-x")...),
+	}
+
+	groups, err := Cluster(patterns, 3)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	var members [][]int
+	for _, g := range groups {
+		members = append(members, g.Members)
+		if len(g.Centroid) != 10 {
+			t.Errorf("expected a centroid of 10 features, got %v", g.Centroid)
+		}
+	}
+	// sparse and straight, syncopated, then busy
+	expected := [][]int{{0, 2}, {4, 5}, {1, 3}}
+	if !reflect.DeepEqual(members, expected) {
+		t.Errorf("expected groups %v, got %v", expected, members)
+	}
+
+	if a, b := Similarity(patterns[0], patterns[2]), Similarity(patterns[0], patterns[5]); a <= b {
+		t.Errorf("expected straight patterns to be more alike than a straight and a syncopated one, got %v and %v", a, b)
+	}
+
+	if groups, err := Cluster(patterns[:2], 2); err != nil || len(groups) != 2 {
+		t.Errorf("expected a group for each pattern, got %v, %v", groups, err)
+	}
+	same := []drum.Pattern{patterns[0], patterns[0]}
+	if groups, err := Cluster(same, 2); err != nil || len(groups) != 1 {
+		t.Errorf("expected identical patterns to share a group, got %v, %v", groups, err)
+	}
+	for _, k := range []int{0, 7} {
+		if _, err := Cluster(patterns, k); !errors.Is(err, ErrClusterCount) {
+			t.Errorf("k=%d: expected %v, got %v", k, ErrClusterCount, err)
+		}
+	}
+}
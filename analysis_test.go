@@ -0,0 +1,229 @@
+package drum
+
+import (
+	"math"
+	"path"
+	"testing"
+)
+
+func TestInstrumentPeriods(t *testing.T) {
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_4.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_4.splice - %v", err)
+	}
+
+	expected := map[uint32]int{0: 1, 1: 8, 99: 2, 255: 8}
+	periods := decoded.InstrumentPeriods()
+
+	for id, want := range expected {
+		if periods[id] != want {
+			t.Errorf("instrument %d: got period %d, expected %d", id, periods[id], want)
+		}
+	}
+	if decoded.HasPolyrhythm() {
+		t.Errorf("expected pattern_4 not to be polyrhythmic")
+	}
+}
+
+func TestHasPolyrhythmFixtures(t *testing.T) {
+
+	for _, name := range []string{"pattern_1.splice", "pattern_2.splice", "pattern_3.splice"} {
+		decoded, err := DecodeFile(path.Join("fixtures", name))
+		if err != nil {
+			t.Fatalf("something went wrong decoding %s - %v", name, err)
+		}
+		if decoded.HasPolyrhythm() {
+			t.Errorf("%s: expected a plain 4/4 pattern not to be polyrhythmic, got periods %v", name, decoded.InstrumentPeriods())
+		}
+	}
+}
+
+func TestHasPolyrhythm(t *testing.T) {
+
+	p := Pattern{instruments: []Instrument{
+		{num: 0, name: "kick", measure: []Step{{1, 0, 0, 0}, {1, 0, 0, 0}, {1, 0, 0, 0}, {1, 0, 0, 0}}},
+		{num: 1, name: "clave", measure: []Step{{1, 0, 0, 1}, {0, 0, 1, 0}, {0, 1, 0, 0}, {1, 0, 0, 1}}},
+	}}
+
+	if got := p.InstrumentPeriods()[1]; got != 3 {
+		t.Fatalf("expected the clave to have period 3, got %d", got)
+	}
+	if !p.HasPolyrhythm() {
+		t.Errorf("expected 3 against 4 to be polyrhythmic")
+	}
+
+	p.instruments = p.instruments[1:]
+	if p.HasPolyrhythm() {
+		t.Errorf("a single instrument can't form a polyrhythm")
+	}
+}
+
+func TestBeatHistogram(t *testing.T) {
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_1.splice - %v", err)
+	}
+
+	expected := []int{2, 0, 1, 0, 4, 0, 2, 0, 2, 0, 2, 0, 3, 0, 1, 1}
+	got := decoded.BeatHistogram()
+
+	if len(got) != len(expected) {
+		t.Fatalf("got %v, expected %v", got, expected)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("got %v, expected %v", got, expected)
+		}
+	}
+}
+
+func TestInstrumentsOnBeat(t *testing.T) {
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_1.splice - %v", err)
+	}
+
+	playing := decoded.InstrumentsOnBeat(12)
+	if len(playing) != 3 || playing[0].name != "kick" || playing[1].name != "snare" || playing[2].name != "hh-close" {
+		t.Errorf("unexpected instruments on step 12 %v", playing)
+	}
+
+	for _, global := range []int{-1, 16} {
+		if playing := decoded.InstrumentsOnBeat(global); playing == nil || len(playing) != 0 {
+			t.Errorf("step %d: expected an empty slice, got %v", global, playing)
+		}
+	}
+}
+
+func TestGuessMeter(t *testing.T) {
+	tData := []struct {
+		name       string
+		p          Pattern
+		beats      int
+		confidence float64
+	}{
+		{"four on the floor", Pattern{instruments: []Instrument{
+			{num: 0, name: "Kick", measure: []Step{{1, 0, 0, 0}, {1, 0, 0, 0}, {1, 0, 0, 0}, {1, 0, 0, 0}}},
+			{num: 1, name: "hat", measure: []Step{{0, 1, 1, 0}, {0, 0, 1, 1}, {1, 0, 0, 1}, {0, 1, 0, 0}}},
+		}}, 4, 1},
+		{"waltz kick", Pattern{instruments: []Instrument{
+			{num: 0, name: "kick", measure: []Step{{1, 0, 0, 0}, {0, 0, 0, 0}, {0, 0, 0, 0}, {1, 0, 0, 0}}},
+		}}, 3, 1},
+		{"no kick falls back to every hit", Pattern{instruments: []Instrument{
+			{num: 0, name: "kick", measure: []Step{{0, 0, 0, 0}, {0, 0, 0, 0}, {0, 0, 0, 0}, {0, 0, 0, 0}}},
+			{num: 1, name: "snare", measure: []Step{{1, 0, 0, 0}, {1, 0, 0, 0}, {0, 0, 0, 0}, {0, 0, 0, 0}}},
+			{num: 2, name: "clap", measure: []Step{{0, 0, 0, 0}, {0, 0, 0, 0}, {1, 0, 0, 0}, {1, 0, 0, 0}}},
+		}}, 4, 1},
+		{"syncopated kick", Pattern{instruments: []Instrument{
+			{num: 0, name: "kick", measure: []Step{{1, 0, 0, 0}, {0, 0, 1, 0}, {1, 0, 0, 0}, {0, 0, 0, 0}}},
+		}}, 4, 2.0 / 3},
+		{"silent", Pattern{instruments: []Instrument{
+			{num: 0, name: "kick", measure: []Step{{0, 0, 0, 0}, {0, 0, 0, 0}, {0, 0, 0, 0}, {0, 0, 0, 0}}},
+		}}, 0, 0},
+	}
+
+	for _, exp := range tData {
+		beats, confidence := exp.p.GuessMeter()
+		if beats != exp.beats || confidence != exp.confidence {
+			t.Errorf("%s: got %d beats with confidence %v, expected %d with %v", exp.name, beats, confidence, exp.beats, exp.confidence)
+		}
+	}
+}
+
+func TestEstimateSwing(t *testing.T) {
+	tData := []struct {
+		name     string
+		measure  []Step
+		expected float64
+	}{
+		{"straight eighths", []Step{{1, 0, 1, 0}, {1, 0, 1, 0}, {1, 0, 1, 0}, {1, 0, 1, 0}}, 0},
+		{"swung eighths", []Step{{1, 0, 0, 1}, {1, 0, 0, 1}, {1, 0, 0, 1}, {1, 0, 0, 1}}, 1},
+		{"half swung", []Step{{1, 0, 0, 1}, {1, 0, 1, 0}, {1, 0, 0, 1}, {1, 0, 1, 0}}, 0.5},
+		{"sixteenths", []Step{{1, 1, 1, 1}, {1, 1, 1, 1}, {1, 1, 1, 1}, {1, 1, 1, 1}}, 0},
+		{"quarters", []Step{{1, 0, 0, 0}, {1, 0, 0, 0}, {1, 0, 0, 0}, {1, 0, 0, 0}}, 0},
+	}
+
+	for _, exp := range tData {
+
+		p := Pattern{instruments: []Instrument{{num: 0, name: "hat", measure: exp.measure}}}
+		if got := p.EstimateSwing(); got != exp.expected {
+			t.Errorf("%s: got swing %v, expected %v", exp.name, got, exp.expected)
+		}
+	}
+}
+
+func TestIsPalindrome(t *testing.T) {
+
+	p := Pattern{instruments: []Instrument{
+		{num: 0, name: "kick", measure: []Step{{1, 0, 0, 1}, {0, 0, 1, 0}, {0, 1, 0, 0}, {1, 0, 0, 1}}},
+		{num: 1, name: "clap", measure: []Step{{0, 0, 0, 0}, {1, 0, 1, 0}, {0, 1, 0, 1}, {0, 0, 0, 0}}},
+	}}
+	if !p.IsPalindrome() {
+		t.Errorf("expected a palindrome:\n%s", p)
+	}
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_1.splice - %v", err)
+	}
+	if decoded.IsPalindrome() {
+		t.Errorf("pattern_1 isn't a palindrome:\n%s", decoded)
+	}
+}
+
+func TestHiHatOffbeats(t *testing.T) {
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_1.splice - %v", err)
+	}
+
+	// hh-open --x-|--x-|x-x-|--x- and hh-close x---|x---|----|x--x
+	if on, off := decoded.HiHatOffbeats(); on != 4 || off != 5 {
+		t.Errorf("got %d on beats and %d off, expected 4 and 5", on, off)
+	}
+
+	p := Pattern{instruments: []Instrument{
+		{num: 0, name: "kick", measure: []Step{{1, 0, 1, 0}, {1, 0, 1, 0}}},
+		{num: 1, name: "HiHat", measure: []Step{{0, 1, 1, 1}, {1, 0, 1, 0}}},
+	}}
+	if on, off := p.HiHatOffbeats(); on != 1 || off != 4 {
+		t.Errorf("got %d on beats and %d off, expected 1 and 4", on, off)
+	}
+
+	p.instruments = p.instruments[:1]
+	if on, off := p.HiHatOffbeats(); on != 0 || off != 0 {
+		t.Errorf("expected zeros without a hi-hat, got %d and %d", on, off)
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	tData := []struct {
+		measure  []Step
+		expected float64
+	}{
+		{[]Step{{0, 0, 0, 0}, {0, 0, 0, 0}, {0, 0, 0, 0}, {0, 0, 0, 0}}, 0},
+		{[]Step{{1, 1, 1, 1}, {1, 1, 1, 1}, {1, 1, 1, 1}, {1, 1, 1, 1}}, 0},
+		{[]Step{{1, 0, 1, 0}, {1, 0, 1, 0}, {1, 0, 1, 0}, {1, 0, 1, 0}}, 1},
+		{[]Step{{1, 0, 0, 0}, {1, 0, 0, 0}, {1, 0, 0, 0}, {1, 0, 0, 0}}, 0.8112781244591328},
+		{nil, 0},
+	}
+
+	for _, exp := range tData {
+		inst := Instrument{measure: exp.measure}
+		if got := inst.Entropy(); math.Abs(got-exp.expected) > 1e-12 {
+			t.Errorf("%s: got entropy %v, expected %v", gridString(inst.steps()), got, exp.expected)
+		}
+	}
+
+	p := Pattern{instruments: []Instrument{{measure: tData[0].measure}, {measure: tData[2].measure}}}
+	if got := p.Complexity(); got != 0.5 {
+		t.Errorf("got complexity %v, expected 0.5", got)
+	}
+	if got := (Pattern{}).Complexity(); got != 0 {
+		t.Errorf("expected an empty pattern to score 0, got %v", got)
+	}
+}
@@ -0,0 +1,49 @@
+package drum
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"path"
+)
+
+// DecodeZip decodes every .splice entry in the zip archive at the provided
+// path and returns the patterns keyed by entry name. An entry that fails to
+// decode doesn't stop the others: the returned error joins the failures of
+// every such entry, and the map still holds every pattern that decoded.
+func DecodeZip(zipPath string) (map[string]Pattern, error) {
+
+	z, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+
+	patterns := make(map[string]Pattern)
+	var errs []error
+
+	for _, f := range z.File {
+		if f.FileInfo().IsDir() || path.Ext(f.Name) != ".splice" {
+			continue
+		}
+
+		p, err := decodeZipEntry(f)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", f.Name, err))
+			continue
+		}
+		patterns[f.Name] = p
+	}
+	return patterns, errors.Join(errs...)
+}
+
+func decodeZipEntry(f *zip.File) (Pattern, error) {
+
+	rc, err := f.Open()
+	if err != nil {
+		return Pattern{}, err
+	}
+	defer rc.Close()
+
+	return Decode(rc)
+}
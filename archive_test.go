@@ -0,0 +1,66 @@
+package drum
+
+import (
+	"archive/zip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDecodeZip(t *testing.T) {
+
+	zipPath := filepath.Join(t.TempDir(), "pack.zip")
+	f, err := os.Create(zipPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zw := zip.NewWriter(f)
+	entries := map[string]string{
+		"grooves/pattern_1.splice": "pattern_1.splice",
+		"pattern_2.splice":         "pattern_2.splice",
+		"readme.txt":               "",
+		"broken.splice":            "",
+	}
+	for name, fixture := range entries {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fixture == "" {
+			w.Write([]byte("not a splice file"))
+			continue
+		}
+		data, err := ioutil.ReadFile(path.Join("fixtures", fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write(data)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	patterns, err := DecodeZip(zipPath)
+	if err == nil || !strings.Contains(err.Error(), "broken.splice") {
+		t.Errorf("expected an error naming broken.splice, got %v", err)
+	}
+	if len(patterns) != 2 {
+		t.Fatalf("expected 2 patterns, got %d", len(patterns))
+	}
+
+	for name, fixture := range map[string]string{"grooves/pattern_1.splice": "pattern_1.splice", "pattern_2.splice": "pattern_2.splice"} {
+		expected, err := DecodeFile(path.Join("fixtures", fixture))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(patterns[name]) != fmt.Sprint(expected) {
+			t.Errorf("%s wasn't decoded as expected:\n%s", name, patterns[name])
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package drum
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// BackupPath returns the path of the nth most recent backup of the file at
+// path kept by EncodeOptions.Backup: path with .bak added for the first,
+// and .bak.2, .bak.3 and so on for older ones
+func BackupPath(path string, n int) string {
+
+	if n <= 1 {
+		return path + ".bak"
+	}
+	return fmt.Sprintf("%s.bak.%d", path, n)
+}
+
+// writeFileAtomic replaces the file at path with what write writes, by
+// writing it to a temporary file beside it that's synced and renamed over
+// path, then syncing the directory so the rename itself is durable. It
+// keeps up to backups earlier versions of the file, and removes the
+// temporary file if anything fails before the rename.
+func writeFileAtomic(path string, backups int, write func(w io.Writer) error) (err error) {
+
+	mode := fs.FileMode(0644)
+	info, statErr := os.Stat(path)
+	if statErr == nil {
+		mode = info.Mode().Perm()
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+
+	if err := write(f); err != nil {
+		return err
+	}
+	if err := f.Chmod(mode); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if statErr == nil && backups > 0 {
+		if err := rotateBackups(path, backups, mode); err != nil {
+			return fmt.Errorf("backing up %s: %w", path, err)
+		}
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir flushes the directory at path to disk, so entries just renamed
+// into it survive a crash
+func syncDir(path string) error {
+
+	d, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	if err := d.Sync(); err != nil {
+		d.Close()
+		return fmt.Errorf("syncing %s: %w", path, err)
+	}
+	return d.Close()
+}
+
+// rotateBackups moves each of the up to n backups of the file at path one
+// older, dropping the oldest, and copies the file to the most recent with
+// the given permissions, so the file itself stays in place until it's
+// replaced
+func rotateBackups(path string, n int, mode fs.FileMode) error {
+
+	if err := os.Remove(BackupPath(path, n)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for k := n - 1; k >= 1; k-- {
+		if err := os.Rename(BackupPath(path, k), BackupPath(path, k+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(BackupPath(path, 1), data, mode)
+}
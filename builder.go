@@ -0,0 +1,74 @@
+package drum
+
+import "fmt"
+
+// NewPattern returns an empty pattern with the given version and tempo, to
+// which instruments can be added with AddInstrument. It is encoded like any
+// other pattern, with the plain SPLICE header.
+func NewPattern(version string, tempo float32) *Pattern {
+
+	return &Pattern{version: version, tempo: tempo, instruments: []Instrument{}}
+}
+
+// InstrumentBuilder sets the steps of an instrument added by AddInstrument.
+// It refers to the instrument by its position, so it should be used before
+// instruments are removed from or reordered in the pattern.
+type InstrumentBuilder struct {
+	p     *Pattern
+	index int
+}
+
+// AddInstrument appends a silent instrument with the given id and name to
+// the pattern and returns a builder for setting its steps, as in
+//
+//	p.AddInstrument(0, "kick").SetSteps("x---x---x---x---")
+//
+// The instrument has as many steps as the pattern's longest instrument, or
+// 16 if it's the first.
+func (p *Pattern) AddInstrument(id uint32, name string) *InstrumentBuilder {
+
+	steps := p.loopSteps()
+	if steps == 0 {
+		steps = stepsPerMeasure * measuresPerInstrument
+	}
+
+	inst := Instrument{num: id, name: name}
+	inst.setSteps(make([]byte, steps))
+
+	p.instruments = append(p.instruments, inst)
+	p.notify(Change{Kind: ChangeInstrumentAdded, InstrumentID: id})
+	return &InstrumentBuilder{p: p, index: len(p.instruments) - 1}
+}
+
+// SetSteps replaces the instrument's steps with those in grid, where x is a
+// hit and - a rest. Spaces and | bar separators are ignored, so the grid
+// can be written the way String prints it, as in "x---|x---|x---|x---".
+// The grid must hold exactly as many steps as the instrument; otherwise the
+// steps are left as they were and an error wrapping ErrInvalidStep is
+// returned.
+func (b *InstrumentBuilder) SetSteps(grid string) error {
+
+	if b.index >= len(b.p.instruments) {
+		return fmt.Errorf("instrument %d is no longer in the pattern", b.index)
+	}
+
+	steps, err := parseSteps(grid, 0)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidStep, err)
+	}
+	if n := b.p.instruments[b.index].stepCount(); len(steps) != n {
+		return fmt.Errorf("%w: %q has %d steps, expected %d", ErrInvalidStep, grid, len(steps), n)
+	}
+
+	values := make([]byte, len(steps))
+	for s, on := range steps {
+		if on {
+			values[s] = StepOn
+		}
+	}
+
+	inst := &b.p.instruments[b.index]
+	inst.setSteps(values)
+	b.p.notify(Change{Kind: ChangeSteps, InstrumentID: inst.num})
+	return nil
+}
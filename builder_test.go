@@ -0,0 +1,71 @@
+package drum
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestNewPattern(t *testing.T) {
+
+	p := NewPattern("0.808-alpha", 120)
+
+	if err := p.AddInstrument(0, "kick").SetSteps("x---x---x---x---"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	snare := p.AddInstrument(1, "snare")
+	p.AddInstrument(2, "clap")
+
+	if err := snare.SetSteps("----|x---|----|x---"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	expected := `Saved with HW Version: 0.808-alpha
+Tempo: 120
+(0) kick	|x---|x---|x---|x---|
+(1) snare	|----|x---|----|x---|
+(2) clap	|----|----|----|----|
+`
+	if got := p.String(); got != expected {
+		t.Errorf("got\n%s\nexpected\n%s", got, expected)
+	}
+
+	var buf bytes.Buffer
+	if err := p.Encode(&buf); err != nil {
+		t.Fatalf("unexpected error encoding %v", err)
+	}
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error decoding %v", err)
+	}
+	if !decoded.Equal(*p) {
+		t.Errorf("round trip changed the pattern:\n%s", decoded)
+	}
+
+	for _, grid := range []string{"x---x---", "x---x---x---x---x", "x---o---x---x---"} {
+		if err := snare.SetSteps(grid); !errors.Is(err, ErrInvalidStep) {
+			t.Errorf("%s: expected %v, got %v", grid, ErrInvalidStep, err)
+		}
+	}
+	if got := gridString(p.instruments[1].steps()); got != "----x-------x---" {
+		t.Errorf("a failed SetSteps changed the steps to %s", got)
+	}
+}
+
+func TestBuilderSharedID(t *testing.T) {
+
+	p := NewPattern("0.808-alpha", 120)
+	if err := p.AddInstrument(0, "kick").SetSteps("x---x---x---x---"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := p.AddInstrument(0, "snare").SetSteps("----x-------x---"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if got := gridString(p.instruments[0].steps()); got != "x---x---x---x---" {
+		t.Errorf("setting the snare changed the kick to %s", got)
+	}
+	if got := gridString(p.instruments[1].steps()); got != "----x-------x---" {
+		t.Errorf("expected the snare's steps to be set, got %s", got)
+	}
+}
@@ -0,0 +1,158 @@
+package drum
+
+import "sync"
+
+// LoopEvent is a pattern coming round to its first step as a Sequencer
+// plays it: the pattern the new loop plays, the number of loops played
+// since the sequencer was last stopped, and the chain entry playing when
+// it plays a song, or -1 otherwise
+type LoopEvent struct {
+	Pattern Pattern
+	Loops   int
+	Entry   int
+}
+
+// TempoChange is the tempo a Sequencer plays at changing, whether by
+// SetTempo, as a song moves on to a pattern with another tempo or as Stop
+// rewinds to the first
+type TempoChange struct {
+	From, To float32
+}
+
+// EventBus passes what a Sequencer does as it plays to any number of
+// subscribers, so several integrations can follow the same playback. Each
+// subscription returns a function that cancels it. Subscribers are called
+// in the order they subscribed, from the goroutine playing the steps, so
+// they should return quickly. An EventBus is safe for use by several
+// goroutines, and subscribing or cancelling while playing takes effect from
+// the next call.
+type EventBus struct {
+	mu          sync.Mutex
+	lastID      int
+	subscribers []subscriber
+}
+
+// subscriber is a single subscription, with just one of its functions set
+type subscriber struct {
+	id    int
+	step  func(Pattern, int)
+	hit   func(StepEvent)
+	loop  func(LoopEvent)
+	tempo func(TempoChange)
+}
+
+// OnStep subscribes fn to be called as each step begins, before any of its
+// hits, with a copy of the pattern being played and the step
+func (b *EventBus) OnStep(fn func(p Pattern, step int)) (cancel func()) {
+
+	return b.subscribe(subscriber{step: fn})
+}
+
+// OnHit subscribes fn to be called with each hit as it comes due, before
+// it's sent on the sequencer's Events channel
+func (b *EventBus) OnHit(fn func(e StepEvent)) (cancel func()) {
+
+	return b.subscribe(subscriber{hit: fn})
+}
+
+// OnPatternLoop subscribes fn to be called as the pattern playing comes
+// round to its first step after its last, before OnStep is called for it
+func (b *EventBus) OnPatternLoop(fn func(e LoopEvent)) (cancel func()) {
+
+	return b.subscribe(subscriber{loop: fn})
+}
+
+// OnTempoChange subscribes fn to be called when the tempo the sequencer
+// plays at changes, as the first step at the new tempo begins and before
+// OnPatternLoop and OnStep are called for it
+func (b *EventBus) OnTempoChange(fn func(c TempoChange)) (cancel func()) {
+
+	return b.subscribe(subscriber{tempo: fn})
+}
+
+// subscribe adds sub and returns the function that removes it again
+func (b *EventBus) subscribe(sub subscriber) func() {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	sub.id = b.lastID
+	b.subscribers = append(b.subscribers, sub)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { b.unsubscribe(sub.id) })
+	}
+}
+
+// unsubscribe removes the subscriber with the given id. It builds a new
+// slice so that publishing can go on with the one it already holds.
+func (b *EventBus) unsubscribe(id int) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var kept []subscriber
+	for _, sub := range b.subscribers {
+		if sub.id != id {
+			kept = append(kept, sub)
+		}
+	}
+	b.subscribers = kept
+}
+
+// current returns the subscribers as they are now
+func (b *EventBus) current() []subscriber {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.subscribers
+}
+
+// publishStep calls the OnStep subscribers, each with its own copy of p
+func (b *EventBus) publishStep(p Pattern, step int) {
+
+	for _, sub := range b.current() {
+		if sub.step != nil {
+			sub.step(p.Clone(), step)
+		}
+	}
+}
+
+// publishHit calls the OnHit subscribers
+func (b *EventBus) publishHit(e StepEvent) {
+
+	for _, sub := range b.current() {
+		if sub.hit != nil {
+			sub.hit(e)
+		}
+	}
+}
+
+// publishLoop calls the OnPatternLoop subscribers, each with its own copy
+// of the pattern
+func (b *EventBus) publishLoop(e LoopEvent) {
+
+	for _, sub := range b.current() {
+		if sub.loop != nil {
+			c := e
+			c.Pattern = e.Pattern.Clone()
+			sub.loop(c)
+		}
+	}
+}
+
+// publishTempo calls the OnTempoChange subscribers, if the tempo changed
+func (b *EventBus) publishTempo(c TempoChange) {
+
+	if c.From == c.To {
+		return
+	}
+	for _, sub := range b.current() {
+		if sub.tempo != nil {
+			sub.tempo(c)
+		}
+	}
+}
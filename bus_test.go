@@ -0,0 +1,98 @@
+package drum
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestEventBus(t *testing.T) {
+
+	a := NewPattern("a", 6000)
+	a.AddInstrument(0, "kick").SetSteps("x---------------")
+	b := NewPattern("b", 12000)
+	b.AddInstrument(1, "snare").SetSteps("--------x-------")
+
+	s, err := NewSongSequencer(Song{Patterns: []Pattern{*a, *b}, Chain: []ChainEntry{{0, 2}, {1, 1}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var steps, hits []int
+	var loops []LoopEvent
+	var tempos []TempoChange
+
+	bus := s.Bus()
+	bus.OnStep(func(p Pattern, step int) {
+		mu.Lock()
+		steps = append(steps, step)
+		mu.Unlock()
+	})
+	cancelHits := bus.OnHit(func(e StepEvent) {
+		mu.Lock()
+		hits = append(hits, e.StepIndex)
+		mu.Unlock()
+	})
+	bus.OnPatternLoop(func(e LoopEvent) {
+		mu.Lock()
+		loops = append(loops, e)
+		mu.Unlock()
+	})
+	bus.OnTempoChange(func(c TempoChange) {
+		mu.Lock()
+		tempos = append(tempos, c)
+		mu.Unlock()
+	})
+	// a second subscriber sees the same steps
+	var others int
+	bus.OnStep(func(Pattern, int) {
+		mu.Lock()
+		others++
+		mu.Unlock()
+	})
+
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// kick, kick, then snare: two loops of a and most of one of b
+	for n := 0; n < 3; n++ {
+		<-s.Events()
+	}
+	s.Pause()
+
+	mu.Lock()
+	if len(steps) < 41 || steps[0] != 0 || steps[16] != 0 || steps[40] != 8 {
+		t.Errorf("expected steps from 0 round to 8 of the third loop, got %v", steps)
+	}
+	if others != len(steps) {
+		t.Errorf("expected both step subscribers to see %d steps, the second saw %d", len(steps), others)
+	}
+	if len(hits) != 3 || hits[2] != 8 {
+		t.Errorf("expected hits on steps 0, 0 and 8, got %v", hits)
+	}
+	if len(loops) != 2 || loops[0].Loops != 1 || loops[0].Entry != 0 || loops[1].Loops != 2 || loops[1].Entry != 1 || loops[1].Pattern.version != "b" {
+		t.Errorf("expected pattern a to loop into its repeat and then b, got %+v", loops)
+	}
+	if len(tempos) != 1 || tempos[0] != (TempoChange{6000, 12000}) {
+		t.Errorf("expected the tempo to change from 6000 to 12000, got %v", tempos)
+	}
+	mu.Unlock()
+
+	cancelHits()
+	cancelHits()
+	s.Stop()
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	<-s.Events()
+	s.Pause()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(hits) != 3 {
+		t.Errorf("expected no hits after cancelling, got %v", hits[3:])
+	}
+	if len(tempos) != 2 || tempos[1] != (TempoChange{12000, 6000}) {
+		t.Errorf("expected rewinding to change the tempo back to 6000, got %v", tempos)
+	}
+}
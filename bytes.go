@@ -0,0 +1,179 @@
+package drum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// internedNames are the instrument names and versions common enough in
+// pattern libraries that decoders share one copy of each instead of
+// allocating a string for every pattern holding them
+var internedNames = internTable(
+	"0.808-alpha", "0.909", "0.708-alpha",
+	"kick", "Kick", "SubKick", "snare", "SnareDrum", "clap", "rim",
+	"hh-open", "hh-close", "hh-closed", "HiHat", "cowbell", "Maracas",
+	"low-tom", "mid-tom", "hi-tom", "tom", "crash", "ride", "Low Conga",
+)
+
+// internTable returns a table mapping each of names to itself
+func internTable(names ...string) map[string]string {
+
+	table := make(map[string]string, len(names))
+	for _, name := range names {
+		table[name] = name
+	}
+	return table
+}
+
+// intern returns b as a string, without allocating if it's one of the
+// internedNames
+func intern(b []byte) string {
+
+	if s, ok := internedNames[string(b)]; ok {
+		return s
+	}
+	return string(b)
+}
+
+// DecodeBytes decodes a single pattern in the original .splice format from
+// the start of data, as Decode does from a reader, for indexing large
+// libraries without the cost of reading them through one. It reads the
+// fields straight out of data rather than copying them into buffers, gives
+// every instrument's steps one shared allocation and shares the strings of
+// common instrument names and versions between patterns, so decoding
+// allocates little more than the pattern itself.
+//
+// The returned pattern's steps, header and tempo bytes alias data, so data
+// must not be modified while the pattern is in use, and editing the
+// pattern's steps writes to data; Clone the pattern to keep it apart. The
+// same data always gives the same pattern, or the same error as Decode,
+// and an extension area following the payload is read as Decode reads it.
+func DecodeBytes(data []byte) (Pattern, error) {
+
+	var p Pattern
+	var opts DecodeOptions
+
+	if len(data) < headerSize {
+		return p, readError(0, "header", shortRead(len(data)))
+	}
+	header, data := data[:headerSize], data[headerSize:]
+	if _, err := parseHeader(header); err != nil {
+		return p, err
+	}
+	p.header = header[:headerSize:headerSize]
+	p.lengthSize = 1
+
+	if len(data) < p.lengthSize {
+		return p, readError(headerSize, "payload length", io.EOF)
+	}
+	length := payloadLength(header, data[:p.lengthSize], binary.LittleEndian)
+	if length > uint64(opts.maxPayload()) {
+		return p, decodeError(headerSize, "payload length", fmt.Errorf("%w: declared payload of %d bytes is over the %d byte limit",
+			ErrPayloadTooLarge, length, opts.maxPayload()))
+	}
+	data = data[p.lengthSize:]
+
+	offset := headerSize + p.lengthSize
+	if uint64(len(data)) < length {
+		return p, readError(offset, "payload", shortRead(len(data)))
+	}
+	payload, rest := data[:length], data[length:]
+
+	if len(payload) < versionSize {
+		return p, decodeError(offset, "version", fmt.Errorf("%w: payload is only %d bytes", ErrTruncated, len(payload)))
+	}
+	p.version = intern(bytes.Trim(payload[:versionSize], "\x00"))
+	payload = payload[versionSize:]
+	offset += versionSize
+
+	tempo, tempoSize, err := opts.TempoFormat.decode(payload, binary.LittleEndian)
+	if err != nil {
+		return p, decodeError(offset, "tempo", err)
+	}
+	p.tempo = tempo
+	p.tempoBin = payload[:tempoSize:tempoSize]
+	payload = payload[tempoSize:]
+	offset += tempoSize
+
+	instruments, err := readInstrumentsInPlace(payload, offset, opts)
+	if err != nil {
+		return p, err
+	}
+	p.instruments = instruments
+
+	if len(rest) >= len(extensionMagic) && string(rest[:len(extensionMagic)]) == extensionMagic {
+		// only patterns with an extension pay for one escaping to the heap
+		extended := p
+		err := readExtension(bytes.NewReader(rest), &extended, offset+len(payload), opts)
+		return extended, err
+	}
+	return p, nil
+}
+
+// shortRead returns the error io.ReadFull gives for reading n bytes of a
+// field that needs more
+func shortRead(n int) error {
+
+	if n == 0 {
+		return io.EOF
+	}
+	return io.ErrUnexpectedEOF
+}
+
+// readInstrumentsInPlace reads the instrument records in payload, which
+// starts at byte offset of the file, as readInstruments does, leaving
+// their steps in payload. It counts the records first so that the
+// instruments, and their measures, take an allocation each between them.
+func readInstrumentsInPlace(payload []byte, offset int, opts DecodeOptions) ([]Instrument, error) {
+
+	stepCount, _ := opts.stepsPerInstrument()
+	const measures = measuresPerInstrument
+
+	count := 0
+	for rest := payload; len(rest) >= 5 && count < opts.maxInstruments(); count++ {
+		nameLength, lengthSize, err := readNameLength(rest[4:])
+		record := 4 + lengthSize + nameLength + stepCount
+		if err != nil || len(rest) < record {
+			// leave the error for the read below
+			count++
+			break
+		}
+		rest = rest[record:]
+	}
+
+	instruments := make([]Instrument, 0, count)
+	steps := make([]Step, count*measures)
+
+	for len(payload) > 0 {
+		if len(instruments) >= opts.maxInstruments() {
+			return instruments, decodeError(offset, "instrument",
+				fmt.Errorf("%w: pattern has more than %d", ErrTooManyInstruments, opts.maxInstruments()))
+		}
+
+		inst, rest, err := readInstrumentName(payload, offset, opts)
+		if err != nil {
+			return instruments, err
+		}
+		stepsAt := offset + len(payload) - len(rest)
+		if len(rest) < stepCount {
+			return instruments, decodeError(stepsAt, "instrument steps", fmt.Errorf("%w: instrument %d needs %d bytes, %d are left",
+				ErrTruncatedInstrument, inst.num, stepCount, len(rest)))
+		}
+
+		if len(steps) < measures {
+			steps = make([]Step, measures)
+		}
+		inst.measure, steps = steps[:measures:measures], steps[measures:]
+		for m := range inst.measure {
+			inst.measure[m] = Step(rest[m*stepsPerMeasure : (m+1)*stepsPerMeasure : (m+1)*stepsPerMeasure])
+		}
+		rest = rest[stepCount:]
+
+		offset += len(payload) - len(rest)
+		payload = rest
+		instruments = append(instruments, inst)
+	}
+	return instruments, nil
+}
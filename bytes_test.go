@@ -0,0 +1,118 @@
+package drum
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeBytes(t *testing.T) {
+
+	names := []string{"pattern_1.splice", "pattern_2.splice", "pattern_3.splice", "pattern_4.splice", "pattern_5.splice",
+		"header_bytes.splice", "many_instruments.splice", "quirks.splice", "duplicate_ids.splice",
+		"truncated_payload.splice", "truncated_tempo.splice"}
+
+	for _, name := range names {
+		data, err := os.ReadFile(path.Join("fixtures", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected, expectedErr := Decode(bytes.NewReader(data))
+		got, err := DecodeBytes(data)
+		if (err == nil) != (expectedErr == nil) || (err != nil && err.Error() != expectedErr.Error()) {
+			t.Errorf("%s: expected error %v, got %v", name, expectedErr, err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(got, expected) {
+			t.Errorf("%s: expected\n%v\ngot\n%v", name, expected, got)
+		}
+	}
+}
+
+func TestDecodeBytesTruncated(t *testing.T) {
+
+	data, err := os.ReadFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// every prefix fails as Decode fails, or decodes the same instruments
+	for n := 0; n < len(data); n++ {
+		expected, expectedErr := Decode(bytes.NewReader(data[:n]))
+		got, err := DecodeBytes(data[:n])
+		if (err == nil) != (expectedErr == nil) || (err != nil && err.Error() != expectedErr.Error()) {
+			t.Fatalf("%d bytes: expected error %v, got %v", n, expectedErr, err)
+		}
+		if err == nil && !reflect.DeepEqual(got, expected) {
+			t.Fatalf("%d bytes: expected\n%v\ngot\n%v", n, expected, got)
+		}
+	}
+}
+
+func TestDecodeBytesExtension(t *testing.T) {
+
+	p := NewPattern("0.808-alpha", 120)
+	p.AddInstrument(1, "kick").SetSteps("x---x---x---x---")
+	p.AddInstrument(2, "hh-closed").SetSteps("x-x-x-x-x-x-x-x-")
+	p.SetLoopLength(2, 12)
+
+	var buf bytes.Buffer
+	if err := p.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodeBytes(buf.Bytes())
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !decoded.Equal(*p) || !decoded.Polyrhythmic() {
+		t.Errorf("expected the loop lengths back, got\n%v", decoded)
+	}
+}
+
+func TestDecodeBytesAllocs(t *testing.T) {
+
+	data, err := os.ReadFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader := testing.AllocsPerRun(100, func() { Decode(bytes.NewReader(data)) })
+	inPlace := testing.AllocsPerRun(100, func() { DecodeBytes(data) })
+	// the instruments and their measures, whose names are all interned
+	if inPlace > 2 || inPlace >= reader {
+		t.Errorf("expected DecodeBytes to allocate twice, and less than Decode's %v, got %v", reader, inPlace)
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+
+	data, err := os.ReadFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := Decode(bytes.NewReader(data)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeBytes(b *testing.B) {
+
+	data, err := os.ReadFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := DecodeBytes(data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
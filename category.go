@@ -0,0 +1,78 @@
+package drum
+
+import "strings"
+
+// Category is the broad family an instrument belongs to
+type Category int
+
+// The categories Categorize sorts instruments into.
+const (
+	// CategoryUnknown holds instruments whose names aren't recognised.
+	CategoryUnknown Category = iota
+	// CategoryDrum holds kicks, snares, toms, claps and rimshots.
+	CategoryDrum
+	// CategoryCymbal holds hi-hats, crashes, rides and other cymbals.
+	CategoryCymbal
+	// CategoryPercussion holds hand and auxiliary percussion such as
+	// cowbells, congas and shakers.
+	CategoryPercussion
+)
+
+// String returns the category's name in lower case
+func (c Category) String() string {
+
+	switch c {
+	case CategoryDrum:
+		return "drum"
+	case CategoryCymbal:
+		return "cymbal"
+	case CategoryPercussion:
+		return "percussion"
+	default:
+		return "unknown"
+	}
+}
+
+// categoryKeywords lists, in the order they're tried, the name fragments
+// that put an instrument in each category
+var categoryKeywords = []struct {
+	category Category
+	keywords []string
+}{
+	{CategoryCymbal, []string{"hh", "hat", "cymbal", "crash", "ride", "splash", "china"}},
+	{CategoryPercussion, []string{"cowbell", "clave", "conga", "bongo", "maraca", "shaker", "tambourine", "cabasa", "agogo", "block", "triangle", "perc"}},
+	{CategoryDrum, []string{"kick", "bass drum", "snare", "tom", "clap", "rim"}},
+}
+
+// Categorize guesses the instrument's category from its name, ignoring
+// case: "hh-open" is a cymbal, "Low Conga" percussion and "SnareDrum" a
+// drum. A name matching none of the known instruments is CategoryUnknown.
+func (i Instrument) Categorize() Category {
+
+	name := strings.ToLower(i.name)
+
+	for _, c := range categoryKeywords {
+		for _, keyword := range c.keywords {
+			if strings.Contains(name, keyword) {
+				return c.category
+			}
+		}
+	}
+	return CategoryUnknown
+}
+
+// GroupByCategory buckets the pattern's instruments by Categorize, keeping
+// their order within each category. Only categories with at least one
+// instrument have an entry. The instruments are copies, but their steps
+// share memory with the pattern's, so the steps of either shouldn't be
+// changed while the other is in use.
+func (p Pattern) GroupByCategory() map[Category][]Instrument {
+
+	groups := make(map[Category][]Instrument)
+
+	for _, inst := range p.instruments {
+		c := inst.Categorize()
+		groups[c] = append(groups[c], inst)
+	}
+	return groups
+}
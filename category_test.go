@@ -0,0 +1,61 @@
+package drum
+
+import (
+	"path"
+	"testing"
+)
+
+func TestCategorize(t *testing.T) {
+	tData := []struct {
+		name     string
+		expected Category
+	}{
+		{"kick", CategoryDrum},
+		{"SnareDrum", CategoryDrum},
+		{"low-tom", CategoryDrum},
+		{"clap", CategoryDrum},
+		{"hh-open", CategoryCymbal},
+		{"HiHat", CategoryCymbal},
+		{"Ride", CategoryCymbal},
+		{"cowbell", CategoryPercussion},
+		{"Low Conga", CategoryPercussion},
+		{"maracas", CategoryPercussion},
+		{"Synth", CategoryUnknown},
+		{"", CategoryUnknown},
+	}
+
+	for _, exp := range tData {
+		if got := (Instrument{name: exp.name}).Categorize(); got != exp.expected {
+			t.Errorf("%q: got %v, expected %v", exp.name, got, exp.expected)
+		}
+	}
+}
+
+func TestGroupByCategory(t *testing.T) {
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_1.splice - %v", err)
+	}
+
+	expected := map[Category][]string{
+		CategoryDrum:       {"kick", "snare", "clap"},
+		CategoryCymbal:     {"hh-open", "hh-close"},
+		CategoryPercussion: {"cowbell"},
+	}
+
+	groups := decoded.GroupByCategory()
+	if len(groups) != len(expected) {
+		t.Fatalf("got %d categories, expected %d: %v", len(groups), len(expected), groups)
+	}
+	for c, names := range expected {
+		if len(groups[c]) != len(names) {
+			t.Fatalf("%v: got %d instruments, expected %v", c, len(groups[c]), names)
+		}
+		for n, name := range names {
+			if groups[c][n].name != name {
+				t.Errorf("%v: got instrument %q at %d, expected %q", c, groups[c][n].name, n, name)
+			}
+		}
+	}
+}
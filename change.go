@@ -0,0 +1,58 @@
+package drum
+
+// ChangeKind identifies what part of a pattern a Change describes
+type ChangeKind int
+
+const (
+	// ChangeStep is a single step being set or cleared.
+	ChangeStep ChangeKind = iota
+	// ChangeSteps is an instrument's steps being replaced or resized.
+	ChangeSteps
+	// ChangeTempo is the pattern's tempo being set.
+	ChangeTempo
+	// ChangeInstrumentRemoved is an instrument being removed from the pattern.
+	ChangeInstrumentRemoved
+	// ChangeInstrumentAdded is an instrument being added to the pattern.
+	ChangeInstrumentAdded
+	// ChangeExpression is the Expression of a single step being set.
+	ChangeExpression
+	// ChangeInstrumentRenamed is an instrument being given a new name.
+	ChangeInstrumentRenamed
+	// ChangeInstrumentMoved is an instrument being moved to another
+	// position in the pattern.
+	ChangeInstrumentMoved
+	// ChangePlayback is an instrument being muted, soloed or given a gain.
+	ChangePlayback
+	// ChangeMeta is the pattern's metadata being set.
+	ChangeMeta
+	// ChangeVersion is the pattern's hardware version being set.
+	ChangeVersion
+)
+
+// Change describes a single mutation made to a pattern. InstrumentID is set
+// for changes to an instrument, Step and On for ChangeStep, Step for
+// ChangeExpression, and Tempo for ChangeTempo.
+type Change struct {
+	Kind         ChangeKind
+	InstrumentID uint32
+	Step         int
+	On           bool
+	Tempo        float32
+}
+
+// OnChange registers fn to be called after each mutation made through the
+// pattern's methods, replacing any function registered before. Passing nil
+// stops notifications. Copies of the pattern made afterwards carry the same
+// function, but patterns derived from it, such as the result of Repeat, don't.
+func (p *Pattern) OnChange(fn func(change Change)) {
+
+	p.onChange = fn
+}
+
+// notify passes change to the registered observer, if there is one
+func (p *Pattern) notify(change Change) {
+
+	if p.onChange != nil {
+		p.onChange(change)
+	}
+}
@@ -0,0 +1,225 @@
+package drum
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// CheckFile does a cheap sanity check of the .splice file at the provided
+// path without parsing its instruments. It validates the header and checks
+// that the file is at least as long as the header, length byte and the
+// payload length it declares.
+func CheckFile(path string) error {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	prefix := make([]byte, headerSize+1)
+	if _, err := io.ReadFull(f, prefix); err != nil {
+		return fmt.Errorf("%s: %w", path, readError(0, "header", err))
+	}
+
+	if _, err := parseHeader(prefix[:headerSize]); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	declared := int64(payloadLength(prefix[:headerSize], prefix[headerSize:], binary.LittleEndian))
+	if want := int64(len(prefix)) + declared; info.Size() < want {
+		return fmt.Errorf("%s: %w: declares a %d byte payload so needs at least %d bytes, but is %d bytes",
+			path, ErrTruncated, declared, want, info.Size())
+	}
+	return nil
+}
+
+// RoundTripOK decodes the file at path, encodes the pattern to a buffer and
+// decodes that again, reporting whether the two decoded patterns are Equal.
+// When they aren't, the returned error describes the first difference. A
+// file that fails to decode or encode returns false along with that error.
+func RoundTripOK(path string) (bool, error) {
+
+	p, err := DecodeFile(path)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var buf bytes.Buffer
+	if err := p.Encode(&buf); err != nil {
+		return false, fmt.Errorf("%s: encoding: %w", path, err)
+	}
+
+	q, err := Decode(&buf)
+	if err != nil {
+		return false, fmt.Errorf("%s: decoding the re-encoded pattern: %w", path, err)
+	}
+
+	if !p.Equal(q) {
+		return false, fmt.Errorf("%s: re-encoding changed the pattern: %s", path, mismatch(*p, q))
+	}
+	return true, nil
+}
+
+// mismatch describes the first difference Equal finds between p and q
+func mismatch(p, q Pattern) string {
+
+	switch {
+	case p.version != q.version:
+		return fmt.Sprintf("version %q became %q", p.version, q.version)
+	case p.tempo != q.tempo:
+		return fmt.Sprintf("tempo %v became %v", p.tempo, q.tempo)
+	case len(p.instruments) != len(q.instruments):
+		return fmt.Sprintf("%d instruments became %d", len(p.instruments), len(q.instruments))
+	}
+
+	for n, inst := range p.instruments {
+		other := q.instruments[n]
+		if inst.num != other.num || inst.name != other.name || !bytes.Equal(inst.steps(), other.steps()) {
+			return fmt.Sprintf("instrument %d %q became %q", n, inst.Line('x', '-'), other.Line('x', '-'))
+		}
+	}
+	return "no difference found"
+}
+
+// Report is what VerifyFile found in a .splice file. A file is clean when
+// it declares the payload it holds, nothing follows it and there are no
+// warnings or issues.
+type Report struct {
+	// Size is the size of the file in bytes.
+	Size int64
+	// DeclaredPayload is the payload length the file declares, and Payload
+	// the length of the payload it holds, up to the end of its last
+	// complete instrument record.
+	DeclaredPayload int64
+	Payload         int64
+	// Trailing is the number of bytes after the payload.
+	Trailing int64
+	// Warnings are the problems with the file's bytes, which Repair fixes.
+	Warnings []Warning
+	// Issues are the problems Validate finds with the pattern, which
+	// Repair leaves alone.
+	Issues []Issue
+	// Repaired reports whether the file was rewritten.
+	Repaired bool
+}
+
+// OK reports whether the file is clean
+func (r Report) OK() bool {
+
+	return r.DeclaredPayload == r.Payload && r.Trailing == 0 && len(r.Warnings) == 0 && len(r.Issues) == 0
+}
+
+// VerifyOptions adjusts what VerifyFileWithOptions does with the problems
+// it finds
+type VerifyOptions struct {
+	// Repair rewrites a file with warnings as a clean one: bytes after the
+	// payload and partial instrument records are dropped, the payload
+	// length is corrected and null bytes padding names are trimmed.
+	Repair bool
+}
+
+// VerifyFile checks the integrity of the .splice file at path, which must
+// hold a single pattern. It decodes the file leniently, as
+// DecodeWithWarnings does, and reports how the payload length it declares
+// compares with the instrument records it holds, any bytes after them, null
+// padded names and the issues Validate finds. When the declared length
+// stops short of complete records the payload is taken to run on to the end
+// of the file. It returns an error, and no report, for a file it can't
+// decode at all, such as one without the SPLICE header or cut short before
+// the tempo.
+func VerifyFile(path string) (Report, error) {
+
+	return VerifyFileWithOptions(path, VerifyOptions{})
+}
+
+// VerifyFileWithOptions checks the file at path as VerifyFile does,
+// repairing it if opts.Repair is set. The report describes the file as it
+// was found.
+func VerifyFileWithOptions(path string, opts VerifyOptions) (Report, error) {
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Report{}, err
+	}
+
+	report, p, err := verify(data)
+	if err != nil {
+		return Report{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if opts.Repair && len(report.Warnings) > 0 {
+		if err := EncodeFile(p, path); err != nil {
+			return report, fmt.Errorf("%s: repairing: %w", path, err)
+		}
+		report.Repaired = true
+	}
+	return report, nil
+}
+
+// verify reports on the .splice file data, returning the pattern it holds
+// with the problems the report's warnings describe fixed
+func verify(data []byte) (Report, Pattern, error) {
+
+	report := Report{Size: int64(len(data))}
+
+	var warnings []Warning
+	r := bytes.NewReader(data)
+	p, err := decode(context.Background(), r, DecodeOptions{}, &warnings)
+	if err != nil {
+		return report, p, err
+	}
+
+	lengthSize := p.lengthFieldSize()
+	report.DeclaredPayload = int64(payloadLength(data[:headerSize], data[headerSize:headerSize+lengthSize], p.order()))
+
+	// bytes past the declared payload may be the rest of its records, if
+	// the length is wrong, rather than junk
+	if held := len(data) - headerSize - lengthSize; r.Len() > 0 && uint64(held) <= maxPayloadLength(lengthSize) {
+		header, length := putPayloadLength(data[:headerSize], uint64(held), lengthSize, p.order())
+		fixed := append(append(header, length...), data[headerSize+lengthSize:]...)
+
+		if q, err := decode(context.Background(), bytes.NewReader(fixed), DecodeOptions{Strict: true}, nil); err == nil && len(q.instruments) > len(p.instruments) {
+			p = q
+			warnings = []Warning{{WarningPayloadLength,
+				fmt.Sprintf("payload declares %d bytes but its instruments run on for %d", report.DeclaredPayload, held)}}
+		}
+	}
+
+	size, err := p.EncodedSize()
+	if err != nil {
+		return report, p, err
+	}
+	report.Payload = int64(size - headerSize - lengthSize)
+
+	if report.Trailing = report.Size - int64(size); report.Trailing > 0 && r.Len() > 0 {
+		warnings = append(warnings, Warning{WarningTrailingBytes,
+			fmt.Sprintf("%d bytes after the payload", r.Len())})
+	}
+
+	for i := range p.instruments {
+		inst := &p.instruments[i]
+
+		if name := strings.TrimRight(inst.name, "\x00"); name != inst.name {
+			warnings = append(warnings, Warning{WarningNameTrailingNulls,
+				fmt.Sprintf("instrument %d name %q has %d trailing null bytes", inst.num, name, len(inst.name)-len(name))})
+			inst.name = name
+			inst.raw = nil
+		}
+	}
+
+	report.Warnings = warnings
+	report.Issues = Validate(p)
+	return report, p, nil
+}
@@ -0,0 +1,164 @@
+package drum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestCheckFile(t *testing.T) {
+	tData := []struct {
+		path string
+		fail bool
+	}{
+		{"pattern_1.splice", false},
+		{"pattern_5.splice", false},
+		{"header_bytes.splice", false},
+		{"truncated_payload.splice", true},
+		{"missing.splice", true},
+	}
+
+	for _, exp := range tData {
+
+		err := CheckFile(path.Join("fixtures", exp.path))
+		if exp.fail && err == nil {
+			t.Errorf("%s: expected an error", exp.path)
+		}
+		if !exp.fail && err != nil {
+			t.Errorf("%s: unexpected error %v", exp.path, err)
+		}
+	}
+}
+
+func TestRoundTripOK(t *testing.T) {
+
+	for _, name := range []string{"pattern_1.splice", "pattern_2.splice", "pattern_3.splice", "pattern_4.splice", "pattern_5.splice"} {
+		if ok, err := RoundTripOK(path.Join("fixtures", name)); !ok || err != nil {
+			t.Errorf("%s: expected a clean round trip, got %v, %v", name, ok, err)
+		}
+	}
+
+	// a NaN tempo never equals itself, so it can't survive a round trip
+	data, err := ioutil.ReadFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary.LittleEndian.PutUint32(data[headerSize+1+versionSize:], math.Float32bits(float32(math.NaN())))
+
+	nan := path.Join(t.TempDir(), "nan.splice")
+	if err := ioutil.WriteFile(nan, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ok, err := RoundTripOK(nan)
+	if ok || err == nil || !strings.Contains(err.Error(), "tempo NaN") {
+		t.Errorf("expected a tempo mismatch, got %v, %v", ok, err)
+	}
+
+	if ok, err := RoundTripOK(path.Join("fixtures", "truncated_payload.splice")); ok || !errors.Is(err, ErrTruncated) {
+		t.Errorf("expected %v, got %v, %v", ErrTruncated, ok, err)
+	}
+}
+
+func TestVerifyFile(t *testing.T) {
+
+	clean, err := ioutil.ReadFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a length byte 5 short cuts into the last instrument record
+	short := append([]byte(nil), clean...)
+	short[headerSize] -= 5
+
+	tData := []struct {
+		name     string
+		data     []byte
+		fixture  string
+		warnings []WarningCode
+		issues   int
+		trailing int64
+	}{
+		{name: "clean", fixture: "pattern_1.splice"},
+		{name: "trailing junk", fixture: "pattern_5.splice", warnings: []WarningCode{WarningTrailingBytes}, trailing: 31},
+		{name: "payload cut short", fixture: "truncated_payload.splice", warnings: []WarningCode{WarningPayloadShort, WarningPartialInstrument}, trailing: 25},
+		{name: "quirks", fixture: "quirks.splice", warnings: []WarningCode{WarningTrailingBytes, WarningNameTrailingNulls}, trailing: 4},
+		{name: "duplicate ids", fixture: "duplicate_ids.splice", issues: 1},
+		{name: "length too short", data: short, warnings: []WarningCode{WarningPayloadLength}},
+	}
+
+	dir := t.TempDir()
+
+	for _, exp := range tData {
+		data := exp.data
+		if exp.fixture != "" {
+			if data, err = ioutil.ReadFile(path.Join("fixtures", exp.fixture)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		file := path.Join(dir, exp.name+".splice")
+		if err := ioutil.WriteFile(file, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		report, err := VerifyFileWithOptions(file, VerifyOptions{Repair: true})
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", exp.name, err)
+		}
+
+		var codes []WarningCode
+		for _, w := range report.Warnings {
+			codes = append(codes, w.Code)
+		}
+		if fmt.Sprint(codes) != fmt.Sprint(exp.warnings) {
+			t.Errorf("%s: got warnings %v, expected %v", exp.name, report.Warnings, exp.warnings)
+		}
+		if len(report.Issues) != exp.issues {
+			t.Errorf("%s: got issues %v, expected %d", exp.name, report.Issues, exp.issues)
+		}
+		if report.Trailing != exp.trailing {
+			t.Errorf("%s: got %d trailing bytes, expected %d", exp.name, report.Trailing, exp.trailing)
+		}
+		if report.Size != int64(len(data)) {
+			t.Errorf("%s: got size %d, expected %d", exp.name, report.Size, len(data))
+		}
+		if report.Repaired != (len(exp.warnings) > 0) {
+			t.Errorf("%s: expected repaired to be %v", exp.name, len(exp.warnings) > 0)
+		}
+		if report.OK() != (len(exp.warnings) == 0 && exp.issues == 0) {
+			t.Errorf("%s: OK reported %v for %+v", exp.name, report.OK(), report)
+		}
+
+		again, err := VerifyFile(file)
+		if err != nil {
+			t.Fatalf("%s: unexpected error verifying the repaired file %v", exp.name, err)
+		}
+		if len(again.Warnings) > 0 || again.Trailing != 0 || again.DeclaredPayload != again.Payload {
+			t.Errorf("%s: expected the repaired file to be clean, got %+v", exp.name, again)
+		}
+	}
+
+	repaired, err := ioutil.ReadFile(path.Join(dir, "length too short.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(repaired, clean) {
+		t.Errorf("expected fixing the length byte to restore the original file")
+	}
+
+	if _, err := VerifyFile(path.Join("fixtures", "missing.splice")); err == nil {
+		t.Errorf("expected an error verifying a missing file")
+	}
+	text := path.Join(dir, "text.splice")
+	if err := ioutil.WriteFile(text, []byte("not a pattern at all"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyFile(text); !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("expected %v, got %v", ErrInvalidHeader, err)
+	}
+}
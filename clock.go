@@ -0,0 +1,114 @@
+package drum
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"math"
+	"time"
+)
+
+// MIDI real-time messages
+const (
+	midiClock    = 0xf8
+	midiStart    = 0xfa
+	midiContinue = 0xfb
+	midiStop     = 0xfc
+)
+
+// clocksPerBeat is the number of MIDI clock messages in a beat
+const clocksPerBeat = 24
+
+// SendMIDIClock makes the sequencer lead other MIDI gear by writing MIDI
+// clock messages to w, a MIDI output such as a raw MIDI device: 24 clock
+// messages a beat while playing, Start when playback starts from the first
+// step, Continue when it starts anywhere else and Stop when it pauses or
+// stops. Passing nil stops writing them. w isn't closed by Close, and
+// errors writing to it are ignored.
+func (s *Sequencer) SendMIDIClock(w io.Writer) {
+
+	s.mu.Lock()
+	s.clock = w
+	s.mu.Unlock()
+}
+
+// clockCues returns the MIDI clock messages that fall within step of p,
+// which is due at start and lasts interval
+func clockCues(p Pattern, step int, start time.Time, interval time.Duration) []cue {
+
+	perStep := float64(clocksPerBeat) / float64(p.beatSteps())
+
+	var cues []cue
+	for c := math.Ceil(float64(step) * perStep); c < float64(step+1)*perStep; c++ {
+		offset := c/perStep - float64(step)
+		cues = append(cues, cue{at: start.Add(time.Duration(offset * float64(interval))), clock: true})
+	}
+	return cues
+}
+
+// FollowMIDIClock makes the sequencer follow other MIDI gear by reading
+// MIDI messages from r, a MIDI input such as a raw MIDI device, until it
+// ends. The tempo follows the clock messages, averaged over the last beat
+// since playback last started, so time spent stopped doesn't count. Start
+// plays from the first step, Continue plays from the current step and Stop
+// pauses. Everything else in r is ignored. The sequencer keeps its own time
+// between clock messages, so it follows the tempo rather than locking to
+// each message. It returns nil when r ends and any other error reading it.
+func (s *Sequencer) FollowMIDIClock(r io.Reader) error {
+
+	return s.followClock(r, time.Now)
+}
+
+// followClock is FollowMIDIClock, timing clock messages with now
+func (s *Sequencer) followClock(r io.Reader, now func() time.Time) error {
+
+	br := bufio.NewReader(r)
+
+	var last time.Time
+	var intervals []time.Duration
+
+	for {
+		b, err := br.ReadByte()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch b {
+		case midiClock:
+			t := now()
+			if !last.IsZero() {
+				intervals = append(intervals, t.Sub(last))
+				if len(intervals) > clocksPerBeat {
+					intervals = intervals[1:]
+				}
+
+				var total time.Duration
+				for _, d := range intervals {
+					total += d
+				}
+				if total > 0 {
+					beat := float64(total) / float64(len(intervals)) * clocksPerBeat
+					s.SetTempo(float32(float64(time.Minute) / beat))
+				}
+			}
+			last = t
+		case midiStart:
+			s.Stop()
+			last, intervals = time.Time{}, nil
+			if err := s.Start(); err != nil {
+				return err
+			}
+		case midiContinue:
+			last, intervals = time.Time{}, nil
+			if err := s.Start(); err != nil {
+				return err
+			}
+		case midiStop:
+			s.Pause()
+			last, intervals = time.Time{}, nil
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package drum
+
+import (
+	"bytes"
+	"math"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncBuffer is a bytes.Buffer safe for use by several goroutines
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
+
+func TestSendMIDIClock(t *testing.T) {
+
+	p := NewPattern("clock", 6000)
+	p.AddInstrument(0, "kick").SetSteps("x---------------")
+
+	var out syncBuffer
+	s := NewSequencer(*p)
+	s.SendMIDIClock(&out)
+
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	<-s.Events()
+	<-s.Events()
+	s.Pause()
+
+	got := out.Bytes()
+	if got[0] != midiStart || got[len(got)-1] != midiStop {
+		t.Fatalf("expected Start first and Stop last, got % x", got)
+	}
+
+	// a loop of four beats and the first pulse of the next
+	clocks := bytes.Count(got, []byte{midiClock})
+	if clocks < 4*clocksPerBeat+1 || clocks != len(got)-2 {
+		t.Errorf("expected at least %d clock messages and nothing else, got % x", 4*clocksPerBeat+1, got)
+	}
+
+	s.Start()
+	s.Stop()
+	s.Start()
+	s.SendMIDIClock(nil)
+	s.Stop()
+
+	got = out.Bytes()[len(got):]
+	if got[0] != midiContinue || bytes.Count(got, []byte{midiStop}) != 1 || bytes.IndexByte(got, midiStart) != len(got)-1 {
+		t.Errorf("expected Continue, clocks, Stop and Start, got % x", got)
+	}
+}
+
+func TestClockCues(t *testing.T) {
+
+	for _, perBeat := range []int{1, 3, 4, 5, 7} {
+
+		p := NewPattern("clock", 120)
+		p.AddInstrument(0, "kick").SetSteps("x---------------")
+		p.resolution = perBeat
+
+		interval := time.Second
+		start := time.Unix(0, 0)
+
+		total := 0
+		for step := 0; step < perBeat; step++ {
+			cues := clockCues(*p, step, start, interval)
+			for _, c := range cues {
+				if c.at.Before(start) || !c.at.Before(start.Add(interval)) {
+					t.Errorf("%d per beat, step %d: clock at %v is outside the step", perBeat, step, c.at.Sub(start))
+				}
+			}
+			total += len(cues)
+			start = start.Add(interval)
+		}
+		if total != clocksPerBeat {
+			t.Errorf("%d per beat: expected %d clocks a beat, got %d", perBeat, clocksPerBeat, total)
+		}
+	}
+}
+
+func TestFollowMIDIClock(t *testing.T) {
+
+	p := NewPattern("clock", 90)
+	p.AddInstrument(0, "kick").SetSteps("x---------------")
+	s := NewSequencer(*p)
+	defer s.Stop()
+
+	// clocks 20.8ms apart are 120 BPM
+	var clock time.Time
+	now := func() time.Time {
+		clock = clock.Add(time.Minute / 120 / clocksPerBeat)
+		return clock
+	}
+
+	playing := func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.stop != nil
+	}
+
+	in := []byte{midiStart, 0x99, 36, 100}
+	in = append(in, bytes.Repeat([]byte{midiClock}, 30)...)
+	if err := s.followClock(bytes.NewReader(in), now); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !playing() {
+		t.Errorf("expected Start to start playing")
+	}
+	if s.tempo < 119.99 || s.tempo > 120.01 || math.IsNaN(float64(s.tempo)) {
+		t.Errorf("expected to follow the clock to 120 BPM, got %v", s.tempo)
+	}
+
+	s.followClock(bytes.NewReader([]byte{midiStop}), now)
+	if playing() {
+		t.Errorf("expected Stop to pause")
+	}
+	s.followClock(bytes.NewReader([]byte{midiContinue}), now)
+	if !playing() {
+		t.Errorf("expected Continue to resume")
+	}
+}
+
+func TestFollowMIDIClockPaused(t *testing.T) {
+
+	p := NewPattern("clock", 90)
+	p.AddInstrument(0, "kick").SetSteps("x---------------")
+	s := NewSequencer(*p)
+	defer s.Stop()
+
+	// clocks at 120 BPM, with ten seconds stopped before the 31st
+	var clock time.Time
+	clocks := 0
+	now := func() time.Time {
+		clocks++
+		if clocks == 31 {
+			clock = clock.Add(10 * time.Second)
+		}
+		clock = clock.Add(time.Minute / 120 / clocksPerBeat)
+		return clock
+	}
+
+	in := []byte{midiStart}
+	in = append(in, bytes.Repeat([]byte{midiClock}, 30)...)
+	in = append(in, midiStop, midiContinue)
+	in = append(in, bytes.Repeat([]byte{midiClock}, 3)...)
+	if err := s.followClock(bytes.NewReader(in), now); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if s.tempo < 119.99 || s.tempo > 120.01 {
+		t.Errorf("expected the time stopped not to count toward the tempo, got %v", s.tempo)
+	}
+}
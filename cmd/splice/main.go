@@ -0,0 +1,262 @@
+// Command splice inspects and converts .splice drum machine patterns.
+//
+// Usage:
+//
+//	splice show file.splice
+//	splice json file.splice
+//	splice convert [-to splice|json|text] [file.splice]
+//	splice set-tempo [-backup n] bpm file.splice
+//	splice to-midi file.splice [out.mid]
+//	splice play [-loops n] [-tempo bpm] [-visual] file.splice
+//
+// show prints the pattern as text and json prints it as JSON. convert
+// prints it in the format -to names, JSON by default. set-tempo rewrites
+// the file with a new tempo, in the format it's in, replacing it
+// atomically and with -backup keeping that many earlier versions beside
+// it. to-midi writes a Standard MIDI File, by default next to the pattern
+// with a .mid extension. play plays the pattern in the terminal, printing
+// each hit as it comes due, or with -visual drawing it as a grid with a
+// moving playhead.
+//
+// A pattern can be a .splice file, JSON or text, whichever the file holds.
+// A file of - reads the pattern from stdin, which convert also does when
+// given no file, and has set-tempo and to-midi write to stdout, so splice
+// fits in a pipeline:
+//
+//	cat a.splice | splice convert -to json | jq .tracks
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	drum "github.com/chrishiestand/golang-challenge-1-drum_machine"
+	"github.com/chrishiestand/golang-challenge-1-drum_machine/tui"
+)
+
+const usage = `usage:
+	splice show file.splice
+	splice json file.splice
+	splice convert [-to splice|json|text] [file.splice]
+	splice set-tempo [-backup n] bpm file.splice
+	splice to-midi file.splice [out.mid]
+	splice play [-loops n] [-tempo bpm] [-visual] file.splice`
+
+// errUsage means the command line couldn't be understood
+var errUsage = errors.New(usage)
+
+func main() {
+
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "splice:", err)
+		os.Exit(2)
+	}
+}
+
+// run carries out the subcommand named by args[0], reading patterns named -
+// from in and writing its output to out
+func run(args []string, in io.Reader, out io.Writer) error {
+
+	if len(args) == 0 {
+		return errUsage
+	}
+	command, args := args[0], args[1:]
+
+	switch command {
+	case "show":
+		return withPattern(args, 1, in, func(p *drum.Pattern) error {
+			return drum.EncodeFormat(out, *p, drum.FormatText)
+		})
+	case "json":
+		return withPattern(args, 1, in, func(p *drum.Pattern) error {
+			return drum.EncodeFormat(out, *p, drum.FormatJSON)
+		})
+	case "convert":
+		return convert(args, in, out)
+	case "set-tempo":
+		return setTempo(args, in, out)
+	case "to-midi":
+		return toMIDI(args, in, out)
+	case "play":
+		return play(args, in, out)
+	}
+	return fmt.Errorf("unknown command %q\n%w", command, errUsage)
+}
+
+// withPattern decodes the file named by the last argument and calls fn with
+// it, after checking there are exactly n arguments
+func withPattern(args []string, n int, in io.Reader, fn func(p *drum.Pattern) error) error {
+
+	if len(args) != n {
+		return errUsage
+	}
+
+	p, _, err := readPattern(args[n-1], in)
+	if err != nil {
+		return err
+	}
+	return fn(p)
+}
+
+// readPattern decodes the pattern in the file at path, or in in if path is
+// -, in whichever format it's in
+func readPattern(path string, in io.Reader) (*drum.Pattern, drum.Format, error) {
+
+	if path == "-" {
+		p, format, err := drum.DecodeAny(in)
+		return &p, format, err
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+
+	p, format, err := drum.DecodeAny(f)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %w", path, err)
+	}
+	return &p, format, nil
+}
+
+// convert writes a pattern to out in another format
+func convert(args []string, in io.Reader, out io.Writer) error {
+
+	flags := flag.NewFlagSet("convert", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	to := flags.String("to", "json", "format to write: splice, json or text")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("%v\n%w", err, errUsage)
+	}
+	format, err := drum.ParseFormat(*to)
+	if err != nil {
+		return err
+	}
+
+	args = flags.Args()
+	if len(args) == 0 {
+		args = []string{"-"}
+	}
+	return withPattern(args, 1, in, func(p *drum.Pattern) error {
+		return drum.EncodeFormat(out, *p, format)
+	})
+}
+
+// setTempo rewrites a pattern with a new tempo, in the format it was in
+func setTempo(args []string, in io.Reader, out io.Writer) error {
+
+	flags := flag.NewFlagSet("set-tempo", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	backup := flags.Int("backup", 0, "number of earlier versions of the file to keep")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("%v\n%w", err, errUsage)
+	}
+	if args = flags.Args(); len(args) != 2 {
+		return errUsage
+	}
+
+	bpm, err := strconv.ParseFloat(args[0], 32)
+	if err != nil || !(bpm > 0) {
+		return fmt.Errorf("tempo %q isn't a positive number", args[0])
+	}
+
+	path := args[1]
+	p, format, err := readPattern(path, in)
+	if err != nil {
+		return err
+	}
+	p.SetTempo(float32(bpm))
+
+	if path == "-" {
+		return drum.EncodeFormat(out, *p, format)
+	}
+	return drum.EncodeFileWithOptions(*p, path, drum.EncodeOptions{Backup: *backup, Format: format})
+}
+
+// toMIDI writes a pattern as a Standard MIDI File, to out if the pattern is
+// read from stdin or the file to write is -
+func toMIDI(args []string, in io.Reader, out io.Writer) error {
+
+	if len(args) != 1 && len(args) != 2 {
+		return errUsage
+	}
+
+	path := strings.TrimSuffix(args[0], filepath.Ext(args[0])) + ".mid"
+	if args[0] == "-" {
+		path = "-"
+	}
+	if len(args) == 2 {
+		path = args[1]
+	}
+
+	return withPattern(args[:1], 1, in, func(p *drum.Pattern) error {
+		if path == "-" {
+			return p.ToMIDI(out, nil)
+		}
+
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		if err := p.ToMIDI(f, nil); err != nil {
+			f.Close()
+			os.Remove(path)
+			return err
+		}
+		return f.Close()
+	})
+}
+
+// play plays a pattern with a Sequencer, printing every hit or drawing the
+// pattern as it plays
+func play(args []string, in io.Reader, out io.Writer) error {
+
+	flags := flag.NewFlagSet("play", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	loops := flags.Int("loops", 1, "number of times to play the pattern")
+	tempo := flags.Float64("tempo", 0, "tempo to play at instead of the pattern's")
+	visual := flags.Bool("visual", false, "draw the pattern with a playhead instead of printing hits")
+
+	if err := flags.Parse(args); err != nil {
+		return fmt.Errorf("%v\n%w", err, errUsage)
+	}
+	if *loops < 1 {
+		return fmt.Errorf("cannot play %d loops", *loops)
+	}
+
+	return withPattern(flags.Args(), 1, in, func(p *drum.Pattern) error {
+		s := drum.NewSequencer(*p)
+		if *tempo != 0 {
+			if err := s.SetTempo(float32(*tempo)); err != nil {
+				return err
+			}
+		}
+
+		hit := func(e drum.StepEvent) error {
+			_, err := fmt.Fprintf(out, "%2d %s\n", e.StepIndex+1, e.Instrument.Name())
+			return err
+		}
+		if *visual {
+			display := tui.New(out, *p, true)
+			display.Attach(s)
+			hit = display.Hit
+			if err := display.Draw(); err != nil {
+				return err
+			}
+		} else {
+			fmt.Fprint(out, p)
+		}
+
+		return s.PlayLoops(context.Background(), *loops, hit)
+	})
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	drum "github.com/chrishiestand/golang-challenge-1-drum_machine"
+)
+
+// fixture copies a pattern from the library's fixtures into a temporary
+// directory so commands can rewrite it
+func fixture(t *testing.T, name string) string {
+
+	data, err := ioutil.ReadFile(filepath.Join("..", "..", "fixtures", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRun(t *testing.T) {
+
+	path := fixture(t, "pattern_2.splice")
+
+	var out bytes.Buffer
+	if err := run([]string{"show", path}, nil, &out); err != nil {
+		t.Fatalf("show: unexpected error %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "Saved with HW Version: 0.808-alpha\nTempo: 98.4\n") {
+		t.Errorf("show: unexpected output\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := run([]string{"json", path}, nil, &out); err != nil {
+		t.Fatalf("json: unexpected error %v", err)
+	}
+	var p drum.Pattern
+	if err := json.Unmarshal(out.Bytes(), &p); err != nil || p.Tempo() != 98.4 {
+		t.Errorf("json: unexpected output %v\n%s", err, out.String())
+	}
+
+	if err := run([]string{"set-tempo", "128", path}, nil, &out); err != nil {
+		t.Fatalf("set-tempo: unexpected error %v", err)
+	}
+	if decoded, err := drum.DecodeFile(path); err != nil || decoded.Tempo() != 128 {
+		t.Errorf("set-tempo: expected the file to be rewritten at 128, got %v", err)
+	}
+
+	// other formats are replaced atomically too, keeping the mode
+	textPath := filepath.Join(t.TempDir(), "pattern.txt")
+	if err := ioutil.WriteFile(textPath, []byte(p.String()), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := run([]string{"set-tempo", "-backup", "1", "110", textPath}, nil, &out); err != nil {
+		t.Fatalf("set-tempo text: unexpected error %v", err)
+	}
+	if text, err := ioutil.ReadFile(textPath); err != nil || !strings.Contains(string(text), "Tempo: 110\n") {
+		t.Errorf("set-tempo text: expected the file to be rewritten at 110, got %v\n%s", err, text)
+	}
+	if info, err := os.Stat(textPath); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("set-tempo text: expected the mode to be kept, got %v", err)
+	}
+	if backup, err := ioutil.ReadFile(drum.BackupPath(textPath, 1)); err != nil || !strings.Contains(string(backup), "Tempo: 98.4\n") {
+		t.Errorf("set-tempo text: expected a backup at 98.4, got %v\n%s", err, backup)
+	}
+
+	if err := run([]string{"to-midi", path}, nil, &out); err != nil {
+		t.Fatalf("to-midi: unexpected error %v", err)
+	}
+	midi, err := os.Open(strings.TrimSuffix(path, ".splice") + ".mid")
+	if err != nil {
+		t.Fatalf("to-midi: %v", err)
+	}
+	defer midi.Close()
+	if imported, err := drum.FromMIDI(midi, drum.ImportOptions{}); err != nil || imported.Tempo() != 128 {
+		t.Errorf("to-midi: expected a MIDI file at 128, got %v", err)
+	}
+
+	out.Reset()
+	if err := run([]string{"play", "-tempo", "6000", fixture(t, "pattern_5.splice")}, nil, &out); err != nil {
+		t.Fatalf("play: unexpected error %v", err)
+	}
+	if !strings.HasSuffix(out.String(), " 1 Kick\n 1 HiHat\n 3 HiHat\n 5 HiHat\n 7 HiHat\n 9 Kick\n 9 HiHat\n11 HiHat\n13 HiHat\n15 HiHat\n") {
+		t.Errorf("play: unexpected output\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := run([]string{"play", "-tempo", "6000", "-visual", fixture(t, "pattern_5.splice")}, nil, &out); err != nil {
+		t.Fatalf("play -visual: unexpected error %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "Tempo: 999\n") || !strings.Contains(out.String(), "\x1b[") {
+		t.Errorf("play -visual: unexpected output\n%q", out.String())
+	}
+
+	// patterns piped through stdin come out on stdout
+	data, err := ioutil.ReadFile(fixture(t, "pattern_2.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out.Reset()
+	if err := run([]string{"convert", "-to", "text"}, bytes.NewReader(data), &out); err != nil {
+		t.Fatalf("convert: unexpected error %v", err)
+	}
+	text := out.String()
+	if !strings.HasPrefix(text, "Saved with HW Version: 0.808-alpha\nTempo: 98.4\n") {
+		t.Errorf("convert: unexpected output\n%s", text)
+	}
+	out.Reset()
+	if err := run([]string{"set-tempo", "100", "-"}, strings.NewReader(text), &out); err != nil {
+		t.Fatalf("set-tempo -: unexpected error %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "Saved with HW Version: 0.808-alpha\nTempo: 100\n") {
+		t.Errorf("set-tempo -: expected text at 100, got\n%s", out.String())
+	}
+	piped := out.String()
+	out.Reset()
+	if err := run([]string{"convert", "--to", "splice", "-"}, strings.NewReader(piped), &out); err != nil {
+		t.Fatalf("convert -to splice: unexpected error %v", err)
+	}
+	if decoded, err := drum.Decode(&out); err != nil || decoded.Tempo() != 100 {
+		t.Errorf("convert -to splice: expected a pattern at 100, got %v", err)
+	}
+	out.Reset()
+	if err := run([]string{"to-midi", "-"}, strings.NewReader(piped), &out); err != nil || !bytes.HasPrefix(out.Bytes(), []byte("MThd")) {
+		t.Errorf("to-midi -: expected a MIDI file on stdout, got %v", err)
+	}
+
+	for _, args := range [][]string{nil, {"convert", "-to", "midi", path}, {"dance"}, {"show"}, {"set-tempo", "fast", path}, {"set-tempo", "-1", path}, {"play", "-loops", "0", path}, {"show", path + ".missing"}} {
+		if err := run(args, nil, &out); err == nil {
+			t.Errorf("%q: expected an error", args)
+		}
+	}
+}
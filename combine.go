@@ -0,0 +1,370 @@
+package drum
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// StepOp is a boolean operator used to combine the steps of two patterns.
+type StepOp int
+
+const (
+	// OpOr turns a step on when it is on in either pattern.
+	OpOr StepOp = iota
+	// OpAnd turns a step on only when it is on in both patterns.
+	OpAnd
+	// OpXor turns a step on when it is on in exactly one pattern.
+	OpXor
+)
+
+func (op StepOp) apply(a, b bool) bool {
+
+	switch op {
+	case OpAnd:
+		return a && b
+	case OpXor:
+		return a != b
+	default:
+		return a || b
+	}
+}
+
+// Combine applies op to the steps of every pair of instruments in a and b
+// that share an id. Instruments found in only one of the patterns are combined
+// against silence. The result takes its version and tempo from a, lists a's
+// instruments first and then any that only b has, in their original order.
+//
+// Instruments sharing an id must have the same number of steps.
+func Combine(a, b Pattern, op StepOp) (Pattern, error) {
+
+	if op < OpOr || op > OpXor {
+		return Pattern{}, fmt.Errorf("unknown step operator %d", op)
+	}
+
+	result := a.blank()
+
+	for _, inst := range a.instruments {
+		other := Instrument{}
+		if j := b.instrumentIndex(inst.num); j >= 0 {
+			other = b.instruments[j]
+			if other.stepCount() != inst.stepCount() {
+				return Pattern{}, fmt.Errorf("instrument %d has %d steps in one pattern and %d in the other",
+					inst.num, inst.stepCount(), other.stepCount())
+			}
+		}
+		result.instruments = append(result.instruments, combineInstrument(inst, inst.steps(), other.steps(), op))
+	}
+
+	for _, inst := range b.instruments {
+		if a.instrumentIndex(inst.num) < 0 {
+			result.instruments = append(result.instruments, combineInstrument(inst, nil, inst.steps(), op))
+		}
+	}
+	return result, nil
+}
+
+// combineInstrument returns a copy of inst whose steps are as and bs
+// combined with op. A missing step on either side counts as silence.
+func combineInstrument(inst Instrument, as, bs []byte, op StepOp) Instrument {
+
+	n := len(as)
+	if len(bs) > n {
+		n = len(bs)
+	}
+
+	steps := make([]byte, n)
+	for i := range steps {
+		steps[i] = StepOff
+		if op.apply(i < len(as) && isOn(as[i]), i < len(bs) && isOn(bs[i])) {
+			steps[i] = StepOn
+		}
+	}
+
+	inst.setSteps(steps)
+	return inst
+}
+
+// Distance returns the number of step positions at which a and b differ,
+// summed over the instruments they share by id. An instrument found in only
+// one of the patterns differs wherever it has a hit. Instruments sharing an
+// id must have the same number of steps.
+func Distance(a, b Pattern) (int, error) {
+
+	diff, err := Combine(a, b, OpXor)
+	if err != nil {
+		return 0, err
+	}
+
+	distance := 0
+	for _, inst := range diff.instruments {
+		distance += inst.hits()
+	}
+	return distance, nil
+}
+
+// NearDuplicates groups the indices of patterns that are within threshold
+// steps of each other by Distance. Grouping is transitive: when a is near b
+// and b is near c, all three share a group even if a and c are further apart
+// than threshold. Patterns Distance can't compare, because shared
+// instruments have different step counts, are never near each other. Only
+// groups of two or more patterns are returned; each lists its indices in
+// ascending order and groups are ordered by their first index.
+func NearDuplicates(ps []Pattern, threshold int) [][]int {
+
+	// group[i] is the index of the first pattern in i's group
+	group := make([]int, len(ps))
+	for i := range group {
+		group[i] = i
+	}
+
+	for a := range ps {
+		for b := a + 1; b < len(ps); b++ {
+			if group[a] == group[b] {
+				continue
+			}
+			if d, err := Distance(ps[a], ps[b]); err != nil || d > threshold {
+				continue
+			}
+
+			// merge the later group into the earlier one
+			from, to := group[a], group[b]
+			if from < to {
+				from, to = to, from
+			}
+			for i := range group {
+				if group[i] == from {
+					group[i] = to
+				}
+			}
+		}
+	}
+
+	var groups [][]int
+	index := make(map[int]int)
+
+	for i, first := range group {
+		n, ok := index[first]
+		if !ok {
+			n = len(groups)
+			index[first] = n
+			groups = append(groups, nil)
+		}
+		groups[n] = append(groups[n], i)
+	}
+
+	var duplicates [][]int
+	for _, g := range groups {
+		if len(g) > 1 {
+			duplicates = append(duplicates, g)
+		}
+	}
+	return duplicates
+}
+
+// Layer stacks the instruments of every pattern into one, in order. Each
+// instrument's name is prefixed with the index of the pattern it came from,
+// so the kick of the second pattern becomes "1:kick", and the instruments are
+// given the fresh ids 0, 1, 2... so none collide. The result takes its
+// version and tempo from the first pattern. The patterns' tempos must agree
+// to within float32 noise, and every instrument must have the same number of
+// steps.
+func Layer(patterns ...Pattern) (Pattern, error) {
+
+	if len(patterns) == 0 {
+		return Pattern{}, fmt.Errorf("no patterns to layer")
+	}
+
+	first := patterns[0]
+	result := first.blank()
+	steps := -1
+
+	for n, p := range patterns {
+		if math.Abs(float64(p.tempo-first.tempo)) > tempoEpsilon {
+			return Pattern{}, fmt.Errorf("pattern %d has tempo %v, pattern 0 has %v", n, p.tempo, first.tempo)
+		}
+
+		for _, inst := range p.instruments {
+			if steps < 0 {
+				steps = inst.stepCount()
+			}
+			if inst.stepCount() != steps {
+				return Pattern{}, fmt.Errorf("%w: instrument %d of pattern %d has %d steps, expected %d",
+					ErrInvalidStep, inst.num, n, inst.stepCount(), steps)
+			}
+
+			layered := Instrument{num: uint32(len(result.instruments)), name: fmt.Sprintf("%d:%s", n, inst.name)}
+			layered.setSteps(inst.steps())
+			result.instruments = append(result.instruments, layered)
+		}
+	}
+	return result, nil
+}
+
+// CommonCore returns the steps every pattern shares: for each instrument of
+// the first pattern whose id is found in all the others, a step is on only
+// when it is on in every pattern. Instruments missing from any pattern are
+// dropped. The result takes its version and tempo from the first pattern
+// and keeps its instrument order. Instruments sharing an id must have the
+// same number of steps.
+func CommonCore(ps ...Pattern) (Pattern, error) {
+
+	if len(ps) == 0 {
+		return Pattern{}, fmt.Errorf("no patterns to find the common core of")
+	}
+
+	result := ps[0].blank()
+
+instruments:
+	for _, inst := range ps[0].instruments {
+		core := inst.steps()
+
+		for n, p := range ps[1:] {
+			j := p.instrumentIndex(inst.num)
+			if j < 0 {
+				continue instruments
+			}
+
+			other := p.instruments[j]
+			if other.stepCount() != len(core) {
+				return Pattern{}, fmt.Errorf("instrument %d has %d steps in pattern 0 and %d in pattern %d",
+					inst.num, len(core), other.stepCount(), n+1)
+			}
+			core = combineInstrument(inst, core, other.steps(), OpAnd).steps()
+		}
+
+		inst.setSteps(core)
+		result.instruments = append(result.instruments, inst)
+	}
+	return result, nil
+}
+
+// MergeStrategy selects what Merge does with an instrument of the second
+// pattern whose name is already taken by the first
+type MergeStrategy int
+
+const (
+	// MergeUnion combines the two instruments into one, keeping the first
+	// pattern's id, with a step on when it is on in either.
+	MergeUnion MergeStrategy = iota
+	// MergeReplace keeps the first pattern's id for the instrument but
+	// takes its steps from the second pattern.
+	MergeReplace
+	// MergeRename keeps both instruments, numbering the second pattern's
+	// one to make its name unique, so a second "kick" becomes "kick 2".
+	MergeRename
+)
+
+// TempoPolicy selects the tempo Merge gives the merged pattern
+type TempoPolicy int
+
+const (
+	// TempoMustMatch fails the merge unless both tempos agree to within
+	// float32 noise, and then keeps the first pattern's.
+	TempoMustMatch TempoPolicy = iota
+	// TempoFirst keeps the first pattern's tempo.
+	TempoFirst
+	// TempoSecond takes the second pattern's tempo.
+	TempoSecond
+	// TempoAverage takes the mean of both tempos.
+	TempoAverage
+)
+
+// MergeOptions control how Merge combines two patterns
+type MergeOptions struct {
+	// Collisions is what happens to instruments with the same name.
+	Collisions MergeStrategy
+	// Tempo is how the two tempos are reconciled.
+	Tempo TempoPolicy
+}
+
+// Merge returns a pattern holding the instruments of a followed by those of
+// b, with a's version. Instruments are matched by name, ignoring case, and
+// an instrument of b whose name a already uses is merged as opts.Collisions
+// says; unions of instruments with different step counts are padded with
+// rests. The instruments of b keep their ids unless the merged pattern
+// already uses them, in which case they're given the lowest ids above every
+// id in use, failing if that would pass math.MaxUint32. Neither pattern is
+// changed.
+func Merge(a, b Pattern, opts MergeOptions) (Pattern, error) {
+
+	if opts.Collisions < MergeUnion || opts.Collisions > MergeRename {
+		return Pattern{}, fmt.Errorf("unknown merge strategy %d", opts.Collisions)
+	}
+
+	result := a.blank()
+
+	switch opts.Tempo {
+	case TempoMustMatch:
+		if math.Abs(float64(a.tempo-b.tempo)) > tempoEpsilon {
+			return Pattern{}, fmt.Errorf("cannot merge patterns at %v and %v BPM", a.tempo, b.tempo)
+		}
+	case TempoFirst:
+	case TempoSecond:
+		result.tempo = b.tempo
+	case TempoAverage:
+		result.tempo = (a.tempo + b.tempo) / 2
+	default:
+		return Pattern{}, fmt.Errorf("unknown tempo policy %d", opts.Tempo)
+	}
+
+	used := make(map[uint32]bool)
+	var next uint64
+
+	claim := func(id uint32) {
+		used[id] = true
+		if uint64(id) >= next {
+			next = uint64(id) + 1
+		}
+	}
+
+	for _, inst := range a.instruments {
+		inst.setSteps(inst.steps())
+		result.instruments = append(result.instruments, inst)
+		claim(inst.num)
+	}
+
+	for _, inst := range b.instruments {
+		i := result.nameIndex(inst.name)
+
+		if i >= 0 && opts.Collisions != MergeRename {
+			merged := result.instruments[i]
+			if opts.Collisions == MergeUnion {
+				merged = combineInstrument(merged, merged.steps(), inst.steps(), OpOr)
+			} else {
+				merged.setSteps(inst.steps())
+			}
+			result.instruments[i] = merged
+			continue
+		}
+
+		if i >= 0 {
+			base := inst.name
+			for n := 2; result.nameIndex(inst.name) >= 0; n++ {
+				inst.name = fmt.Sprintf("%s %d", base, n)
+			}
+		}
+		if used[inst.num] {
+			if next > math.MaxUint32 {
+				return Pattern{}, fmt.Errorf("no id above %d is left for instrument %q", uint32(math.MaxUint32), inst.name)
+			}
+			inst.num = uint32(next)
+		}
+		inst.setSteps(inst.steps())
+		result.instruments = append(result.instruments, inst)
+		claim(inst.num)
+	}
+	return result, nil
+}
+
+// nameIndex returns the index of the first instrument with the given name,
+// ignoring case, or -1 if the pattern has no such instrument.
+func (p Pattern) nameIndex(name string) int {
+
+	for i, inst := range p.instruments {
+		if strings.EqualFold(inst.name, name) {
+			return i
+		}
+	}
+	return -1
+}
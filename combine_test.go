@@ -0,0 +1,296 @@
+package drum
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestCombine(t *testing.T) {
+
+	a := Pattern{version: "0.808-alpha", tempo: 120, instruments: []Instrument{
+		{num: 0, name: "kick", measure: []Step{{1, 1, 0, 0}}},
+		{num: 1, name: "snare", measure: []Step{{0, 0, 1, 0}}},
+	}}
+	b := Pattern{version: "0.909", tempo: 98, instruments: []Instrument{
+		{num: 0, name: "kick", measure: []Step{{1, 0, 1, 0}}},
+		{num: 2, name: "clap", measure: []Step{{0, 1, 0, 1}}},
+	}}
+
+	tData := []struct {
+		op    StepOp
+		kick  string
+		snare string
+		clap  string
+	}{
+		{OpOr, "\x01\x01\x01\x00", "\x00\x00\x01\x00", "\x00\x01\x00\x01"},
+		{OpAnd, "\x01\x00\x00\x00", "\x00\x00\x00\x00", "\x00\x00\x00\x00"},
+		{OpXor, "\x00\x01\x01\x00", "\x00\x00\x01\x00", "\x00\x01\x00\x01"},
+	}
+
+	for _, exp := range tData {
+
+		c, err := Combine(a, b, exp.op)
+		if err != nil {
+			t.Fatalf("op %d: unexpected error %v", exp.op, err)
+		}
+		if c.version != a.version || c.tempo != a.tempo {
+			t.Errorf("op %d: expected version and tempo from a, got %q %v", exp.op, c.version, c.tempo)
+		}
+		if len(c.instruments) != 3 {
+			t.Fatalf("op %d: expected 3 instruments, got %d", exp.op, len(c.instruments))
+		}
+
+		for i, want := range []string{exp.kick, exp.snare, exp.clap} {
+			if got := string(c.instruments[i].steps()); got != want {
+				t.Errorf("op %d: %s got %v, expected %v", exp.op, c.instruments[i].name, []byte(got), []byte(want))
+			}
+		}
+	}
+
+	if string(a.instruments[0].steps()) != "\x01\x01\x00\x00" {
+		t.Errorf("Combine modified its input")
+	}
+}
+
+func TestCombineShapeMismatch(t *testing.T) {
+
+	a := Pattern{instruments: []Instrument{{num: 0, measure: []Step{{1, 0, 0, 0}}}}}
+	b := Pattern{instruments: []Instrument{{num: 0, measure: []Step{{1, 0, 0, 0}, {1, 0, 0, 0}}}}}
+
+	if _, err := Combine(a, b, OpOr); err == nil {
+		t.Fatalf("expected an error combining instruments of different lengths")
+	}
+}
+
+func TestDistance(t *testing.T) {
+
+	a := Pattern{instruments: []Instrument{
+		{num: 0, name: "kick", measure: []Step{{1, 0, 1, 0}, {1, 0, 1, 0}}},
+		{num: 1, name: "snare", measure: []Step{{0, 0, 1, 0}, {0, 0, 1, 1}}},
+	}}
+	inverse := Pattern{instruments: []Instrument{
+		{num: 0, name: "kick", measure: []Step{{0, 1, 0, 1}, {0, 1, 0, 1}}},
+		{num: 1, name: "snare", measure: []Step{{1, 1, 0, 1}, {1, 1, 0, 0}}},
+	}}
+	other := Pattern{instruments: []Instrument{
+		{num: 0, name: "kick", measure: []Step{{1, 0, 1, 0}, {1, 0, 0, 0}}},
+		{num: 2, name: "clap", measure: []Step{{0, 1, 0, 0}, {0, 1, 0, 0}}},
+	}}
+
+	tData := []struct {
+		name     string
+		a, b     Pattern
+		expected int
+	}{
+		{"identical", a, a, 0},
+		{"every step flipped", a, inverse, 16},
+		{"partly shared", a, other, 1 + 3 + 2},
+	}
+
+	for _, exp := range tData {
+		got, err := Distance(exp.a, exp.b)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", exp.name, err)
+		}
+		if got != exp.expected {
+			t.Errorf("%s: got distance %d, expected %d", exp.name, got, exp.expected)
+		}
+	}
+
+	short := Pattern{instruments: []Instrument{{num: 0, name: "kick", measure: []Step{{1, 0, 1, 0}}}}}
+	if _, err := Distance(a, short); err == nil {
+		t.Errorf("expected an error comparing instruments of different lengths")
+	}
+}
+
+func TestNearDuplicates(t *testing.T) {
+
+	kick := func(steps ...byte) Pattern {
+		return Pattern{instruments: []Instrument{{num: 0, name: "kick", measure: []Step{steps}}}}
+	}
+
+	ps := []Pattern{
+		kick(1, 0, 0, 0),
+		kick(0, 1, 1, 1),
+		kick(1, 0, 1, 0),
+		kick(1, 1, 1, 0),
+		kick(1, 0, 0, 0, 0, 0),
+		kick(0, 1, 1, 1),
+		kick(1, 0, 0, 0, 0, 0),
+	}
+
+	tData := []struct {
+		threshold int
+		expected  [][]int
+	}{
+		{0, [][]int{{1, 5}, {4, 6}}},
+		{1, [][]int{{0, 2, 3}, {1, 5}, {4, 6}}},
+		{4, [][]int{{0, 1, 2, 3, 5}, {4, 6}}},
+	}
+
+	for _, exp := range tData {
+		if got := NearDuplicates(ps, exp.threshold); !reflect.DeepEqual(got, exp.expected) {
+			t.Errorf("threshold %d: got %v, expected %v", exp.threshold, got, exp.expected)
+		}
+	}
+}
+
+func TestLayer(t *testing.T) {
+
+	a := Pattern{version: "0.808-alpha", tempo: 120, instruments: []Instrument{
+		{num: 0, name: "kick", measure: []Step{{1, 0, 0, 0}}},
+		{num: 1, name: "snare", measure: []Step{{0, 0, 1, 0}}},
+	}}
+	b := Pattern{version: "0.909", tempo: 119.9999, instruments: []Instrument{
+		{num: 0, name: "kick", measure: []Step{{1, 0, 1, 0}}},
+	}}
+
+	layered, err := Layer(a, b)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	expected := "Saved with HW Version: 0.808-alpha\nTempo: 120\n" +
+		"(0) 0:kick\t|x---|\n" +
+		"(1) 0:snare\t|--x-|\n" +
+		"(2) 1:kick\t|x-x-|\n"
+	if layered.String() != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", layered, expected)
+	}
+
+	b.tempo = 98
+	if _, err := Layer(a, b); err == nil {
+		t.Errorf("expected an error layering patterns with different tempos")
+	}
+
+	b.tempo = 120
+	b.instruments[0].measure = []Step{{1, 0, 1, 0}, {1}}
+	if _, err := Layer(a, b); !errors.Is(err, ErrInvalidStep) {
+		t.Errorf("expected %v layering instruments of different lengths, got %v", ErrInvalidStep, err)
+	}
+
+	if _, err := Layer(); err == nil {
+		t.Errorf("expected an error layering nothing")
+	}
+}
+
+func TestCommonCore(t *testing.T) {
+
+	a := Pattern{version: "0.808-alpha", tempo: 120, instruments: []Instrument{
+		{num: 0, name: "kick", measure: []Step{{1, 0, 1, 0}, {1, 0, 1, 1}}},
+		{num: 1, name: "snare", measure: []Step{{0, 0, 1, 0}, {0, 0, 1, 0}}},
+		{num: 2, name: "clap", measure: []Step{{0, 0, 1, 0}, {0, 0, 1, 0}}},
+	}}
+	b := Pattern{version: "0.909", tempo: 98, instruments: []Instrument{
+		{num: 1, name: "snare", measure: []Step{{0, 1, 1, 0}, {0, 0, 1, 1}}},
+		{num: 0, name: "kick", measure: []Step{{1, 0, 0, 0}, {1, 1, 1, 1}}},
+		{num: 2, name: "clap", measure: []Step{{0, 0, 1, 0}, {0, 0, 1, 0}}},
+	}}
+	c := Pattern{instruments: []Instrument{
+		{num: 0, name: "kick", measure: []Step{{1, 1, 1, 1}, {1, 0, 1, 0}}},
+		{num: 1, name: "snare", measure: []Step{{1, 1, 1, 1}, {0, 0, 0, 0}}},
+	}}
+
+	core, err := CommonCore(a, b, c)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	expected := "Saved with HW Version: 0.808-alpha\nTempo: 120\n" +
+		"(0) kick\t|x---|x-x-|\n" +
+		"(1) snare\t|--x-|----|\n"
+	if core.String() != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", core, expected)
+	}
+
+	c.instruments[1].measure = []Step{{1, 1, 1, 1}}
+	if _, err := CommonCore(a, b, c); err == nil {
+		t.Errorf("expected an error for instruments of different lengths")
+	}
+}
+
+func TestMerge(t *testing.T) {
+
+	a := Pattern{version: "a", tempo: 120, instruments: []Instrument{
+		{num: 0, name: "kick", measure: []Step{{1, 0, 0, 0}, {0, 0, 0, 0}, {1, 0, 0, 0}, {0, 0, 0, 0}}},
+		{num: 1, name: "snare", measure: []Step{{0, 0, 0, 0}, {1, 0, 0, 0}, {0, 0, 0, 0}, {1, 0, 0, 0}}},
+	}}
+	b := Pattern{version: "b", tempo: 120.00001, instruments: []Instrument{
+		{num: 0, name: "Kick", measure: []Step{{0, 0, 1, 0}, {0, 0, 0, 0}, {0, 0, 1, 0}, {0, 0, 0, 0}}},
+		{num: 3, name: "hat", measure: []Step{{1, 1, 1, 1}, {1, 1, 1, 1}, {1, 1, 1, 1}, {1, 1, 1, 1}}},
+		{num: 1, name: "clap", measure: []Step{{0, 0, 0, 0}, {1, 0, 0, 0}, {0, 0, 0, 0}, {0, 0, 0, 0}}},
+	}}
+
+	tData := []struct {
+		strategy MergeStrategy
+		expected string
+	}{
+		{MergeUnion, "(0) kick\t|x-x-|----|x-x-|----|\n(1) snare\t|----|x---|----|x---|\n(3) hat\t|xxxx|xxxx|xxxx|xxxx|\n(4) clap\t|----|x---|----|----|\n"},
+		{MergeReplace, "(0) kick\t|--x-|----|--x-|----|\n(1) snare\t|----|x---|----|x---|\n(3) hat\t|xxxx|xxxx|xxxx|xxxx|\n(4) clap\t|----|x---|----|----|\n"},
+		{MergeRename, "(0) kick\t|x---|----|x---|----|\n(1) snare\t|----|x---|----|x---|\n(2) Kick 2\t|--x-|----|--x-|----|\n(3) hat\t|xxxx|xxxx|xxxx|xxxx|\n(4) clap\t|----|x---|----|----|\n"},
+	}
+
+	for _, exp := range tData {
+		merged, err := Merge(a, b, MergeOptions{Collisions: exp.strategy})
+		if err != nil {
+			t.Fatalf("strategy %d: unexpected error %v", exp.strategy, err)
+		}
+		if expected := "Saved with HW Version: a\nTempo: 120\n" + exp.expected; merged.String() != expected {
+			t.Errorf("strategy %d: got\n%s\nexpected\n%s", exp.strategy, merged, expected)
+		}
+	}
+
+	if got := gridString(a.instruments[0].steps()); got != "x-------x-------" {
+		t.Errorf("Merge changed the first pattern's kick to %s", got)
+	}
+
+	b.tempo = 100
+	if _, err := Merge(a, b, MergeOptions{}); err == nil {
+		t.Errorf("expected an error merging different tempos")
+	}
+	for policy, tempo := range map[TempoPolicy]float32{TempoFirst: 120, TempoSecond: 100, TempoAverage: 110} {
+		if merged, err := Merge(a, b, MergeOptions{Tempo: policy}); err != nil || merged.tempo != tempo {
+			t.Errorf("policy %d: expected %v, got %v, %v", policy, tempo, merged.tempo, err)
+		}
+	}
+	if _, err := Merge(a, b, MergeOptions{Tempo: TempoFirst, Collisions: 7}); err == nil {
+		t.Errorf("expected an error for an unknown strategy")
+	}
+
+	// no id is left above the highest one
+	top := Pattern{version: "0.808-alpha", tempo: 120, instruments: []Instrument{
+		{num: math.MaxUint32, name: "kick", measure: []Step{{1, 0, 0, 0}}},
+		{num: 0, name: "snare", measure: []Step{{0, 0, 1, 0}}},
+	}}
+	other := Pattern{version: "0.808-alpha", tempo: 120, instruments: []Instrument{
+		{num: 0, name: "clap", measure: []Step{{0, 1, 0, 1}}},
+	}}
+	if _, err := Merge(top, other, MergeOptions{}); err == nil {
+		t.Errorf("expected an error when the ids run out")
+	}
+}
+
+func TestDerivedPatternsKeepFormat(t *testing.T) {
+
+	p := Pattern{version: "0.909", tempo: 120, header: []byte("SPLICE\x00\x00\x00\x00\x00\x00\x00"), lengthSize: 2,
+		layout: LayoutColumnMajor, resolution: 8, byteOrder: binary.BigEndian, versionSize: 40,
+		instruments: []Instrument{{num: 0, name: "kick", measure: []Step{{1, 0, 1, 0}}}}}
+
+	combined, _ := Combine(p, p, OpOr)
+	layered, _ := Layer(p, p)
+	core, _ := CommonCore(p, p)
+	merged, _ := Merge(p, p, MergeOptions{})
+	repeated, _ := p.Repeat(2)
+	call, response := p.CallResponse()
+
+	derived := map[string]Pattern{"Combine": combined, "Layer": layered, "CommonCore": core, "Merge": merged,
+		"Repeat": repeated, "Thin": p.Thin(2), "call": call, "response": response}
+	for name, d := range derived {
+		if !reflect.DeepEqual(d.blank(), p.blank()) {
+			t.Errorf("%s: expected the format of %+v, got %+v", name, p.blank(), d.blank())
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package drum
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// WriteCSV writes the pattern's instruments as CSV, one row per instrument.
+// Each row holds the instrument id, its name and then a 1 or 0 for every
+// step. A header row labels the columns "id", "name" and the step numbers
+// 1 to N. Instruments with fewer steps than the longest one leave their
+// trailing cells empty.
+func (p Pattern) WriteCSV(w io.Writer) error {
+
+	n := 0
+	for _, inst := range p.instruments {
+		if inst.stepCount() > n {
+			n = inst.stepCount()
+		}
+	}
+
+	cw := csv.NewWriter(w)
+
+	header := []string{"id", "name"}
+	for i := 1; i <= n; i++ {
+		header = append(header, strconv.Itoa(i))
+	}
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+
+	for _, inst := range p.instruments {
+		row := make([]string, n+2)
+		row[0] = strconv.FormatUint(uint64(inst.num), 10)
+		row[1] = inst.name
+
+		for i, step := range inst.steps() {
+			if isOn(step) {
+				row[i+2] = "1"
+			} else {
+				row[i+2] = "0"
+			}
+		}
+
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// ReadCSV reads instruments in the format written by WriteCSV. CSV carries
+// no version or tempo, so those are left empty on the returned pattern.
+func ReadCSV(r io.Reader) (Pattern, error) {
+
+	var p Pattern
+
+	cr := csv.NewReader(r)
+
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return p, err
+	}
+	if len(rows) == 0 {
+		return p, fmt.Errorf("csv has no header row")
+	}
+
+	for line, row := range rows[1:] {
+		var inst Instrument
+
+		if len(row) < 2 {
+			return p, fmt.Errorf("csv row %d: expected an id and a name", line+2)
+		}
+
+		num, err := strconv.ParseUint(row[0], 10, 32)
+		if err != nil {
+			return p, fmt.Errorf("csv row %d: invalid id %q", line+2, row[0])
+		}
+		inst.num = uint32(num)
+		inst.name = row[1]
+
+		steps := make([]byte, 0, len(row)-2)
+		for col, cell := range row[2:] {
+			switch cell {
+			case "1":
+				steps = append(steps, StepOn)
+			case "0":
+				steps = append(steps, StepOff)
+			case "":
+				continue
+			default:
+				return p, fmt.Errorf("csv row %d, column %d: invalid step %q", line+2, col+3, cell)
+			}
+		}
+
+		inst.setSteps(steps)
+		p.instruments = append(p.instruments, inst)
+	}
+	return p, nil
+}
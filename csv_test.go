@@ -0,0 +1,46 @@
+package drum
+
+import (
+	"bytes"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestWriteCSV(t *testing.T) {
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_5.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_5.splice - %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := decoded.WriteCSV(&buf); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	expected := `id,name,1,2,3,4,5,6,7,8,9,10,11,12,13,14,15,16
+1,Kick,1,0,0,0,0,0,0,0,1,0,0,0,0,0,0,0
+2,HiHat,1,0,1,0,1,0,1,0,1,0,1,0,1,0,1,0
+`
+	if buf.String() != expected {
+		t.Fatalf("unexpected csv output:\n%s\nExpected:\n%s", buf.String(), expected)
+	}
+
+	read, err := ReadCSV(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error reading csv back %v", err)
+	}
+
+	read.version, read.tempo = decoded.version, decoded.tempo
+	if read.String() != decoded.String() {
+		t.Errorf("csv round trip changed the pattern:\n%s\nExpected:\n%s", read, decoded)
+	}
+}
+
+func TestReadCSVInvalidStep(t *testing.T) {
+
+	if _, err := ReadCSV(strings.NewReader("id,name,1\n0,kick,x\n")); err == nil {
+		t.Fatalf("expected an error for an invalid step cell")
+	}
+}
@@ -1,12 +1,17 @@
 package drum
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 // Pattern is the high level representation of the
@@ -15,152 +20,572 @@ type Pattern struct {
 	instruments []Instrument
 	version     string
 	tempo       float32
+	tempoBin    []byte
+	tempoFormat TempoFormat
+	header      []byte
+	lengthSize  int
+	packing     StepPacking
+	layout      Layout
+	resolution  int
+	byteOrder   binary.ByteOrder
+	versionSize int
+	chunks      []Chunk
+	meta        *PatternMeta
+	onChange    func(Change)
 }
 
 // Instrument is the high level representation of the
 // instrument section of a drum machine pattern
 type Instrument struct {
-	measure []Step
-	num     uint32
-	name    string
+	measure    []Step
+	num        uint32
+	name       string
+	raw        []byte
+	expression []Expression
+	// muted, solo and gain are how the instrument is played back, with
+	// hasGain set if gain is set
+	muted, solo bool
+	hasGain     bool
+	gain        float32
 }
 
 // Step is the representation of a step within a musical measure
 // in the drum machine pattern
 type Step []byte
 
+// The byte values a single step takes in a measure. StepOn is a plain hit at
+// DefaultVelocity; any other non-zero byte is a hit played at that velocity,
+// as StepValue reports.
+const (
+	StepOff byte = 0x00
+	StepOn  byte = 0x01
+)
+
+// headerSize is the number of bytes in the header that precedes the
+// payload length
+const headerSize = 13
+
+// scratchPool holds the buffers DecodeFile reads each file into, so that
+// decoding many files doesn't allocate a fresh buffer for every one. A buffer
+// is large enough for the header, the widest length field and the biggest
+// payload a single length byte can declare; bigger payloads get their own
+// buffer.
+var scratchPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, headerSize+8+255)
+		return &b
+	},
+}
+
+// readerPool holds the buffered readers DecodeFile wraps each file in. The
+// buffer is big enough to take a whole file in one read, so the header,
+// length byte and payload cost a single syscall between them.
+var readerPool = sync.Pool{
+	New: func() interface{} {
+		return bufio.NewReaderSize(nil, 512)
+	},
+}
+
+// Decode decodes a single drum machine pattern from r, reading exactly the
+// header, payload length and the payload it declares, so another pattern
+// following it in r can be decoded next. DecodeFile is Decode over a file.
+func Decode(r io.Reader) (Pattern, error) {
+
+	return decode(context.Background(), r, DecodeOptions{}, nil)
+}
+
+// DecodeAll decodes every pattern in a stream of .splice payloads written
+// back to back, such as one produced by EncodeAll. It stops at the first
+// pattern that fails to decode, returning those decoded before it.
+func DecodeAll(r io.Reader) ([]Pattern, error) {
+
+	var patterns []Pattern
+
+	br := bufio.NewReader(r)
+
+	for {
+		if _, err := br.Peek(1); err == io.EOF {
+			return patterns, nil
+		}
+
+		p, err := Decode(br)
+		if err != nil {
+			return patterns, fmt.Errorf("decoding pattern %d: %w", len(patterns), err)
+		}
+		patterns = append(patterns, p)
+	}
+}
+
 // DecodeFile decodes the drum machine file found at the provided path
-// and returns a pointer to a parsed pattern which is the entry point to the
-// rest of the data.
+// as Decode does and returns a pointer to a parsed pattern which is the entry
+// point to the rest of the data.
+//
+// The file is read into a pooled scratch buffer. Everything the returned
+// pattern holds is copied out of that buffer before it returns to the pool,
+// so the pattern stays valid however many files are decoded afterwards.
 func DecodeFile(path string) (*Pattern, error) {
 
+	p, err := DecodeFileContext(context.Background(), path)
+	return &p, err
+}
+
+// DecodeFileContext decodes the drum machine file found at the provided path
+// like DecodeFile, but checks ctx between reading each section of the file and
+// returns the context's error as soon as it is done.
+func DecodeFileContext(ctx context.Context, path string) (Pattern, error) {
+
 	var p Pattern
 
+	if err := ctx.Err(); err != nil {
+		return p, err
+	}
+
 	f, err := os.Open(path)
 	if err != nil {
-		return &p, err
+		return p, err
+	}
+	defer f.Close()
+
+	r := readerPool.Get().(*bufio.Reader)
+	r.Reset(f)
+	defer func() {
+		r.Reset(nil)
+		readerPool.Put(r)
+	}()
+
+	return decode(ctx, r, DecodeOptions{}, nil)
+}
+
+// decode reads a single pattern from r, consuming exactly the header,
+// length byte and the payload it declares. In strict mode it then reads on
+// to make sure nothing follows. Given warnings, a lenient decode recovers
+// from a payload that ends early and appends a Warning for what it skipped
+// instead of failing.
+func decode(ctx context.Context, r io.Reader, opts DecodeOptions, warnings *[]Warning) (Pattern, error) {
+
+	lenient := warnings != nil && !opts.Strict
+	if opts.Strict {
+		r = peekable(r)
+	}
+
+	var p Pattern
+
+	scratch := scratchPool.Get().(*[]byte)
+	defer scratchPool.Put(scratch)
+
+	headerBin := (*scratch)[:headerSize]
+	if _, err := io.ReadFull(r, headerBin); err != nil {
+		return p, readError(0, "header", err)
+	}
+
+	if _, err := parseHeader(headerBin); err != nil {
+		return p, err
+	}
+	p.header = append([]byte(nil), headerBin...)
+
+	lengthSize, err := opts.lengthFieldSize()
+	if err != nil {
+		return p, err
+	}
+	p.lengthSize = lengthSize
+
+	steps, err := opts.stepsPerInstrument()
+	if err != nil {
+		return p, err
 	}
+	if _, err := opts.StepPacking.stepsSize(steps); err != nil {
+		return p, err
+	}
+	p.packing = opts.StepPacking
+
+	if opts.StepsPerBeat < 0 {
+		return p, fmt.Errorf("%w: steps can't be played %d to a beat", ErrInvalidStep, opts.StepsPerBeat)
+	}
+	p.resolution = opts.StepsPerBeat
 
-	headerBin := make([]byte, 13)
-	if _, err = f.Read(headerBin); err != nil {
-		return &p, err
+	if err := opts.checkLayout(); err != nil {
+		return p, err
 	}
+	p.layout = opts.Layout
 
-	if _, err = parseHeader(headerBin); err != nil {
-		return &p, err
+	if _, err := opts.versionSize(); err != nil {
+		return p, err
 	}
 
-	numBytesSlice := make([]byte, 1)
+	numBytesSlice := (*scratch)[headerSize : headerSize+lengthSize]
 
-	if _, err = f.Read(numBytesSlice); err != nil {
-		return &p, err
+	if _, err := io.ReadFull(r, numBytesSlice); err != nil {
+		return p, readError(headerSize, "payload length", err)
 	}
 
-	numBytesRemaining := uint64(numBytesSlice[0])
+	numBytesRemaining := payloadLength(headerBin, numBytesSlice, opts.byteOrder())
 
-	remainingBytes := make([]byte, numBytesRemaining)
+	if numBytesRemaining > uint64(opts.maxPayload()) {
+		return p, decodeError(headerSize, "payload length", fmt.Errorf("%w: declared payload of %d bytes is over the %d byte limit",
+			ErrPayloadTooLarge, numBytesRemaining, opts.maxPayload()))
+	}
 
-	if _, err := io.ReadFull(f, remainingBytes); err != nil {
-		return &p, err
+	var remainingBytes []byte
+	if start := headerSize + 8; uint64(len(*scratch)-start) >= numBytesRemaining {
+		remainingBytes = (*scratch)[start : start+int(numBytesRemaining)]
+	} else {
+		remainingBytes = make([]byte, numBytesRemaining)
 	}
 
-	versionBin, remainingBytes := remainingBytes[0:32], remainingBytes[32:]
+	if err := ctx.Err(); err != nil {
+		return p, err
+	}
+
+	if n, err := io.ReadFull(r, remainingBytes); err == io.ErrUnexpectedEOF && lenient {
+		*warnings = append(*warnings, Warning{WarningPayloadShort,
+			fmt.Sprintf("payload declares %d bytes but only %d follow", len(remainingBytes), n)})
+		remainingBytes = remainingBytes[:n]
+	} else if err != nil {
+		return p, readError(headerSize+lengthSize, "payload", err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return p, err
+	}
+
+	opts = opts.withKnownVersions()
+	if len(opts.Dialects) > 0 {
+		opts = opts.withDialect(remainingBytes)
+	}
+	versionSize, err := opts.versionSize()
+	if err != nil {
+		return p, err
+	}
+	p.byteOrder = opts.ByteOrder
+	p.versionSize = opts.VersionSize
+
+	if len(remainingBytes) < versionSize {
+		return p, decodeError(headerSize+lengthSize, "version",
+			fmt.Errorf("%w: payload is only %d bytes", ErrTruncated, len(remainingBytes)))
+	}
+
+	versionBin, remainingBytes := remainingBytes[0:versionSize], remainingBytes[versionSize:]
 
 	p.version = string(bytes.Trim(versionBin, "\x00"))
+	if err := opts.checkVersion(p.version); err != nil {
+		return p, decodeError(headerSize+lengthSize, "version", err)
+	}
 
-	tempoBin, remainingBytes := remainingBytes[0:4], remainingBytes[4:]
-	buf := bytes.NewReader(tempoBin)
-	binary.Read(buf, binary.LittleEndian, &p.tempo)
+	tempo, tempoSize, err := opts.TempoFormat.decode(remainingBytes, opts.byteOrder())
+	if err != nil {
+		return p, decodeError(headerSize+lengthSize+versionSize, "tempo", err)
+	}
+	p.tempo = tempo
+	p.tempoFormat = opts.TempoFormat
+	p.tempoBin = append([]byte(nil), remainingBytes[:tempoSize]...)
+	remainingBytes = remainingBytes[tempoSize:]
+
+	if err := ctx.Err(); err != nil {
+		return p, err
+	}
+
+	// the instruments' steps alias the bytes they're read from, so give them
+	// their own copy rather than the pooled buffer
+	offset := headerSize + lengthSize + versionSize + tempoSize
+	instruments, err := readInstruments(append([]byte(nil), remainingBytes...), offset, opts)
+	partial := errors.Is(err, ErrTruncated) || errors.Is(err, ErrInvalidNameLength)
+	if partial && lenient && opts.Layout == LayoutRowMajor {
+		*warnings = append(*warnings, Warning{WarningPartialInstrument,
+			fmt.Sprintf("skipped a partial instrument after %d complete instruments: %v", len(instruments), err)})
+	} else if err != nil {
+		return p, err
+	}
+	for _, inst := range instruments {
+		if err := opts.checkInstrument(p.version, inst); err != nil {
+			return p, decodeError(offset, "instrument", err)
+		}
+	}
+	p.instruments = instruments
 
-	p.instruments = readInstruments(remainingBytes)
+	if err := readExtension(r, &p, offset+len(remainingBytes), opts); err != nil {
+		return p, err
+	}
 
-	if err := f.Close(); err != nil {
-		return &p, err
+	if opts.Strict {
+		var next [1]byte
+		if n, _ := io.ReadFull(r, next[:]); n > 0 {
+			return p, decodeError(offset+len(remainingBytes), "payload", ErrTrailingData)
+		}
 	}
-	return &p, nil
+	return p, nil
+}
+
+// HeaderBytes returns a copy of the 13 header bytes the pattern was decoded
+// from, including any format-specific bytes following the SPLICE magic.
+// Encoding the pattern writes these bytes back verbatim, but for the last
+// two, which with a one byte length field hold the higher bytes of the
+// payload length.
+func (p Pattern) HeaderBytes() []byte {
+
+	return append([]byte(nil), p.header...)
 }
 
 // String converts a drum machine pattern into a string
 func (p Pattern) String() string {
 
-	version := fmt.Sprintf("Saved with HW Version: %v\n", p.version)
-	tempo := fmt.Sprintf("Tempo: %v\n", p.tempo)
+	var b strings.Builder
+	b.Grow(p.renderedSize())
+	p.render(&b)
+	return b.String()
+}
 
-	instruments := ""
+// renderWriter is what render writes the text form of a pattern to
+type renderWriter interface {
+	io.ByteWriter
+	io.StringWriter
+	WriteRune(r rune) (int, error)
+}
+
+// render writes the text form of the pattern returned by String to w
+func (p Pattern) render(w renderWriter) {
+
+	w.WriteString(versionPrefix)
+	w.WriteString(p.version)
+	w.WriteByte('\n')
+	w.WriteString(tempoPrefix)
+	w.WriteString(formatTempo(p.tempo))
+	w.WriteByte('\n')
 
 	for _, instrument := range p.instruments {
-		line := fmt.Sprintf("(%d) %s\t|", instrument.num, instrument.name)
+		instrument.renderLine(w, 'x', '-')
+		w.WriteByte('\n')
+	}
+}
 
-		for _, measure := range instrument.measure {
+// renderLine writes the instrument's line of the text form to w, without a
+// trailing newline, drawing hits with on and rests with off
+func (i Instrument) renderLine(w renderWriter, on, off rune) {
 
-			for _, beat := range measure {
-				if beat == 0x01 {
-					line += "x"
-				} else {
-					line += "-"
-				}
-			}
+	w.WriteByte('(')
+	w.WriteString(strconv.FormatUint(uint64(i.num), 10))
+	w.WriteString(") ")
+	w.WriteString(i.name)
+	w.WriteString("\t|")
 
-			line += "|"
+	for _, measure := range i.measure {
+
+		for _, beat := range measure {
+			if isOn(beat) {
+				w.WriteRune(on)
+			} else {
+				w.WriteRune(off)
+			}
 		}
-		line += "\n"
-		instruments += line
+
+		w.WriteByte('|')
 	}
+}
+
+// renderedSize returns the exact length of the text render writes, so the
+// output can be allocated once up front.
+func (p Pattern) renderedSize() int {
 
-	return version + tempo + instruments
+	size := len(versionPrefix+"\n"+tempoPrefix+"\n") + len(p.version) + len(formatTempo(p.tempo))
+
+	for _, instrument := range p.instruments {
+		size += len("() \t|\n") + len(strconv.FormatUint(uint64(instrument.num), 10)) + len(instrument.name)
+		size += instrument.stepCount() + len(instrument.measure)
+	}
+	return size
 }
 
-func readInstruments(instrumentBytes []byte) []Instrument {
+// formatTempo formats the tempo the way %v does
+func formatTempo(tempo float32) string {
+
+	return strconv.FormatFloat(float64(tempo), 'g', -1, 32)
+}
+
+// readInstruments reads every instrument in instrumentBytes, which start at
+// byte offset of the file
+func readInstruments(instrumentBytes []byte, offset int, opts DecodeOptions) ([]Instrument, error) {
+
+	if opts.Layout == LayoutColumnMajor {
+		return readColumns(instrumentBytes, offset, opts)
+	}
 
 	instruments := make([]Instrument, 0)
+	seen := make(map[uint32]bool)
 
 	for len(instrumentBytes) > 0 {
 
+		if len(instruments) >= opts.maxInstruments() {
+			return instruments, decodeError(offset, "instrument",
+				fmt.Errorf("%w: pattern has more than %d", ErrTooManyInstruments, opts.maxInstruments()))
+		}
+
 		// Is there a better way to track instrumentBytes than returning rb
 		// e.g. I'd like to pass by reference but passing slices by reference
 		// seems no bueno
-		i, rb := readInstrument(instrumentBytes)
+		i, rb, err := readInstrument(instrumentBytes, offset, opts)
+		if err != nil {
+			return instruments, err
+		}
+		if opts.RejectDuplicateIDs && seen[i.num] {
+			return instruments, decodeError(offset, "instrument id", fmt.Errorf("%w: %d appears more than once", ErrDuplicateID, i.num))
+		}
+		seen[i.num] = true
+
+		offset += len(instrumentBytes) - len(rb)
 		instrumentBytes = rb
 		instruments = append(instruments, i)
 	}
-	return instruments
+	return instruments, nil
 }
 
-func readInstrument(instrumentBytes []byte) (Instrument, []byte) {
+// readColumns reads the instruments of a column-major payload: the id and
+// name of opts.InstrumentCount instruments, followed by every instrument's
+// first step, then every instrument's second step and so on.
+func readColumns(instrumentBytes []byte, offset int, opts DecodeOptions) ([]Instrument, error) {
 
-	var inst Instrument
+	count := opts.InstrumentCount
+	if count > opts.maxInstruments() {
+		return nil, decodeError(offset, "instrument",
+			fmt.Errorf("%w: pattern has more than %d", ErrTooManyInstruments, opts.maxInstruments()))
+	}
 
-	numBin, instrumentBytes := instrumentBytes[0:4], instrumentBytes[4:]
+	instruments := make([]Instrument, 0, count)
+	seen := make(map[uint32]bool)
 
-	buf := bytes.NewReader(numBin)
-	binary.Read(buf, binary.LittleEndian, &inst.num)
+	for len(instruments) < count {
+		i, rb, err := readInstrumentName(instrumentBytes, offset, opts)
+		if err != nil {
+			return instruments, err
+		}
+		if opts.RejectDuplicateIDs && seen[i.num] {
+			return instruments, decodeError(offset, "instrument id", fmt.Errorf("%w: %d appears more than once", ErrDuplicateID, i.num))
+		}
+		seen[i.num] = true
 
-	nameLengthBin, instrumentBytes := instrumentBytes[0:1], instrumentBytes[1:]
+		offset += len(instrumentBytes) - len(rb)
+		instrumentBytes = rb
+		instruments = append(instruments, i)
+	}
 
-	nameLength := nameLengthBin[0]
+	stepCount, _ := opts.stepsPerInstrument()
+	if len(instrumentBytes) < count*stepCount {
+		return instruments, decodeError(offset, "instrument steps", fmt.Errorf("%w: they need %d bytes for %d instruments, %d are left",
+			ErrTruncatedInstrument, count*stepCount, count, len(instrumentBytes)))
+	}
+	if len(instrumentBytes) > count*stepCount {
+		return instruments, decodeError(offset+count*stepCount, "instrument steps",
+			fmt.Errorf("%d bytes follow the steps of %d instruments", len(instrumentBytes)-count*stepCount, count))
+	}
 
-	nameBin, instrumentBytes := instrumentBytes[0:nameLength], instrumentBytes[nameLength:]
+	for n := range instruments {
+		steps := make([]byte, stepCount)
+		for s := range steps {
+			steps[s] = instrumentBytes[s*count+n]
+		}
+		instruments[n].setSteps(steps)
+	}
+	return instruments, nil
+}
 
-	inst.name = string(nameBin)
+// readInstrument reads the instrument record at the start of
+// instrumentBytes, which start at byte offset of the file, and returns the
+// bytes that follow it
+func readInstrument(instrumentBytes []byte, offset int, opts DecodeOptions) (Instrument, []byte, error) {
 
-	for i := 0; i < 4; i++ {
+	record := instrumentBytes
 
-		stepBin, rb := instrumentBytes[0:4], instrumentBytes[4:]
-		instrumentBytes = rb
+	inst, instrumentBytes, err := readInstrumentName(instrumentBytes, offset, opts)
+	if err != nil {
+		return inst, instrumentBytes, err
+	}
+	offset += len(record) - len(instrumentBytes)
+
+	stepCount, _ := opts.stepsPerInstrument()
+	stepsSize, err := opts.StepPacking.stepsSize(stepCount)
+	if err != nil {
+		return inst, instrumentBytes, err
+	}
+
+	if len(instrumentBytes) < stepsSize {
+		return inst, instrumentBytes, decodeError(offset, "instrument steps", fmt.Errorf("%w: instrument %d needs %d bytes, %d are left",
+			ErrTruncatedInstrument, inst.num, stepsSize, len(instrumentBytes)))
+	}
+
+	if opts.StepPacking == PackingBits {
+		inst.setSteps(unpackBits(instrumentBytes, stepCount))
+		instrumentBytes = instrumentBytes[stepsSize:]
+	} else {
+		inst.measure = make([]Step, 0, (stepCount+stepsPerMeasure-1)/stepsPerMeasure)
+
+		for remaining := stepCount; remaining > 0; remaining -= stepsPerMeasure {
 
-		inst.measure = append(inst.measure, stepBin)
+			n := stepsPerMeasure
+			if remaining < n {
+				n = remaining
+			}
+
+			stepBin, rb := instrumentBytes[0:n], instrumentBytes[n:]
+			instrumentBytes = rb
+
+			inst.measure = append(inst.measure, stepBin)
+		}
 	}
 
-	return inst, instrumentBytes
+	if opts.KeepRaw {
+		inst.raw = record[:len(record)-len(instrumentBytes)]
+	}
+
+	return inst, instrumentBytes, nil
 }
 
-func parseHeader(h []byte) (string, error) {
+// readInstrumentName reads an instrument's id and name, leaving its steps
+func readInstrumentName(instrumentBytes []byte, offset int, opts DecodeOptions) (Instrument, []byte, error) {
+
+	var inst Instrument
 
-	headerBin := bytes.Trim(h, "\x00")
+	if len(instrumentBytes) < 4 {
+		return inst, instrumentBytes, decodeError(offset, "instrument id",
+			fmt.Errorf("%w: it needs 4 bytes, %d are left", ErrTruncatedInstrument, len(instrumentBytes)))
+	}
+	inst.num = opts.byteOrder().Uint32(instrumentBytes)
+	instrumentBytes = instrumentBytes[4:]
+
+	if len(instrumentBytes) < 1 {
+		return inst, instrumentBytes, decodeError(offset+4, "instrument name length",
+			fmt.Errorf("%w: instrument %d has none", ErrTruncatedInstrument, inst.num))
+	}
+
+	nameLength, lengthSize, err := readNameLength(instrumentBytes)
+	if err != nil {
+		return inst, instrumentBytes, decodeError(offset+4, "instrument name length", fmt.Errorf("instrument %d: %w", inst.num, err))
+	}
+	instrumentBytes = instrumentBytes[lengthSize:]
+
+	if len(instrumentBytes) < nameLength {
+		return inst, instrumentBytes, decodeError(offset+4, "instrument name length", fmt.Errorf("%w: instrument %d has %d, but only %d bytes are left",
+			ErrInvalidNameLength, inst.num, nameLength, len(instrumentBytes)))
+	}
+
+	nameBin, instrumentBytes := instrumentBytes[0:nameLength], instrumentBytes[nameLength:]
+
+	name, err := opts.NameEncoding.decode(nameBin)
+	if err != nil {
+		return inst, instrumentBytes, decodeError(offset+4+lengthSize, "instrument name", fmt.Errorf("instrument %d: %w", inst.num, err))
+	}
+	inst.name = name
+
+	return inst, instrumentBytes, nil
+}
+
+// spliceMagic is the magic string every .splice header starts with
+const spliceMagic = "SPLICE"
+
+// parseHeader validates that the header starts with the SPLICE magic. Any
+// bytes that follow the magic are left for the caller to preserve.
+func parseHeader(h []byte) (string, error) {
 
-	if string(headerBin) != "SPLICE" {
-		return "", errors.New("invalid header")
+	if !bytes.HasPrefix(h, []byte(spliceMagic)) {
+		return "", decodeError(0, "header", ErrInvalidHeader)
 	}
 
-	return string(headerBin), nil
+	return spliceMagic, nil
 }
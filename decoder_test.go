@@ -1,8 +1,15 @@
 package drum
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"path"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -76,3 +83,163 @@ Tempo: 999
 		}
 	}
 }
+
+func TestDecodeFileHeaderBytes(t *testing.T) {
+
+	decoded, err := DecodeFile(path.Join("fixtures", "header_bytes.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding header_bytes.splice - %v", err)
+	}
+
+	expected := "SPLICE\x00\x02\x07AB\x00\x00"
+	if got := string(decoded.HeaderBytes()); got != expected {
+		t.Fatalf("expected header %q, got %q", expected, got)
+	}
+
+	original, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_1.splice - %v", err)
+	}
+	if fmt.Sprint(decoded) != fmt.Sprint(original) {
+		t.Errorf("header bytes changed the decoded pattern:\n%s", decoded)
+	}
+}
+
+func BenchmarkDecodeFile(b *testing.B) {
+
+	fixturePath := path.Join("fixtures", "pattern_1.splice")
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := DecodeFile(fixturePath); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestDecodeFileContextCancelled(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := DecodeFileContext(ctx, path.Join("fixtures", "pattern_1.splice"))
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+func TestDecodeFileTruncatedTempo(t *testing.T) {
+
+	_, err := DecodeFile(path.Join("fixtures", "truncated_tempo.splice"))
+	if err == nil {
+		t.Fatalf("expected an error decoding a truncated tempo")
+	}
+	if !strings.Contains(err.Error(), "tempo") || !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected a wrapped tempo read error, got %v", err)
+	}
+}
+
+func BenchmarkString(b *testing.B) {
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		_ = decoded.String()
+	}
+}
+
+func TestRenderedSize(t *testing.T) {
+
+	for _, name := range []string{"pattern_1.splice", "pattern_2.splice", "pattern_3.splice", "pattern_4.splice", "pattern_5.splice"} {
+
+		decoded, err := DecodeFile(path.Join("fixtures", name))
+		if err != nil {
+			t.Fatalf("something went wrong decoding %s - %v", name, err)
+		}
+		if size := decoded.renderedSize(); size != len(decoded.String()) {
+			t.Errorf("%s: renderedSize returned %d, String is %d bytes", name, size, len(decoded.String()))
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+
+	var stream []byte
+	for _, name := range []string{"pattern_1.splice", "pattern_2.splice"} {
+		data, err := ioutil.ReadFile(path.Join("fixtures", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream = append(stream, data...)
+	}
+	r := bytes.NewReader(stream)
+
+	for _, name := range []string{"pattern_1.splice", "pattern_2.splice"} {
+		expected, err := DecodeFile(path.Join("fixtures", name))
+		if err != nil {
+			t.Fatalf("something went wrong decoding %s - %v", name, err)
+		}
+
+		p, err := Decode(r)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", name, err)
+		}
+		if p.String() != expected.String() {
+			t.Errorf("%s: got:\n%s\nexpected:\n%s", name, p, expected)
+		}
+	}
+
+	if r.Len() != 0 {
+		t.Errorf("expected Decode to read both patterns exactly, %d bytes left", r.Len())
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+
+	names, err := filepath.Glob(path.Join("fixtures", "*.splice"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, name := range names {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+
+	options := []DecodeOptions{
+		{},
+		{KeepRaw: true, RejectDuplicateIDs: true, NameEncoding: NameReplaceInvalid},
+		{LengthFieldSize: 2, MaxPayload: 4096},
+		{StepPacking: PackingBits, TempoFormat: TextTempo},
+		{Layout: LayoutColumnMajor, InstrumentCount: 3, TempoFormat: Int32Tempo},
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+
+		for _, opts := range options {
+			p, err := DecodeWithOptions(bytes.NewReader(data), opts)
+			if err != nil {
+				continue
+			}
+
+			_ = p.String()
+			_ = Validate(p)
+			if err := p.Encode(ioutil.Discard); err != nil && len(Validate(p)) == 0 {
+				t.Fatalf("%+v: a pattern without issues failed to encode: %v", opts, err)
+			}
+		}
+
+		if _, instruments, err := DecodeStream(bytes.NewReader(data)); err == nil {
+			for range instruments {
+			}
+		}
+		DecodeVerbose(bytes.NewReader(data))
+		DecodeAll(bytes.NewReader(data))
+	})
+}
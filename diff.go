@@ -0,0 +1,118 @@
+package drum
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// StepChange is a step that differs between two versions of an instrument
+type StepChange struct {
+	InstrumentID uint32
+	Name         string
+	Step         int
+	From, To     bool
+}
+
+// Rename is an instrument whose name differs between two patterns
+type Rename struct {
+	InstrumentID uint32
+	From, To     string
+}
+
+// PatternDiff describes how one pattern differs from another, as found by
+// Diff. The From and To fields hold the same value when it is unchanged.
+type PatternDiff struct {
+	VersionFrom, VersionTo string
+	TempoFrom, TempoTo     float32
+	Added                  []Instrument
+	Removed                []Instrument
+	Renamed                []Rename
+	Steps                  []StepChange
+}
+
+// Diff reports how b differs from a: the version and tempo, the instruments
+// added and removed, those renamed and every step that was turned on or off.
+// Instruments are matched by id, and steps past the end of the shorter of
+// two matched instruments count as rests. Tempos within float32 noise of
+// each other count as unchanged.
+func Diff(a, b Pattern) PatternDiff {
+
+	d := PatternDiff{VersionFrom: a.version, VersionTo: b.version, TempoFrom: a.tempo, TempoTo: b.tempo}
+
+	for _, inst := range a.instruments {
+		j := b.instrumentIndex(inst.num)
+		if j < 0 {
+			d.Removed = append(d.Removed, inst)
+			continue
+		}
+
+		other := b.instruments[j]
+		if other.name != inst.name {
+			d.Renamed = append(d.Renamed, Rename{InstrumentID: inst.num, From: inst.name, To: other.name})
+		}
+
+		from, to := inst.steps(), other.steps()
+		for s := 0; s < len(from) || s < len(to); s++ {
+			was := s < len(from) && isOn(from[s])
+			is := s < len(to) && isOn(to[s])
+			if was != is {
+				d.Steps = append(d.Steps, StepChange{InstrumentID: other.num, Name: other.name, Step: s, From: was, To: is})
+			}
+		}
+	}
+
+	for _, inst := range b.instruments {
+		if a.instrumentIndex(inst.num) < 0 {
+			d.Added = append(d.Added, inst)
+		}
+	}
+	return d
+}
+
+// Empty reports whether the diff found no differences at all
+func (d PatternDiff) Empty() bool {
+
+	return d.VersionFrom == d.VersionTo && !d.tempoChanged() &&
+		len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Renamed) == 0 && len(d.Steps) == 0
+}
+
+func (d PatternDiff) tempoChanged() bool {
+
+	return math.Abs(float64(d.TempoFrom-d.TempoTo)) > tempoEpsilon
+}
+
+// String describes the diff one change to a line, such as
+//
+//	tempo: 120 -> 128
+//	+ (3) cowbell
+//	kick step 5: - -> x
+//
+// with the version and tempo first, then the removed, added and renamed
+// instruments and then the step changes. An empty diff gives "".
+func (d PatternDiff) String() string {
+
+	var b strings.Builder
+
+	if d.VersionFrom != d.VersionTo {
+		fmt.Fprintf(&b, "version: %q -> %q\n", d.VersionFrom, d.VersionTo)
+	}
+	if d.tempoChanged() {
+		fmt.Fprintf(&b, "tempo: %v -> %v\n", d.TempoFrom, d.TempoTo)
+	}
+	for _, inst := range d.Removed {
+		fmt.Fprintf(&b, "- (%d) %s\n", inst.num, inst.name)
+	}
+	for _, inst := range d.Added {
+		fmt.Fprintf(&b, "+ (%d) %s\n", inst.num, inst.name)
+	}
+	for _, r := range d.Renamed {
+		fmt.Fprintf(&b, "(%d) renamed: %s -> %s\n", r.InstrumentID, r.From, r.To)
+	}
+
+	mark := map[bool]byte{false: '-', true: 'x'}
+	for _, c := range d.Steps {
+		fmt.Fprintf(&b, "%s step %d: %c -> %c\n", c.Name, c.Step, mark[c.From], mark[c.To])
+	}
+	return b.String()
+}
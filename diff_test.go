@@ -0,0 +1,45 @@
+package drum
+
+import (
+	"path"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_1.splice - %v", err)
+	}
+
+	if d := Diff(*decoded, decoded.Clone()); !d.Empty() || d.String() != "" {
+		t.Errorf("expected no differences from a clone, got\n%s", d)
+	}
+
+	edited := decoded.Clone()
+	edited.SetTempo(128)
+	edited.SetStep(0, 5, true)
+	edited.SetStep(1, 4, false)
+	edited.instruments[3].name = "open hat"
+	edited.instruments = append(edited.instruments[:2], edited.instruments[3:]...)
+	edited.instruments = append(edited.instruments, Instrument{num: 9, name: "rim", measure: []Step{{1, 0, 0, 0}}})
+
+	expected := "tempo: 120 -> 128\n" +
+		"- (2) clap\n" +
+		"+ (9) rim\n" +
+		"(3) renamed: hh-open -> open hat\n" +
+		"kick step 5: - -> x\n" +
+		"snare step 4: x -> -\n"
+
+	d := Diff(*decoded, edited)
+	if d.Empty() || d.String() != expected {
+		t.Errorf("got\n%s\nexpected\n%s", d, expected)
+	}
+	if len(d.Steps) != 2 || d.Steps[0] != (StepChange{InstrumentID: 0, Name: "kick", Step: 5, From: false, To: true}) {
+		t.Errorf("unexpected step changes %+v", d.Steps)
+	}
+
+	if d := Diff(Pattern{version: "a", tempo: 120}, Pattern{version: "b", tempo: 120.00001}); d.String() != "version: \"a\" -> \"b\"\n" {
+		t.Errorf("expected only the version to change, got\n%s", d)
+	}
+}
@@ -0,0 +1,209 @@
+package drum
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// NamedPattern is a pattern together with the path of the file it was
+// decoded from
+type NamedPattern struct {
+	Path    string
+	Pattern Pattern
+}
+
+// DecodeDir decodes every .splice file in the directory tree rooted at root,
+// using up to workers goroutines, or one per CPU if workers isn't positive.
+// Patterns are returned in order of path. Files that fail to decode, and
+// directories that can't be read, are skipped and reported in the returned
+// errors, each naming its path, in the same order. A file's sidecar
+// metadata, read as ReadMeta does, takes the place of any the pattern was
+// encoded with, and one that can't be read fails the file.
+func DecodeDir(root string, workers int) ([]NamedPattern, []error) {
+
+	return DecodeDirContext(context.Background(), root, workers)
+}
+
+// DecodeDirContext decodes the directory tree rooted at root like
+// DecodeDir, but stops walking it and decoding files as soon as ctx is
+// done, returning the patterns decoded by then with the context's error
+// last among the errors.
+func DecodeDirContext(ctx context.Context, root string, workers int) ([]NamedPattern, []error) {
+
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	type result struct {
+		path string
+		p    *Pattern
+		err  error
+	}
+
+	var results []result
+	var paths []string
+
+	walkErr := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+
+		if ctx.Err() != nil {
+			return fs.SkipAll
+		}
+		if err != nil {
+			results = append(results, result{path: path, err: fmt.Errorf("%s: %w", path, err)})
+			if entry != nil && entry.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !entry.IsDir() && filepath.Ext(path) == ".splice" {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if walkErr != nil {
+		results = append(results, result{path: root, err: fmt.Errorf("%s: %w", root, walkErr)})
+	}
+
+	decoded := make([]result, len(paths))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(paths); w++ {
+		wg.Add(1)
+		go func() {
+
+			defer wg.Done()
+			for n := range jobs {
+				p, err := decodeFileMeta(ctx, paths[n])
+				if err != nil {
+					err = fmt.Errorf("%s: %w", paths[n], err)
+				}
+				decoded[n] = result{path: paths[n], p: p, err: err}
+			}
+		}()
+	}
+
+	queued := 0
+feed:
+	for ; queued < len(paths); queued++ {
+		select {
+		case jobs <- queued:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	// files decoded as ctx was done report its error, which is reported
+	// once, at the end, instead
+	for _, r := range decoded[:queued] {
+		if err := ctx.Err(); err != nil && errors.Is(r.err, err) {
+			continue
+		}
+		results = append(results, r)
+	}
+	sort.SliceStable(results, func(a, b int) bool { return results[a].path < results[b].path })
+
+	var patterns []NamedPattern
+	var errs []error
+
+	for _, r := range results {
+		if r.err != nil {
+			errs = append(errs, r.err)
+			continue
+		}
+		patterns = append(patterns, NamedPattern{Path: r.path, Pattern: *r.p})
+	}
+	if err := ctx.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return patterns, errs
+}
+
+// DecodeDirByTempo decodes the .splice files in dir, not descending into
+// subdirectories, and returns those whose tempo is between min and max BPM
+// inclusive, keyed by file path. Files that fail to decode are skipped and
+// reported together in the returned error.
+func DecodeDirByTempo(dir string, min, max float32) (map[string]Pattern, error) {
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	patterns := make(map[string]Pattern)
+	var errs []error
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".splice" {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		p, err := DecodeFile(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", path, err))
+			continue
+		}
+
+		if p.TempoInRange(min, max) {
+			patterns[path] = *p
+		}
+	}
+	return patterns, errors.Join(errs...)
+}
+
+// WriteTextDir writes each pattern to dir/<name>.txt in the text form
+// returned by String, creating dir and any missing parents first. Files that
+// already exist are overwritten. Patterns are written in order of name, and
+// the first one that fails stops the rest, returning an error naming
+// its file. Names must be plain file names, without any directory.
+func WriteTextDir(dir string, patterns map[string]Pattern) error {
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(patterns))
+	for name := range patterns {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := filepath.Join(dir, name+".txt")
+
+		if name == "" || name == "." || name == ".." || filepath.Base(name) != name {
+			return fmt.Errorf("%s: %q is not a plain file name", path, name)
+		}
+
+		if err := writeTextFile(path, patterns[name]); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+// writeTextFile writes the text form of p to a file at path, replacing
+// anything already there
+func writeTextFile(path string, p Pattern) error {
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if _, err := p.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,146 @@
+package drum_test
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	drum "github.com/chrishiestand/golang-challenge-1-drum_machine"
+	"github.com/chrishiestand/golang-challenge-1-drum_machine/drumtest"
+)
+
+func TestDecodeDirByTempo(t *testing.T) {
+
+	dir := drumtest.FixtureDir(t, "fixtures", "pattern_1.splice", "pattern_2.splice", "pattern_3.splice", "pattern_4.splice", "truncated_payload.splice")
+
+	patterns, err := drum.DecodeDirByTempo(dir, 110, 130)
+	if err == nil {
+		t.Errorf("expected an error for truncated_payload.splice")
+	}
+
+	if len(patterns) != 2 {
+		t.Fatalf("expected 2 patterns, got %d", len(patterns))
+	}
+	for _, name := range []string{"pattern_1.splice", "pattern_3.splice"} {
+		if _, ok := patterns[filepath.Join(dir, name)]; !ok {
+			t.Errorf("expected %s in range", name)
+		}
+	}
+}
+
+func TestWriteTextDir(t *testing.T) {
+
+	patterns := make(map[string]drum.Pattern)
+	for _, name := range []string{"pattern_1", "pattern_2"} {
+		p, err := drum.DecodeFile(filepath.Join("fixtures", name+".splice"))
+		if err != nil {
+			t.Fatalf("something went wrong decoding %s - %v", name, err)
+		}
+		patterns[name] = *p
+	}
+
+	dir := filepath.Join(t.TempDir(), "library", "text")
+
+	// the second write overwrites the files of the first
+	for i := 0; i < 2; i++ {
+		if err := drum.WriteTextDir(dir, patterns); err != nil {
+			t.Fatalf("write %d: unexpected error %v", i, err)
+		}
+	}
+
+	for name, p := range patterns {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name+".txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != p.String() {
+			t.Errorf("%s.txt holds:\n%s\nexpected:\n%s", name, data, p)
+		}
+	}
+
+	err := drum.WriteTextDir(dir, map[string]drum.Pattern{"../escape": patterns["pattern_1"]})
+	if err == nil || !strings.Contains(err.Error(), "escape.txt") {
+		t.Errorf("expected an error naming the file for a name with a directory, got %v", err)
+	}
+}
+
+func TestDecodeDir(t *testing.T) {
+
+	dir := drumtest.FixtureDir(t, "fixtures", "pattern_1.splice", "pattern_2.splice", "truncated_payload.splice")
+	nested := filepath.Join(dir, "nested", "deeper")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"pattern_3.splice", "pattern_4.splice"} {
+		data, err := ioutil.ReadFile(filepath.Join("fixtures", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(nested, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a pattern"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		filepath.Join(nested, "pattern_3.splice"),
+		filepath.Join(nested, "pattern_4.splice"),
+		filepath.Join(dir, "pattern_1.splice"),
+		filepath.Join(dir, "pattern_2.splice"),
+	}
+
+	for _, workers := range []int{0, 1, 3, 16} {
+
+		patterns, errs := drum.DecodeDir(dir, workers)
+
+		if len(errs) != 1 || !errors.Is(errs[0], drum.ErrTruncated) || !strings.Contains(errs[0].Error(), "truncated_payload.splice") {
+			t.Errorf("workers %d: expected one error for truncated_payload.splice, got %v", workers, errs)
+		}
+		if len(patterns) != len(expected) {
+			t.Fatalf("workers %d: expected %d patterns, got %d", workers, len(expected), len(patterns))
+		}
+		for n, path := range expected {
+			if patterns[n].Path != path {
+				t.Errorf("workers %d: pattern %d is %s, expected %s", workers, n, patterns[n].Path, path)
+			}
+		}
+
+		want, err := drum.DecodeFile(expected[2])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if patterns[2].Pattern.String() != want.String() {
+			t.Errorf("workers %d: pattern_1 decoded as\n%s", workers, patterns[2].Pattern)
+		}
+	}
+
+	if patterns, errs := drum.DecodeDir(filepath.Join(dir, "missing"), 2); len(patterns) != 0 || len(errs) != 1 {
+		t.Errorf("expected one error for a missing directory, got %d patterns and %v", len(patterns), errs)
+	}
+}
+
+func TestDecodeDirContext(t *testing.T) {
+
+	dir := drumtest.FixtureDir(t, "fixtures", "pattern_1.splice", "pattern_2.splice", "pattern_3.splice")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	patterns, errs := drum.DecodeDirContext(ctx, dir, 2)
+	if len(patterns) != 3 || len(errs) != 0 {
+		t.Errorf("expected 3 patterns and no errors, got %d and %v", len(patterns), errs)
+	}
+
+	cancel()
+	patterns, errs = drum.DecodeDirContext(ctx, dir, 2)
+	if len(patterns) != 0 || len(errs) != 1 || !errors.Is(errs[0], context.Canceled) {
+		t.Errorf("expected only the context's error, got %d patterns and %v", len(patterns), errs)
+	}
+	if x, errs := drum.IndexDirContext(ctx, dir, 2); x.Len() != 0 || len(errs) != 1 {
+		t.Errorf("expected an empty index and one error, got %d patterns and %v", x.Len(), errs)
+	}
+}
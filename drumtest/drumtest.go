@@ -0,0 +1,230 @@
+// Package drumtest provides helpers for testing code that reads and writes
+// patterns: Pattern builds a pattern from step grids and RandomPattern
+// makes valid patterns to feed it, FixtureDir copies fixture files to read,
+// RoundTrip encodes and decodes a pattern, and Compare and AssertEqual
+// check that two patterns hold the same thing, so a change to a writer or
+// editor that drifts from the format shows up as a failing test.
+package drumtest
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	drum "github.com/chrishiestand/golang-challenge-1-drum_machine"
+)
+
+// Options limits the patterns RandomPattern makes
+type Options struct {
+	// MaxInstruments is the most instruments a pattern gets, though it gets
+	// no more than fit the payload length a .splice file can declare. Zero
+	// means 8.
+	MaxInstruments int
+}
+
+// nameLetters are the bytes RandomPattern builds versions and names from
+const nameLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-._ "
+
+// RandomPattern returns a pattern made with rng that Validate finds no
+// issues with: a random version and tempo, and instruments with their own
+// ids and names and 16 steps, each off, on or on at a velocity, some of
+// them muted, soloed or at a gain.
+func RandomPattern(rng *rand.Rand, opts Options) drum.Pattern {
+
+	maxInstruments := opts.MaxInstruments
+	if maxInstruments <= 0 {
+		maxInstruments = 8
+	}
+
+	tempo := drum.MinTempo + rng.Float32()*(drum.MaxTempo-drum.MinTempo)
+	p := drum.NewPattern(randomString(rng, 0, 32), tempo)
+
+	ids := make(map[uint32]bool)
+	for n := rng.Intn(maxInstruments + 1); n > 0; n-- {
+		id := rng.Uint32()
+		for ids[id] {
+			id = rng.Uint32()
+		}
+		ids[id] = true
+
+		p.AddInstrument(id, randomString(rng, 1, 24))
+		if _, err := p.EncodedSize(); err != nil {
+			p.RemoveInstrument(id)
+			break
+		}
+
+		on := make([]bool, len(p.Instruments()[0].Steps()))
+		for s := range on {
+			on[s] = rng.Intn(3) == 0
+		}
+		p.SetSteps(id, on)
+		for s := range on {
+			if on[s] && rng.Intn(4) == 0 {
+				p.SetVelocity(id, s, uint8(2+rng.Intn(126)))
+			}
+		}
+
+		switch rng.Intn(8) {
+		case 0:
+			p.SetMuted(id, true)
+		case 1:
+			p.SetSolo(id, true)
+		case 2:
+			p.SetGain(id, rng.Float32()*2)
+		}
+	}
+	return *p
+}
+
+// randomString returns a string of between min and max bytes from
+// nameLetters
+func randomString(rng *rand.Rand, min, max int) string {
+
+	b := make([]byte, min+rng.Intn(max-min+1))
+	for i := range b {
+		b[i] = nameLetters[rng.Intn(len(nameLetters))]
+	}
+	return string(b)
+}
+
+// Track is an instrument for Pattern to add: its id, name and steps, written
+// as InstrumentBuilder.SetSteps reads them, x for a hit and - for a rest
+type Track struct {
+	ID    uint32
+	Name  string
+	Steps string
+}
+
+// Pattern returns a pattern of the given version and tempo holding tracks,
+// in order, failing t unless each grid holds as many steps as AddInstrument
+// gives the track's instrument
+func Pattern(t testing.TB, version string, tempo float32, tracks ...Track) drum.Pattern {
+
+	t.Helper()
+
+	p := drum.NewPattern(version, tempo)
+	for _, track := range tracks {
+		if err := p.AddInstrument(track.ID, track.Name).SetSteps(track.Steps); err != nil {
+			t.Fatalf("track %q: %v", track.Name, err)
+		}
+	}
+	return *p
+}
+
+// FixtureDir copies the named files from the directory fixtures into a
+// temporary directory, removed when t finishes, and returns its path
+func FixtureDir(t testing.TB, fixtures string, names ...string) string {
+
+	t.Helper()
+
+	dir := t.TempDir()
+	for _, name := range names {
+		data, err := ioutil.ReadFile(filepath.Join(fixtures, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// RoundTrip encodes p and decodes the bytes again, strictly and with the
+// step count the format doesn't record taken from p, so that patterns of
+// other lengths can round trip too, failing t if either step does. It
+// returns the decoded pattern.
+func RoundTrip(t testing.TB, p drum.Pattern) drum.Pattern {
+
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := p.Encode(&buf); err != nil {
+		t.Fatalf("encoding: %v", err)
+	}
+
+	opts := drum.DecodeOptions{Strict: true}
+	if instruments := p.Instruments(); len(instruments) > 0 {
+		opts.StepsPerInstrument = len(instruments[0].Steps())
+	}
+
+	decoded, err := drum.DecodeWithOptions(bytes.NewReader(buf.Bytes()), opts)
+	if err != nil {
+		t.Fatalf("decoding % x: %v", buf.Bytes(), err)
+	}
+	return decoded
+}
+
+// Compare returns a description of each way got differs from want: its
+// version, tempo, instruments and their ids, names, step values and
+// playback attributes, and the chunks kept from an extension area. It
+// returns nil if they hold the same thing. Unlike Pattern.Equal, it
+// doesn't stop at the first difference.
+func Compare(want, got drum.Pattern) []string {
+
+	var diffs []string
+	differ := func(format string, args ...interface{}) {
+		diffs = append(diffs, fmt.Sprintf(format, args...))
+	}
+
+	if want.Version() != got.Version() {
+		differ("version is %q, want %q", got.Version(), want.Version())
+	}
+	if want.Tempo() != got.Tempo() {
+		differ("tempo is %v, want %v", got.Tempo(), want.Tempo())
+	}
+
+	wi, gi := want.Instruments(), got.Instruments()
+	if len(wi) != len(gi) {
+		differ("%d instruments, want %d", len(gi), len(wi))
+	}
+	for i := 0; i < len(wi) && i < len(gi); i++ {
+		w, g := wi[i], gi[i]
+		if w.ID() != g.ID() {
+			differ("instrument %d has id %d, want %d", i, g.ID(), w.ID())
+		}
+		if w.Name() != g.Name() {
+			differ("instrument %d is named %q, want %q", i, g.Name(), w.Name())
+		}
+		if w.Muted() != g.Muted() || w.Solo() != g.Solo() || w.Gain() != g.Gain() {
+			differ("instrument %d has muted %v, solo %v and gain %v, want %v, %v and %v",
+				i, g.Muted(), g.Solo(), g.Gain(), w.Muted(), w.Solo(), w.Gain())
+		}
+
+		ws, gs := w.StepValues(), g.StepValues()
+		if len(ws) != len(gs) {
+			differ("instrument %d has %d steps, want %d", i, len(gs), len(ws))
+			continue
+		}
+		for s := range ws {
+			if ws[s] != gs[s] {
+				differ("instrument %d step %d is %+v, want %+v", i, s, gs[s], ws[s])
+			}
+		}
+	}
+
+	wc, gc := want.UnknownChunks(), got.UnknownChunks()
+	if len(wc) != len(gc) {
+		differ("%d unknown chunks, want %d", len(gc), len(wc))
+	}
+	for i := 0; i < len(wc) && i < len(gc); i++ {
+		if wc[i].Type != gc[i].Type || !bytes.Equal(wc[i].Data, gc[i].Data) {
+			differ("unknown chunk %d is %q % x, want %q % x", i, gc[i].Type, gc[i].Data, wc[i].Type, wc[i].Data)
+		}
+	}
+	return diffs
+}
+
+// AssertEqual fails t with every difference Compare finds between want and
+// got
+func AssertEqual(t testing.TB, want, got drum.Pattern) {
+
+	t.Helper()
+
+	for _, diff := range Compare(want, got) {
+		t.Error(diff)
+	}
+}
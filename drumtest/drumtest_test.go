@@ -0,0 +1,140 @@
+package drumtest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	drum "github.com/chrishiestand/golang-challenge-1-drum_machine"
+)
+
+func TestPattern(t *testing.T) {
+
+	p := Pattern(t, "0.808-alpha", 120,
+		Track{ID: 0, Name: "kick", Steps: "x---|x---|x---|x---"},
+		Track{ID: 3, Name: "hat", Steps: "--x---x---x---x-"})
+
+	grid := p.ToGrid()
+	if len(grid) != 2 || p.Instruments()[1].ID() != 3 || !grid[0][4] || grid[0][5] || !grid[1][2] {
+		t.Errorf("unexpected pattern\n%s", p)
+	}
+}
+
+func TestRandomPattern(t *testing.T) {
+
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{"defaults", Options{}},
+		{"one", Options{MaxInstruments: 1}},
+		{"as many as fit", Options{MaxInstruments: 40}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for seed := int64(0); seed < 200; seed++ {
+				p := RandomPattern(rand.New(rand.NewSource(seed)), tt.opts)
+				if issues := drum.Validate(p); len(issues) > 0 {
+					t.Fatalf("seed %d: expected a valid pattern, got %v", seed, issues)
+				}
+				if n := len(p.Instruments()); n > 8 && tt.opts.MaxInstruments == 0 || tt.opts.MaxInstruments > 0 && n > tt.opts.MaxInstruments {
+					t.Fatalf("seed %d: %d instruments is over the limit", seed, n)
+				}
+				AssertEqual(t, p, RoundTrip(t, p))
+			}
+		})
+	}
+
+	// longer instruments round trip with their step count
+	p := RandomPattern(rand.New(rand.NewSource(1)), Options{MaxInstruments: 2})
+	if err := p.Resize(32); err != nil {
+		t.Fatal(err)
+	}
+	AssertEqual(t, p, RoundTrip(t, p))
+
+	a := RandomPattern(rand.New(rand.NewSource(7)), Options{})
+	b := RandomPattern(rand.New(rand.NewSource(7)), Options{})
+	if diffs := Compare(a, b); diffs != nil {
+		t.Errorf("expected the same seed to make the same pattern, got %v", diffs)
+	}
+}
+
+func TestCompare(t *testing.T) {
+
+	want := drum.NewPattern("0.808-alpha", 120)
+	want.AddInstrument(1, "kick").SetSteps("x...x...x...x...")
+	want.AddInstrument(2, "snare").SetSteps("....x.......x...")
+
+	got := want.Clone()
+	if diffs := Compare(*want, got); diffs != nil {
+		t.Errorf("expected no differences, got %v", diffs)
+	}
+
+	got.SetTempo(98)
+	got.RenameInstrument(2, "clap")
+	got.SetStep(1, 1, true)
+	got.SetMuted(2, true)
+	if diffs := Compare(*want, got); len(diffs) != 4 {
+		t.Errorf("expected 4 differences, got %q", diffs)
+	}
+
+	got.RemoveInstrument(2)
+	if diffs := Compare(*want, got); len(diffs) != 3 {
+		t.Errorf("expected 3 differences, got %q", diffs)
+	}
+}
+
+func FuzzRoundTrip(f *testing.F) {
+
+	for seed := int64(0); seed < 8; seed++ {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, seed int64) {
+
+		p := RandomPattern(rand.New(rand.NewSource(seed)), Options{MaxInstruments: 16})
+		AssertEqual(t, p, RoundTrip(t, p))
+	})
+}
+
+// FuzzDecode checks that whatever Decode accepts without issues survives
+// being written and read again, and that writing it is then stable
+func FuzzDecode(f *testing.F) {
+
+	names, err := filepath.Glob(filepath.Join("..", "fixtures", "*.splice"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, name := range names {
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+
+		p, err := drum.Decode(bytes.NewReader(data))
+		if err != nil || len(drum.Validate(p)) > 0 {
+			return
+		}
+
+		decoded := RoundTrip(t, p)
+		AssertEqual(t, p, decoded)
+
+		var first, second bytes.Buffer
+		if err := p.Encode(&first); err != nil {
+			t.Fatal(err)
+		}
+		if err := decoded.Encode(&second); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(first.Bytes(), second.Bytes()) {
+			t.Errorf("encoding changed after a round trip\n got % x\nwant % x", second.Bytes(), first.Bytes())
+		}
+	})
+}
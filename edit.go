@@ -0,0 +1,222 @@
+package drum
+
+import "fmt"
+
+// SetTempo sets the pattern's tempo in beats per minute. The tempo bytes
+// kept from decoding are dropped, so encoding writes the new value.
+func (p *Pattern) SetTempo(bpm float32) {
+
+	p.tempo = bpm
+	p.tempoBin = nil
+	p.notify(Change{Kind: ChangeTempo, Tempo: bpm})
+}
+
+// SetStep turns the step at index step of the instrument with the given id on
+// or off. Steps are indexed across measures, so with four steps per measure
+// step 5 is the second step of the second measure.
+func (p *Pattern) SetStep(id uint32, step int, on bool) error {
+
+	i := p.instrumentIndex(id)
+	if i < 0 {
+		return fmt.Errorf("no instrument with id %d", id)
+	}
+
+	value := StepOff
+	if on {
+		value = StepOn
+	}
+
+	if err := p.instruments[i].setStep(step, value); err != nil {
+		return err
+	}
+
+	p.notify(Change{Kind: ChangeStep, InstrumentID: id, Step: step, On: on})
+	return nil
+}
+
+// ToggleStep flips the step at index step of the instrument with the given
+// id, indexed as in SetStep.
+func (p *Pattern) ToggleStep(id uint32, step int) error {
+
+	i := p.instrumentIndex(id)
+	if i < 0 {
+		return fmt.Errorf("no instrument with id %d", id)
+	}
+
+	value, err := p.instruments[i].step(step)
+	if err != nil {
+		return err
+	}
+
+	return p.SetStep(id, step, !isOn(value))
+}
+
+// SetSteps replaces every step of the instrument with the given id, where
+// true is a hit. steps must have as many entries as the instrument already
+// has steps; use PadTo or ConformSteps to change an instrument's length.
+func (p *Pattern) SetSteps(id uint32, steps []bool) error {
+
+	i := p.instrumentIndex(id)
+	if i < 0 {
+		return fmt.Errorf("no instrument with id %d", id)
+	}
+
+	if n := p.instruments[i].stepCount(); len(steps) != n {
+		return fmt.Errorf("instrument %d has %d steps, got %d", id, n, len(steps))
+	}
+
+	values := make([]byte, len(steps))
+	for s, on := range steps {
+		if on {
+			values[s] = StepOn
+		}
+	}
+
+	p.instruments[i].setSteps(values)
+	p.notify(Change{Kind: ChangeSteps, InstrumentID: id})
+	return nil
+}
+
+// RemoveEmptyInstruments removes every instrument without a single hit,
+// keeping the rest in their original order, and returns how many were removed.
+func (p *Pattern) RemoveEmptyInstruments() int {
+
+	kept := make([]Instrument, 0, len(p.instruments))
+	var removed []uint32
+
+	for _, inst := range p.instruments {
+		if inst.hits() == 0 {
+			removed = append(removed, inst.num)
+			continue
+		}
+		kept = append(kept, inst)
+	}
+	p.instruments = kept
+
+	for _, id := range removed {
+		p.notify(Change{Kind: ChangeInstrumentRemoved, InstrumentID: id})
+	}
+	return len(removed)
+}
+
+// ReorderByNames moves the instruments named in preferred to the front, in
+// the order the names are given, followed by the rest in their original
+// order. Names are compared exactly, every instrument sharing a name moves
+// together in its original order, and names no instrument has are skipped.
+// Each instrument that ends up at another position is reported as a
+// ChangeInstrumentMoved, in the new order.
+func (p *Pattern) ReorderByNames(preferred []string) {
+
+	reordered := make([]Instrument, 0, len(p.instruments))
+	moved := make([]bool, len(p.instruments))
+
+	for _, name := range preferred {
+		for i, inst := range p.instruments {
+			if !moved[i] && inst.name == name {
+				moved[i] = true
+				reordered = append(reordered, inst)
+			}
+		}
+	}
+
+	for i, inst := range p.instruments {
+		if !moved[i] {
+			reordered = append(reordered, inst)
+		}
+	}
+	previous := p.instruments
+	p.instruments = reordered
+
+	for i, inst := range reordered {
+		if previous[i].num != inst.num {
+			p.notify(Change{Kind: ChangeInstrumentMoved, InstrumentID: inst.num})
+		}
+	}
+}
+
+// RemoveInstrument removes the first instrument with the given id, keeping
+// the rest in their order.
+func (p *Pattern) RemoveInstrument(id uint32) error {
+
+	i := p.instrumentIndex(id)
+	if i < 0 {
+		return fmt.Errorf("no instrument with id %d", id)
+	}
+
+	p.instruments = append(p.instruments[:i:i], p.instruments[i+1:]...)
+	p.notify(Change{Kind: ChangeInstrumentRemoved, InstrumentID: id})
+	return nil
+}
+
+// RenameInstrument gives the first instrument with the given id a new name.
+// The name can be up to 65535 bytes, or an error wrapping ErrNameTooLong is
+// returned. Any raw bytes kept from decoding are dropped, so encoding writes
+// the new name.
+func (p *Pattern) RenameInstrument(id uint32, name string) error {
+
+	i := p.instrumentIndex(id)
+	if i < 0 {
+		return fmt.Errorf("no instrument with id %d", id)
+	}
+	if len(name) > maxNameSize {
+		return fmt.Errorf("%w: %q is %d bytes, the most is %d", ErrNameTooLong, name, len(name), maxNameSize)
+	}
+
+	p.instruments[i].name = name
+	p.instruments[i].raw = nil
+	p.notify(Change{Kind: ChangeInstrumentRenamed, InstrumentID: id})
+	return nil
+}
+
+// MoveInstrument moves the instrument at index from to index to, shifting
+// the instruments between them along by one. Both indices must be within
+// the pattern's instruments.
+func (p *Pattern) MoveInstrument(from, to int) error {
+
+	if from < 0 || from >= len(p.instruments) || to < 0 || to >= len(p.instruments) {
+		return fmt.Errorf("cannot move instrument %d to %d in a pattern of %d", from, to, len(p.instruments))
+	}
+	if from == to {
+		return nil
+	}
+
+	inst := p.instruments[from]
+	rest := append(p.instruments[:from:from], p.instruments[from+1:]...)
+	p.instruments = append(rest[:to:to], append([]Instrument{inst}, rest[to:]...)...)
+
+	p.notify(Change{Kind: ChangeInstrumentMoved, InstrumentID: inst.num})
+	return nil
+}
+
+// DuplicateInstrument inserts a copy of the first instrument with the given
+// id right after it, with the same name, steps and Expression, and returns
+// the copy's id: one more than the highest id in the pattern, so it doesn't
+// clash with any other.
+func (p *Pattern) DuplicateInstrument(id uint32) (uint32, error) {
+
+	i := p.instrumentIndex(id)
+	if i < 0 {
+		return 0, fmt.Errorf("no instrument with id %d", id)
+	}
+
+	dup := p.instruments[i].clone()
+	dup.num = p.nextID()
+	dup.raw = nil
+
+	p.instruments = append(p.instruments[:i+1:i+1], append([]Instrument{dup}, p.instruments[i+1:]...)...)
+	p.notify(Change{Kind: ChangeInstrumentAdded, InstrumentID: dup.num})
+	return dup.num, nil
+}
+
+// nextID returns one more than the highest instrument id in the pattern, or
+// 0 if it has no instruments
+func (p Pattern) nextID() uint32 {
+
+	var id uint32
+	for _, inst := range p.instruments {
+		if inst.num >= id {
+			id = inst.num + 1
+		}
+	}
+	return id
+}
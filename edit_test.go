@@ -0,0 +1,238 @@
+package drum
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSetStep(t *testing.T) {
+
+	p := Pattern{instruments: []Instrument{
+		{num: 3, name: "kick", measure: []Step{{0, 0, 0, 0}, {0, 0, 0, 0}}},
+	}}
+
+	if err := p.SetStep(3, 5, true); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := p.ToggleStep(3, 0); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got := gridString(p.instruments[0].steps()); got != "x----x--" {
+		t.Errorf("got %s, expected x----x--", got)
+	}
+
+	if err := p.SetStep(3, 8, true); err == nil {
+		t.Errorf("expected an error setting an out of range step")
+	}
+	if err := p.ToggleStep(4, 0); err == nil {
+		t.Errorf("expected an error toggling an unknown instrument")
+	}
+}
+
+func TestOnChange(t *testing.T) {
+
+	p := Pattern{instruments: []Instrument{
+		{num: 1, name: "snare", measure: []Step{{0, 0, 0, 0}}},
+	}}
+
+	// mutations before registering must work without an observer
+	p.SetTempo(100)
+
+	var changes []Change
+	p.OnChange(func(c Change) { changes = append(changes, c) })
+
+	p.SetTempo(120)
+	p.SetStep(1, 2, true)
+	p.ToggleStep(1, 2)
+	p.SetStep(1, 9, true)
+
+	expected := []Change{
+		{Kind: ChangeTempo, Tempo: 120},
+		{Kind: ChangeStep, InstrumentID: 1, Step: 2, On: true},
+		{Kind: ChangeStep, InstrumentID: 1, Step: 2, On: false},
+	}
+	if len(changes) != len(expected) {
+		t.Fatalf("expected %d changes, got %v", len(expected), changes)
+	}
+	for i := range expected {
+		if changes[i] != expected[i] {
+			t.Errorf("change %d: got %+v, expected %+v", i, changes[i], expected[i])
+		}
+	}
+
+	p.OnChange(nil)
+	p.SetTempo(90)
+	if len(changes) != len(expected) {
+		t.Errorf("observer was called after being removed")
+	}
+}
+
+func TestSetSteps(t *testing.T) {
+
+	p := Pattern{instruments: []Instrument{
+		{num: 2, name: "clap", measure: []Step{{1, 1, 1, 1}, {0, 0, 0, 0}}},
+	}}
+
+	steps := []bool{true, false, false, true, false, true, false, false}
+	if err := p.SetSteps(2, steps); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got := gridString(p.instruments[0].steps()); got != "x--x-x--" {
+		t.Errorf("got %s, expected x--x-x--", got)
+	}
+
+	if err := p.SetSteps(2, steps[:4]); err == nil {
+		t.Errorf("expected an error setting the wrong number of steps")
+	}
+	if err := p.SetSteps(9, steps); err == nil {
+		t.Errorf("expected an error setting steps on an unknown instrument")
+	}
+}
+
+func TestRemoveEmptyInstruments(t *testing.T) {
+
+	p := Pattern{instruments: []Instrument{
+		{num: 0, name: "SubKick", measure: []Step{{0, 0, 0, 0}}},
+		{num: 1, name: "Kick", measure: []Step{{1, 0, 0, 0}}},
+		{num: 2, name: "ghost", measure: []Step{{0, 0, 0, 0}}},
+		{num: 3, name: "Maracas", measure: []Step{{1, 0, 1, 0}}},
+		{num: 4, name: "empty"},
+	}}
+
+	if n := p.RemoveEmptyInstruments(); n != 3 {
+		t.Fatalf("expected 3 instruments removed, got %d", n)
+	}
+	if len(p.instruments) != 2 || p.instruments[0].name != "Kick" || p.instruments[1].name != "Maracas" {
+		t.Errorf("unexpected instruments left %v", p.instruments)
+	}
+	if n := p.RemoveEmptyInstruments(); n != 0 {
+		t.Errorf("expected nothing left to remove, removed %d", n)
+	}
+}
+
+func TestReorderByNames(t *testing.T) {
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_1.splice - %v", err)
+	}
+	copied := *decoded
+
+	var moved []uint32
+	decoded.OnChange(func(c Change) {
+		if c.Kind == ChangeInstrumentMoved {
+			moved = append(moved, c.InstrumentID)
+		}
+	})
+
+	decoded.ReorderByNames([]string{"cowbell", "tambourine", "kick", "cowbell", "hh-close"})
+
+	var order []uint32
+	for _, inst := range decoded.instruments {
+		order = append(order, inst.num)
+	}
+	if expected := []uint32{5, 0, 4, 1, 2, 3}; !reflect.DeepEqual(order, expected) {
+		t.Errorf("got order %v, expected %v", order, expected)
+	}
+	if !reflect.DeepEqual(moved, order) {
+		t.Errorf("expected moves of %v, got %v", order, moved)
+	}
+	if copied.instruments[0].num != 0 {
+		t.Errorf("reordering changed the order of a copy of the pattern")
+	}
+
+	moved = nil
+	decoded.ReorderByNames([]string{"kick", "cowbell"})
+	if expected := []uint32{0, 5}; !reflect.DeepEqual(moved, expected) {
+		t.Errorf("expected moves of %v, got %v", expected, moved)
+	}
+}
+
+func TestInstrumentEdits(t *testing.T) {
+
+	f, err := os.Open(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	p, err := DecodeWithOptions(f, DecodeOptions{KeepRaw: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	copied := p
+
+	var changes []Change
+	p.OnChange(func(c Change) { changes = append(changes, c) })
+
+	if err := p.RemoveInstrument(2); err != nil {
+		t.Fatalf("remove: unexpected error %v", err)
+	}
+	if err := p.RenameInstrument(0, "bass drum"); err != nil {
+		t.Fatalf("rename: unexpected error %v", err)
+	}
+	if err := p.MoveInstrument(4, 0); err != nil {
+		t.Fatalf("move: unexpected error %v", err)
+	}
+	id, err := p.DuplicateInstrument(1)
+	if err != nil {
+		t.Fatalf("duplicate: unexpected error %v", err)
+	}
+	if id != 6 {
+		t.Errorf("expected the copy to get id 6, got %d", id)
+	}
+
+	var order []string
+	for _, inst := range p.instruments {
+		order = append(order, fmt.Sprintf("%d %s", inst.num, inst.name))
+	}
+	expected := []string{"5 cowbell", "0 bass drum", "1 snare", "6 snare", "3 hh-open", "4 hh-close"}
+	if !reflect.DeepEqual(order, expected) {
+		t.Errorf("got instruments %v, expected %v", order, expected)
+	}
+	if copied.instruments[0].num != 0 || len(copied.instruments) != 6 || copied.instruments[2].num != 2 {
+		t.Errorf("editing changed the instruments of a copy of the pattern")
+	}
+
+	kinds := []ChangeKind{ChangeInstrumentRemoved, ChangeInstrumentRenamed, ChangeInstrumentMoved, ChangeInstrumentAdded}
+	if len(changes) != len(kinds) {
+		t.Fatalf("expected %d changes, got %v", len(kinds), changes)
+	}
+	for i, kind := range kinds {
+		if changes[i].Kind != kind {
+			t.Errorf("change %d: got kind %d, expected %d", i, changes[i].Kind, kind)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := p.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	reread, err := Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reread.Equal(p) {
+		t.Errorf("re-encoding lost the edits, got\n%s", reread)
+	}
+
+	for name, err := range map[string]error{
+		"remove missing":    p.RemoveInstrument(99),
+		"rename missing":    p.RenameInstrument(99, "x"),
+		"rename too long":   p.RenameInstrument(1, strings.Repeat("x", 1<<16)),
+		"move out of range": p.MoveInstrument(0, 6),
+		"move negative":     p.MoveInstrument(-1, 0),
+	} {
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := p.DuplicateInstrument(99); err == nil {
+		t.Errorf("duplicate missing: expected an error")
+	}
+}
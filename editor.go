@@ -0,0 +1,295 @@
+package drum
+
+import "fmt"
+
+// Edit is one reversible mutation recorded by a PatternEditor. Kind is
+// ChangeStep, ChangeTempo, ChangeInstrumentAdded or ChangeInstrumentRemoved.
+// A step edit holds the step byte Before and After it, StepOff, StepOn or
+// a velocity, a tempo edit the tempo From and To, and an instrument edit the
+// Index the instrument was added at or removed from, with its Name and
+// step bytes.
+type Edit struct {
+	Kind         ChangeKind `json:"kind"`
+	InstrumentID uint32     `json:"id"`
+	Step         int        `json:"step,omitempty"`
+	Before       byte       `json:"before,omitempty"`
+	After        byte       `json:"after,omitempty"`
+	From         float32    `json:"from,omitempty"`
+	To           float32    `json:"to,omitempty"`
+	Index        int        `json:"index,omitempty"`
+	Name         string     `json:"name,omitempty"`
+	Steps        []byte     `json:"steps,omitempty"`
+	// inst is the whole instrument added or removed, with its Expression
+	// and playback state, for as long as the history isn't serialized
+	inst *Instrument
+}
+
+// History is a PatternEditor's edits, oldest first: those Undo undoes, the
+// last of them first, and those Redo redoes, the last of them first. It
+// serializes as JSON, so an editor's history can be saved with its
+// pattern and restored with SetHistory.
+type History struct {
+	Undo []Edit `json:"undo"`
+	Redo []Edit `json:"redo"`
+}
+
+// PatternEditor edits a pattern, recording each edit so that it can be
+// undone with Undo and redone with Redo. Making an edit after undoing
+// others drops them from the redo history. Edits made to the pattern
+// other than through the editor aren't recorded, and can leave the
+// history unable to undo or redo past them. A PatternEditor isn't safe
+// for concurrent use.
+type PatternEditor struct {
+	p    *Pattern
+	undo []Edit
+	redo []Edit
+}
+
+// NewPatternEditor returns an editor with an empty history for p, which it
+// edits in place, so the pattern's OnChange function is told of every edit,
+// undo and redo
+func NewPatternEditor(p *Pattern) *PatternEditor {
+
+	return &PatternEditor{p: p}
+}
+
+// Pattern returns the pattern being edited
+func (e *PatternEditor) Pattern() *Pattern {
+
+	return e.p
+}
+
+// SetStep turns a step of the instrument with the given id on or off, as
+// Pattern.SetStep does. Setting a step to the byte it already holds isn't
+// recorded.
+func (e *PatternEditor) SetStep(id uint32, step int, on bool) error {
+
+	i := e.p.instrumentIndex(id)
+	if i < 0 {
+		return fmt.Errorf("no instrument with id %d", id)
+	}
+	before, err := e.p.instruments[i].step(step)
+	if err != nil {
+		return err
+	}
+
+	after := StepOff
+	if on {
+		after = StepOn
+	}
+	if before == after {
+		return nil
+	}
+	return e.do(Edit{Kind: ChangeStep, InstrumentID: id, Step: step, Before: before, After: after})
+}
+
+// ToggleStep flips a step of the instrument with the given id, as
+// Pattern.ToggleStep does
+func (e *PatternEditor) ToggleStep(id uint32, step int) error {
+
+	i := e.p.instrumentIndex(id)
+	if i < 0 {
+		return fmt.Errorf("no instrument with id %d", id)
+	}
+	value, err := e.p.instruments[i].step(step)
+	if err != nil {
+		return err
+	}
+	return e.SetStep(id, step, !isOn(value))
+}
+
+// SetTempo sets the pattern's tempo, as Pattern.SetTempo does. Setting
+// the tempo it already has isn't recorded.
+func (e *PatternEditor) SetTempo(bpm float32) {
+
+	if bpm == e.p.tempo {
+		return
+	}
+	e.do(Edit{Kind: ChangeTempo, From: e.p.tempo, To: bpm})
+}
+
+// AddInstrument appends a silent instrument with the given id and name, as
+// Pattern.AddInstrument does
+func (e *PatternEditor) AddInstrument(id uint32, name string) {
+
+	e.p.AddInstrument(id, name)
+	e.record(instrumentEdit(ChangeInstrumentAdded, len(e.p.instruments)-1, e.p.instruments[len(e.p.instruments)-1]))
+}
+
+// RemoveInstrument removes the first instrument with the given id, as
+// Pattern.RemoveInstrument does. Undoing it puts the instrument back where
+// it was, as it was.
+func (e *PatternEditor) RemoveInstrument(id uint32) error {
+
+	i := e.p.instrumentIndex(id)
+	if i < 0 {
+		return fmt.Errorf("no instrument with id %d", id)
+	}
+	return e.do(instrumentEdit(ChangeInstrumentRemoved, i, e.p.instruments[i]))
+}
+
+// CanUndo reports whether there's an edit to undo
+func (e *PatternEditor) CanUndo() bool {
+
+	return len(e.undo) > 0
+}
+
+// CanRedo reports whether there's an undone edit to redo
+func (e *PatternEditor) CanRedo() bool {
+
+	return len(e.redo) > 0
+}
+
+// Undo reverses the last edit that hasn't been undone. It returns an error
+// wrapping ErrNoHistory if there's none, and an error leaving the history
+// unchanged if the pattern no longer holds what the edit changed.
+func (e *PatternEditor) Undo() error {
+
+	if len(e.undo) == 0 {
+		return fmt.Errorf("%w: nothing to undo", ErrNoHistory)
+	}
+	edit := e.undo[len(e.undo)-1]
+	if err := e.apply(edit, false); err != nil {
+		return fmt.Errorf("undoing: %w", err)
+	}
+	e.undo = e.undo[:len(e.undo)-1]
+	e.redo = append(e.redo, edit)
+	return nil
+}
+
+// Redo makes the last edit undone again, returning errors as Undo does
+func (e *PatternEditor) Redo() error {
+
+	if len(e.redo) == 0 {
+		return fmt.Errorf("%w: nothing to redo", ErrNoHistory)
+	}
+	edit := e.redo[len(e.redo)-1]
+	if err := e.apply(edit, true); err != nil {
+		return fmt.Errorf("redoing: %w", err)
+	}
+	e.redo = e.redo[:len(e.redo)-1]
+	e.undo = append(e.undo, edit)
+	return nil
+}
+
+// History returns a copy of the editor's history
+func (e *PatternEditor) History() History {
+
+	return History{Undo: cloneEdits(e.undo), Redo: cloneEdits(e.redo)}
+}
+
+// SetHistory replaces the editor's history with a copy of h, such as one
+// saved from History along with the pattern as it was. Undone instruments
+// are restored from the Name and Steps of their edits.
+func (e *PatternEditor) SetHistory(h History) {
+
+	e.undo, e.redo = cloneEdits(h.Undo), cloneEdits(h.Redo)
+}
+
+// do makes edit and records it
+func (e *PatternEditor) do(edit Edit) error {
+
+	if err := e.apply(edit, true); err != nil {
+		return err
+	}
+	e.record(edit)
+	return nil
+}
+
+// record adds edit to the undo history, dropping the redo history
+func (e *PatternEditor) record(edit Edit) {
+
+	e.undo = append(e.undo, edit)
+	e.redo = nil
+}
+
+// apply makes edit, or reverses it if forward is false
+func (e *PatternEditor) apply(edit Edit, forward bool) error {
+
+	p := e.p
+	switch edit.Kind {
+	case ChangeStep:
+		i := p.instrumentIndex(edit.InstrumentID)
+		if i < 0 {
+			return fmt.Errorf("no instrument with id %d", edit.InstrumentID)
+		}
+		value := edit.After
+		if !forward {
+			value = edit.Before
+		}
+		if err := p.instruments[i].setStep(edit.Step, value); err != nil {
+			return err
+		}
+		p.notify(Change{Kind: ChangeStep, InstrumentID: edit.InstrumentID, Step: edit.Step, On: isOn(value)})
+
+	case ChangeTempo:
+		if forward {
+			p.SetTempo(edit.To)
+		} else {
+			p.SetTempo(edit.From)
+		}
+
+	case ChangeInstrumentAdded, ChangeInstrumentRemoved:
+		if (edit.Kind == ChangeInstrumentAdded) == forward {
+			return e.insert(edit)
+		}
+		return e.remove(edit)
+
+	default:
+		return fmt.Errorf("cannot apply a change of kind %d", edit.Kind)
+	}
+	return nil
+}
+
+// insert puts the instrument of an instrument edit back at its index
+func (e *PatternEditor) insert(edit Edit) error {
+
+	p := e.p
+	if edit.Index < 0 || edit.Index > len(p.instruments) {
+		return fmt.Errorf("cannot insert instrument %d at %d in a pattern of %d", edit.InstrumentID, edit.Index, len(p.instruments))
+	}
+
+	var inst Instrument
+	if edit.inst != nil {
+		inst = edit.inst.clone()
+	} else {
+		inst = Instrument{num: edit.InstrumentID, name: edit.Name}
+		inst.setSteps(edit.Steps)
+	}
+
+	p.instruments = append(p.instruments[:edit.Index:edit.Index], append([]Instrument{inst}, p.instruments[edit.Index:]...)...)
+	p.notify(Change{Kind: ChangeInstrumentAdded, InstrumentID: edit.InstrumentID})
+	return nil
+}
+
+// remove takes the instrument of an instrument edit out from its index
+func (e *PatternEditor) remove(edit Edit) error {
+
+	p := e.p
+	if edit.Index < 0 || edit.Index >= len(p.instruments) || p.instruments[edit.Index].num != edit.InstrumentID {
+		return fmt.Errorf("no instrument with id %d at %d", edit.InstrumentID, edit.Index)
+	}
+
+	p.instruments = append(p.instruments[:edit.Index:edit.Index], p.instruments[edit.Index+1:]...)
+	p.notify(Change{Kind: ChangeInstrumentRemoved, InstrumentID: edit.InstrumentID})
+	return nil
+}
+
+// instrumentEdit returns the edit of the given kind adding or removing
+// inst at index
+func instrumentEdit(kind ChangeKind, index int, inst Instrument) Edit {
+
+	clone := inst.clone()
+	return Edit{Kind: kind, InstrumentID: inst.num, Index: index, Name: inst.name, Steps: inst.steps(), inst: &clone}
+}
+
+// cloneEdits returns a copy of edits whose step bytes share no memory with
+// them
+func cloneEdits(edits []Edit) []Edit {
+
+	clone := append([]Edit(nil), edits...)
+	for n := range clone {
+		clone[n].Steps = cloneBytes(clone[n].Steps)
+	}
+	return clone
+}
@@ -0,0 +1,94 @@
+package drum
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestPatternEditor(t *testing.T) {
+
+	p := NewPattern("editor", 120)
+	p.AddInstrument(0, "kick").SetSteps("x-------x-------")
+	p.AddInstrument(1, "snare").SetSteps("----x-------x---")
+	p.instruments[1].setStep(4, 0x40)
+	p.SetMuted(1, true)
+	original := p.String()
+
+	var changes []Change
+	p.OnChange(func(c Change) { changes = append(changes, c) })
+
+	e := NewPatternEditor(p)
+	if err := e.Undo(); !errors.Is(err, ErrNoHistory) {
+		t.Errorf("expected %v undoing nothing, got %v", ErrNoHistory, err)
+	}
+
+	e.SetStep(0, 2, true)
+	e.SetStep(0, 0, true) // already on, so not recorded
+	e.ToggleStep(1, 4)
+	e.SetTempo(98.5)
+	e.AddInstrument(7, "cowbell")
+	e.SetStep(7, 15, true)
+	if err := e.RemoveInstrument(1); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := e.SetStep(9, 0, true); err == nil {
+		t.Errorf("expected an error for a missing instrument")
+	}
+	if len(e.History().Undo) != 6 || len(changes) != 6 {
+		t.Fatalf("expected 6 edits and changes, got %d and %d", len(e.History().Undo), len(changes))
+	}
+	edited := p.String()
+
+	for e.CanUndo() {
+		if err := e.Undo(); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	if p.String() != original {
+		t.Errorf("undoing everything gave\n%s\nexpected\n%s", p, original)
+	}
+	if step, _ := p.instruments[1].step(4); step != 0x40 || !p.instruments[1].muted {
+		t.Errorf("expected the snare back as it was, with step %#x and muted %v", step, p.instruments[1].muted)
+	}
+	if changes[len(changes)-1].Kind != ChangeStep || changes[len(changes)-1].InstrumentID != 0 {
+		t.Errorf("expected undoing to notify the changes, ending with %+v", changes[len(changes)-1])
+	}
+
+	// the history survives being serialized, and redoes the edits from it
+	data, err := json.Marshal(e.History())
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var h History
+	if err := json.Unmarshal(data, &h); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	e = NewPatternEditor(p)
+	e.SetHistory(h)
+	for e.CanRedo() {
+		if err := e.Redo(); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	if p.String() != edited {
+		t.Errorf("redoing everything gave\n%s\nexpected\n%s", p, edited)
+	}
+
+	// a new edit drops what could have been redone
+	e.Undo()
+	e.Undo()
+	e.SetTempo(120)
+	if e.CanRedo() {
+		t.Errorf("expected nothing to redo after a new edit")
+	}
+
+	// edits that no longer match the pattern fail, keeping the history
+	p.RemoveInstrument(7)
+	if err := e.Undo(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := e.Undo(); err == nil || !e.CanUndo() {
+		t.Errorf("expected an error undoing the cowbell's addition, got %v", err)
+	}
+}
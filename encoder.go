@@ -0,0 +1,255 @@
+package drum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// versionSize is the number of bytes the version string is padded to
+const versionSize = 32
+
+// Encode writes the pattern to w in the .splice format: the header, the
+// payload length, the version, the tempo and then each instrument's id,
+// name and steps. The tempo and steps are stored and laid out the way they
+// were decoded. A pattern that was decoded keeps its original header bytes;
+// one built from scratch gets the plain SPLICE magic. Every instrument must
+// hold the same number of steps, which the format doesn't record, so a
+// pattern of other than 16 steps has to be decoded with that count in
+// DecodeOptions.StepsPerInstrument. Instruments muted, soloed or given a
+// gain are recorded in a chunk after the payload, which decoders that stop
+// at the payload's length skip. Of each step's Expression only the ratchet
+// and flam are recorded, likewise in a chunk; its velocity and offset are
+// dropped, so velocities to keep have to be set with SetVelocity.
+//
+// Neither the payload nor a name has to fit in a byte. With the original
+// one byte length field, the length of a payload over 255 bytes runs on
+// back into the last two header bytes as a big-endian number, which is how
+// files that treat the header's last eight bytes as a big-endian length
+// store it, for payloads of up to 16MiB. A name of 255 bytes or more has a
+// length byte of 255 followed by its length as a uvarint. Short payloads
+// and names are written exactly as before.
+func (p Pattern) Encode(w io.Writer) error {
+
+	if _, err := p.EncodedSize(); err != nil {
+		return err
+	}
+
+	payload := p.payload()
+	extension, err := p.extension()
+	if err != nil {
+		return err
+	}
+
+	header := p.header
+	if len(header) != headerSize {
+		header = make([]byte, headerSize)
+		copy(header, spliceMagic)
+	}
+
+	header, length := putPayloadLength(header, uint64(len(payload)), p.lengthFieldSize(), p.order())
+
+	var buf bytes.Buffer
+	buf.Write(header)
+	buf.Write(length)
+	buf.Write(payload)
+	buf.Write(extension)
+
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// EncodeFile writes the pattern to a .splice file at path, replacing any
+// file already there. Nothing is written if the pattern can't be encoded,
+// and the file is replaced atomically, as EncodeFileWithOptions does.
+func EncodeFile(p Pattern, path string) error {
+
+	return EncodeFileWithOptions(p, path, EncodeOptions{})
+}
+
+// EncodeOptions adjusts how EncodeFileWithOptions writes a file. The zero
+// value writes the same way EncodeFile does.
+type EncodeOptions struct {
+	// Backup keeps up to this many earlier versions of the file, the
+	// latest at BackupPath(path, 1), each write moving the older ones
+	// along and dropping the oldest. Zero or less keeps none.
+	Backup int
+	// Format is the format to write the file in, as EncodeFormat writes
+	// it. The zero value is FormatSplice.
+	Format Format
+}
+
+// EncodeFileWithOptions writes the pattern to a file at path like
+// EncodeFile, in the format and keeping the backups opts asks for. The
+// pattern is written to a temporary file in the same directory, which is
+// then renamed over path, so path always holds either the old pattern or
+// the whole of the new one, even if writing fails part way or the machine
+// crashes. A file already at path keeps its permissions.
+func EncodeFileWithOptions(p Pattern, path string, opts EncodeOptions) error {
+
+	if opts.Format == FormatSplice {
+		if _, err := p.EncodedSize(); err != nil {
+			return err
+		}
+	}
+	return writeFileAtomic(path, opts.Backup, func(w io.Writer) error {
+		return EncodeFormat(w, p, opts.Format)
+	})
+}
+
+// EncodedSize returns the number of bytes Encode would write for the pattern
+// without encoding it, or the error Encode would return.
+func (p Pattern) EncodedSize() (int, error) {
+
+	if len(p.version) > p.versionFieldSize() {
+		return 0, fmt.Errorf("%w: %q is longer than %d bytes", ErrVersionTooLong, p.version, p.versionFieldSize())
+	}
+
+	steps := measuresPerInstrument * stepsPerMeasure
+	if len(p.instruments) > 0 {
+		steps = p.loopSteps()
+	}
+
+	stepsSize, err := p.packing.stepsSize(steps)
+	if err != nil {
+		return 0, err
+	}
+
+	tempo, err := p.tempoFormat.encode(p.tempo, p.order())
+	if err != nil {
+		return 0, err
+	}
+
+	size := p.versionFieldSize() + len(tempo)
+
+	for _, inst := range p.instruments {
+		if len(inst.name) > maxNameSize {
+			return 0, fmt.Errorf("%w: instrument %d name is %d bytes, the most is %d", ErrNameTooLong, inst.num, len(inst.name), maxNameSize)
+		}
+
+		if inst.stepCount() == 0 {
+			return 0, fmt.Errorf("%w: instrument %d has no steps", ErrInvalidStep, inst.num)
+		}
+
+		size += 4 + nameLengthSize(len(inst.name)) + len(inst.name) + stepsSize
+	}
+
+	lengthSize := p.lengthFieldSize()
+	if max := maxPayloadLength(lengthSize); uint64(size) > max {
+		return 0, fmt.Errorf("%w: payload is %d bytes, the most a %d byte length can declare is %d",
+			ErrPayloadTooLarge, size, lengthSize, max)
+	}
+
+	extension, err := p.extension()
+	if err != nil {
+		return 0, err
+	}
+	return headerSize + lengthSize + size + len(extension), nil
+}
+
+// lengthFieldSize returns the width of the payload length to encode, the
+// width the pattern was decoded with or 1 for a pattern built from scratch.
+func (p Pattern) lengthFieldSize() int {
+
+	if p.lengthSize == 0 {
+		return 1
+	}
+	return p.lengthSize
+}
+
+// order returns the byte order to encode numbers in, the order the pattern
+// was decoded with or little-endian for a pattern built from scratch
+func (p Pattern) order() binary.ByteOrder {
+
+	if p.byteOrder == nil {
+		return binary.LittleEndian
+	}
+	return p.byteOrder
+}
+
+// versionFieldSize returns the width of the version field to encode, the
+// width the pattern was decoded with or 32 for a pattern built from scratch
+func (p Pattern) versionFieldSize() int {
+
+	if p.versionSize == 0 {
+		return versionSize
+	}
+	return p.versionSize
+}
+
+// payload returns the bytes that follow the payload length: the version,
+// tempo and instrument records. The pattern must already have passed the
+// checks in EncodedSize.
+func (p Pattern) payload() []byte {
+
+	var buf bytes.Buffer
+
+	version := make([]byte, p.versionFieldSize())
+	copy(version, p.version)
+	buf.Write(version)
+
+	// write back the exact tempo bytes that were decoded, if the tempo hasn't
+	// been set since, so that round trips are byte for byte
+	if size, _ := p.tempoFormat.size(); len(p.tempoBin) == size {
+		buf.Write(p.tempoBin)
+	} else {
+		tempo, _ := p.tempoFormat.encode(p.tempo, p.order())
+		buf.Write(tempo)
+	}
+
+	if p.layout == LayoutColumnMajor {
+		p.writeColumns(&buf)
+		return buf.Bytes()
+	}
+
+	for _, inst := range p.instruments {
+		// an instrument decoded with KeepRaw that hasn't been changed since
+		// is written back exactly as it was read
+		if len(inst.raw) > 0 {
+			buf.Write(inst.raw)
+			continue
+		}
+
+		binary.Write(&buf, p.order(), inst.num)
+		writeNameLength(&buf, len(inst.name))
+		buf.WriteString(inst.name)
+
+		buf.Write(p.packing.packSteps(inst.cycled(p.loopSteps())))
+	}
+	return buf.Bytes()
+}
+
+// writeColumns writes the instruments in LayoutColumnMajor: every id and
+// name, then the steps interleaved step by step across instruments
+func (p Pattern) writeColumns(buf *bytes.Buffer) {
+
+	steps := make([][]byte, len(p.instruments))
+
+	for n, inst := range p.instruments {
+		binary.Write(buf, p.order(), inst.num)
+		writeNameLength(buf, len(inst.name))
+		buf.WriteString(inst.name)
+		steps[n] = inst.cycled(p.loopSteps())
+	}
+
+	for s := 0; len(steps) > 0 && s < len(steps[0]); s++ {
+		for n := range steps {
+			buf.WriteByte(steps[n][s])
+		}
+	}
+}
+
+// EncodeAll writes each pattern to w back to back, every one with its own
+// header and payload length, so the stream can be read back with DecodeAll.
+// Nothing is written for a pattern that fails to encode, and the patterns
+// after it are skipped.
+func EncodeAll(w io.Writer, patterns []Pattern) error {
+
+	for i, p := range patterns {
+		if err := p.Encode(w); err != nil {
+			return fmt.Errorf("encoding pattern %d: %w", i, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package drum
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestEncodeRoundTrip(t *testing.T) {
+
+	for _, name := range []string{"pattern_1.splice", "pattern_2.splice", "pattern_3.splice", "pattern_4.splice", "header_bytes.splice"} {
+
+		fixturePath := path.Join("fixtures", name)
+		decoded, err := DecodeFile(fixturePath)
+		if err != nil {
+			t.Fatalf("something went wrong decoding %s - %v", name, err)
+		}
+
+		var buf bytes.Buffer
+		if err := decoded.Encode(&buf); err != nil {
+			t.Fatalf("something went wrong encoding %s - %v", name, err)
+		}
+
+		original, err := ioutil.ReadFile(fixturePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), original) {
+			t.Errorf("%s wasn't re-encoded byte for byte.\nGot:\n%x\nExpected:\n%x", name, buf.Bytes(), original)
+		}
+	}
+}
+
+func TestEncodeAll(t *testing.T) {
+
+	var patterns []Pattern
+	for _, name := range []string{"pattern_1.splice", "pattern_2.splice", "pattern_5.splice"} {
+		decoded, err := DecodeFile(path.Join("fixtures", name))
+		if err != nil {
+			t.Fatalf("something went wrong decoding %s - %v", name, err)
+		}
+		patterns = append(patterns, *decoded)
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeAll(&buf, patterns); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	decoded, err := DecodeAll(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(decoded) != len(patterns) {
+		t.Fatalf("expected %d patterns, got %d", len(patterns), len(decoded))
+	}
+	for i := range patterns {
+		if fmt.Sprint(decoded[i]) != fmt.Sprint(patterns[i]) {
+			t.Errorf("pattern %d changed.\nGot:\n%s\nExpected:\n%s", i, decoded[i], patterns[i])
+		}
+	}
+}
+
+func TestEncodeInvalid(t *testing.T) {
+
+	long := Pattern{version: "this version string is far too long to fit"}
+	if err := long.Encode(ioutil.Discard); err == nil {
+		t.Errorf("expected an error encoding a version over 32 bytes")
+	}
+
+	empty := Pattern{instruments: []Instrument{{num: 0, name: "kick"}}}
+	if err := empty.Encode(ioutil.Discard); err == nil {
+		t.Errorf("expected an error encoding an instrument without steps")
+	}
+}
+
+func TestEncodedSize(t *testing.T) {
+
+	for _, name := range []string{"pattern_1.splice", "pattern_4.splice", "pattern_5.splice"} {
+
+		decoded, err := DecodeFile(path.Join("fixtures", name))
+		if err != nil {
+			t.Fatalf("something went wrong decoding %s - %v", name, err)
+		}
+
+		size, err := decoded.EncodedSize()
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", name, err)
+		}
+
+		var buf bytes.Buffer
+		if err := decoded.Encode(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if size != buf.Len() {
+			t.Errorf("%s: EncodedSize returned %d, Encode wrote %d bytes", name, size, buf.Len())
+		}
+	}
+
+	if _, err := (Pattern{version: "this version string is far too long to fit"}).EncodedSize(); err == nil {
+		t.Errorf("expected an error sizing a version over 32 bytes")
+	}
+}
+
+func TestEncodePreservesTempoBytes(t *testing.T) {
+
+	// a signalling NaN, whose payload bits a float32 conversion may not keep
+	tempoBin := []byte{0x01, 0x00, 0x80, 0x7f}
+
+	payload := make([]byte, versionSize)
+	copy(payload, "0.808-alpha")
+	payload = append(payload, tempoBin...)
+
+	data := append([]byte("SPLICE\x00\x00\x00\x00\x00\x00\x00"), byte(len(payload)))
+	data = append(data, payload...)
+
+	p, err := DecodeWithOptions(bytes.NewReader(data), DecodeOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := p.Encode(&buf); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got := buf.Bytes()[headerSize+1+versionSize:]; !bytes.Equal(got, tempoBin) {
+		t.Errorf("tempo bytes changed from %x to %x", tempoBin, got)
+	}
+
+	p.SetTempo(120)
+	buf.Reset()
+	if err := p.Encode(&buf); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got := buf.Bytes()[headerSize+1+versionSize:]; !bytes.Equal(got, []byte{0x00, 0x00, 0xf0, 0x42}) {
+		t.Errorf("expected SetTempo(120) to encode as 0000f042, got %x", got)
+	}
+}
+
+func TestEncodeFile(t *testing.T) {
+
+	for _, name := range []string{"pattern_1.splice", "pattern_4.splice"} {
+
+		fixturePath := path.Join("fixtures", name)
+		decoded, err := DecodeFile(fixturePath)
+		if err != nil {
+			t.Fatalf("something went wrong decoding %s - %v", name, err)
+		}
+
+		out := path.Join(t.TempDir(), name)
+		if err := EncodeFile(*decoded, out); err != nil {
+			t.Fatalf("something went wrong encoding %s - %v", name, err)
+		}
+
+		written, err := ioutil.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		original, err := ioutil.ReadFile(fixturePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(written, original) {
+			t.Errorf("%s wasn't written byte for byte.\nGot:\n%x\nExpected:\n%x", name, written, original)
+		}
+	}
+
+	out := path.Join(t.TempDir(), "invalid.splice")
+	p := Pattern{version: strings.Repeat("v", versionSize+1)}
+	if err := EncodeFile(p, out); !errors.Is(err, ErrVersionTooLong) {
+		t.Errorf("expected %v, got %v", ErrVersionTooLong, err)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("expected no file for a pattern that can't be encoded, got %v", err)
+	}
+}
+
+func TestEncodeFileBackup(t *testing.T) {
+
+	dir := t.TempDir()
+	out := path.Join(dir, "backup.splice")
+	p := NewPattern("0.808-alpha", 100)
+	p.AddInstrument(0, "kick").SetSteps("x---x---x---x---")
+
+	for tempo := float32(100); tempo <= 104; tempo++ {
+		p.SetTempo(tempo)
+		if err := EncodeFileWithOptions(*p, out, EncodeOptions{Backup: 3}); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		if tempo == 100 {
+			os.Chmod(out, 0600)
+		}
+	}
+
+	for n, expected := range map[string]float32{out: 104, BackupPath(out, 1): 103, BackupPath(out, 2): 102, BackupPath(out, 3): 101} {
+		if decoded, err := DecodeFile(n); err != nil || decoded.Tempo() != expected {
+			t.Errorf("%s: expected a tempo of %v, got %v and %v", n, expected, decoded.Tempo(), err)
+		}
+	}
+	if _, err := os.Stat(BackupPath(out, 4)); !os.IsNotExist(err) {
+		t.Errorf("expected only 3 backups, got %v", err)
+	}
+	if info, err := os.Stat(out); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("expected the file to keep its permissions, got %v and %v", info.Mode(), err)
+	}
+
+	// a write that fails leaves the file as it was, and nothing beside it
+	failed := errors.New("failed")
+	err := writeFileAtomic(out, 3, func(w io.Writer) error {
+
+		w.Write([]byte("SPLICE"))
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Errorf("expected %v, got %v", failed, err)
+	}
+	if decoded, err := DecodeFile(out); err != nil || decoded.Tempo() != 104 {
+		t.Errorf("expected the file unchanged, got %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 4 {
+		t.Errorf("expected the file and its 3 backups, got %d files", len(entries))
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if err := decoded.Encode(ioutil.Discard); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package drum
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Errors returned, usually wrapped with more context, when a pattern can't
+// be decoded or encoded. Test for them with errors.Is. Errors decoding a
+// pattern's bytes are also wrapped in a *DecodeError.
+var (
+	// ErrInvalidHeader means the data doesn't start with the SPLICE magic,
+	// so it isn't a .splice file at all.
+	ErrInvalidHeader = errors.New("invalid header")
+	// ErrUnsupportedVersion means a pattern's version isn't one of the
+	// DecodeOptions.Versions allowed.
+	ErrUnsupportedVersion = errors.New("unsupported version")
+	// ErrTruncated means the data ended before the pattern did.
+	ErrTruncated = errors.New("truncated pattern")
+	// ErrInvalidStep means a step index or step count doesn't fit the
+	// instrument or the format.
+	ErrInvalidStep = errors.New("invalid step")
+	// ErrInvalidName means an instrument name isn't valid UTF-8.
+	ErrInvalidName = errors.New("invalid instrument name")
+	// ErrNameTooLong means an instrument name won't fit its length.
+	ErrNameTooLong = errors.New("instrument name too long")
+	// ErrVersionTooLong means the version won't fit the version field.
+	ErrVersionTooLong = errors.New("version too long")
+	// ErrPayloadTooLarge means the pattern won't fit the payload length.
+	ErrPayloadTooLarge = errors.New("payload too large")
+	// ErrDuplicateID means two instruments share an id.
+	ErrDuplicateID = errors.New("duplicate instrument id")
+	// ErrTooManyInstruments means a pattern holds more instruments than
+	// DecodeOptions allow.
+	ErrTooManyInstruments = errors.New("too many instruments")
+	// ErrTruncatedInstrument means the payload ended part way through an
+	// instrument record. It wraps ErrTruncated.
+	ErrTruncatedInstrument = fmt.Errorf("%w: instrument cut short", ErrTruncated)
+	// ErrInvalidNameLength means an instrument's name length runs past the
+	// end of the payload.
+	ErrInvalidNameLength = errors.New("invalid instrument name length")
+	// ErrInvalidMIDI means data given to FromMIDI isn't a Standard MIDI
+	// File it can read.
+	ErrInvalidMIDI = errors.New("invalid MIDI file")
+	// ErrInvalidHydrogen means data given to ReadHydrogen isn't a Hydrogen
+	// song it can read.
+	ErrInvalidHydrogen = errors.New("invalid Hydrogen song")
+	// ErrTrailingData means bytes follow the payload of a pattern decoded
+	// with DecodeOptions.Strict.
+	ErrTrailingData = errors.New("trailing data after the payload")
+	// ErrInvalidSong means a Song's chain is empty or names a pattern the
+	// song doesn't hold, or song data doesn't start with the song magic.
+	ErrInvalidSong = errors.New("invalid song")
+	// ErrInvalidMeta means a pattern's metadata isn't JSON, or has a rating
+	// out of range or an empty tag.
+	ErrInvalidMeta = errors.New("invalid pattern metadata")
+	// ErrNoHistory means a PatternEditor has no edit to undo or redo.
+	ErrNoHistory = errors.New("no edit history")
+	// ErrUnknownFormat means DecodeAny can't tell what format its input is
+	// in, or a format named isn't one there is.
+	ErrUnknownFormat = errors.New("unknown pattern format")
+)
+
+// DecodeError reports where in its bytes a pattern couldn't be decoded: the
+// byte offset from the start of the pattern and the field found there. It
+// wraps the error describing what was wrong, such as ErrInvalidHeader for
+// data that isn't a .splice file or ErrTruncated for one that's cut short,
+// so errors.Is sees through it. Every error decoding a pattern's bytes is a
+// DecodeError, while errors reading them, such as I/O failures, and errors
+// in DecodeOptions aren't.
+type DecodeError struct {
+	Offset int64
+	Field  string
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+
+	return fmt.Sprintf("%s at byte %d: %v", e.Field, e.Offset, e.Err)
+}
+
+// Unwrap returns the error describing what was wrong
+func (e *DecodeError) Unwrap() error {
+
+	return e.Err
+}
+
+// decodeError returns a *DecodeError for the field at offset
+func decodeError(offset int, field string, err error) error {
+
+	return &DecodeError{Offset: int64(offset), Field: field, Err: err}
+}
+
+// readError wraps an error from reading the field of a pattern at offset,
+// returning a *DecodeError wrapping ErrTruncated when the data ran out.
+func readError(offset int, field string, err error) error {
+
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return decodeError(offset, field, fmt.Errorf("%w: %w", ErrTruncated, err))
+	}
+	return fmt.Errorf("reading %s: %w", field, err)
+}
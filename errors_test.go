@@ -0,0 +1,188 @@
+package drum
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestDecodeErrors(t *testing.T) {
+
+	valid, err := ioutil.ReadFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tData := []struct {
+		name     string
+		data     []byte
+		opts     DecodeOptions
+		expected error
+	}{
+		{"empty", nil, DecodeOptions{}, ErrTruncated},
+		{"bad magic", append([]byte("SPLISH"), valid[6:]...), DecodeOptions{}, ErrInvalidHeader},
+		{"short header", valid[:8], DecodeOptions{}, ErrTruncated},
+		{"short payload", valid[:100], DecodeOptions{}, ErrTruncated},
+		{"short version", append(append([]byte(nil), valid[:13]...), 4, '0', '.', '8', '0'), DecodeOptions{}, ErrTruncated},
+		{"short instrument", append(append([]byte(nil), valid[:13]...), append([]byte{60}, valid[14:74]...)...), DecodeOptions{}, ErrTruncated},
+		{"short steps", append(append([]byte(nil), valid[:13]...), append([]byte{60}, valid[14:74]...)...), DecodeOptions{}, ErrTruncatedInstrument},
+		{"short id", append(append([]byte(nil), valid[:13]...), append([]byte{38}, valid[14:52]...)...), DecodeOptions{}, ErrTruncatedInstrument},
+	}
+
+	for _, exp := range tData {
+		if _, err := DecodeWithOptions(bytes.NewReader(exp.data), exp.opts); !errors.Is(err, exp.expected) {
+			t.Errorf("%s: expected %v, got %v", exp.name, exp.expected, err)
+		}
+	}
+
+	// the name length byte of the first instrument claims more than is left
+	long := append(append([]byte(nil), valid[:13]...), append([]byte{45}, valid[14:59]...)...)
+	long[headerSize+1+versionSize+4+4] = 200
+
+	_, err = DecodeWithOptions(bytes.NewReader(long), DecodeOptions{})
+	if !errors.Is(err, ErrInvalidNameLength) || !strings.Contains(err.Error(), "at byte 54") {
+		t.Errorf("expected %v at byte 54, got %v", ErrInvalidNameLength, err)
+	}
+
+	fixtures := []struct {
+		path     string
+		opts     DecodeOptions
+		expected error
+	}{
+		{"truncated_tempo.splice", DecodeOptions{}, ErrTruncated},
+		{"name_high_bytes.splice", DecodeOptions{NameEncoding: NameRejectInvalid}, ErrInvalidName},
+		{"duplicate_ids.splice", DecodeOptions{RejectDuplicateIDs: true}, ErrDuplicateID},
+		{"many_instruments.splice", DecodeOptions{MaxInstruments: 2}, ErrTooManyInstruments},
+	}
+
+	for _, exp := range fixtures {
+
+		f, err := os.Open(path.Join("fixtures", exp.path))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = DecodeWithOptions(f, exp.opts)
+		f.Close()
+
+		if !errors.Is(err, exp.expected) {
+			t.Errorf("%s: expected %v, got %v", exp.path, exp.expected, err)
+		}
+	}
+
+	if err := CheckFile(path.Join("fixtures", "truncated_payload.splice")); !errors.Is(err, ErrTruncated) {
+		t.Errorf("CheckFile: expected %v, got %v", ErrTruncated, err)
+	}
+}
+
+func TestEncodeErrors(t *testing.T) {
+
+	steps := []Step{{1, 0, 0, 0}, {1, 0, 0, 0}, {1, 0, 0, 0}, {1, 0, 0, 0}}
+
+	// too much for a two byte length
+	var many []Instrument
+	for i := 0; i < 2; i++ {
+		many = append(many, Instrument{num: uint32(i), name: strings.Repeat("k", 40000), measure: steps})
+	}
+
+	tData := []struct {
+		name     string
+		p        Pattern
+		expected error
+	}{
+		{"long version", Pattern{version: strings.Repeat("9", 33)}, ErrVersionTooLong},
+		{"long name", Pattern{instruments: []Instrument{{name: strings.Repeat("k", 1<<16), measure: steps}}}, ErrNameTooLong},
+		{"no steps", Pattern{instruments: []Instrument{{name: "kick"}}}, ErrInvalidStep},
+		{"large payload", Pattern{lengthSize: 2, instruments: many}, ErrPayloadTooLarge},
+	}
+
+	for _, exp := range tData {
+		if err := exp.p.Encode(ioutil.Discard); !errors.Is(err, exp.expected) {
+			t.Errorf("%s: expected %v, got %v", exp.name, exp.expected, err)
+		}
+	}
+
+	p := Pattern{instruments: []Instrument{{num: 1, name: "kick", measure: steps}}}
+	if err := p.SetStep(1, 16, true); !errors.Is(err, ErrInvalidStep) {
+		t.Errorf("SetStep: expected %v, got %v", ErrInvalidStep, err)
+	}
+}
+
+// failingReader returns its data, then err
+type failingReader struct {
+	data []byte
+	err  error
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+
+	if len(r.data) == 0 {
+		return 0, r.err
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestDecodeErrorOffsets(t *testing.T) {
+
+	valid, err := ioutil.ReadFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trailing, err := ioutil.ReadFile(path.Join("fixtures", "pattern_5.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	long := append(append([]byte(nil), valid[:13]...), append([]byte{45}, valid[14:59]...)...)
+	long[headerSize+1+versionSize+4+4] = 200
+
+	tData := []struct {
+		name     string
+		data     []byte
+		opts     DecodeOptions
+		offset   int64
+		field    string
+		expected error
+	}{
+		{"not splice", append([]byte("RIFF"), valid[4:]...), DecodeOptions{}, 0, "header", ErrInvalidHeader},
+		{"empty", nil, DecodeOptions{}, 0, "header", ErrTruncated},
+		{"short payload", valid[:100], DecodeOptions{}, 14, "payload", ErrTruncated},
+		{"short version", append(append([]byte(nil), valid[:13]...), 4, '0', '.', '8', '0'), DecodeOptions{}, 14, "version", ErrTruncated},
+		{"version", valid, DecodeOptions{Versions: []string{"0.909"}}, 14, "version", ErrUnsupportedVersion},
+		{"short steps", append(append([]byte(nil), valid[:13]...), append([]byte{60}, valid[14:74]...)...), DecodeOptions{}, 59, "instrument steps", ErrTruncatedInstrument},
+		{"name length", long, DecodeOptions{}, 54, "instrument name length", ErrInvalidNameLength},
+		{"trailing", trailing, DecodeOptions{Strict: true}, int64(len(trailing) - 31), "payload", ErrTrailingData},
+	}
+
+	for _, exp := range tData {
+
+		_, err := DecodeWithOptions(bytes.NewReader(exp.data), exp.opts)
+
+		var de *DecodeError
+		if !errors.As(err, &de) {
+			t.Errorf("%s: expected a DecodeError, got %v", exp.name, err)
+			continue
+		}
+		if de.Offset != exp.offset || de.Field != exp.field || !errors.Is(err, exp.expected) {
+			t.Errorf("%s: expected %v in %s at byte %d, got %v", exp.name, exp.expected, exp.field, exp.offset, err)
+		}
+	}
+
+	if _, err := DecodeWithOptions(bytes.NewReader(valid), DecodeOptions{Versions: []string{"0.909", "0.808-alpha"}}); err != nil {
+		t.Errorf("unexpected error for an allowed version %v", err)
+	}
+
+	// failing to read isn't a decode error
+	failure := errors.New("disk on fire")
+	_, err = DecodeWithOptions(&failingReader{data: valid[:20], err: failure}, DecodeOptions{})
+	var de *DecodeError
+	if !errors.Is(err, failure) || errors.As(err, &de) {
+		t.Errorf("expected the read error alone, got %v", err)
+	}
+}
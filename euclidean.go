@@ -0,0 +1,119 @@
+package drum
+
+import "fmt"
+
+// SetEuclidean writes a Euclidean rhythm to the instrument with the given id,
+// spreading pulses hits as evenly as possible over steps positions using
+// Bjorklund's algorithm. The instrument is resized to steps if needed; its
+// first step is always a hit when pulses > 0.
+func (p *Pattern) SetEuclidean(id uint32, pulses, steps int) error {
+
+	if steps < 1 {
+		return fmt.Errorf("a euclidean rhythm needs at least one step, got %d", steps)
+	}
+	if pulses < 0 || pulses > steps {
+		return fmt.Errorf("cannot place %d pulses in %d steps", pulses, steps)
+	}
+
+	i := p.instrumentIndex(id)
+	if i < 0 {
+		return fmt.Errorf("no instrument with id %d", id)
+	}
+
+	p.instruments[i].setSteps(bjorklund(pulses, steps))
+	p.notify(Change{Kind: ChangeSteps, InstrumentID: id})
+	return nil
+}
+
+// bjorklund returns steps step bytes with pulses of them on, distributed
+// with Bjorklund's algorithm. It expects 0 <= pulses <= steps.
+func bjorklund(pulses, steps int) []byte {
+
+	// start with one group per step, hits first, then repeatedly pair the
+	// leading groups with the remainder groups until at most one remains
+	groups := make([][]byte, steps)
+	for i := range groups {
+		if i < pulses {
+			groups[i] = []byte{StepOn}
+		} else {
+			groups[i] = []byte{StepOff}
+		}
+	}
+
+	heads, rest := groups[:pulses], groups[pulses:]
+
+	for len(heads) > 0 && len(rest) > 1 {
+		n := len(heads)
+		if len(rest) < n {
+			n = len(rest)
+		}
+
+		merged := make([][]byte, n)
+		for i := 0; i < n; i++ {
+			merged[i] = append(append([]byte(nil), heads[i]...), rest[i]...)
+		}
+
+		if len(heads) > n {
+			rest = heads[n:]
+		} else {
+			rest = rest[n:]
+		}
+		heads = merged
+	}
+
+	result := make([]byte, 0, steps)
+	for _, group := range append(heads, rest...) {
+		result = append(result, group...)
+	}
+	return result
+}
+
+// GenerateEuclidean returns a Euclidean rhythm of pulses hits spread over
+// steps steps with Bjorklund's algorithm, grouped into measures as an
+// instrument's steps are. The rhythm is rotated right by rotation steps, so
+// its first hit falls on step rotation; a negative rotation rotates it left.
+// Pulses outside 0 to steps are clamped to that range, and a steps below 1
+// gives no measures.
+func GenerateEuclidean(pulses, steps int, rotation int) []Step {
+
+	if steps < 1 {
+		return nil
+	}
+	if pulses < 0 {
+		pulses = 0
+	}
+	if pulses > steps {
+		pulses = steps
+	}
+
+	rhythm := bjorklund(pulses, steps)
+
+	shift := ((rotation % steps) + steps) % steps
+	rotated := append(append([]byte(nil), rhythm[steps-shift:]...), rhythm[:steps-shift]...)
+
+	var inst Instrument
+	inst.setSteps(rotated)
+	return inst.measure
+}
+
+// AddEuclideanTrack appends an instrument with the given name playing a
+// Euclidean rhythm of pulses hits over as many steps as the pattern's
+// longest instrument, or 16 if it's the first, and returns its id: one more
+// than the highest id in the pattern, or 0 in an empty one.
+func (p *Pattern) AddEuclideanTrack(name string, pulses int) (uint32, error) {
+
+	steps := p.loopSteps()
+	if steps == 0 {
+		steps = stepsPerMeasure * measuresPerInstrument
+	}
+	if pulses < 0 || pulses > steps {
+		return 0, fmt.Errorf("cannot place %d pulses in %d steps", pulses, steps)
+	}
+
+	id := p.nextID()
+	p.AddInstrument(id, name)
+	if err := p.SetEuclidean(id, pulses, steps); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
@@ -0,0 +1,113 @@
+package drum
+
+import "testing"
+
+func TestSetEuclidean(t *testing.T) {
+	tData := []struct {
+		pulses   int
+		steps    int
+		expected string
+	}{
+		{3, 8, "x--x--x-"},
+		{5, 8, "x-xx-xx-"},
+		{4, 16, "x---x---x---x---"},
+		{0, 4, "----"},
+		{4, 4, "xxxx"},
+		{2, 5, "x-x--"},
+	}
+
+	for _, exp := range tData {
+
+		p := Pattern{instruments: []Instrument{{num: 7, name: "kick", measure: []Step{{0, 0, 0, 0}}}}}
+
+		if err := p.SetEuclidean(7, exp.pulses, exp.steps); err != nil {
+			t.Fatalf("E(%d,%d): unexpected error %v", exp.pulses, exp.steps, err)
+		}
+
+		if got := gridString(p.instruments[0].steps()); got != exp.expected {
+			t.Errorf("E(%d,%d): got %s, expected %s", exp.pulses, exp.steps, got, exp.expected)
+		}
+	}
+}
+
+func TestSetEuclideanInvalid(t *testing.T) {
+
+	p := Pattern{instruments: []Instrument{{num: 0, name: "kick"}}}
+
+	for _, args := range [][3]int{{0, 5, 4}, {0, -1, 4}, {0, 0, 0}, {1, 1, 4}} {
+		if err := p.SetEuclidean(uint32(args[0]), args[1], args[2]); err == nil {
+			t.Errorf("SetEuclidean%v: expected an error", args)
+		}
+	}
+}
+
+func TestGenerateEuclidean(t *testing.T) {
+	tData := []struct {
+		pulses   int
+		steps    int
+		rotation int
+		expected string
+	}{
+		{3, 8, 0, "x--x--x-"},
+		{3, 8, 2, "x-x--x--"},
+		{3, 8, -1, "--x--x-x"},
+		{3, 8, 9, "-x--x--x"},
+		{4, 16, 4, "x---x---x---x---"},
+		{2, 5, 1, "-x-x-"},
+		{-1, 4, 0, "----"},
+		{6, 4, 0, "xxxx"},
+	}
+
+	for _, exp := range tData {
+		var inst Instrument
+		inst.measure = GenerateEuclidean(exp.pulses, exp.steps, exp.rotation)
+
+		if got := gridString(inst.steps()); got != exp.expected {
+			t.Errorf("E(%d,%d) rotated %d: got %s, expected %s", exp.pulses, exp.steps, exp.rotation, got, exp.expected)
+		}
+	}
+
+	if measures := GenerateEuclidean(3, 10, 0); len(measures) != 3 || len(measures[2]) != 2 {
+		t.Errorf("expected 10 steps in measures of 4, 4 and 2, got %v", measures)
+	}
+	if measures := GenerateEuclidean(1, 0, 0); measures != nil {
+		t.Errorf("expected no measures for no steps, got %v", measures)
+	}
+}
+
+func TestAddEuclideanTrack(t *testing.T) {
+
+	p := NewPattern("0.808-alpha", 120)
+
+	id, err := p.AddEuclideanTrack("tresillo", 3)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if id != 0 {
+		t.Errorf("expected the first track to get id 0, got %d", id)
+	}
+
+	p.AddInstrument(9, "clave").SetSteps("x--x--x---x-x---")
+
+	id, err = p.AddEuclideanTrack("cinquillo", 5)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if id != 10 {
+		t.Errorf("expected id 10 after instrument 9, got %d", id)
+	}
+
+	expected := []string{"x----x----x-----", "x--x--x---x-x---", "x--x--x--x--x---"}
+	for i, exp := range expected {
+		if got := gridString(p.instruments[i].steps()); got != exp {
+			t.Errorf("instrument %d: got %s, expected %s", i, got, exp)
+		}
+	}
+
+	if _, err := p.AddEuclideanTrack("too many", 17); err == nil {
+		t.Errorf("expected an error for more pulses than steps")
+	}
+	if len(p.instruments) != 3 {
+		t.Errorf("expected a failed track not to be added, got %d instruments", len(p.instruments))
+	}
+}
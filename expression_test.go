@@ -0,0 +1,117 @@
+package drum
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestExpression(t *testing.T) {
+
+	p := NewPattern("expression", 120)
+	p.AddInstrument(0, "kick").SetSteps("x-------x-------")
+
+	var changes []Change
+	p.OnChange(func(c Change) { changes = append(changes, c) })
+
+	tData := []struct {
+		step  int
+		e     Expression
+		valid bool
+	}{
+		{0, Expression{Velocity: 64, Offset: 0.5}, true},
+		{8, Expression{Offset: -0.25}, true},
+		{3, Expression{Velocity: 127}, true},
+		{1, Expression{Velocity: 128}, false},
+		{1, Expression{Offset: 0.6}, false},
+		{16, Expression{}, false},
+		{-1, Expression{}, false},
+	}
+
+	for _, exp := range tData {
+		if err := p.SetExpression(0, exp.step, exp.e); (err == nil) != exp.valid {
+			t.Errorf("step %d %+v: expected valid %v, got %v", exp.step, exp.e, exp.valid, err)
+		}
+	}
+	if err := p.SetExpression(9, 0, Expression{}); err == nil {
+		t.Errorf("expected an error for an unknown instrument")
+	}
+	if len(changes) != 3 || changes[0].Kind != ChangeExpression || changes[1].Step != 8 {
+		t.Errorf("expected three expression changes, got %+v", changes)
+	}
+
+	inst := p.Instruments()[0]
+	if e, _ := inst.Expression(0); e != (Expression{Velocity: 64, Offset: 0.5}) {
+		t.Errorf("step 0: got %+v", e)
+	}
+	if e, _ := inst.Expression(1); e != (Expression{}) || e.EffectiveVelocity() != DefaultVelocity {
+		t.Errorf("step 1: expected the zero expression at the default velocity, got %+v", e)
+	}
+
+	clone := p.Clone()
+	clone.SetExpression(0, 0, Expression{Velocity: 1})
+	if e, _ := p.Instruments()[0].Expression(0); e.Velocity != 64 {
+		t.Errorf("setting a clone's expression changed the original to %+v", e)
+	}
+
+	p.SetSteps(0, []bool{true, false, false, false, true, false, false, false, true, false, false, false, true, false, false, false})
+	if e, _ := p.Instruments()[0].Expression(0); e != (Expression{}) {
+		t.Errorf("expected replacing the steps to reset the expression, got %+v", e)
+	}
+}
+
+func TestExpressionMIDI(t *testing.T) {
+
+	p := NewPattern("expression", 120)
+	p.AddInstrument(0, "kick").SetSteps("x-------x-------")
+	p.SetExpression(0, 0, Expression{Velocity: 64, Offset: 0.5})
+	p.SetExpression(0, 8, Expression{Offset: -0.25})
+
+	expected := []byte{
+		'M', 'T', 'h', 'd', 0, 0, 0, 6, 0, 0, 0, 1, 0, 96,
+		'M', 'T', 'r', 'k', 0, 0, 0, 37,
+		0x00, 0xff, 0x51, 0x03, 0x07, 0xa1, 0x20,
+		0x00, 0xff, 0x58, 0x04, 0x04, 0x02, 0x18, 0x08,
+		0x0c, 0x99, 36, 64,
+		0x18, 0x89, 36, 64,
+		0x81, 0x16, 0x99, 36, 100,
+		0x18, 0x89, 36, 100,
+		0x81, 0x2e, 0xff, 0x2f, 0x00,
+	}
+
+	var buf bytes.Buffer
+	if err := p.ToMIDI(&buf, nil); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("got\n% x\nexpected\n% x", buf.Bytes(), expected)
+	}
+}
+
+func TestExpressionSequencer(t *testing.T) {
+
+	// at 600 BPM a step is 25ms; the hat on step 4 plays early, before the
+	// kick's late hit on step 3
+	p := NewPattern("expression", 600)
+	p.AddInstrument(0, "kick").SetSteps("---x------------")
+	p.AddInstrument(1, "hat").SetSteps("----x-----------")
+	p.SetExpression(0, 3, Expression{Offset: 0.5})
+	p.SetExpression(1, 4, Expression{Velocity: 30, Offset: -0.5})
+
+	s := NewSequencer(*p)
+	if err := s.Start(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	defer s.Stop()
+
+	first, second := <-s.Events(), <-s.Events()
+	if first.StepIndex != 3 || second.StepIndex != 4 {
+		t.Fatalf("expected steps 3 then 4, got %d then %d", first.StepIndex, second.StepIndex)
+	}
+	if first.Velocity != DefaultVelocity || second.Velocity != 30 {
+		t.Errorf("expected velocities %d and 30, got %d and %d", DefaultVelocity, first.Velocity, second.Velocity)
+	}
+	if gap := second.Time.Sub(first.Time); gap > time.Microsecond || gap < -time.Microsecond {
+		t.Errorf("expected both hits halfway between steps 3 and 4, %v apart", gap)
+	}
+}
@@ -0,0 +1,228 @@
+package drum
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// extensionMagic starts the extension area Encode writes after the payload
+// when a pattern has chunks to record. The area is the magic, the length of
+// the chunks that follow as a uint32 and then the chunks themselves, each a
+// four byte type, the length of its data as a uint32 and the data, with
+// numbers in the pattern's byte order. The payload length doesn't count the
+// area, so decoders that stop at the end of the payload, as the original
+// format's do, skip it.
+const extensionMagic = "SPLX"
+
+// Chunk is a chunk of the extension area after a pattern's payload: its
+// four byte type and its data
+type Chunk struct {
+	Type string
+	Data []byte
+}
+
+// ChunkCodec reads and writes the chunks of one type, for a feature stored
+// in the extension area. Codecs are registered with RegisterChunkCodec.
+type ChunkCodec interface {
+	// EncodeChunk returns the data of the chunk to write for p, or nil to
+	// write none.
+	EncodeChunk(p Pattern) ([]byte, error)
+	// DecodeChunk applies the data of a chunk read after p's payload to p.
+	DecodeChunk(p *Pattern, data []byte) error
+}
+
+// chunkCodecs holds the registered codecs by chunk type, starting with the
+// package's own
+var (
+	chunkCodecsMu sync.RWMutex
+	chunkCodecs   = map[string]ChunkCodec{
+		playbackChunkType: playbackCodec{},
+		loopChunkType:     loopCodec{},
+		metaChunkType:     metaCodec{},
+		ratchetChunkType:  ratchetCodec{},
+	}
+)
+
+// RegisterChunkCodec registers the codec for chunks of the given type,
+// which must be four bytes long, so that Encode writes the chunk and the
+// decoders apply it. Types in upper case are reserved for this package.
+// It panics if the type is the wrong length or already registered, so
+// it's meant to be called from an init function.
+func RegisterChunkCodec(chunkType string, codec ChunkCodec) {
+
+	if len(chunkType) != 4 {
+		panic(fmt.Sprintf("drum: chunk type %q isn't four bytes", chunkType))
+	}
+
+	chunkCodecsMu.Lock()
+	defer chunkCodecsMu.Unlock()
+
+	if _, ok := chunkCodecs[chunkType]; ok {
+		panic(fmt.Sprintf("drum: chunk type %q is already registered", chunkType))
+	}
+	chunkCodecs[chunkType] = codec
+}
+
+// chunkCodec returns the codec registered for a chunk type
+func chunkCodec(chunkType string) (ChunkCodec, bool) {
+
+	chunkCodecsMu.RLock()
+	defer chunkCodecsMu.RUnlock()
+
+	codec, ok := chunkCodecs[chunkType]
+	return codec, ok
+}
+
+// UnknownChunks returns copies of the chunks decoded with the pattern whose
+// types have no codec registered. Encode writes them back as they were read,
+// after the chunks of the registered codecs.
+func (p Pattern) UnknownChunks() []Chunk {
+
+	var chunks []Chunk
+	for _, c := range p.chunks {
+		chunks = append(chunks, Chunk{Type: c.Type, Data: cloneBytes(c.Data)})
+	}
+	return chunks
+}
+
+// extension returns the extension area Encode writes after the payload, or
+// nil if there are no chunks to write. The registered codecs' chunks come
+// first, in order of type.
+func (p Pattern) extension() ([]byte, error) {
+
+	chunkCodecsMu.RLock()
+	types := make([]string, 0, len(chunkCodecs))
+	for t := range chunkCodecs {
+		types = append(types, t)
+	}
+	chunkCodecsMu.RUnlock()
+	sort.Strings(types)
+
+	var chunks bytes.Buffer
+	write := func(chunkType string, data []byte) {
+		chunks.WriteString(chunkType)
+		chunks.Write(putUint(p.order(), uint64(len(data)), 4))
+		chunks.Write(data)
+	}
+
+	for _, t := range types {
+		codec, _ := chunkCodec(t)
+		data, err := codec.EncodeChunk(p)
+		if err != nil {
+			return nil, fmt.Errorf("encoding chunk %q: %w", t, err)
+		}
+		if data != nil {
+			write(t, data)
+		}
+	}
+	for _, c := range p.chunks {
+		if _, ok := chunkCodec(c.Type); !ok {
+			write(c.Type, c.Data)
+		}
+	}
+	if chunks.Len() == 0 {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(extensionMagic)
+	buf.Write(putUint(p.order(), uint64(chunks.Len()), 4))
+	chunks.WriteTo(&buf)
+	return buf.Bytes(), nil
+}
+
+// readExtension reads the extension area following the payload of p, which
+// ends at offset, if there is one, applying the chunks of the registered
+// codecs to p and keeping the others. It can only look for the area without
+// consuming the start of the next pattern if r can peek, as a *bufio.Reader
+// can, or seek, so from other readers the area is left unread.
+func readExtension(r io.Reader, p *Pattern, offset int, opts DecodeOptions) error {
+
+	if !startsExtension(r) {
+		return nil
+	}
+	offset += len(extensionMagic)
+
+	lengthBin := make([]byte, 4)
+	if _, err := io.ReadFull(r, lengthBin); err != nil {
+		return readError(offset, "extension length", err)
+	}
+	length := readUint(p.order(), lengthBin)
+	if length > uint64(opts.maxPayload()) {
+		return decodeError(offset, "extension length", fmt.Errorf("%w: declared extension of %d bytes is over the %d byte limit",
+			ErrPayloadTooLarge, length, opts.maxPayload()))
+	}
+	offset += len(lengthBin)
+
+	area := make([]byte, length)
+	if _, err := io.ReadFull(r, area); err != nil {
+		return readError(offset, "extension", err)
+	}
+
+	for len(area) > 0 {
+		if len(area) < 8 {
+			return decodeError(offset, "chunk", fmt.Errorf("%w: %d bytes left for a chunk header", ErrTruncated, len(area)))
+		}
+		chunkType := string(area[:4])
+		size := readUint(p.order(), area[4:8])
+		if size > uint64(len(area)-8) {
+			return decodeError(offset, "chunk "+chunkType, fmt.Errorf("%w: chunk of %d bytes runs past the extension", ErrTruncated, size))
+		}
+		data := append([]byte(nil), area[8:8+size]...)
+
+		if codec, ok := chunkCodec(chunkType); ok {
+			if err := codec.DecodeChunk(p, data); err != nil {
+				return decodeError(offset, "chunk "+chunkType, err)
+			}
+		} else {
+			p.chunks = append(p.chunks, Chunk{Type: chunkType, Data: data})
+		}
+
+		offset += 8 + int(size)
+		area = area[8+size:]
+	}
+	return nil
+}
+
+// peekable returns r if startsExtension can look ahead in it, because it
+// can Peek or Seek, and otherwise r read through a bufio.Reader, which may
+// read past what's decoded from it. It's only for decoders that read r to
+// the end anyway, so nothing after the pattern is lost.
+func peekable(r io.Reader) io.Reader {
+
+	switch r.(type) {
+	case interface{ Peek(int) ([]byte, error) }, io.Seeker:
+		return r
+	}
+	return bufio.NewReader(r)
+}
+
+// startsExtension reports whether an extension area comes next in r,
+// consuming its magic if it does and nothing otherwise
+func startsExtension(r io.Reader) bool {
+
+	magic := make([]byte, len(extensionMagic))
+
+	switch r := r.(type) {
+	case interface {
+		io.Reader
+		Peek(int) ([]byte, error)
+	}:
+		if next, err := r.Peek(len(magic)); err != nil || string(next) != extensionMagic {
+			return false
+		}
+		_, err := io.ReadFull(r, magic)
+		return err == nil
+	case io.ReadSeeker:
+		n, _ := io.ReadFull(r, magic)
+		if string(magic[:n]) == extensionMagic {
+			return true
+		}
+		r.Seek(int64(-n), io.SeekCurrent)
+	}
+	return false
+}
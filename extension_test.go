@@ -0,0 +1,221 @@
+package drum
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// authorCodec writes the author recorded for each version and records the
+// authors it decodes, as a codec outside the package might
+type authorCodec struct {
+	authors map[string]string
+}
+
+func (c authorCodec) EncodeChunk(p Pattern) ([]byte, error) {
+
+	if author, ok := c.authors[p.version]; ok {
+		return []byte(author), nil
+	}
+	return nil, nil
+}
+
+func (c authorCodec) DecodeChunk(p *Pattern, data []byte) error {
+
+	if len(data) == 0 {
+		return errors.New("empty author")
+	}
+	c.authors[p.version+" decoded"] = string(data)
+	return nil
+}
+
+// registerTestCodec registers codec for the test's duration
+func registerTestCodec(t *testing.T, chunkType string, codec ChunkCodec) {
+
+	t.Helper()
+	RegisterChunkCodec(chunkType, codec)
+	t.Cleanup(func() {
+		chunkCodecsMu.Lock()
+		delete(chunkCodecs, chunkType)
+		chunkCodecsMu.Unlock()
+	})
+}
+
+func TestChunkCodec(t *testing.T) {
+
+	codec := authorCodec{authors: map[string]string{"0.808-alpha": "chris"}}
+	registerTestCodec(t, "auth", codec)
+
+	p := NewPattern("0.808-alpha", 120)
+	p.AddInstrument(1, "kick")
+	p.SetSolo(1, true)
+
+	var buf bytes.Buffer
+	if err := p.Encode(&buf); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	encoded := buf.Bytes()
+	if size, _ := p.EncodedSize(); size != len(encoded) {
+		t.Errorf("EncodedSize reported %d bytes, Encode wrote %d", size, len(encoded))
+	}
+
+	// the chunks come in order of type, so the playback chunk comes first
+	area := encoded[headerSize+1+int(encoded[headerSize]):]
+	if string(area[:4]) != extensionMagic || string(area[8:12]) != playbackChunkType || bytes.Index(area, []byte("auth")) < 12 {
+		t.Errorf("expected the extension area after the payload, got % x", area)
+	}
+
+	decoded, err := Decode(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if codec.authors["0.808-alpha decoded"] != "chris" || !decoded.instruments[0].solo {
+		t.Errorf("expected both chunks to be decoded, got %v, %+v", codec.authors, decoded.instruments)
+	}
+	if chunks := decoded.UnknownChunks(); len(chunks) != 0 {
+		t.Errorf("expected no unknown chunks, got %v", chunks)
+	}
+
+	// a codec's error is reported with the chunk's offset
+	codec.authors["0.808-alpha"] = ""
+	buf.Reset()
+	if err := p.Encode(&buf); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var decodeErr *DecodeError
+	if _, err := Decode(&buf); !errors.As(err, &decodeErr) || decodeErr.Field != "chunk auth" {
+		t.Errorf("expected a DecodeError for the auth chunk, got %v", err)
+	}
+}
+
+func TestUnknownChunks(t *testing.T) {
+
+	p := NewPattern("0.808-alpha", 120)
+	p.AddInstrument(1, "kick")
+	p.chunks = []Chunk{{"tags", []byte("techno")}, {"mixr", []byte{1, 2, 3}}}
+
+	var buf bytes.Buffer
+	if err := p.Encode(&buf); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	encoded := buf.Bytes()
+
+	decoded, err := Decode(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	chunks := decoded.UnknownChunks()
+	if len(chunks) != 2 || chunks[0].Type != "tags" || string(chunks[0].Data) != "techno" || chunks[1].Type != "mixr" {
+		t.Fatalf("expected the unknown chunks in order, got %v", chunks)
+	}
+	chunks[0].Data[0] = 'X'
+	if decoded.chunks[0].Data[0] != 't' {
+		t.Error("UnknownChunks shares memory with the pattern")
+	}
+
+	buf.Reset()
+	if err := decoded.Clone().Encode(&buf); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), encoded) {
+		t.Errorf("expected the unknown chunks to round trip\n got % x\nwant % x", buf.Bytes(), encoded)
+	}
+
+	// readers that stop at the end of the payload leave the area unread
+	r := io.MultiReader(bytes.NewReader(encoded))
+	if _, err := Decode(r); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if rest, _ := io.ReadAll(r); string(rest[:4]) != extensionMagic {
+		t.Errorf("expected the area to be left unread, %q was left", rest)
+	}
+
+	// a stream of patterns steps over the area to the next one
+	stream := append(append([]byte(nil), encoded...), encoded...)
+	dec := NewDecoder(bytes.NewReader(stream))
+	for i := 0; i < 2; i++ {
+		if _, err := dec.NextPattern(); err != nil {
+			t.Fatalf("pattern %d: unexpected error %v", i, err)
+		}
+	}
+
+	for _, n := range []int{1, 7, 12} {
+		if _, err := Decode(bytes.NewReader(encoded[:len(encoded)-n])); !errors.Is(err, ErrTruncated) {
+			t.Errorf("expected %v with %d bytes cut, got %v", ErrTruncated, n, err)
+		}
+	}
+}
+
+// plainReader hides the Peek and Seek methods of the reader it wraps
+type plainReader struct {
+	io.Reader
+}
+
+func TestDecodePlainReader(t *testing.T) {
+
+	p := NewPattern("0.808-alpha", 120)
+	p.AddInstrument(1, "kick")
+	p.chunks = []Chunk{{"tags", []byte("techno")}}
+
+	var buf bytes.Buffer
+	if err := p.Encode(&buf); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	encoded := buf.Bytes()
+
+	check := func(name string, decoded Pattern, err error) {
+
+		t.Helper()
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", name, err)
+		} else if chunks := decoded.UnknownChunks(); len(chunks) != 1 || chunks[0].Type != "tags" {
+			t.Errorf("%s: expected the tags chunk, got %v", name, chunks)
+		}
+	}
+
+	decoded, err := DecodeWithOptions(plainReader{bytes.NewReader(encoded)}, DecodeOptions{Strict: true})
+	check("strict", decoded, err)
+
+	decoded, warnings, err := DecodeWithWarnings(plainReader{bytes.NewReader(encoded)}, DecodeOptions{})
+	check("warnings", decoded, err)
+	if len(warnings) != 0 {
+		t.Errorf("warnings: expected no warnings, got %v", warnings)
+	}
+
+	// plain patterns decode back to back without reading past each other
+	p.chunks = nil
+	buf.Reset()
+	if err := p.Encode(&buf); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	r := plainReader{bytes.NewReader(append(append([]byte(nil), buf.Bytes()...), buf.Bytes()...))}
+	for i := 0; i < 2; i++ {
+		if _, err := Decode(r); err != nil {
+			t.Fatalf("pattern %d: unexpected error %v", i, err)
+		}
+	}
+}
+
+func TestRegisterChunkCodec(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		chunkType string
+	}{
+		{"too short", "abc"},
+		{"too long", "abcde"},
+		{"registered", playbackChunkType},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("expected registering %q to panic", tt.chunkType)
+				}
+			}()
+			RegisterChunkCodec(tt.chunkType, playbackCodec{})
+		})
+	}
+}
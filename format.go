@@ -0,0 +1,118 @@
+package drum
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Format is a form a pattern can be read and written in
+type Format int
+
+const (
+	// FormatSplice is the binary .splice format Decode and Encode read and
+	// write.
+	FormatSplice Format = iota
+	// FormatJSON is the JSON form Pattern.MarshalJSON writes.
+	FormatJSON
+	// FormatText is the text form String writes and ParseText reads.
+	FormatText
+)
+
+// formatNames are the names of the formats, as String gives them
+var formatNames = []string{"splice", "json", "text"}
+
+// sniffSize is the most DecodeAny looks at to tell what format it's reading
+const sniffSize = 512
+
+// String returns the format's name: "splice", "json" or "text"
+func (f Format) String() string {
+
+	if f < 0 || int(f) >= len(formatNames) {
+		return fmt.Sprintf("Format(%d)", int(f))
+	}
+	return formatNames[f]
+}
+
+// ParseFormat returns the format with the given name, as String gives it,
+// ignoring case
+func ParseFormat(name string) (Format, error) {
+
+	for f, n := range formatNames {
+		if strings.EqualFold(name, n) {
+			return Format(f), nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q isn't one of %s", ErrUnknownFormat, name, strings.Join(formatNames, ", "))
+}
+
+// DecodeAny reads a single pattern from r in whichever format it's in,
+// returning the format with it: the binary .splice format, starting with
+// the SPLICE magic, as Decode reads it, JSON, starting with a {, as
+// Pattern.UnmarshalJSON reads it, or the text form, starting with the
+// version line, as ParseText reads it. Whitespace and a UTF-8 byte order
+// mark before JSON or text are skipped. Anything else returns an error
+// wrapping ErrUnknownFormat. JSON and text are read to the end of r, so it
+// suits stdin and other streams holding one pattern.
+func DecodeAny(r io.Reader) (Pattern, Format, error) {
+
+	br := bufio.NewReaderSize(r, sniffSize)
+	head, err := br.Peek(sniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return Pattern{}, 0, err
+	}
+
+	if bytes.HasPrefix(head, []byte(spliceMagic)) {
+		p, err := Decode(br)
+		return p, FormatSplice, err
+	}
+
+	text := bytes.TrimLeft(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf")), " \t\r\n")
+	br.Discard(len(head) - len(text))
+	switch {
+	case bytes.HasPrefix(text, []byte("{")):
+		data, err := io.ReadAll(br)
+		if err != nil {
+			return Pattern{}, FormatJSON, err
+		}
+		var p Pattern
+		if err := json.Unmarshal(data, &p); err != nil {
+			return Pattern{}, FormatJSON, err
+		}
+		return p, FormatJSON, nil
+
+	case bytes.HasPrefix(text, []byte(versionPrefix)):
+		p, err := ParseText(br)
+		return p, FormatText, err
+	}
+
+	if len(head) == 0 {
+		return Pattern{}, 0, fmt.Errorf("%w: no input", ErrUnknownFormat)
+	}
+	return Pattern{}, 0, fmt.Errorf("%w: input starts %q", ErrUnknownFormat, bytes.SplitN(head, []byte("\n"), 2)[0])
+}
+
+// EncodeFormat writes p to w in the format f: the binary .splice format as
+// Encode writes it, indented JSON or the text form String returns, each of
+// the last two ending in a newline
+func EncodeFormat(w io.Writer, p Pattern, f Format) error {
+
+	switch f {
+	case FormatSplice:
+		return p.Encode(w)
+	case FormatJSON:
+		data, err := json.MarshalIndent(p, "", "\t")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(data, '\n'))
+		return err
+	case FormatText:
+		_, err := p.WriteTo(w)
+		return err
+	}
+	return fmt.Errorf("%w: %v", ErrUnknownFormat, f)
+}
@@ -0,0 +1,60 @@
+package drum
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestDecodeAny(t *testing.T) {
+
+	data, err := ioutil.ReadFile("fixtures/pattern_2.splice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []Format{FormatSplice, FormatJSON, FormatText} {
+		var buf bytes.Buffer
+		if err := EncodeFormat(&buf, want, f); err != nil {
+			t.Fatalf("%v: unexpected error %v", f, err)
+		}
+		if f != FormatSplice && !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			t.Errorf("%v: expected a trailing newline", f)
+		}
+
+		for _, prefix := range []string{"", "\xef\xbb\xbf\n  \t"} {
+			if f == FormatSplice && prefix != "" {
+				continue
+			}
+			p, got, err := DecodeAny(strings.NewReader(prefix + buf.String()))
+			if err != nil {
+				t.Fatalf("%v: unexpected error %v", f, err)
+			}
+			if got != f || p.String() != want.String() {
+				t.Errorf("%v: got %v holding\n%s", f, got, p)
+			}
+		}
+
+		if parsed, err := ParseFormat(strings.ToUpper(f.String())); err != nil || parsed != f {
+			t.Errorf("%v: parsed its name as %v, %v", f, parsed, err)
+		}
+	}
+
+	for _, input := range []string{"", "MThd", "Tempo: 120\n"} {
+		if _, _, err := DecodeAny(strings.NewReader(input)); !errors.Is(err, ErrUnknownFormat) {
+			t.Errorf("%q: expected %v, got %v", input, ErrUnknownFormat, err)
+		}
+	}
+	if _, err := ParseFormat("midi"); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("expected %v for midi, got %v", ErrUnknownFormat, err)
+	}
+	if _, _, err := DecodeAny(strings.NewReader(`{"version":"0.909"}`)); err == nil {
+		t.Errorf("expected an error for JSON without a tempo")
+	}
+}
@@ -0,0 +1,164 @@
+// Package generate makes new drum patterns at random from a Profile of how
+// likely each instrument is to hit on each step, which can be learned from
+// a corpus of decoded patterns.
+package generate
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+
+	drum "github.com/chrishiestand/golang-challenge-1-drum_machine"
+)
+
+// Profile describes a style of pattern: the version and tempo generated
+// patterns get and the instruments they play
+type Profile struct {
+	Version string
+	Tempo   float32
+	Tracks  []Track
+}
+
+// Track is one instrument of a Profile, with the probability from 0 to 1
+// that it hits on each step. Every track of a profile has the same number
+// of steps.
+type Track struct {
+	ID            uint32
+	Name          string
+	Probabilities []float64
+}
+
+// TrainProfile learns a Profile from patterns. Instruments are matched
+// across patterns by name, ignoring case and surrounding space, and each
+// step's probability is the share of the patterns holding the instrument
+// that hit on that step. The profile has as many steps as the longest
+// instrument in patterns, and a shorter instrument counts as looping over
+// them. Tracks are in the order their instruments first appear and keep the
+// name and id they first had, unless an earlier track took the id, in which
+// case they get one more than the highest id so far. The tempo is the mean
+// of the patterns' tempos and the version the first pattern's.
+func TrainProfile(patterns []drum.Pattern) (Profile, error) {
+
+	if len(patterns) == 0 {
+		return Profile{}, errors.New("cannot train a profile without patterns")
+	}
+
+	steps := 0
+	for _, p := range patterns {
+		for _, inst := range p.Instruments() {
+			if n := len(inst.Steps()); n > steps {
+				steps = n
+			}
+		}
+	}
+
+	profile := Profile{Version: patterns[0].Version()}
+	var counts []int
+	byName := make(map[string]int)
+	ids := make(map[uint32]bool)
+	var nextID uint32
+	var tempo float64
+
+	for _, p := range patterns {
+		tempo += float64(p.Tempo())
+
+		for _, inst := range p.Instruments() {
+			hits := inst.Steps()
+			if len(hits) == 0 {
+				continue
+			}
+
+			key := strings.ToLower(strings.TrimSpace(inst.Name()))
+			t, ok := byName[key]
+			if !ok {
+				id := inst.ID()
+				if ids[id] {
+					id = nextID
+				}
+				ids[id] = true
+				if id >= nextID {
+					nextID = id + 1
+				}
+
+				t = len(profile.Tracks)
+				byName[key] = t
+				profile.Tracks = append(profile.Tracks, Track{ID: id, Name: inst.Name(), Probabilities: make([]float64, steps)})
+				counts = append(counts, 0)
+			}
+
+			counts[t]++
+			for s := range profile.Tracks[t].Probabilities {
+				if hits[s%len(hits)] {
+					profile.Tracks[t].Probabilities[s]++
+				}
+			}
+		}
+	}
+
+	for t, track := range profile.Tracks {
+		for s := range track.Probabilities {
+			track.Probabilities[s] /= float64(counts[t])
+		}
+	}
+	profile.Tempo = float32(tempo / float64(len(patterns)))
+	return profile, nil
+}
+
+// Generate returns a new pattern in the profile's style, each track's step
+// hitting with its probability. The same seed always gives the same
+// pattern. It returns an error if a probability isn't between 0 and 1 or
+// the tracks have different numbers of steps.
+func (p Profile) Generate(seed int64) (drum.Pattern, error) {
+
+	if err := p.check(); err != nil {
+		return drum.Pattern{}, err
+	}
+
+	random := rand.New(rand.NewSource(seed))
+	pattern := drum.NewPattern(p.Version, p.Tempo)
+
+	for _, track := range p.Tracks {
+		pattern.AddInstrument(track.ID, track.Name)
+	}
+	if len(p.Tracks) > 0 {
+		if err := pattern.Resize(len(p.Tracks[0].Probabilities)); err != nil {
+			return drum.Pattern{}, err
+		}
+	}
+
+	for _, track := range p.Tracks {
+		steps := make([]bool, len(track.Probabilities))
+		for s, probability := range track.Probabilities {
+			steps[s] = random.Float64() < probability
+		}
+		if err := pattern.SetSteps(track.ID, steps); err != nil {
+			return drum.Pattern{}, err
+		}
+	}
+	return *pattern, nil
+}
+
+// check reports whether the profile's tracks can be generated from
+func (p Profile) check() error {
+
+	ids := make(map[uint32]bool)
+
+	for _, track := range p.Tracks {
+		if ids[track.ID] {
+			return fmt.Errorf("tracks share the id %d", track.ID)
+		}
+		ids[track.ID] = true
+
+		if n := len(p.Tracks[0].Probabilities); len(track.Probabilities) != n {
+			return fmt.Errorf("track %q has %d steps, expected %d", track.Name, len(track.Probabilities), n)
+		}
+		for s, probability := range track.Probabilities {
+			if math.IsNaN(probability) || probability < 0 || probability > 1 {
+				return fmt.Errorf("track %q step %d has probability %v, not between 0 and 1", track.Name, s, probability)
+			}
+		}
+	}
+	return nil
+}
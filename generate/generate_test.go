@@ -0,0 +1,127 @@
+package generate
+
+import (
+	"path"
+	"testing"
+
+	drum "github.com/chrishiestand/golang-challenge-1-drum_machine"
+	"github.com/chrishiestand/golang-challenge-1-drum_machine/drumtest"
+)
+
+func TestTrainProfile(t *testing.T) {
+
+	profile, err := TrainProfile([]drum.Pattern{
+		drumtest.Pattern(t, "generate", 100,
+			drumtest.Track{ID: 0, Name: "kick", Steps: "x---x---x---x---"},
+			drumtest.Track{ID: 1, Name: "hat", Steps: "x-x-x-x-x-x-x-x-"}),
+		drumtest.Pattern(t, "generate", 120,
+			drumtest.Track{ID: 0, Name: "kick", Steps: "x-------x-------"},
+			drumtest.Track{ID: 1, Name: "hat", Steps: "--x---x---x---x-"}),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if profile.Tempo != 110 || profile.Version != "generate" {
+		t.Errorf("expected version generate at 110 BPM, got %q at %v", profile.Version, profile.Tempo)
+	}
+	if len(profile.Tracks) != 2 {
+		t.Fatalf("expected 2 tracks, got %d", len(profile.Tracks))
+	}
+
+	expected := map[string][]float64{
+		"kick": {1, 0, 0, 0, 0.5, 0, 0, 0, 1, 0, 0, 0, 0.5, 0, 0, 0},
+		"hat":  {0.5, 0, 1, 0, 0.5, 0, 1, 0, 0.5, 0, 1, 0, 0.5, 0, 1, 0},
+	}
+	for _, track := range profile.Tracks {
+		for s, probability := range track.Probabilities {
+			if probability != expected[track.Name][s] {
+				t.Errorf("%s step %d: got probability %v, expected %v", track.Name, s, probability, expected[track.Name][s])
+			}
+		}
+	}
+
+	if _, err := TrainProfile(nil); err == nil {
+		t.Errorf("expected an error training without patterns")
+	}
+}
+
+func TestTrainProfileFixtures(t *testing.T) {
+
+	var patterns []drum.Pattern
+	for _, name := range []string{"pattern_1.splice", "pattern_2.splice", "pattern_3.splice"} {
+		decoded, err := drum.DecodeFile(path.Join("..", "fixtures", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		patterns = append(patterns, *decoded)
+	}
+
+	profile, err := TrainProfile(patterns)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	ids := make(map[uint32]bool)
+	for _, track := range profile.Tracks {
+		if ids[track.ID] {
+			t.Errorf("track %q reuses id %d", track.Name, track.ID)
+		}
+		ids[track.ID] = true
+	}
+
+	if _, err := profile.Generate(1); err != nil {
+		t.Errorf("unexpected error generating from the fixtures' profile: %v", err)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+
+	profile := Profile{Version: "gen", Tempo: 90, Tracks: []Track{
+		{ID: 3, Name: "kick", Probabilities: []float64{1, 0, 0, 0, 1, 0, 0, 0}},
+		{ID: 4, Name: "hat", Probabilities: []float64{0.5, 0.5, 0.5, 0.5, 0.5, 0.5, 0.5, 0.5}},
+	}}
+
+	p, err := profile.Generate(42)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if p.Version() != "gen" || p.Tempo() != 90 {
+		t.Errorf("expected version gen at 90 BPM, got %q at %v", p.Version(), p.Tempo())
+	}
+
+	instruments := p.Instruments()
+	if len(instruments) != 2 || instruments[0].ID() != 3 || instruments[1].Name() != "hat" {
+		t.Fatalf("expected the kick and hat tracks, got %v", instruments)
+	}
+	if got := instruments[0].Line('x', '-'); got != "(3) kick\t|x---|x---|" {
+		t.Errorf("expected the certain kick hits only, got %s", got)
+	}
+
+	again, err := profile.Generate(42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !again.Equal(p) {
+		t.Errorf("expected the same seed to give the same pattern")
+	}
+}
+
+func TestGenerateInvalid(t *testing.T) {
+
+	tData := []struct {
+		name   string
+		tracks []Track
+	}{
+		{"probability over 1", []Track{{ID: 0, Name: "kick", Probabilities: []float64{1.5}}}},
+		{"negative probability", []Track{{ID: 0, Name: "kick", Probabilities: []float64{-0.1}}}},
+		{"uneven tracks", []Track{{ID: 0, Name: "kick", Probabilities: []float64{1}}, {ID: 1, Name: "hat", Probabilities: []float64{1, 0}}}},
+		{"shared id", []Track{{ID: 0, Name: "kick", Probabilities: []float64{1}}, {ID: 0, Name: "hat", Probabilities: []float64{1}}}},
+	}
+
+	for _, exp := range tData {
+		if _, err := (Profile{Tempo: 120, Tracks: exp.tracks}).Generate(1); err == nil {
+			t.Errorf("%s: expected an error", exp.name)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package drum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+)
+
+// gobFormatVersion is written as the first byte of GobEncode's output and
+// must be bumped whenever gobPattern changes incompatibly.
+const gobFormatVersion = 2
+
+// gobPattern mirrors Pattern's fields for gob encoding
+type gobPattern struct {
+	Version     string
+	Tempo       float32
+	TempoBin    []byte
+	Header      []byte
+	LengthSize  int
+	Packing     StepPacking
+	Layout      Layout
+	TempoFormat TempoFormat
+	Resolution  int
+	BigEndian   bool
+	VersionSize int
+	Instruments []gobInstrument
+	Chunks      []Chunk
+	Meta        *PatternMeta
+}
+
+// gobInstrument mirrors Instrument's fields for gob encoding
+type gobInstrument struct {
+	ID         uint32
+	Name       string
+	Raw        []byte
+	Measures   [][]byte
+	Expression []Expression
+	Muted      bool
+	Solo       bool
+	HasGain    bool
+	Gain       float32
+}
+
+// GobEncode implements gob.GobEncoder, serializing the pattern, including
+// its metadata and the header, tempo and instrument bytes it was decoded
+// from, behind a leading format version byte. A function registered with OnChange is not serialized.
+func (p Pattern) GobEncode() ([]byte, error) {
+
+	g := gobPattern{Version: p.version, Tempo: p.tempo, TempoBin: p.tempoBin, TempoFormat: p.tempoFormat,
+		Header: p.header, LengthSize: p.lengthSize, Packing: p.packing, Layout: p.layout,
+		Resolution: p.resolution, BigEndian: isBigEndian(p.order()), VersionSize: p.versionSize,
+		Chunks: p.chunks, Meta: p.meta}
+
+	for _, inst := range p.instruments {
+		gi := gobInstrument{ID: inst.num, Name: inst.name, Raw: inst.raw, Expression: inst.expression,
+			Muted: inst.muted, Solo: inst.solo, HasGain: inst.hasGain, Gain: inst.gain}
+		for _, measure := range inst.measure {
+			gi.Measures = append(gi.Measures, measure)
+		}
+		g.Instruments = append(g.Instruments, gi)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte(gobFormatVersion)
+
+	if err := gob.NewEncoder(&buf).Encode(g); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder, replacing the pattern with one
+// serialized by GobEncode. Data written with a different format version is
+// rejected.
+func (p *Pattern) GobDecode(data []byte) error {
+
+	if len(data) == 0 {
+		return fmt.Errorf("gob data is empty")
+	}
+	if data[0] != gobFormatVersion {
+		return fmt.Errorf("gob data has format version %d, expected %d", data[0], gobFormatVersion)
+	}
+
+	var g gobPattern
+	if err := gob.NewDecoder(bytes.NewReader(data[1:])).Decode(&g); err != nil {
+		return err
+	}
+
+	decoded := Pattern{version: g.Version, tempo: g.Tempo, tempoBin: g.TempoBin, tempoFormat: g.TempoFormat,
+		header: g.Header, lengthSize: g.LengthSize, packing: g.Packing, layout: g.Layout,
+		resolution: g.Resolution, versionSize: g.VersionSize, chunks: g.Chunks, meta: g.Meta}
+	if g.BigEndian {
+		decoded.byteOrder = binary.BigEndian
+	}
+
+	for _, gi := range g.Instruments {
+		inst := Instrument{num: gi.ID, name: gi.Name, raw: gi.Raw, expression: gi.Expression,
+			muted: gi.Muted, solo: gi.Solo, hasGain: gi.HasGain, gain: gi.Gain}
+		for _, measure := range gi.Measures {
+			inst.measure = append(inst.measure, Step(measure))
+		}
+		decoded.instruments = append(decoded.instruments, inst)
+	}
+
+	*p = decoded
+	return nil
+}
@@ -0,0 +1,112 @@
+package drum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"io/ioutil"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGobRoundTrip(t *testing.T) {
+
+	for _, name := range []string{"pattern_1.splice", "pattern_4.splice", "header_bytes.splice"} {
+
+		decoded, err := DecodeFile(path.Join("fixtures", name))
+		if err != nil {
+			t.Fatalf("something went wrong decoding %s - %v", name, err)
+		}
+
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(decoded); err != nil {
+			t.Fatalf("%s: unexpected error encoding %v", name, err)
+		}
+
+		var cached Pattern
+		if err := gob.NewDecoder(&buf).Decode(&cached); err != nil {
+			t.Fatalf("%s: unexpected error decoding %v", name, err)
+		}
+
+		var want, got bytes.Buffer
+		decoded.Encode(&want)
+		cached.Encode(&got)
+
+		if cached.String() != decoded.String() || !bytes.Equal(got.Bytes(), want.Bytes()) {
+			t.Errorf("%s changed through gob:\n%s", name, cached)
+		}
+	}
+
+	original, err := ioutil.ReadFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := DecodeWithOptions(bytes.NewReader(original), DecodeOptions{KeepRaw: true})
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_1.splice - %v", err)
+	}
+	meta := PatternMeta{Title: "four on the floor", Author: "splice", Tags: []string{"house"}, Rating: 4,
+		Created: time.Date(2015, 3, 1, 12, 0, 0, 0, time.UTC)}
+	if err := p.SetMeta(meta); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(p); err != nil {
+		t.Fatalf("unexpected error encoding %v", err)
+	}
+	var cached Pattern
+	if err := gob.NewDecoder(&buf).Decode(&cached); err != nil {
+		t.Fatalf("unexpected error decoding %v", err)
+	}
+	if got := cached.Meta(); !reflect.DeepEqual(got, meta) {
+		t.Errorf("the metadata changed through gob: got %+v, expected %+v", got, meta)
+	}
+	for i, inst := range cached.instruments {
+		if inst.raw == nil || !bytes.Equal(inst.raw, p.instruments[i].raw) {
+			t.Errorf("instrument %d lost its raw bytes through gob", inst.num)
+		}
+	}
+}
+
+func TestGobKeepsDialect(t *testing.T) {
+
+	p := Pattern{version: "0.909", tempo: 120, byteOrder: binary.BigEndian, versionSize: 40, instruments: []Instrument{
+		{num: 1, name: "kick", measure: []Step{{1, 0, 0, 0}, {1, 0, 0, 0}, {1, 0, 0, 0}, {1, 0, 0, 0}}},
+	}}
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(p); err != nil {
+		t.Fatal(err)
+	}
+	var cached Pattern
+	if err := gob.NewDecoder(&buf).Decode(&cached); err != nil {
+		t.Fatal(err)
+	}
+
+	var want, got bytes.Buffer
+	p.Encode(&want)
+	cached.Encode(&got)
+	if !bytes.Equal(got.Bytes(), want.Bytes()) {
+		t.Errorf("the byte order and version width were lost through gob")
+	}
+}
+
+func TestGobDecodeFormatVersion(t *testing.T) {
+
+	data, err := Pattern{version: "0.909", tempo: 120}.GobEncode()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if data[0] != gobFormatVersion {
+		t.Fatalf("expected a leading format version byte, got %d", data[0])
+	}
+
+	data[0] = gobFormatVersion + 1
+	var p Pattern
+	if err := p.GobDecode(data); err == nil {
+		t.Errorf("expected an error decoding an unknown format version")
+	}
+}
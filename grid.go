@@ -0,0 +1,54 @@
+package drum
+
+import "fmt"
+
+// ToGrid returns the pattern's steps as one row per instrument, in order,
+// where true is a hit.
+func (p Pattern) ToGrid() [][]bool {
+
+	grid := make([][]bool, 0, len(p.instruments))
+
+	for _, inst := range p.instruments {
+		row := make([]bool, 0, inst.stepCount())
+		for _, step := range inst.steps() {
+			row = append(row, isOn(step))
+		}
+		grid = append(grid, row)
+	}
+	return grid
+}
+
+// FromGrid builds a pattern with one instrument per row of grid, named from
+// names and given the ids 0, 1, 2... in order. It is the inverse of ToGrid.
+// Every row must have the same number of steps, there must be a name for
+// every row, and the result must be a pattern Encode can write.
+func FromGrid(version string, tempo float32, names []string, grid [][]bool) (Pattern, error) {
+
+	p := Pattern{version: version, tempo: tempo}
+
+	if len(names) != len(grid) {
+		return Pattern{}, fmt.Errorf("got %d names for %d grid rows", len(names), len(grid))
+	}
+
+	for n, row := range grid {
+		if len(row) != len(grid[0]) {
+			return Pattern{}, fmt.Errorf("%w: grid row %d has %d steps, row 0 has %d", ErrInvalidStep, n, len(row), len(grid[0]))
+		}
+
+		steps := make([]byte, len(row))
+		for s, on := range row {
+			if on {
+				steps[s] = StepOn
+			}
+		}
+
+		inst := Instrument{num: uint32(n), name: names[n]}
+		inst.setSteps(steps)
+		p.instruments = append(p.instruments, inst)
+	}
+
+	if _, err := p.EncodedSize(); err != nil {
+		return Pattern{}, err
+	}
+	return p, nil
+}
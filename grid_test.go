@@ -0,0 +1,54 @@
+package drum
+
+import (
+	"bytes"
+	"errors"
+	"path"
+	"testing"
+)
+
+func TestFromGrid(t *testing.T) {
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_3.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_3.splice - %v", err)
+	}
+
+	var names []string
+	for _, inst := range decoded.instruments {
+		names = append(names, inst.name)
+	}
+
+	p, err := FromGrid(decoded.version, decoded.tempo, names, decoded.ToGrid())
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	for n, inst := range p.instruments {
+		if inst.num != uint32(n) || inst.name != names[n] || !bytes.Equal(inst.steps(), decoded.instruments[n].steps()) {
+			t.Errorf("instrument %d wasn't built from its grid row: (%d) %s %s", n, inst.num, inst.name, gridString(inst.steps()))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := p.Encode(&buf); err != nil {
+		t.Fatalf("unexpected error encoding %v", err)
+	}
+	if _, err := DecodeWithOptions(&buf, DecodeOptions{}); err != nil {
+		t.Errorf("unexpected error decoding the encoded grid %v", err)
+	}
+}
+
+func TestFromGridErrors(t *testing.T) {
+
+	row := make([]bool, 16)
+
+	if _, err := FromGrid("", 120, []string{"kick"}, [][]bool{row, row}); err == nil {
+		t.Errorf("expected an error for a missing name")
+	}
+	if _, err := FromGrid("", 120, []string{"kick", "snare"}, [][]bool{row, row[:8]}); !errors.Is(err, ErrInvalidStep) {
+		t.Errorf("expected %v for rows of different lengths, got %v", ErrInvalidStep, err)
+	}
+	if _, err := FromGrid("", 120, []string{"kick"}, [][]bool{row[:0]}); !errors.Is(err, ErrInvalidStep) {
+		t.Errorf("expected %v for rows that can't be encoded, got %v", ErrInvalidStep, err)
+	}
+}
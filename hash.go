@@ -0,0 +1,57 @@
+package drum
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"sort"
+	"strings"
+)
+
+// RhythmHash returns a SHA-256 fingerprint of the pattern's step grid alone.
+// Only the instruments' names, lower cased and trimmed of surrounding
+// whitespace, and their steps are hashed; the tempo, version and instrument
+// ids are not, and neither is the order the instruments appear in. Patterns
+// with the same hits at different tempos therefore share a rhythm hash.
+func (p Pattern) RhythmHash() [32]byte {
+
+	records := make([][]byte, 0, len(p.instruments))
+
+	for _, inst := range p.instruments {
+		var record bytes.Buffer
+		name := strings.ToLower(strings.TrimSpace(inst.name))
+
+		binary.Write(&record, binary.LittleEndian, uint32(len(name)))
+		record.WriteString(name)
+		binary.Write(&record, binary.LittleEndian, uint32(inst.stepCount()))
+
+		for _, step := range inst.steps() {
+			if isOn(step) {
+				record.WriteByte(StepOn)
+			} else {
+				record.WriteByte(StepOff)
+			}
+		}
+		records = append(records, record.Bytes())
+	}
+
+	sort.Slice(records, func(a, b int) bool {
+		return bytes.Compare(records[a], records[b]) < 0
+	})
+
+	h := sha256.New()
+	for _, record := range records {
+		h.Write(record)
+	}
+
+	var sum [32]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
+
+// SameGroove reports whether a and b play the same rhythm, whatever their
+// tempo or version, by comparing their RhythmHash.
+func SameGroove(a, b Pattern) bool {
+
+	return a.RhythmHash() == b.RhythmHash()
+}
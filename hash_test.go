@@ -0,0 +1,44 @@
+package drum
+
+import "testing"
+
+func TestRhythmHash(t *testing.T) {
+
+	a := Pattern{version: "0.808-alpha", tempo: 120, instruments: []Instrument{
+		{num: 0, name: "kick", measure: []Step{{1, 0, 0, 0}}},
+		{num: 1, name: "snare", measure: []Step{{0, 0, 1, 0}}},
+	}}
+	b := Pattern{version: "0.909", tempo: 98.4, instruments: []Instrument{
+		{num: 5, name: "Snare ", measure: []Step{{0, 0, 1, 0}}},
+		{num: 9, name: "KICK", measure: []Step{{1, 0, 0, 0}}},
+	}}
+	c := Pattern{version: "0.808-alpha", tempo: 120, instruments: []Instrument{
+		{num: 0, name: "kick", measure: []Step{{1, 0, 0, 0}}},
+		{num: 1, name: "snare", measure: []Step{{0, 0, 0, 1}}},
+	}}
+
+	if a.RhythmHash() != b.RhythmHash() {
+		t.Errorf("expected the same rhythm at different tempos to share a hash")
+	}
+	if a.RhythmHash() == c.RhythmHash() {
+		t.Errorf("expected different rhythms to hash differently")
+	}
+}
+
+func TestSameGroove(t *testing.T) {
+
+	a := Pattern{version: "0.808-alpha", tempo: 120, instruments: []Instrument{
+		{num: 0, name: "kick", measure: []Step{{1, 0, 0, 0}}},
+	}}
+	b := a
+	b.version, b.tempo = "0.909", 240
+
+	if !SameGroove(a, b) {
+		t.Errorf("expected a tempo and version change to keep the groove")
+	}
+
+	b.instruments = []Instrument{{num: 0, name: "kick", measure: []Step{{1, 0, 1, 0}}}}
+	if SameGroove(a, b) {
+		t.Errorf("expected different steps to be a different groove")
+	}
+}
@@ -0,0 +1,147 @@
+package drum
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// hydrogenSongXML is a song as Hydrogen saves it, trimmed to the elements
+// ReadHydrogen reads and a few it doesn't
+const hydrogenSongXML = `<?xml version="1.0" encoding="UTF-8"?>
+<song>
+ <version>0.9.7</version>
+ <bpm>96.5</bpm>
+ <volume>0.5</volume>
+ <name>Funky</name>
+ <instrumentList>
+  <instrument><id>0</id><name>Kick</name><volume>1</volume><isMuted>false</isMuted><gain>1</gain></instrument>
+  <instrument><id>1</id><name>Snare</name><isMuted>true</isMuted></instrument>
+  <instrument><id>2</id><name>Hat</name><gain>0.5</gain></instrument>
+ </instrumentList>
+ <patternList>
+  <pattern>
+   <name>fill</name>
+   <size>96</size>
+   <noteList><note><position>0</position><instrument>1</instrument></note></noteList>
+  </pattern>
+  <pattern>
+   <name>groove</name>
+   <size>192</size>
+   <noteList>
+    <note><position>0</position><velocity>0.8</velocity><instrument>0</instrument></note>
+    <note><position>96</position><velocity>1</velocity><instrument>0</instrument></note>
+    <note><position>49</position><instrument>1</instrument></note>
+    <note><position>143</position><velocity>0.3</velocity><instrument>1</instrument></note>
+    <note><position>144</position><velocity>0.6</velocity><instrument>1</instrument></note>
+    <note><position>190</position><instrument>2</instrument></note>
+   </noteList>
+  </pattern>
+ </patternList>
+ <patternSequence><group><patternID>groove</patternID></group></patternSequence>
+</song>
+`
+
+func TestReadHydrogen(t *testing.T) {
+
+	p, err := ReadHydrogen(strings.NewReader(hydrogenSongXML))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if p.Version() != "Funky" || p.Tempo() != 96.5 || len(p.Instruments()) != 3 {
+		t.Fatalf("expected Funky at 96.5 bpm with 3 instruments, got %q at %v with %d", p.Version(), p.Tempo(), len(p.Instruments()))
+	}
+
+	tests := []struct {
+		name  string
+		grid  string
+		muted bool
+		gain  float32
+	}{
+		{"Kick", "x-------x-------", false, 1},
+		{"Snare", "----x-------x---", true, 1},
+		{"Hat", "x---------------", false, 0.5},
+	}
+	for i, tt := range tests {
+		inst := p.Instruments()[i]
+		want, _ := parseSteps(tt.grid, 0)
+		if inst.ID() != uint32(i) || inst.Name() != tt.name || !reflect.DeepEqual(inst.Steps(), want) ||
+			inst.Muted() != tt.muted || inst.Gain() != tt.gain {
+			t.Errorf("instrument %d: expected %s %s, muted %v, gain %v, got %v", i, tt.name, tt.grid, tt.muted, tt.gain, inst)
+		}
+	}
+
+	// 0.8 is the default velocity, and the louder of two notes on a step wins
+	velocities := []struct {
+		inst, step int
+		want       uint8
+	}{
+		{0, 0, 102}, {0, 8, 127}, {1, 4, 102}, {1, 12, 76},
+	}
+	for _, v := range velocities {
+		if got, _ := p.Instruments()[v.inst].StepValue(v.step); got.Velocity != v.want {
+			t.Errorf("instrument %d step %d: expected velocity %d, got %d", v.inst, v.step, v.want, got.Velocity)
+		}
+	}
+}
+
+func TestReadHydrogenInvalid(t *testing.T) {
+
+	tests := []struct {
+		name string
+		song string
+	}{
+		{"not XML", "SPLICE"},
+		{"no patterns", "<song><bpm>120</bpm></song>"},
+		{"missing pattern", "<song><patternList><pattern><name>a</name><size>192</size></pattern></patternList>" +
+			"<patternSequence><group><patternID>b</patternID></group></patternSequence></song>"},
+		{"empty pattern", "<song><patternList><pattern><name>a</name></pattern></patternList></song>"},
+		{"unknown instrument", "<song><patternList><pattern><name>a</name><size>192</size>" +
+			"<noteList><note><instrument>3</instrument></note></noteList></pattern></patternList></song>"},
+		{"duplicate ids", "<song><instrumentList><instrument><id>1</id></instrument><instrument><id>1</id></instrument></instrumentList>" +
+			"<patternList><pattern><name>a</name><size>192</size></pattern></patternList></song>"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ReadHydrogen(strings.NewReader(tt.song)); !errors.Is(err, ErrInvalidHydrogen) {
+				t.Errorf("expected %v, got %v", ErrInvalidHydrogen, err)
+			}
+		})
+	}
+}
+
+func TestWriteHydrogen(t *testing.T) {
+
+	p := NewPattern("0.808-alpha", 120)
+	p.AddInstrument(40, "kick").SetSteps("x---x---x---x---")
+	p.AddInstrument(41, "snare").SetSteps("----x-------x---")
+	p.AddInstrument(42, "hh").SetSteps("--x---x---x---x-")
+	p.SetVelocity(40, 4, 64)
+	p.SetSolo(41, true)
+	p.SetGain(42, 0.25)
+
+	var buf bytes.Buffer
+	if err := p.WriteHydrogen(&buf); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	for _, want := range []string{"<bpm>120</bpm>", "<size>192</size>", "<position>96</position>", "<isSoloed>true</isSoloed>"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("expected the song to hold %s", want)
+		}
+	}
+
+	read, err := ReadHydrogen(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !read.Equal(*p) {
+		t.Errorf("expected the pattern back, got\n%v\nwant\n%v", read, p)
+	}
+	got := read.Instruments()
+	if !got[1].Solo() || got[0].Solo() || got[2].Gain() != 0.25 {
+		t.Errorf("expected the playback attributes back, got %+v", got)
+	}
+}
@@ -0,0 +1,184 @@
+package drum
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// Index is an in-memory library of patterns that can be searched by tempo,
+// instrument, tag and rhythm. The zero Index is empty and ready to use. An
+// Index isn't safe for concurrent use while patterns are being added.
+type Index struct {
+	patterns     []NamedPattern
+	byInstrument map[string][]int
+	byTag        map[string][]int
+}
+
+// Match is a pattern found by Index.Similar with its Similarity to the
+// pattern searched for
+type Match struct {
+	NamedPattern
+	Similarity float64
+}
+
+// NewIndex returns an index holding the given patterns
+func NewIndex(patterns []NamedPattern) *Index {
+
+	index := &Index{}
+	for _, p := range patterns {
+		index.Add(p)
+	}
+	return index
+}
+
+// IndexDir decodes the directory tree rooted at root as DecodeDir does, with
+// the metadata in the patterns' sidecars, and indexes the patterns it holds,
+// returning the errors DecodeDir reports alongside.
+func IndexDir(root string, workers int) (*Index, []error) {
+
+	return IndexDirContext(context.Background(), root, workers)
+}
+
+// IndexDirContext indexes the directory tree rooted at root like IndexDir,
+// but decodes it as DecodeDirContext does, so that once ctx is done the
+// index holds only the patterns decoded by then.
+func IndexDirContext(ctx context.Context, root string, workers int) (*Index, []error) {
+
+	patterns, errs := DecodeDirContext(ctx, root, workers)
+	return NewIndex(patterns), errs
+}
+
+// Add adds a copy of p to the index
+func (x *Index) Add(p NamedPattern) {
+
+	if x.byInstrument == nil {
+		x.byInstrument = make(map[string][]int)
+		x.byTag = make(map[string][]int)
+	}
+
+	n := len(x.patterns)
+	p.Pattern = p.Pattern.Clone()
+	x.patterns = append(x.patterns, p)
+
+	seen := make(map[string]bool)
+	for _, inst := range p.Pattern.instruments {
+		key := indexKey(inst.name)
+		if !seen[key] {
+			seen[key] = true
+			x.byInstrument[key] = append(x.byInstrument[key], n)
+		}
+	}
+
+	seen = make(map[string]bool)
+	for _, tag := range p.Pattern.Meta().Tags {
+		key := indexKey(tag)
+		if !seen[key] {
+			seen[key] = true
+			x.byTag[key] = append(x.byTag[key], n)
+		}
+	}
+}
+
+// Len returns the number of patterns in the index
+func (x *Index) Len() int {
+
+	return len(x.patterns)
+}
+
+// ByTempoRange returns the patterns whose tempo is between min and max BPM
+// inclusive, as TempoInRange decides, in the order they were added.
+func (x *Index) ByTempoRange(min, max float32) []NamedPattern {
+
+	var found []NamedPattern
+	for _, p := range x.patterns {
+		if p.Pattern.TempoInRange(min, max) {
+			found = append(found, p)
+		}
+	}
+	return found
+}
+
+// ByInstrument returns the patterns with an instrument called name, in the
+// order they were added. Names are compared ignoring case and surrounding
+// whitespace.
+func (x *Index) ByInstrument(name string) []NamedPattern {
+
+	var found []NamedPattern
+	for _, n := range x.byInstrument[indexKey(name)] {
+		found = append(found, x.patterns[n])
+	}
+	return found
+}
+
+// ByTag returns the patterns whose metadata is tagged tag, in the order
+// they were added. Tags are compared ignoring case and surrounding
+// whitespace.
+func (x *Index) ByTag(tag string) []NamedPattern {
+
+	var found []NamedPattern
+	for _, n := range x.byTag[indexKey(tag)] {
+		found = append(found, x.patterns[n])
+	}
+	return found
+}
+
+// Similar returns the patterns whose Similarity to p is at least threshold,
+// most similar first, and in the order they were added when equally similar.
+func (x *Index) Similar(p Pattern, threshold float64) []Match {
+
+	var matches []Match
+	for _, q := range x.patterns {
+		if s := Similarity(p, q.Pattern); s >= threshold {
+			matches = append(matches, Match{NamedPattern: q, Similarity: s})
+		}
+	}
+
+	sort.SliceStable(matches, func(a, b int) bool { return matches[a].Similarity > matches[b].Similarity })
+	return matches
+}
+
+// Similarity compares the step grids of a and b, returning from 0 when they
+// share no hits to 1 when they have the same ones. It's the share of all
+// their hits that both patterns play, matching instruments by name ignoring
+// case and surrounding whitespace, so ids, tempo and instrument order don't
+// count. Two patterns without any hits are the same.
+func Similarity(a, b Pattern) float64 {
+
+	type hit struct {
+		name string
+		step int
+	}
+
+	hits := func(p Pattern) map[hit]bool {
+
+		set := make(map[hit]bool)
+		for _, inst := range p.instruments {
+			for s, step := range inst.steps() {
+				if isOn(step) {
+					set[hit{indexKey(inst.name), s}] = true
+				}
+			}
+		}
+		return set
+	}
+
+	as, bs := hits(a), hits(b)
+	if len(as) == 0 && len(bs) == 0 {
+		return 1
+	}
+
+	shared := 0
+	for h := range as {
+		if bs[h] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(as)+len(bs)-shared)
+}
+
+// indexKey normalizes an instrument name for searching
+func indexKey(name string) string {
+
+	return strings.ToLower(strings.TrimSpace(name))
+}
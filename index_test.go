@@ -0,0 +1,112 @@
+package drum_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	drum "github.com/chrishiestand/golang-challenge-1-drum_machine"
+	"github.com/chrishiestand/golang-challenge-1-drum_machine/drumtest"
+)
+
+// names returns the base names of the patterns' paths
+func names(ps []drum.NamedPattern) []string {
+
+	var names []string
+	for _, p := range ps {
+		names = append(names, filepath.Base(p.Path))
+	}
+	return names
+}
+
+func TestIndex(t *testing.T) {
+
+	dir := drumtest.FixtureDir(t, "fixtures", "pattern_1.splice", "pattern_2.splice", "pattern_3.splice", "pattern_4.splice", "truncated_payload.splice")
+
+	index, errs := drum.IndexDir(dir, 2)
+	if len(errs) != 1 {
+		t.Errorf("expected one error for truncated_payload.splice, got %v", errs)
+	}
+	if index.Len() != 4 {
+		t.Fatalf("expected 4 patterns, got %d", index.Len())
+	}
+
+	tData := []struct {
+		name     string
+		got      []drum.NamedPattern
+		expected []string
+	}{
+		{"tempo 110-130", index.ByTempoRange(110, 130), []string{"pattern_1.splice", "pattern_3.splice"}},
+		{"tempo 300-400", index.ByTempoRange(300, 400), nil},
+		{"kick", index.ByInstrument(" Kick "), []string{"pattern_1.splice", "pattern_2.splice", "pattern_3.splice", "pattern_4.splice"}},
+		{"cowbell", index.ByInstrument("cowbell"), []string{"pattern_1.splice", "pattern_2.splice"}},
+		{"theremin", index.ByInstrument("theremin"), nil},
+	}
+
+	for _, exp := range tData {
+		if got := names(exp.got); !reflect.DeepEqual(got, exp.expected) {
+			t.Errorf("%s: got %v, expected %v", exp.name, got, exp.expected)
+		}
+	}
+
+	p1, err := drum.DecodeFile(filepath.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matches := index.Similar(*p1, 0.5)
+	if len(matches) == 0 || filepath.Base(matches[0].Path) != "pattern_1.splice" || matches[0].Similarity != 1 {
+		t.Fatalf("expected pattern_1 to match itself first, got %+v", matches)
+	}
+	for n := 1; n < len(matches); n++ {
+		if matches[n].Similarity > matches[n-1].Similarity || matches[n].Similarity < 0.5 {
+			t.Errorf("match %d has similarity %v after %v", n, matches[n].Similarity, matches[n-1].Similarity)
+		}
+	}
+	if all := index.Similar(*p1, 0); len(all) != 4 {
+		t.Errorf("expected every pattern at threshold 0, got %d", len(all))
+	}
+
+	// an index holds its own copies
+	p1.SetTempo(1)
+	index.Add(drum.NamedPattern{Path: "p1", Pattern: *p1})
+	p1.SetTempo(500)
+	if got := index.ByTempoRange(1, 1); len(got) != 1 || got[0].Path != "p1" {
+		t.Errorf("expected the added pattern at its tempo when added, got %v", names(got))
+	}
+	if (&drum.Index{}).Len() != 0 || len((&drum.Index{}).ByInstrument("kick")) != 0 {
+		t.Errorf("expected the zero Index to be empty")
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+
+	pattern := func(grids ...string) drum.Pattern {
+		p := drum.NewPattern("similar", 120)
+		for n, grid := range grids {
+			if err := p.AddInstrument(uint32(n), []string{"kick", "snare"}[n]).SetSteps(grid); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return *p
+	}
+
+	tData := []struct {
+		name     string
+		a, b     drum.Pattern
+		expected float64
+	}{
+		{"same", pattern("x---x---x---x---"), pattern("x---x---x---x---"), 1},
+		{"half", pattern("x---x---x---x---"), pattern("x-------x-------"), 0.5},
+		{"disjoint", pattern("x---------------"), pattern("-x--------------"), 0},
+		{"other instrument", pattern("x---------------", "----------------"), pattern("----------------", "x---------------"), 0},
+		{"empty", pattern("----------------"), pattern("----------------"), 1},
+		{"one empty", pattern("x---------------"), pattern("----------------"), 0},
+	}
+
+	for _, exp := range tData {
+		if got := drum.Similarity(exp.a, exp.b); got != exp.expected {
+			t.Errorf("%s: expected %v, got %v", exp.name, exp.expected, got)
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package drum
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// stepsPerMeasure is the number of steps grouped into each measure
+// of an instrument.
+const stepsPerMeasure = 4
+
+// measuresPerInstrument is the number of measures each instrument holds
+// in a .splice file.
+const measuresPerInstrument = 4
+
+// steps returns the instrument's steps as one flat slice, in play order.
+func (i Instrument) steps() []byte {
+
+	steps := make([]byte, 0, i.stepCount())
+
+	for _, measure := range i.measure {
+		steps = append(steps, measure...)
+	}
+	return steps
+}
+
+// stepCount returns the total number of steps across every measure
+func (i Instrument) stepCount() int {
+
+	n := 0
+
+	for _, measure := range i.measure {
+		n += len(measure)
+	}
+	return n
+}
+
+// setSteps replaces the instrument's measures with the given flat steps,
+// grouping them into measures of stepsPerMeasure. A trailing partial
+// measure holds any remainder. Any raw bytes kept from decoding and any
+// Expression are dropped.
+func (i *Instrument) setSteps(steps []byte) {
+
+	measures := make([]Step, 0, (len(steps)+stepsPerMeasure-1)/stepsPerMeasure)
+
+	for len(steps) > 0 {
+		n := stepsPerMeasure
+		if len(steps) < n {
+			n = len(steps)
+		}
+
+		measure := make(Step, n)
+		copy(measure, steps[:n])
+		measures = append(measures, measure)
+		steps = steps[n:]
+	}
+	i.measure = measures
+	i.raw = nil
+	i.expression = nil
+}
+
+// resize truncates the instrument to n steps, or pads it with StepOff
+// steps until it has n.
+func (i *Instrument) resize(n int) {
+
+	steps := i.steps()
+
+	if len(steps) >= n {
+		i.setSteps(steps[:n])
+		return
+	}
+	for len(steps) < n {
+		steps = append(steps, StepOff)
+	}
+	i.setSteps(steps)
+}
+
+// RepeatedMeasures groups the indices of measures whose steps are identical.
+// Only measures that repeat are reported; each group lists its indices in
+// ascending order and groups are ordered by their first index.
+func (i Instrument) RepeatedMeasures() [][]int {
+
+	var groups [][]int
+	grouped := make([]bool, len(i.measure))
+
+	for a := range i.measure {
+		if grouped[a] {
+			continue
+		}
+
+		group := []int{a}
+		for b := a + 1; b < len(i.measure); b++ {
+			if !grouped[b] && bytes.Equal(i.measure[a], i.measure[b]) {
+				grouped[b] = true
+				group = append(group, b)
+			}
+		}
+
+		if len(group) > 1 {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// hits returns the number of steps that are on
+func (i Instrument) hits() int {
+
+	n := 0
+
+	for _, measure := range i.measure {
+		for _, step := range measure {
+			if isOn(step) {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// step returns the step at the given index into the flat step sequence
+func (i Instrument) step(global int) (byte, error) {
+
+	m, s, err := i.locate(global)
+	if err != nil {
+		return StepOff, err
+	}
+	return i.measure[m][s], nil
+}
+
+// setStep sets the step at the given index into the flat step sequence
+func (i *Instrument) setStep(global int, value byte) error {
+
+	m, s, err := i.locate(global)
+	if err != nil {
+		return err
+	}
+	i.measure[m][s] = value
+	i.raw = nil
+	return nil
+}
+
+// locate maps an index into the flat step sequence onto a measure and the
+// step within it
+func (i Instrument) locate(global int) (int, int, error) {
+
+	if global >= 0 {
+		offset := global
+		for m, measure := range i.measure {
+			if offset < len(measure) {
+				return m, offset, nil
+			}
+			offset -= len(measure)
+		}
+	}
+	return 0, 0, fmt.Errorf("%w: step %d is out of range for instrument %d with %d steps", ErrInvalidStep, global, i.num, i.stepCount())
+}
+
+// StepAt reports whether the step at the given index is on. Steps are
+// indexed across measures, so with four steps per measure index 5 is the
+// second step of the second measure.
+func (i Instrument) StepAt(global int) (bool, error) {
+
+	step, err := i.step(global)
+	return isOn(step), err
+}
+
+// SetStepAt turns the step at the given index on or off, indexed as in
+// StepAt.
+func (i *Instrument) SetStepAt(global int, on bool) error {
+
+	if on {
+		return i.setStep(global, StepOn)
+	}
+	return i.setStep(global, StepOff)
+}
+
+// Intervals returns the gaps, in steps, between each hit and the next, ending
+// with the gap from the last hit around the loop to the first. A kick on every
+// quarter note of 16 steps gives [4 4 4 4], and a single hit gives the step
+// count. A silent instrument gives an empty slice.
+func (i Instrument) Intervals() []int {
+
+	steps := i.steps()
+	intervals := []int{}
+
+	var onsets []int
+	for s, step := range steps {
+		if isOn(step) {
+			onsets = append(onsets, s)
+		}
+	}
+
+	for n, onset := range onsets {
+		if n+1 < len(onsets) {
+			intervals = append(intervals, onsets[n+1]-onset)
+		} else {
+			intervals = append(intervals, len(steps)-onset+onsets[0])
+		}
+	}
+	return intervals
+}
+
+// Mask returns the instrument's first 16 steps as a bitmask, where bit n
+// (the bit with value 1<<n) is set when step n is on. Step 0, the first step
+// of the first measure, is the least significant bit and step 15 the most
+// significant. Steps past the sixteenth don't fit and are left out; missing
+// steps of a shorter instrument read as off.
+func (i Instrument) Mask() uint16 {
+
+	var mask uint16
+
+	for s, step := range i.steps() {
+		if s >= 16 {
+			break
+		}
+		if isOn(step) {
+			mask |= 1 << uint(s)
+		}
+	}
+	return mask
+}
+
+// InstrumentFromMask returns an instrument with the given id and name whose
+// 16 steps are read from mask, using the bit ordering of Mask.
+func InstrumentFromMask(id uint32, name string, mask uint16) Instrument {
+
+	steps := make([]byte, measuresPerInstrument*stepsPerMeasure)
+
+	for s := range steps {
+		if mask&(1<<uint(s)) != 0 {
+			steps[s] = StepOn
+		}
+	}
+
+	inst := Instrument{num: id, name: name}
+	inst.setSteps(steps)
+	return inst
+}
+
+// DiffBeats returns the indices of the steps, counted across measures, at
+// which i and other disagree, in ascending order. The instruments must have
+// the same number of steps.
+func (i Instrument) DiffBeats(other Instrument) ([]int, error) {
+
+	a, b := i.steps(), other.steps()
+	if len(a) != len(b) {
+		return nil, fmt.Errorf("%w: instrument %d has %d steps, instrument %d has %d",
+			ErrInvalidStep, i.num, len(a), other.num, len(b))
+	}
+
+	diff := []int{}
+	for s := range a {
+		if isOn(a[s]) != isOn(b[s]) {
+			diff = append(diff, s)
+		}
+	}
+	return diff, nil
+}
+
+// Line returns the instrument's line of Pattern.String, without the trailing
+// newline, drawing hits with onChar and rests with offChar. Steps are grouped
+// into the same bars between | separators as the full pattern, so lines of
+// instruments from one pattern line up with each other and with String.
+func (i Instrument) Line(onChar, offChar rune) string {
+
+	var b strings.Builder
+	i.renderLine(&b, onChar, offChar)
+	return b.String()
+}
+
+// UniformMeasure returns a copy of the instrument's measure and true when
+// every one of its measures holds the same steps, such as a hi-hat playing
+// one bar four times over. It returns nil and false when any measure
+// differs, or when the instrument has no measures.
+func (i Instrument) UniformMeasure() (Step, bool) {
+
+	if len(i.measure) == 0 {
+		return nil, false
+	}
+
+	for _, measure := range i.measure[1:] {
+		if !bytes.Equal(measure, i.measure[0]) {
+			return nil, false
+		}
+	}
+	return append(Step(nil), i.measure[0]...), true
+}
+
+// LongestRest returns the length of the longest run of consecutive steps
+// without a hit. The pattern loops, so a run may wrap around from the last
+// step to the first: with hits only on steps 4 and 11 of 16, the longest
+// rest is the 8 steps from 12 round to 3. A silent instrument rests for its
+// whole step count and one that hits on every step returns 0.
+func (i Instrument) LongestRest() int {
+
+	steps := i.steps()
+	if i.hits() == 0 {
+		return len(steps)
+	}
+
+	longest, run := 0, 0
+
+	// two passes over the loop catch the runs that wrap around
+	for s := 0; s < 2*len(steps); s++ {
+		if isOn(steps[s%len(steps)]) {
+			run = 0
+			continue
+		}
+		run++
+		if run > longest {
+			longest = run
+		}
+	}
+	return longest
+}
+
+// WindowDensity returns the number of hits in each consecutive window of
+// windowSteps steps, in order. When windowSteps doesn't divide the step
+// count, the last window holds the steps left over and is shorter than the
+// rest. A windowSteps below 1 is treated as 1, giving one entry per step.
+func (i Instrument) WindowDensity(windowSteps int) []int {
+
+	if windowSteps < 1 {
+		windowSteps = 1
+	}
+
+	steps := i.steps()
+	density := make([]int, 0, (len(steps)+windowSteps-1)/windowSteps)
+
+	for s, step := range steps {
+		if s%windowSteps == 0 {
+			density = append(density, 0)
+		}
+		if isOn(step) {
+			density[len(density)-1]++
+		}
+	}
+	return density
+}
@@ -0,0 +1,227 @@
+package drum
+
+import (
+	"errors"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRepeatedMeasures(t *testing.T) {
+	tData := []struct {
+		measure  []Step
+		expected [][]int
+	}{
+		{[]Step{{1, 0, 0, 0}, {0, 0, 1, 0}, {1, 0, 0, 0}, {0, 0, 1, 0}}, [][]int{{0, 2}, {1, 3}}},
+		{[]Step{{1, 0, 1, 0}, {1, 0, 1, 0}, {1, 0, 1, 0}, {1, 0, 1, 0}}, [][]int{{0, 1, 2, 3}}},
+		{[]Step{{1, 0, 0, 0}, {0, 1, 0, 0}, {0, 0, 1, 0}, {0, 0, 0, 1}}, nil},
+	}
+
+	for _, exp := range tData {
+
+		got := Instrument{measure: exp.measure}.RepeatedMeasures()
+		if !reflect.DeepEqual(got, exp.expected) {
+			t.Errorf("%v: got %v, expected %v", exp.measure, got, exp.expected)
+		}
+	}
+}
+
+// gridString renders steps as x for hits and - for rests
+func gridString(steps []byte) string {
+
+	s := ""
+	for _, step := range steps {
+		if step == StepOn {
+			s += "x"
+		} else {
+			s += "-"
+		}
+	}
+	return s
+}
+
+func TestStepAt(t *testing.T) {
+
+	inst := Instrument{num: 1, name: "snare", measure: []Step{{0, 0, 0, 0}, {0, 0, 0, 0}}}
+
+	if err := inst.SetStepAt(6, true); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if on, err := inst.StepAt(6); err != nil || !on {
+		t.Errorf("expected step 6 on, got %v %v", on, err)
+	}
+	if on, err := inst.StepAt(2); err != nil || on {
+		t.Errorf("expected step 2 off, got %v %v", on, err)
+	}
+	if inst.measure[1][2] != StepOn {
+		t.Errorf("step 6 didn't map onto the third step of the second measure")
+	}
+
+	for _, global := range []int{-1, 8} {
+		if _, err := inst.StepAt(global); err == nil {
+			t.Errorf("StepAt(%d): expected an error", global)
+		}
+		if err := inst.SetStepAt(global, true); err == nil {
+			t.Errorf("SetStepAt(%d): expected an error", global)
+		}
+	}
+}
+
+func TestIntervals(t *testing.T) {
+	tData := []struct {
+		measure  []Step
+		expected []int
+	}{
+		{[]Step{{1, 0, 0, 0}, {1, 0, 0, 0}, {1, 0, 0, 0}, {1, 0, 0, 0}}, []int{4, 4, 4, 4}},
+		{[]Step{{0, 0, 1, 0}, {0, 0, 1, 0}, {1, 0, 1, 0}, {0, 0, 1, 0}}, []int{4, 2, 2, 4, 4}},
+		{[]Step{{0, 1, 0, 0}}, []int{4}},
+		{[]Step{{0, 0, 0, 0}}, []int{}},
+	}
+
+	for _, exp := range tData {
+		if got := (Instrument{measure: exp.measure}).Intervals(); !reflect.DeepEqual(got, exp.expected) {
+			t.Errorf("%v: got %v, expected %v", exp.measure, got, exp.expected)
+		}
+	}
+}
+
+func TestMask(t *testing.T) {
+	tData := []struct {
+		measure []Step
+		mask    uint16
+	}{
+		{[]Step{{1, 0, 0, 0}, {0, 0, 0, 0}, {0, 0, 0, 0}, {0, 0, 0, 0}}, 0x0001},
+		{[]Step{{0, 0, 0, 0}, {0, 0, 0, 0}, {0, 0, 0, 0}, {0, 0, 0, 1}}, 0x8000},
+		{[]Step{{1, 0, 0, 0}, {1, 0, 0, 0}, {1, 0, 0, 0}, {1, 0, 0, 0}}, 0x1111},
+		{[]Step{{0, 0, 1, 0}, {0, 0, 1, 0}}, 0x0044},
+		{[]Step{{1, 1, 1, 1}, {1, 1, 1, 1}, {1, 1, 1, 1}, {1, 1, 1, 1}, {1, 1}}, 0xffff},
+	}
+
+	for _, exp := range tData {
+
+		inst := Instrument{measure: exp.measure}
+		if got := inst.Mask(); got != exp.mask {
+			t.Errorf("%s: got mask %#04x, expected %#04x", gridString(inst.steps()), got, exp.mask)
+		}
+	}
+
+	inst := InstrumentFromMask(7, "clave", 0x9249)
+	if inst.num != 7 || inst.name != "clave" {
+		t.Errorf("got instrument (%d) %s, expected (7) clave", inst.num, inst.name)
+	}
+	if got := gridString(inst.steps()); got != "x--x--x--x--x--x" {
+		t.Errorf("0x9249 unpacked to %s", got)
+	}
+	if got := inst.Mask(); got != 0x9249 {
+		t.Errorf("mask didn't round trip, got %#04x", got)
+	}
+}
+
+func TestDiffBeats(t *testing.T) {
+
+	a := Instrument{num: 0, measure: []Step{{1, 0, 1, 0}, {1, 0, 0, 0}}}
+	b := Instrument{num: 1, measure: []Step{{1, 1, 1, 0}, {0, 0, 0, 1}}}
+
+	got, err := a.DiffBeats(b)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if expected := []int{1, 4, 7}; !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, expected %v", got, expected)
+	}
+
+	if got, _ := a.DiffBeats(a); len(got) != 0 {
+		t.Errorf("an instrument shouldn't differ from itself, got %v", got)
+	}
+
+	short := Instrument{num: 2, measure: []Step{{1, 0, 1, 0}}}
+	if _, err := a.DiffBeats(short); !errors.Is(err, ErrInvalidStep) {
+		t.Errorf("expected %v, got %v", ErrInvalidStep, err)
+	}
+}
+
+func TestLine(t *testing.T) {
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_1.splice - %v", err)
+	}
+
+	lines := strings.Split(decoded.String(), "\n")[2:]
+	for n, inst := range decoded.instruments {
+		if got := inst.Line('x', '-'); got != lines[n] {
+			t.Errorf("got line %q, expected %q", got, lines[n])
+		}
+	}
+
+	if got, expected := decoded.instruments[0].Line('●', '·'), "(0) kick\t|●···|●···|●···|●···|"; got != expected {
+		t.Errorf("got line %q, expected %q", got, expected)
+	}
+}
+
+func TestUniformMeasure(t *testing.T) {
+	tData := []struct {
+		measure  []Step
+		expected Step
+		uniform  bool
+	}{
+		{[]Step{{1, 0, 1, 0}, {1, 0, 1, 0}, {1, 0, 1, 0}, {1, 0, 1, 0}}, Step{1, 0, 1, 0}, true},
+		{[]Step{{0, 0, 0, 0}}, Step{0, 0, 0, 0}, true},
+		{[]Step{{1, 0, 1, 0}, {1, 0, 1, 0}, {1, 0, 1, 0}, {1, 0, 1, 1}}, nil, false},
+		{[]Step{{1, 0, 1, 0}, {1, 0}}, nil, false},
+		{nil, nil, false},
+	}
+
+	for _, exp := range tData {
+
+		got, uniform := Instrument{measure: exp.measure}.UniformMeasure()
+		if uniform != exp.uniform || !reflect.DeepEqual(got, exp.expected) {
+			t.Errorf("%v: got %v, %v, expected %v, %v", exp.measure, got, uniform, exp.expected, exp.uniform)
+		}
+	}
+}
+
+func TestLongestRest(t *testing.T) {
+	tData := []struct {
+		measure  []Step
+		expected int
+	}{
+		{[]Step{{0, 0, 0, 0}, {1, 0, 0, 0}, {0, 0, 0, 1}, {0, 0, 0, 0}}, 8},
+		{[]Step{{1, 0, 0, 0}, {1, 0, 0, 0}, {1, 0, 0, 0}, {1, 0, 0, 0}}, 3},
+		{[]Step{{0, 0, 0, 0}, {0, 0, 0, 0}, {0, 0, 0, 0}, {0, 0, 0, 0}}, 16},
+		{[]Step{{1, 1, 1, 1}, {1, 1, 1, 1}, {1, 1, 1, 1}, {1, 1, 1, 1}}, 0},
+		{[]Step{{0, 0, 1, 0}, {0, 0, 0, 0}, {0, 0, 0, 0}, {0, 0, 0, 0}}, 15},
+	}
+
+	for _, exp := range tData {
+
+		inst := Instrument{measure: exp.measure}
+		if got := inst.LongestRest(); got != exp.expected {
+			t.Errorf("%s: got %d, expected %d", gridString(inst.steps()), got, exp.expected)
+		}
+	}
+}
+
+func TestWindowDensity(t *testing.T) {
+
+	inst := Instrument{measure: []Step{{1, 1, 1, 0}, {1, 0, 1, 0}, {0, 0, 1, 0}, {0, 0, 0, 1}}}
+
+	tData := []struct {
+		window   int
+		expected []int
+	}{
+		{4, []int{3, 2, 1, 1}},
+		{8, []int{5, 2}},
+		{16, []int{7}},
+		{6, []int{4, 2, 1}},
+		{0, []int{1, 1, 1, 0, 1, 0, 1, 0, 0, 0, 1, 0, 0, 0, 0, 1}},
+		{32, []int{7}},
+	}
+
+	for _, exp := range tData {
+		if got := inst.WindowDensity(exp.window); !reflect.DeepEqual(got, exp.expected) {
+			t.Errorf("window %d: got %v, expected %v", exp.window, got, exp.expected)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package drum
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+)
+
+// jsonlHeader is the first line WriteJSONL writes
+type jsonlHeader struct {
+	Version string  `json:"version"`
+	Tempo   float32 `json:"tempo"`
+}
+
+// jsonInstrument is the JSON form of an instrument
+type jsonInstrument struct {
+	ID    uint32 `json:"id"`
+	Name  string `json:"name"`
+	Steps []bool `json:"steps"`
+}
+
+func newJSONInstrument(inst Instrument) jsonInstrument {
+
+	steps := make([]bool, 0, inst.stepCount())
+	for _, step := range inst.steps() {
+		steps = append(steps, isOn(step))
+	}
+	return jsonInstrument{ID: inst.num, Name: inst.name, Steps: steps}
+}
+
+// WriteJSONL writes the pattern as newline-delimited JSON: a first line
+// holding the version and tempo, such as
+//
+//	{"version":"0.808-alpha","tempo":120}
+//
+// followed by one line per instrument with its id, name and steps:
+//
+//	{"id":0,"name":"kick","steps":[true,false,false,false,...]}
+//
+// Every line is a complete JSON document.
+func (p Pattern) WriteJSONL(w io.Writer) error {
+
+	enc := json.NewEncoder(w)
+
+	if err := enc.Encode(jsonlHeader{Version: p.version, Tempo: p.tempo}); err != nil {
+		return err
+	}
+
+	for _, inst := range p.instruments {
+		if err := enc.Encode(newJSONInstrument(inst)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsonPattern is the JSON form of a pattern
+type jsonPattern struct {
+	Version string       `json:"version"`
+	Tempo   float32      `json:"tempo"`
+	Tracks  []Instrument `json:"tracks"`
+}
+
+// MarshalJSON implements json.Marshaler, writing the pattern as an object
+// with these fields:
+//
+//	version  string   the pattern's version, possibly empty
+//	tempo    number   the tempo in BPM, positive
+//	tracks   array    the instruments in pattern order, each in the form
+//	                  Instrument.MarshalJSON writes
+//
+// such as
+//
+//	{"version":"0.808-alpha","tempo":120,"tracks":[{"id":0,"name":"kick","steps":[true,false,...]},...]}
+//
+// A pattern without instruments has an empty tracks array rather than null.
+func (p Pattern) MarshalJSON() ([]byte, error) {
+
+	jp := jsonPattern{Version: p.version, Tempo: p.tempo, Tracks: p.instruments}
+	if jp.Tracks == nil {
+		jp.Tracks = []Instrument{}
+	}
+	return json.Marshal(jp)
+}
+
+// UnmarshalJSON implements json.Unmarshaler, replacing the pattern with one
+// in the form written by MarshalJSON. The tempo must be given and positive,
+// every track must be valid for Instrument.UnmarshalJSON, and every track
+// must have as many steps as the first. Anything else
+// is rejected with an error naming the first offending track by its index,
+// and the pattern is left unchanged.
+func (p *Pattern) UnmarshalJSON(data []byte) error {
+
+	var jp struct {
+		Version string            `json:"version"`
+		Tempo   *float64          `json:"tempo"`
+		Tracks  []json.RawMessage `json:"tracks"`
+	}
+
+	if err := json.Unmarshal(data, &jp); err != nil {
+		return err
+	}
+
+	if jp.Tempo == nil {
+		return fmt.Errorf("pattern has no tempo")
+	}
+	if *jp.Tempo <= 0 || *jp.Tempo > math.MaxFloat32 {
+		return fmt.Errorf("tempo %v is not a positive float32", *jp.Tempo)
+	}
+
+	decoded := Pattern{version: jp.Version, tempo: float32(*jp.Tempo), instruments: []Instrument{}}
+
+	for n, track := range jp.Tracks {
+		inst, err := unmarshalInstrument(track, fmt.Sprintf("track %d", n))
+		if err != nil {
+			return err
+		}
+		if n > 0 && inst.stepCount() != decoded.instruments[0].stepCount() {
+			return fmt.Errorf("%w: track %d has %d steps, expected %d like track 0",
+				ErrInvalidStep, n, inst.stepCount(), decoded.instruments[0].stepCount())
+		}
+		decoded.instruments = append(decoded.instruments, inst)
+	}
+
+	*p = decoded
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler, writing the instrument as an
+// object with these fields:
+//
+//	id     number   the instrument's id, from 0 to 4294967295
+//	name   string   the instrument's name, not empty
+//	steps  array    booleans, true where the instrument plays, in order
+//	                across its measures; 16 in the original format
+//
+// such as
+//
+//	{"id":0,"name":"kick","steps":[true,false,false,false,...]}
+func (i Instrument) MarshalJSON() ([]byte, error) {
+
+	return json.Marshal(newJSONInstrument(i))
+}
+
+// UnmarshalJSON implements json.Unmarshaler, replacing the instrument with
+// one in the form written by MarshalJSON. The id must fit in 32 bits, the
+// name must not be empty and there must be at least one step; anything
+// else is rejected and the instrument is left unchanged.
+func (i *Instrument) UnmarshalJSON(data []byte) error {
+
+	inst, err := unmarshalInstrument(data, "instrument")
+	if err != nil {
+		return err
+	}
+
+	*i = inst
+	return nil
+}
+
+// unmarshalInstrument decodes and validates the JSON form of an instrument,
+// naming it by label in errors
+func unmarshalInstrument(data []byte, label string) (Instrument, error) {
+
+	var track struct {
+		ID    *int64  `json:"id"`
+		Name  *string `json:"name"`
+		Steps *[]bool `json:"steps"`
+	}
+
+	if err := json.Unmarshal(data, &track); err != nil {
+		return Instrument{}, fmt.Errorf("%s: %w", label, err)
+	}
+
+	if track.ID == nil {
+		return Instrument{}, fmt.Errorf("%s has no id", label)
+	}
+	if *track.ID < 0 || *track.ID > math.MaxUint32 {
+		return Instrument{}, fmt.Errorf("%s: id %d doesn't fit in 32 bits", label, *track.ID)
+	}
+	if track.Name == nil || *track.Name == "" {
+		return Instrument{}, fmt.Errorf("%w: %s has no name", ErrInvalidName, label)
+	}
+	if track.Steps == nil {
+		return Instrument{}, fmt.Errorf("%w: %s has no steps", ErrInvalidStep, label)
+	}
+	if len(*track.Steps) == 0 {
+		return Instrument{}, fmt.Errorf("%w: %s has no steps", ErrInvalidStep, label)
+	}
+
+	steps := make([]byte, len(*track.Steps))
+	for s, on := range *track.Steps {
+		if on {
+			steps[s] = StepOn
+		}
+	}
+
+	inst := Instrument{num: uint32(*track.ID), name: *track.Name}
+	inst.setSteps(steps)
+	return inst, nil
+}
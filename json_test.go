@@ -0,0 +1,169 @@
+package drum
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestWriteJSONL(t *testing.T) {
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_5.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_5.splice - %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := decoded.WriteJSONL(&buf); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 lines, got %d:\n%s", len(lines), lines)
+	}
+	if lines[0] != `{"version":"0.708-alpha","tempo":999}` {
+		t.Errorf("unexpected header line %s", lines[0])
+	}
+
+	var kick jsonInstrument
+	if err := json.Unmarshal([]byte(lines[1]), &kick); err != nil {
+		t.Fatalf("instrument line isn't valid JSON: %v", err)
+	}
+	if kick.ID != 1 || kick.Name != "Kick" || len(kick.Steps) != 16 || !kick.Steps[0] || !kick.Steps[8] || kick.Steps[1] {
+		t.Errorf("unexpected instrument %+v", kick)
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_2.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_2.splice - %v", err)
+	}
+
+	data, err := json.Marshal(decoded)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	var p Pattern
+	if err := json.Unmarshal(data, &p); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !p.Equal(*decoded) {
+		t.Errorf("JSON round trip changed the pattern.\nGot:\n%s\nExpected:\n%s", p, decoded)
+	}
+}
+
+func TestJSONRoundTripResolution(t *testing.T) {
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_2.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_2.splice - %v", err)
+	}
+	fine, err := decoded.WithResolution(8, 4)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	data, err := json.Marshal(fine)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	var p Pattern
+	if err := json.Unmarshal(data, &p); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !p.Equal(fine) {
+		t.Errorf("JSON round trip changed the pattern.\nGot:\n%s\nExpected:\n%s", p, fine)
+	}
+	for _, inst := range p.Instruments() {
+		if n := len(inst.Steps()); n != 32 {
+			t.Errorf("expected %s to keep 32 steps, got %d", inst.Name(), n)
+		}
+	}
+	if issues := Validate(p); len(issues) > 0 {
+		t.Errorf("expected no issues with a 32 step pattern, got %v", issues)
+	}
+}
+
+func TestUnmarshalJSONInvalid(t *testing.T) {
+
+	steps := `[true,false,false,false,true,false,false,false,true,false,false,false,true,false,false,false]`
+
+	tData := []struct {
+		doc     string
+		message string
+	}{
+		{`{"version":"0.808","tracks":[]}`, "no tempo"},
+		{`{"version":"0.808","tempo":0,"tracks":[]}`, "tempo 0"},
+		{`{"version":"0.808","tempo":-98.4,"tracks":[]}`, "tempo -98.4"},
+		{`{"tempo":120,"tracks":[{"id":0,"name":"kick","steps":` + steps + `},{"name":"snare","steps":` + steps + `}]}`, "track 1 has no id"},
+		{`{"tempo":120,"tracks":[{"id":-1,"name":"kick","steps":` + steps + `}]}`, "track 0: id -1"},
+		{`{"tempo":120,"tracks":[{"id":4294967296,"name":"kick","steps":` + steps + `}]}`, "track 0: id 4294967296"},
+		{`{"tempo":120,"tracks":[{"id":0,"steps":` + steps + `}]}`, "track 0 has no name"},
+		{`{"tempo":120,"tracks":[{"id":0,"name":"","steps":` + steps + `}]}`, "track 0 has no name"},
+		{`{"tempo":120,"tracks":[{"id":0,"name":"kick"}]}`, "track 0 has no steps"},
+		{`{"tempo":120,"tracks":[{"id":0,"name":"kick","steps":[]}]}`, "track 0 has no steps"},
+		{`{"tempo":120,"tracks":[{"id":0,"name":"kick","steps":` + steps + `},{"id":1,"name":"snare","steps":[true,false]}]}`, "track 1 has 2 steps"},
+		{`{"tempo":120,"tracks":[{"id":0,"name":"kick","steps":"x---"}]}`, "cannot unmarshal"},
+	}
+
+	for _, exp := range tData {
+
+		p := Pattern{version: "untouched"}
+		err := json.Unmarshal([]byte(exp.doc), &p)
+		if err == nil || !strings.Contains(err.Error(), exp.message) {
+			t.Errorf("%s: expected an error containing %q, got %v", exp.doc, exp.message, err)
+		}
+		if p.version != "untouched" {
+			t.Errorf("%s: the pattern was changed by a failed unmarshal", exp.doc)
+		}
+	}
+}
+
+func TestInstrumentJSON(t *testing.T) {
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_1.splice - %v", err)
+	}
+
+	snare := decoded.instruments[1]
+	data, err := json.Marshal(snare)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	expected := `{"id":1,"name":"snare","steps":[false,false,false,false,true,false,false,false,false,false,false,false,true,false,false,false]}`
+	if string(data) != expected {
+		t.Errorf("got %s, expected %s", data, expected)
+	}
+
+	var inst Instrument
+	if err := json.Unmarshal(data, &inst); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if inst.num != snare.num || inst.name != snare.name || !bytes.Equal(inst.steps(), snare.steps()) {
+		t.Errorf("round trip changed the instrument: got %+v", inst)
+	}
+
+	for _, doc := range []string{`{"id":2,"name":"kick","steps":[]}`, `{"id":2,"steps":[true]}`, `[]`} {
+		if err := json.Unmarshal([]byte(doc), &inst); err == nil {
+			t.Errorf("%s: expected an error", doc)
+		}
+		if inst.name != "snare" {
+			t.Errorf("%s: the instrument was changed by a failed unmarshal", doc)
+		}
+	}
+}
@@ -0,0 +1,538 @@
+package kits
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/chrishiestand/golang-challenge-1-drum_machine/render"
+)
+
+// ErrInvalidFLAC means a sample file isn't a FLAC stream LoadFLAC can read.
+var ErrInvalidFLAC = errors.New("invalid FLAC file")
+
+// flacMagic starts every FLAC stream
+const flacMagic = "fLaC"
+
+// The sample rates and sizes a frame header's codes stand for, with 0 for
+// the stream's own and -1 for those that are reserved
+var (
+	flacSampleRates = [16]int{0, 88200, 176400, 192000, 8000, 16000, 22050, 24000, 32000, 44100, 48000, 96000, -1, -1, -1, -1}
+	flacSampleSizes = [8]int{0, 8, 12, -1, 16, 20, 24, 32}
+)
+
+// The channel assignments of a frame that code one channel as the
+// difference of the two
+const (
+	flacLeftSide  = 8
+	flacRightSide = 9
+	flacMidSide   = 10
+)
+
+// flacInfo is what a stream's STREAMINFO block says about its audio
+type flacInfo struct {
+	sampleRate    int
+	channels      int
+	bitsPerSample int
+}
+
+// LoadFLAC reads a FLAC file of samples at render.SampleRate, in mono or
+// stereo. Samples of other sizes than 16 bits are scaled to 16, and mono
+// samples are played in both channels. Frames' checksums are checked, but
+// the stream's MD5 signature isn't.
+func LoadFLAC(r io.Reader) (render.Sample, error) {
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return render.Sample{}, err
+	}
+	if len(data) < len(flacMagic) || string(data[:len(flacMagic)]) != flacMagic {
+		return render.Sample{}, fmt.Errorf("%w: no fLaC marker", ErrInvalidFLAC)
+	}
+	data = data[len(flacMagic):]
+
+	var info flacInfo
+	haveInfo := false
+	for last := false; !last; {
+		if len(data) < 4 {
+			return render.Sample{}, fmt.Errorf("%w: metadata cut short", ErrInvalidFLAC)
+		}
+		last = data[0]&0x80 != 0
+		kind := data[0] & 0x7f
+		size := int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+		if size > len(data)-4 {
+			return render.Sample{}, fmt.Errorf("%w: metadata block of %d bytes runs past the end of the file", ErrInvalidFLAC, size)
+		}
+		block := data[4 : 4+size]
+		data = data[4+size:]
+
+		if kind == 0 {
+			if size < 18 {
+				return render.Sample{}, fmt.Errorf("%w: short STREAMINFO block", ErrInvalidFLAC)
+			}
+			info = flacInfo{
+				sampleRate:    int(block[10])<<12 | int(block[11])<<4 | int(block[12])>>4,
+				channels:      int(block[12]>>1&0x07) + 1,
+				bitsPerSample: (int(block[12]&0x01)<<4 | int(block[13])>>4) + 1,
+			}
+			haveInfo = true
+		}
+	}
+	if !haveInfo {
+		return render.Sample{}, fmt.Errorf("%w: no STREAMINFO block", ErrInvalidFLAC)
+	}
+	if info.sampleRate != render.SampleRate || info.channels > 2 {
+		return render.Sample{}, fmt.Errorf("%w: only %d Hz audio in mono or stereo is supported, got %d Hz in %d channels",
+			ErrInvalidFLAC, render.SampleRate, info.sampleRate, info.channels)
+	}
+
+	var s render.Sample
+	for len(data) > 0 {
+		channels, size, n, err := decodeFrame(data, info)
+		if err != nil {
+			return render.Sample{}, err
+		}
+		data = data[n:]
+
+		for f := range channels[0] {
+			left, right := channels[0][f], channels[0][f]
+			if len(channels) > 1 {
+				right = channels[1][f]
+			}
+			s.Left = append(s.Left, to16(left, size))
+			s.Right = append(s.Right, to16(right, size))
+		}
+	}
+	return s, nil
+}
+
+// to16 scales a sample of size bits to 16 bits
+func to16(v int64, size int) int16 {
+
+	if size > 16 {
+		return int16(v >> uint(size-16))
+	}
+	return int16(v << uint(16-size))
+}
+
+// decodeFrame decodes the FLAC frame at the start of data, returning its
+// channels' samples, their size in bits and the length of the frame
+func decodeFrame(data []byte, info flacInfo) ([][]int64, int, int, error) {
+
+	r := &bitReader{data: data}
+	header := func(n uint) uint64 {
+
+		v, _ := r.bits(n)
+		return v
+	}
+
+	if header(14) != 0x3ffe {
+		return nil, 0, 0, fmt.Errorf("%w: frame doesn't start with a sync code", ErrInvalidFLAC)
+	}
+	header(2)
+	blockCode, rateCode := header(4), header(4)
+	assignment, sizeCode := int(header(4)), header(3)
+	header(1)
+
+	// the frame or sample number, UTF-8 coded
+	if first := header(8); first&0x80 != 0 {
+		for b := first << 1; b&0x80 != 0; b <<= 1 {
+			header(8)
+		}
+	}
+
+	var blockSize int
+	switch {
+	case blockCode == 1:
+		blockSize = 192
+	case blockCode >= 2 && blockCode <= 5:
+		blockSize = 576 << (blockCode - 2)
+	case blockCode == 6:
+		blockSize = int(header(8)) + 1
+	case blockCode == 7:
+		blockSize = int(header(16)) + 1
+	case blockCode >= 8:
+		blockSize = 256 << (blockCode - 8)
+	default:
+		return nil, 0, 0, fmt.Errorf("%w: reserved block size", ErrInvalidFLAC)
+	}
+
+	rate := flacSampleRates[rateCode]
+	switch rateCode {
+	case 12:
+		rate = int(header(8)) * 1000
+	case 13:
+		rate = int(header(16))
+	case 14:
+		rate = int(header(16)) * 10
+	}
+	if rate == 0 {
+		rate = info.sampleRate
+	}
+	size := flacSampleSizes[sizeCode]
+	if size == 0 {
+		size = info.bitsPerSample
+	}
+
+	channels := assignment + 1
+	if assignment >= flacLeftSide {
+		channels = 2
+	}
+	switch {
+	case rate != info.sampleRate:
+		return nil, 0, 0, fmt.Errorf("%w: frame at %d Hz in a stream at %d Hz", ErrInvalidFLAC, rate, info.sampleRate)
+	case size < 0 || assignment > flacMidSide:
+		return nil, 0, 0, fmt.Errorf("%w: reserved sample size or channel assignment", ErrInvalidFLAC)
+	case channels != info.channels:
+		return nil, 0, 0, fmt.Errorf("%w: frame of %d channels in a stream of %d", ErrInvalidFLAC, channels, info.channels)
+	}
+
+	crc, err := r.bits(8)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("%w: frame header cut short", ErrInvalidFLAC)
+	}
+	if headerLen := r.pos/8 - 1; crc8(data[:headerLen]) != byte(crc) {
+		return nil, 0, 0, fmt.Errorf("%w: frame header checksum mismatch", ErrInvalidFLAC)
+	}
+
+	samples := make([][]int64, channels)
+	for c := range samples {
+		// the side channel of a stereo pair takes an extra bit
+		bits := size
+		if (assignment == flacLeftSide || assignment == flacMidSide) && c == 1 ||
+			assignment == flacRightSide && c == 0 {
+			bits++
+		}
+		if samples[c], err = decodeSubframe(r, blockSize, bits); err != nil {
+			return nil, 0, 0, err
+		}
+	}
+
+	r.align()
+	end := r.pos / 8
+	footer, err := r.bits(16)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("%w: frame cut short", ErrInvalidFLAC)
+	}
+	if crc16(data[:end]) != uint16(footer) {
+		return nil, 0, 0, fmt.Errorf("%w: frame checksum mismatch", ErrInvalidFLAC)
+	}
+
+	switch assignment {
+	case flacLeftSide:
+		for i, side := range samples[1] {
+			samples[1][i] = samples[0][i] - side
+		}
+	case flacRightSide:
+		for i, side := range samples[0] {
+			samples[0][i] = side + samples[1][i]
+		}
+	case flacMidSide:
+		for i, side := range samples[1] {
+			mid := samples[0][i]<<1 | side&1
+			samples[0][i], samples[1][i] = (mid+side)>>1, (mid-side)>>1
+		}
+	}
+	return samples, size, end + 2, nil
+}
+
+// decodeSubframe decodes the blockSize samples, of the given size in bits,
+// of one channel of a frame
+func decodeSubframe(r *bitReader, blockSize, bits int) ([]int64, error) {
+
+	short := fmt.Errorf("%w: subframe cut short", ErrInvalidFLAC)
+
+	head, err := r.bits(8)
+	if err != nil {
+		return nil, short
+	}
+	kind := int(head >> 1 & 0x3f)
+	wasted := 0
+	if head&1 != 0 {
+		n, err := r.unary()
+		if err != nil {
+			return nil, short
+		}
+		wasted = n + 1
+	}
+	bits -= wasted
+	if head&0x80 != 0 || bits <= 0 {
+		return nil, fmt.Errorf("%w: malformed subframe header", ErrInvalidFLAC)
+	}
+
+	samples := make([]int64, blockSize)
+	switch {
+	case kind == 0:
+		v, err := r.signed(uint(bits))
+		if err != nil {
+			return nil, short
+		}
+		for i := range samples {
+			samples[i] = v
+		}
+	case kind == 1:
+		for i := range samples {
+			if samples[i], err = r.signed(uint(bits)); err != nil {
+				return nil, short
+			}
+		}
+	case kind >= 8 && kind <= 12:
+		if err := decodeFixed(r, samples, kind-8, bits); err != nil {
+			return nil, err
+		}
+	case kind >= 32:
+		if err := decodeLPC(r, samples, kind-31, bits); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: reserved subframe type %d", ErrInvalidFLAC, kind)
+	}
+
+	if wasted > 0 {
+		for i := range samples {
+			samples[i] <<= uint(wasted)
+		}
+	}
+	return samples, nil
+}
+
+// fixedCoefficients are the coefficients of the fixed predictors of each
+// order, for the samples before the one predicted, nearest first
+var fixedCoefficients = [][]int64{{}, {1}, {2, -1}, {3, -3, 1}, {4, -6, 4, -1}}
+
+// decodeFixed decodes the samples of a subframe with the fixed predictor of
+// the given order
+func decodeFixed(r *bitReader, samples []int64, order, bits int) error {
+
+	if order > len(samples) {
+		return fmt.Errorf("%w: predictor order %d for a block of %d", ErrInvalidFLAC, order, len(samples))
+	}
+	if err := warmUp(r, samples[:order], bits); err != nil {
+		return err
+	}
+	if err := decodeResidual(r, samples, order); err != nil {
+		return err
+	}
+	predict(samples, order, fixedCoefficients[order], 0)
+	return nil
+}
+
+// decodeLPC decodes the samples of a subframe with a linear predictor of
+// the given order, whose coefficients the subframe holds
+func decodeLPC(r *bitReader, samples []int64, order, bits int) error {
+
+	short := fmt.Errorf("%w: subframe cut short", ErrInvalidFLAC)
+
+	if order > len(samples) {
+		return fmt.Errorf("%w: predictor order %d for a block of %d", ErrInvalidFLAC, order, len(samples))
+	}
+	if err := warmUp(r, samples[:order], bits); err != nil {
+		return err
+	}
+
+	precision, err := r.bits(4)
+	if err != nil {
+		return short
+	}
+	if precision == 0x0f {
+		return fmt.Errorf("%w: invalid predictor precision", ErrInvalidFLAC)
+	}
+	shift, err := r.signed(5)
+	if err != nil {
+		return short
+	}
+	if shift < 0 {
+		return fmt.Errorf("%w: negative predictor shift", ErrInvalidFLAC)
+	}
+
+	coefficients := make([]int64, order)
+	for i := range coefficients {
+		if coefficients[i], err = r.signed(uint(precision + 1)); err != nil {
+			return short
+		}
+	}
+
+	if err := decodeResidual(r, samples, order); err != nil {
+		return err
+	}
+	predict(samples, order, coefficients, uint(shift))
+	return nil
+}
+
+// warmUp reads the unpredicted samples a predicted subframe starts with
+func warmUp(r *bitReader, samples []int64, bits int) error {
+
+	for i := range samples {
+		v, err := r.signed(uint(bits))
+		if err != nil {
+			return fmt.Errorf("%w: subframe cut short", ErrInvalidFLAC)
+		}
+		samples[i] = v
+	}
+	return nil
+}
+
+// predict adds the prediction from the coefficients, nearest sample first,
+// to the residuals in samples after the first order
+func predict(samples []int64, order int, coefficients []int64, shift uint) {
+
+	for i := order; i < len(samples); i++ {
+		var sum int64
+		for j, c := range coefficients {
+			sum += c * samples[i-j-1]
+		}
+		samples[i] += sum >> shift
+	}
+}
+
+// decodeResidual reads the Rice coded residuals of the samples after the
+// first order into samples
+func decodeResidual(r *bitReader, samples []int64, order int) error {
+
+	short := fmt.Errorf("%w: residual cut short", ErrInvalidFLAC)
+
+	method, err := r.bits(2)
+	if err != nil {
+		return short
+	}
+	if method > 1 {
+		return fmt.Errorf("%w: reserved residual coding method", ErrInvalidFLAC)
+	}
+	paramBits, escape := uint(4), uint64(0x0f)
+	if method == 1 {
+		paramBits, escape = 5, 0x1f
+	}
+
+	partitionOrder, err := r.bits(4)
+	if err != nil {
+		return short
+	}
+	partitions := 1 << partitionOrder
+	if len(samples)%partitions != 0 || len(samples)/partitions < order {
+		return fmt.Errorf("%w: %d residual partitions for a block of %d", ErrInvalidFLAC, partitions, len(samples))
+	}
+
+	i := order
+	for p := 0; p < partitions; p++ {
+		end := (p + 1) * len(samples) / partitions
+
+		param, err := r.bits(paramBits)
+		if err != nil {
+			return short
+		}
+		if param == escape {
+			raw, err := r.bits(5)
+			if err != nil {
+				return short
+			}
+			for ; i < end; i++ {
+				if samples[i], err = r.signed(uint(raw)); err != nil {
+					return short
+				}
+			}
+			continue
+		}
+
+		for ; i < end; i++ {
+			q, err := r.unary()
+			if err != nil {
+				return short
+			}
+			low, err := r.bits(uint(param))
+			if err != nil {
+				return short
+			}
+			v := uint64(q)<<param | low
+			samples[i] = int64(v>>1) ^ -int64(v&1)
+		}
+	}
+	return nil
+}
+
+// bitReader reads big-endian bit fields from data
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+// bits reads an unsigned field of n bits, up to 64
+func (r *bitReader) bits(n uint) (uint64, error) {
+
+	if r.pos+int(n) > len(r.data)*8 {
+		return 0, errors.New("out of data")
+	}
+
+	var v uint64
+	for ; n > 0; n-- {
+		bit := r.data[r.pos/8] >> (7 - uint(r.pos%8)) & 1
+		v = v<<1 | uint64(bit)
+		r.pos++
+	}
+	return v, nil
+}
+
+// signed reads a two's complement field of n bits
+func (r *bitReader) signed(n uint) (int64, error) {
+
+	v, err := r.bits(n)
+	if err != nil || n == 0 {
+		return 0, err
+	}
+	return int64(v<<(64-n)) >> (64 - n), nil
+}
+
+// unary reads the number of zero bits before the next one bit
+func (r *bitReader) unary() (int, error) {
+
+	n := 0
+	for {
+		bit, err := r.bits(1)
+		if err != nil {
+			return 0, err
+		}
+		if bit == 1 {
+			return n, nil
+		}
+		n++
+	}
+}
+
+// align skips to the start of the next byte
+func (r *bitReader) align() {
+
+	r.pos = (r.pos + 7) / 8 * 8
+}
+
+// crc8 returns the CRC-8 of a frame header, with the polynomial 0x07
+func crc8(data []byte) byte {
+
+	var crc byte
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// crc16 returns the CRC-16 of a frame, with the polynomial 0x8005
+func crc16(data []byte) uint16 {
+
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x8005
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
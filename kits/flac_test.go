@@ -0,0 +1,198 @@
+package kits
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// bitWriter writes big-endian bit fields, as a FLAC encoder does
+type bitWriter struct {
+	data []byte
+	n    int
+}
+
+func (w *bitWriter) bits(v uint64, n int) {
+
+	for i := n - 1; i >= 0; i-- {
+		if w.n%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+		w.data[len(w.data)-1] |= byte(v>>uint(i)&1) << (7 - uint(w.n%8))
+		w.n++
+	}
+}
+
+func (w *bitWriter) signed(v int64, n int) {
+
+	w.bits(uint64(v)&(1<<uint(n)-1), n)
+}
+
+// rice writes residuals as one partition with the given Rice parameter
+func (w *bitWriter) rice(residuals []int64, param int) {
+
+	w.bits(0, 2)
+	w.bits(0, 4)
+	w.bits(uint64(param), 4)
+	for _, r := range residuals {
+		v := uint64(r<<1) ^ uint64(r>>63)
+		w.bits(1, int(v>>uint(param))+1)
+		w.bits(v&(1<<uint(param)-1), param)
+	}
+}
+
+// flacStream returns a FLAC stream of 16 bit samples at 44.1kHz in the
+// given number of channels, holding the given frames
+func flacStream(channels int, frames ...[]byte) []byte {
+
+	info := &bitWriter{}
+	info.bits(4096, 16)
+	info.bits(4096, 16)
+	info.bits(0, 48)
+	info.bits(44100, 20)
+	info.bits(uint64(channels-1), 3)
+	info.bits(15, 5)
+	info.bits(0, 36)
+	info.bits(0, 128)
+
+	stream := append([]byte("fLaC"), 0x80, 0, 0, byte(len(info.data)))
+	stream = append(stream, info.data...)
+	for _, f := range frames {
+		stream = append(stream, f...)
+	}
+	return stream
+}
+
+// flacFrame returns a frame of blockSize samples with the given channel
+// assignment, whose subframes write writes
+func flacFrame(number, blockSize, assignment int, write func(w *bitWriter)) []byte {
+
+	w := &bitWriter{}
+	w.bits(0x3ffe, 14)
+	w.bits(0, 2)
+	w.bits(7, 4) // a 16 bit block size follows
+	w.bits(9, 4) // 44.1kHz
+	w.bits(uint64(assignment), 4)
+	w.bits(4, 3) // 16 bits
+	w.bits(0, 1)
+	w.bits(uint64(number), 8)
+	w.bits(uint64(blockSize-1), 16)
+	w.bits(uint64(crc8(w.data)), 8)
+
+	write(w)
+	crc := crc16(w.data)
+	return append(w.data, byte(crc>>8), byte(crc))
+}
+
+func TestLoadFLAC(t *testing.T) {
+
+	left := []int64{1000, 1000, 1000, 1000, 1000, 1000}
+	right := []int64{1, -2, 3, -4, 5, -6}
+	ramp := []int64{10, 20, 30, 40, 50, 60}
+	wave := []int64{100, 120, 136, 148, 156, 160}
+
+	independent := flacFrame(0, 6, 1, func(w *bitWriter) {
+
+		// a constant left channel and a verbatim right
+		w.bits(0, 8)
+		w.signed(1000, 16)
+		w.bits(1<<1, 8)
+		for _, v := range right {
+			w.signed(v, 16)
+		}
+	})
+
+	leftSide := flacFrame(1, 6, flacLeftSide, func(w *bitWriter) {
+
+		// the ramp with the second order fixed predictor, whose residuals
+		// are all zero, and the side channel, ramp minus wave, with a first
+		// order linear predictor of 1/2 in 17 bits
+		w.bits(10<<1, 8)
+		w.signed(10, 16)
+		w.signed(20, 16)
+		w.rice([]int64{0, 0, 0, 0}, 0)
+
+		side := make([]int64, len(ramp))
+		for i := range side {
+			side[i] = ramp[i] - wave[i]
+		}
+		w.bits(32<<1, 8)
+		w.signed(side[0], 17)
+		w.bits(3, 4)
+		w.signed(1, 5)
+		w.signed(1, 4)
+		var residuals []int64
+		for i := 1; i < len(side); i++ {
+			residuals = append(residuals, side[i]-side[i-1]>>1)
+		}
+		w.rice(residuals, 3)
+	})
+
+	midSide := flacFrame(2, 6, flacMidSide, func(w *bitWriter) {
+
+		// verbatim mid and side, the mid with one wasted bit
+		w.bits(1<<1|1, 8)
+		w.bits(1, 1)
+		for i := range left {
+			w.signed((left[i]+right[i])>>1>>1, 15)
+		}
+		w.bits(1<<1, 8)
+		for i := range left {
+			w.signed(left[i]-right[i], 17)
+		}
+	})
+
+	s, err := LoadFLAC(bytes.NewReader(flacStream(2, independent, leftSide, midSide)))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	var expectedLeft, expectedRight []int16
+	for _, frame := range [][2][]int64{{left, right}, {ramp, wave}} {
+		for i := range frame[0] {
+			expectedLeft = append(expectedLeft, int16(frame[0][i]))
+			expectedRight = append(expectedRight, int16(frame[1][i]))
+		}
+	}
+	// the wasted bit loses the mid's lowest bit, which the side restores
+	// for odd sums only where the mid had it
+	for i := range left {
+		mid := (left[i] + right[i]) >> 1 >> 1 << 1
+		side := left[i] - right[i]
+		m := mid<<1 | side&1
+		expectedLeft = append(expectedLeft, int16((m+side)>>1))
+		expectedRight = append(expectedRight, int16((m-side)>>1))
+	}
+	if !reflect.DeepEqual(s.Left, expectedLeft) || !reflect.DeepEqual(s.Right, expectedRight) {
+		t.Errorf("got\n%v\n%v\nexpected\n%v\n%v", s.Left, s.Right, expectedLeft, expectedRight)
+	}
+
+	// mono streams play in both channels
+	mono := flacFrame(0, 3, 0, func(w *bitWriter) {
+
+		w.bits(0, 8)
+		w.signed(-500, 16)
+	})
+	if s, err := LoadFLAC(bytes.NewReader(flacStream(1, mono))); err != nil || !reflect.DeepEqual(s.Right, []int16{-500, -500, -500}) {
+		t.Errorf("got %v, %v for a mono stream", s, err)
+	}
+
+	corrupt := append([]byte(nil), independent...)
+	corrupt[len(corrupt)-3] ^= 0x10
+	tData := []struct {
+		name string
+		data []byte
+	}{
+		{"not flac", []byte("RIFF....WAVE")},
+		{"no frames end", flacStream(2, independent[:len(independent)-4])},
+		{"corrupt", flacStream(2, corrupt)},
+		{"mono frame in stereo", flacStream(2, mono)},
+		{"no metadata", []byte("fLaC")},
+	}
+	for _, exp := range tData {
+		if _, err := LoadFLAC(bytes.NewReader(exp.data)); !errors.Is(err, ErrInvalidFLAC) {
+			t.Errorf("%s: expected %v, got %v", exp.name, ErrInvalidFLAC, err)
+		}
+	}
+}
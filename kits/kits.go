@@ -0,0 +1,304 @@
+// Package kits loads a directory of drum samples and matches them to the
+// instruments of patterns by name, so a pattern can be rendered without
+// naming the sample each instrument plays: "hh-closed.wav" plays "cl
+// hihat", "BD_808.flac" plays "kick" and "SnareDrum.wav" plays "snare".
+// Matches can be overridden by hand with Assign.
+package kits
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
+
+	drum "github.com/chrishiestand/golang-challenge-1-drum_machine"
+	"github.com/chrishiestand/golang-challenge-1-drum_machine/render"
+)
+
+// minScore is the share of their words an instrument and a sample's name
+// must have in common to match
+const minScore = 0.5
+
+// loaders read the sample files Load finds, by extension
+var loaders = map[string]func(data []byte) (render.Sample, error){
+	".wav": func(data []byte) (render.Sample, error) {
+		return render.LoadSample(bytes.NewReader(data))
+	},
+	".flac": func(data []byte) (render.Sample, error) {
+		return LoadFLAC(bytes.NewReader(data))
+	},
+}
+
+// synonyms maps the words and abbreviations of sample and instrument names
+// to the words they're matched as
+var synonyms = map[string][]string{
+	"bd": {"kick"}, "kik": {"kick"}, "kck": {"kick"}, "bassdrum": {"kick"},
+	"sd": {"snare"}, "snr": {"snare"}, "sn": {"snare"},
+	"hh": {"hihat"}, "hat": {"hihat"}, "hats": {"hihat"},
+	"ch": {"closed", "hihat"}, "oh": {"open", "hihat"},
+	"cl": {"closed"}, "cls": {"closed"}, "close": {"closed"},
+	"op": {"open"}, "opn": {"open"},
+	"cp": {"clap"}, "clp": {"clap"}, "handclap": {"clap"},
+	"rs": {"rim"}, "rimshot": {"rim"},
+	"cb": {"cowbell"},
+	"cy": {"cymbal"}, "cym": {"cymbal"},
+	"cr": {"crash"}, "crsh": {"crash"}, "rd": {"ride"},
+	"tm": {"tom"}, "lt": {"low", "tom"}, "mt": {"mid", "tom"}, "ht": {"high", "tom"},
+	"lo": {"low"}, "md": {"mid"}, "hi": {"high"}, "hii": {"high"},
+	"perc": {"percussion"}, "shk": {"shaker"}, "tamb": {"tambourine"}, "cga": {"conga"},
+	"maraca": {"maracas"},
+}
+
+// compounds maps pairs of words that name one instrument between them to
+// the word they're matched as
+var compounds = map[[2]string]string{
+	{"hi", "hat"}:    "hihat",
+	{"bass", "drum"}: "kick",
+	{"hand", "clap"}: "clap",
+	{"rim", "shot"}:  "rim",
+}
+
+// fillers are words left out of matching
+var fillers = map[string]bool{"drum": true, "drums": true, "sample": true, "samples": true, "one": true, "shot": true, "oneshot": true}
+
+// Library is a directory of samples, each named by its file name without
+// the extension, that instruments are matched to. A Library isn't safe
+// for concurrent use while samples are being assigned.
+type Library struct {
+	samples   map[string]render.Sample
+	words     map[string][]string
+	names     []string
+	overrides map[string]string
+}
+
+// Load loads the .wav and .flac samples in dir, without descending into
+// subdirectories, as render.LoadSample and LoadFLAC read them. Files that
+// can't be read are skipped and reported in the returned errors, each
+// naming its path, in order of path, as is a directory that can't be read.
+func Load(dir string) (*Library, []error) {
+
+	l := &Library{samples: make(map[string]render.Sample), words: make(map[string][]string)}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return l, []error{fmt.Errorf("%s: %w", dir, err)}
+	}
+
+	var errs []error
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		load, ok := loaders[ext]
+		if entry.IsDir() || !ok {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err == nil {
+			var s render.Sample
+			if s, err = load(data); err == nil {
+				l.Add(strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name())), s)
+				continue
+			}
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", path, err))
+	}
+	return l, errs
+}
+
+// Add adds s to the library as name, replacing any sample of that name
+func (l *Library) Add(name string, s render.Sample) {
+
+	if l.samples == nil {
+		l.samples = make(map[string]render.Sample)
+		l.words = make(map[string][]string)
+	}
+
+	if _, ok := l.samples[name]; !ok {
+		l.names = append(l.names, name)
+		sort.Strings(l.names)
+	}
+	l.samples[name] = s
+	l.words[name] = words(name)
+}
+
+// Names returns the names of the library's samples in order
+func (l *Library) Names() []string {
+
+	return append([]string(nil), l.names...)
+}
+
+// Assign has instrument, compared ignoring case and surrounding
+// whitespace, play the sample called sample whatever it would match. It
+// returns an error if the library has no such sample.
+func (l *Library) Assign(instrument, sample string) error {
+
+	if _, ok := l.samples[sample]; !ok {
+		return fmt.Errorf("no sample called %q", sample)
+	}
+	if l.overrides == nil {
+		l.overrides = make(map[string]string)
+	}
+	l.overrides[key(instrument)] = sample
+	return nil
+}
+
+// AssignAll assigns each instrument in overrides the sample it maps to, as
+// Assign does, stopping at the first sample the library doesn't have
+func (l *Library) AssignAll(overrides map[string]string) error {
+
+	instruments := make([]string, 0, len(overrides))
+	for instrument := range overrides {
+		instruments = append(instruments, instrument)
+	}
+	sort.Strings(instruments)
+
+	for _, instrument := range instruments {
+		if err := l.Assign(instrument, overrides[instrument]); err != nil {
+			return fmt.Errorf("assigning %q: %w", instrument, err)
+		}
+	}
+	return nil
+}
+
+// Match returns the name of the sample instrument plays: the one assigned
+// to it, or else the one whose name shares the most words with it, once
+// abbreviations such as "hh", "bd" and "cl" are spelled out. At least half
+// of the words of the two must be shared, so "hh-open" doesn't play
+// "hh-closed", though it does play a plain "hihat". Equally good matches
+// are settled by the order of the samples' names. It returns false if no
+// sample matches.
+func (l *Library) Match(instrument string) (string, bool) {
+
+	if sample, ok := l.overrides[key(instrument)]; ok {
+		return sample, true
+	}
+
+	want := words(instrument)
+	best, bestScore := "", 0.0
+	for _, name := range l.names {
+		score := similarity(want, l.words[name])
+		if key(name) == key(instrument) {
+			score = 2
+		}
+		if score > bestScore {
+			best, bestScore = name, score
+		}
+	}
+	return best, bestScore >= minScore
+}
+
+// Kit returns the kit that plays p with the library's samples, holding the
+// sample Match finds for each of p's instruments, with the names of the
+// instruments no sample matches, in the order they first appear.
+func (l *Library) Kit(p drum.Pattern) (render.SampleKit, []string) {
+
+	kit := make(render.SampleKit)
+	var missing []string
+	seen := make(map[string]bool)
+
+	for _, inst := range p.Instruments() {
+		name := inst.Name()
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		if sample, ok := l.Match(name); ok {
+			kit[name] = l.samples[sample]
+		} else {
+			missing = append(missing, name)
+		}
+	}
+	return kit, missing
+}
+
+// similarity returns the share of the words of a and b that both have
+func similarity(a, b []string) float64 {
+
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	shared := 0
+	for _, w := range a {
+		for _, v := range b {
+			if w == v {
+				shared++
+				break
+			}
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// words splits a name into the words it's matched by: lower case, split
+// at punctuation, spaces, changes of case and between letters and digits,
+// with compounds joined, abbreviations spelled out and fillers left out.
+// Each word appears once.
+func words(name string) []string {
+
+	var parts []string
+	var current []rune
+	flush := func() {
+
+		if len(current) > 0 {
+			parts = append(parts, strings.ToLower(string(current)))
+			current = current[:0]
+		}
+	}
+
+	var prev rune
+	for _, r := range name {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			flush()
+		case len(current) > 0 && (unicode.IsUpper(r) && unicode.IsLower(prev) ||
+			unicode.IsDigit(r) != unicode.IsDigit(prev)):
+			flush()
+			current = append(current, r)
+		default:
+			current = append(current, r)
+		}
+		prev = r
+	}
+	flush()
+
+	var spelled []string
+	for i := 0; i < len(parts); i++ {
+		if i+1 < len(parts) {
+			if w, ok := compounds[[2]string{parts[i], parts[i+1]}]; ok {
+				spelled = append(spelled, w)
+				i++
+				continue
+			}
+		}
+		if fillers[parts[i]] {
+			continue
+		}
+		if s, ok := synonyms[parts[i]]; ok {
+			spelled = append(spelled, s...)
+			continue
+		}
+		spelled = append(spelled, parts[i])
+	}
+
+	var unique []string
+	seen := make(map[string]bool)
+	for _, w := range spelled {
+		if !seen[w] {
+			seen[w] = true
+			unique = append(unique, w)
+		}
+	}
+	return unique
+}
+
+// key normalizes an instrument name for assigning samples to it
+func key(name string) string {
+
+	return strings.ToLower(strings.TrimSpace(name))
+}
@@ -0,0 +1,119 @@
+package kits
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	drum "github.com/chrishiestand/golang-challenge-1-drum_machine"
+	"github.com/chrishiestand/golang-challenge-1-drum_machine/render"
+)
+
+// wav returns a mono 16 bit WAV file at render.SampleRate holding frames
+func wav(frames ...int16) []byte {
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+2*len(frames)))
+	buf.WriteString("WAVEfmt ")
+	binary.Write(&buf, binary.LittleEndian, []uint32{16})
+	binary.Write(&buf, binary.LittleEndian, []uint16{1, 1})
+	binary.Write(&buf, binary.LittleEndian, []uint32{render.SampleRate, render.SampleRate * 2})
+	binary.Write(&buf, binary.LittleEndian, []uint16{2, 16})
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(2*len(frames)))
+	binary.Write(&buf, binary.LittleEndian, frames)
+	return buf.Bytes()
+}
+
+func TestLoad(t *testing.T) {
+
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"hh-closed.wav":   wav(1),
+		"HiHat.WAV":       wav(2),
+		"BD_808.flac":     flacStream(1, flacFrame(0, 1, 0, func(w *bitWriter) { w.bits(0, 8); w.signed(3, 16) })),
+		"SnareDrum.wav":   wav(4),
+		"low tom.wav":     wav(5),
+		"clap.wav":        []byte("not a wav"),
+		"notes.txt":       []byte("not a sample"),
+		"sub/kick.wav":    wav(6),
+		"Ride Cymbal.wav": wav(7),
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	library, errs := Load(dir)
+	if len(errs) != 1 || !errors.Is(errs[0], render.ErrInvalidWAV) {
+		t.Errorf("expected an error for clap.wav, got %v", errs)
+	}
+	if names := library.Names(); !reflect.DeepEqual(names, []string{"BD_808", "HiHat", "Ride Cymbal", "SnareDrum", "hh-closed", "low tom"}) {
+		t.Errorf("unexpected samples %v", names)
+	}
+
+	tData := []struct {
+		instrument string
+		expected   string
+	}{
+		{"cl hihat", "hh-closed"},
+		{"hh-close", "hh-closed"},
+		{"closed hat", "hh-closed"},
+		{"hh-open", "HiHat"},
+		{"Kick", "BD_808"},
+		{"bass drum", "BD_808"},
+		{"snare", "SnareDrum"},
+		{"SD", "SnareDrum"},
+		{"LT", "low tom"},
+		{"ride", "Ride Cymbal"},
+		{"hihat", "HiHat"},
+		{"clap", ""},
+		{"hi-tom", ""},
+		{"cowbell", ""},
+	}
+	for _, exp := range tData {
+		got, ok := library.Match(exp.instrument)
+		if !ok {
+			got = ""
+		}
+		if got != exp.expected {
+			t.Errorf("%q: matched %q, expected %q", exp.instrument, got, exp.expected)
+		}
+	}
+
+	p := drum.NewPattern("kits", 120)
+	p.AddInstrument(0, "kick")
+	p.AddInstrument(1, "hh-closed")
+	p.AddInstrument(2, "cowbell")
+	p.AddInstrument(3, "Maracas")
+	p.AddInstrument(4, "cowbell")
+
+	if err := library.AssignAll(map[string]string{" COWBELL": "low tom"}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := library.Assign("kick", "cl hihat"); err == nil {
+		t.Errorf("expected an error assigning a missing sample")
+	}
+
+	kit, missing := library.Kit(*p)
+	if !reflect.DeepEqual(missing, []string{"Maracas"}) {
+		t.Errorf("expected only the maracas missing, got %v", missing)
+	}
+	for name, frame := range map[string]int16{"kick": 3, "hh-closed": 1, "cowbell": 5} {
+		if s := kit[name]; len(s.Left) != 1 || s.Left[0] != frame {
+			t.Errorf("%s: got %v, expected the sample holding %d", name, s, frame)
+		}
+	}
+
+	if _, errs := Load(filepath.Join(dir, "missing")); len(errs) != 1 {
+		t.Errorf("expected an error loading a missing directory, got %v", errs)
+	}
+}
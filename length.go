@@ -0,0 +1,110 @@
+package drum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// headerLengthBytes is the number of bytes at the end of the header that
+// hold the higher bytes of a payload length in the original format. Its
+// length is a big-endian number running from the header into the length
+// byte, so the length byte alone declares payloads of up to 255 bytes and
+// the two before it take the length up to maxPayloadLength(1).
+const headerLengthBytes = 2
+
+// longName is the name length byte that means the name's real length
+// follows as a uvarint, for names of longName bytes or more
+const longName = 0xff
+
+// maxNameSize is the longest instrument name the encoder writes
+const maxNameSize = 1<<16 - 1
+
+// payloadLength returns the payload length declared by field, the length
+// field of the given width following header, read in order. A one byte
+// field is the lowest byte of the original format's length.
+func payloadLength(header, field []byte, order binary.ByteOrder) uint64 {
+
+	if len(field) != 1 {
+		return readUint(order, field)
+	}
+
+	var n uint64
+	for _, b := range header[headerSize-headerLengthBytes:] {
+		n = n<<8 | uint64(b)
+	}
+	return n<<8 | uint64(field[0])
+}
+
+// putPayloadLength returns a copy of header, with the higher bytes of n in
+// place for a one byte length field, and the length field of width size
+// declaring a payload of n bytes in order
+func putPayloadLength(header []byte, n uint64, size int, order binary.ByteOrder) ([]byte, []byte) {
+
+	header = append([]byte(nil), header...)
+	if size != 1 {
+		return header, putUint(order, n, size)
+	}
+
+	for i := headerSize - 1; i >= headerSize-headerLengthBytes; i-- {
+		header[i] = byte(n >> (8 * uint(headerSize-i)))
+	}
+	return header, []byte{byte(n)}
+}
+
+// maxPayloadLength returns the longest payload a length field of width
+// size can declare
+func maxPayloadLength(size int) uint64 {
+
+	if size == 1 {
+		size += headerLengthBytes
+	}
+	if size >= 8 {
+		return 1<<64 - 1
+	}
+	return 1<<(8*uint(size)) - 1
+}
+
+// nameLengthSize returns the number of bytes the length of a name of n
+// bytes takes: one up to longName bytes, and otherwise longName followed by
+// the length as a uvarint
+func nameLengthSize(n int) int {
+
+	if n < longName {
+		return 1
+	}
+	var b [binary.MaxVarintLen64]byte
+	return 1 + binary.PutUvarint(b[:], uint64(n))
+}
+
+// writeNameLength writes the length of a name of n bytes to buf
+func writeNameLength(buf *bytes.Buffer, n int) {
+
+	if n < longName {
+		buf.WriteByte(byte(n))
+		return
+	}
+
+	var b [binary.MaxVarintLen64]byte
+	buf.WriteByte(longName)
+	buf.Write(b[:binary.PutUvarint(b[:], uint64(n))])
+}
+
+// readNameLength reads the name length at the start of b, returning it and
+// the number of bytes it took, or an error wrapping ErrInvalidNameLength if
+// b ends within it or it's too long to be real
+func readNameLength(b []byte) (int, int, error) {
+
+	if len(b) == 0 {
+		return 0, 0, fmt.Errorf("%w: the name has no length", ErrInvalidNameLength)
+	}
+	if b[0] != longName {
+		return int(b[0]), 1, nil
+	}
+
+	n, size := binary.Uvarint(b[1:])
+	if size <= 0 || n > maxNameSize {
+		return 0, 0, fmt.Errorf("%w: the name's long length is malformed", ErrInvalidNameLength)
+	}
+	return int(n), 1 + size, nil
+}
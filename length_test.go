@@ -0,0 +1,108 @@
+package drum
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// longPattern returns a pattern whose payload needs more than a byte's
+// length, with a name needing more than a byte of its own
+func longPattern() *Pattern {
+
+	p := NewPattern("0.808-alpha", 120)
+	for i := 0; i < 20; i++ {
+		p.AddInstrument(uint32(i), "kick").SetSteps("x---x---x---x---")
+	}
+	p.AddInstrument(20, strings.Repeat("cowbell ", 40)).SetSteps("--x---x---x---x-")
+	return p
+}
+
+func TestLongPayload(t *testing.T) {
+
+	p := longPattern()
+
+	var buf bytes.Buffer
+	if err := p.Encode(&buf); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	data := buf.Bytes()
+
+	// 36 bytes of version and tempo, 20 kicks of 25 bytes and the cowbell's
+	// id, 3 byte name length, 320 byte name and steps
+	size := 36 + 20*25 + 4 + 3 + 320 + 16
+	if got := int(data[11])<<16 | int(data[12])<<8 | int(data[13]); got != size {
+		t.Errorf("expected a big-endian length of %d running into the header, got %d", size, got)
+	}
+	if n, err := p.EncodedSize(); err != nil || n != len(data) {
+		t.Errorf("expected an encoded size of %d, got %d, %v", len(data), n, err)
+	}
+
+	decoded, err := Decode(bytes.NewReader(data))
+	if err != nil || !decoded.Equal(*p) {
+		t.Fatalf("expected the pattern back, got %v\n%v", err, decoded)
+	}
+	if inPlace, err := DecodeBytes(data); err != nil || !inPlace.Equal(*p) {
+		t.Errorf("DecodeBytes: expected the pattern back, got %v\n%v", err, inPlace)
+	}
+	if streamed, err := NewDecoder(bytes.NewReader(data)).NextPattern(); err != nil || !streamed.Equal(*p) {
+		t.Errorf("Decoder: expected the pattern back, got %v\n%v", err, streamed)
+	}
+
+	_, instruments, err := DecodeStream(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for inst := range instruments {
+		if inst.Err != nil {
+			t.Fatalf("DecodeStream: unexpected error %v", inst.Err)
+		}
+		n++
+	}
+	if n != 21 {
+		t.Errorf("DecodeStream: expected 21 instruments, got %d", n)
+	}
+
+	// re-encoding a shorter pattern clears the header's length bytes
+	for id := uint32(5); id <= 20; id++ {
+		decoded.RemoveInstrument(id)
+	}
+	buf.Reset()
+	if err := decoded.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if b := buf.Bytes(); b[11] != 0 || b[12] != 0 || b[13] != 36+5*25 {
+		t.Errorf("expected a one byte length of %d, got header bytes %v", 36+5*25, b[:14])
+	}
+}
+
+func TestNameLength(t *testing.T) {
+
+	tests := []struct {
+		n        int
+		expected []byte
+	}{
+		{0, []byte{0}},
+		{254, []byte{254}},
+		{255, []byte{255, 255, 1}},
+		{300, []byte{255, 172, 2}},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		writeNameLength(&buf, tt.n)
+		if !bytes.Equal(buf.Bytes(), tt.expected) || nameLengthSize(tt.n) != len(tt.expected) {
+			t.Errorf("%d: expected %v, got %v", tt.n, tt.expected, buf.Bytes())
+		}
+		if n, size, err := readNameLength(tt.expected); err != nil || n != tt.n || size != len(tt.expected) {
+			t.Errorf("%d: read back %d of %d bytes, %v", tt.n, n, size, err)
+		}
+	}
+
+	for _, b := range [][]byte{{}, {255}, {255, 0x80}, {255, 0xff, 0xff, 0x7f}} {
+		if _, _, err := readNameLength(b); !errors.Is(err, ErrInvalidNameLength) {
+			t.Errorf("%v: expected %v, got %v", b, ErrInvalidNameLength, err)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package drum
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+)
+
+// metaChunkType is the type of the extension chunk Encode writes for a
+// pattern with metadata
+const metaChunkType = "META"
+
+// MetaSuffix is appended to a pattern file's path to name its sidecar
+// metadata file, so fixtures/pattern_1.splice is described by
+// fixtures/pattern_1.splice.meta.json.
+const MetaSuffix = ".meta.json"
+
+// MaxRating is the highest rating a pattern can be given
+const MaxRating = 5
+
+// PatternMeta describes a pattern for finding it in a library: its title
+// and author, the genre tags it's filed under, a rating from 1 to
+// MaxRating, or 0 if it's unrated, and when it was created.
+type PatternMeta struct {
+	Title   string    `json:"title,omitempty"`
+	Author  string    `json:"author,omitempty"`
+	Tags    []string  `json:"tags,omitempty"`
+	Rating  int       `json:"rating,omitempty"`
+	Created time.Time `json:"created"`
+}
+
+// IsZero reports whether m holds no metadata
+func (m PatternMeta) IsZero() bool {
+
+	return m.Title == "" && m.Author == "" && len(m.Tags) == 0 && m.Rating == 0 && m.Created.IsZero()
+}
+
+// HasTag reports whether m is tagged tag, ignoring case and surrounding
+// whitespace
+func (m PatternMeta) HasTag(tag string) bool {
+
+	for _, t := range m.Tags {
+		if indexKey(t) == indexKey(tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// validate returns an error wrapping ErrInvalidMeta if m's rating is out of
+// range or it has an empty tag
+func (m PatternMeta) validate() error {
+
+	if m.Rating < 0 || m.Rating > MaxRating {
+		return fmt.Errorf("%w: rating %d is out of the range 0 to %d", ErrInvalidMeta, m.Rating, MaxRating)
+	}
+	for _, t := range m.Tags {
+		if strings.TrimSpace(t) == "" {
+			return fmt.Errorf("%w: empty tag", ErrInvalidMeta)
+		}
+	}
+	return nil
+}
+
+// clone returns a copy of m that shares no memory with it
+func (m PatternMeta) clone() PatternMeta {
+
+	if m.Tags != nil {
+		m.Tags = append([]string(nil), m.Tags...)
+	}
+	return m
+}
+
+// Meta returns a copy of the pattern's metadata, which is zero unless it's
+// been set or decoded
+func (p Pattern) Meta() PatternMeta {
+
+	if p.meta == nil {
+		return PatternMeta{}
+	}
+	return p.meta.clone()
+}
+
+// SetMeta sets the pattern's metadata, which Encode writes in an extension
+// chunk. It returns an error if the rating is out of range or a tag is
+// empty, wrapping ErrInvalidMeta.
+func (p *Pattern) SetMeta(m PatternMeta) error {
+
+	if err := m.validate(); err != nil {
+		return err
+	}
+
+	if m.IsZero() {
+		p.meta = nil
+	} else {
+		m = m.clone()
+		p.meta = &m
+	}
+	p.notify(Change{Kind: ChangeMeta})
+	return nil
+}
+
+// ReadMeta reads the sidecar metadata of the pattern file at path. The
+// error wraps fs.ErrNotExist if the pattern has no sidecar.
+func ReadMeta(path string) (PatternMeta, error) {
+
+	var m PatternMeta
+
+	data, err := os.ReadFile(path + MetaSuffix)
+	if err != nil {
+		return m, err
+	}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return PatternMeta{}, fmt.Errorf("reading %s: %w: %v", path+MetaSuffix, ErrInvalidMeta, err)
+	}
+	if err := m.validate(); err != nil {
+		return PatternMeta{}, fmt.Errorf("reading %s: %w", path+MetaSuffix, err)
+	}
+	return m, nil
+}
+
+// WriteMeta writes m as the sidecar metadata of the pattern file at path,
+// leaving the pattern file itself alone
+func WriteMeta(path string, m PatternMeta) error {
+
+	if err := m.validate(); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path+MetaSuffix, append(data, '\n'), 0644)
+}
+
+// decodeFileMeta decodes the pattern file at path as DecodeFileContext does,
+// and gives the pattern the metadata in its sidecar, if it has one, in
+// place of any it was encoded with
+func decodeFileMeta(ctx context.Context, path string) (*Pattern, error) {
+
+	p, err := DecodeFileContext(ctx, path)
+	if err != nil {
+		return &p, err
+	}
+
+	m, err := ReadMeta(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &p, nil
+	}
+	if err != nil {
+		return &p, err
+	}
+	if !m.IsZero() {
+		p.meta = &m
+	}
+	return &p, nil
+}
+
+// metaCodec reads and writes the metadata chunk
+type metaCodec struct{}
+
+// EncodeChunk returns the pattern's metadata as JSON, or nil if it has none
+func (metaCodec) EncodeChunk(p Pattern) ([]byte, error) {
+
+	if p.meta == nil {
+		return nil, nil
+	}
+	return json.Marshal(p.meta)
+}
+
+// DecodeChunk gives p the metadata the chunk holds
+func (metaCodec) DecodeChunk(p *Pattern, data []byte) error {
+
+	var m PatternMeta
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidMeta, err)
+	}
+	if err := m.validate(); err != nil {
+		return err
+	}
+	if !m.IsZero() {
+		p.meta = &m
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package drum_test
+
+import (
+	"bytes"
+	"errors"
+	"io/fs"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	drum "github.com/chrishiestand/golang-challenge-1-drum_machine"
+	"github.com/chrishiestand/golang-challenge-1-drum_machine/drumtest"
+)
+
+func TestMeta(t *testing.T) {
+
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	meta := drum.PatternMeta{Title: "Four on the floor", Author: "chris", Tags: []string{"techno", "House"}, Rating: 4, Created: created}
+
+	p := drum.NewPattern("0.808-alpha", 128)
+	p.AddInstrument(0, "kick").SetSteps("x---x---x---x---")
+
+	var changes []drum.Change
+	p.OnChange(func(c drum.Change) { changes = append(changes, c) })
+	if err := p.SetMeta(meta); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(changes) != 1 || changes[0].Kind != drum.ChangeMeta {
+		t.Errorf("expected a ChangeMeta, got %+v", changes)
+	}
+
+	// the pattern keeps its own copy
+	meta.Tags[0] = "trance"
+	got := p.Meta()
+	got.Tags[1] = "disco"
+	if !p.Meta().HasTag(" TECHNO ") || !p.Meta().HasTag("house") || p.Meta().HasTag("trance") {
+		t.Errorf("expected the tags as set, got %v", p.Meta().Tags)
+	}
+
+	var buf bytes.Buffer
+	if err := p.Encode(&buf); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	decoded, err := drum.Decode(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if expected := p.Meta(); !reflect.DeepEqual(decoded.Meta(), expected) {
+		t.Errorf("got %+v after decoding, expected %+v", decoded.Meta(), expected)
+	}
+	if clone := decoded.Clone(); !reflect.DeepEqual(clone.Meta(), decoded.Meta()) {
+		t.Errorf("expected the clone to keep the metadata, got %+v", clone.Meta())
+	}
+
+	// clearing the metadata drops its chunk
+	plain := drum.NewPattern("0.808-alpha", 128)
+	plain.AddInstrument(0, "kick").SetSteps("x---x---x---x---")
+	var expected bytes.Buffer
+	plain.Encode(&expected)
+	p.SetMeta(drum.PatternMeta{})
+	buf.Reset()
+	p.Encode(&buf)
+	if !bytes.Equal(buf.Bytes(), expected.Bytes()) || !p.Meta().IsZero() {
+		t.Errorf("expected a pattern without metadata to encode as before")
+	}
+
+	for _, bad := range []drum.PatternMeta{{Rating: drum.MaxRating + 1}, {Rating: -1}, {Tags: []string{"techno", " "}}} {
+		if err := p.SetMeta(bad); !errors.Is(err, drum.ErrInvalidMeta) {
+			t.Errorf("%+v: expected %v, got %v", bad, drum.ErrInvalidMeta, err)
+		}
+	}
+
+	// a chunk that isn't JSON fails the pattern
+	p.SetMeta(drum.PatternMeta{Title: "broken"})
+	buf.Reset()
+	p.Encode(&buf)
+	malformed := bytes.Replace(buf.Bytes(), []byte(`{"title"`), []byte(`["title"`), 1)
+	if _, err := drum.Decode(bytes.NewReader(malformed)); !errors.Is(err, drum.ErrInvalidMeta) {
+		t.Errorf("expected %v decoding a malformed chunk, got %v", drum.ErrInvalidMeta, err)
+	}
+}
+
+func TestMetaSidecar(t *testing.T) {
+
+	dir := drumtest.FixtureDir(t, "fixtures", "pattern_1.splice", "pattern_2.splice", "pattern_3.splice")
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	if _, err := drum.ReadMeta(path("pattern_1.splice")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected %v without a sidecar, got %v", fs.ErrNotExist, err)
+	}
+
+	meta := drum.PatternMeta{Title: "Rock", Tags: []string{"rock", "Techno"}, Rating: 3}
+	if err := drum.WriteMeta(path("pattern_1.splice"), meta); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := drum.WriteMeta(path("pattern_3.splice"), drum.PatternMeta{Tags: []string{"techno"}}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := drum.WriteMeta(path("pattern_2.splice"), drum.PatternMeta{Rating: 9}); !errors.Is(err, drum.ErrInvalidMeta) {
+		t.Errorf("expected %v writing a rating of 9, got %v", drum.ErrInvalidMeta, err)
+	}
+
+	got, err := drum.ReadMeta(path("pattern_1.splice"))
+	if err != nil || !reflect.DeepEqual(got, meta) {
+		t.Errorf("got %+v, %v, expected %+v", got, err, meta)
+	}
+
+	index, errs := drum.IndexDir(dir, 2)
+	if len(errs) != 0 {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+
+	tData := []struct {
+		tag      string
+		expected []string
+	}{
+		{"techno", []string{"pattern_1.splice", "pattern_3.splice"}},
+		{" ROCK", []string{"pattern_1.splice"}},
+		{"jazz", nil},
+	}
+	for _, exp := range tData {
+		if got := names(index.ByTag(exp.tag)); !reflect.DeepEqual(got, exp.expected) {
+			t.Errorf("%q: got %v, expected %v", exp.tag, got, exp.expected)
+		}
+	}
+
+	// a sidecar that can't be read fails its pattern
+	if err := ioutil.WriteFile(path("pattern_2.splice")+drum.MetaSuffix, []byte(`{"rating": "high"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	patterns, errs := drum.DecodeDir(dir, 1)
+	if len(patterns) != 2 || len(errs) != 1 || !errors.Is(errs[0], drum.ErrInvalidMeta) {
+		t.Errorf("expected pattern_2 to fail with %v, got %d patterns and %v", drum.ErrInvalidMeta, len(patterns), errs)
+	}
+}
@@ -0,0 +1,513 @@
+package drum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+// MIDI file constants used by ToMIDI
+const (
+	// midiTicksPerBeat is the time division of the files ToMIDI writes, in
+	// ticks per quarter note
+	midiTicksPerBeat = 96
+	// midiNoteOn and midiNoteOff are the status bytes for channel 10, the
+	// General MIDI percussion channel
+	midiNoteOn  = 0x99
+	midiNoteOff = 0x89
+	// midiControl is the control change status byte for channel 10, and
+	// midiChannelVolume the channel volume controller
+	midiControl       = 0xb9
+	midiChannelVolume = 0x07
+)
+
+// DefaultGMDrumMap maps common instrument names to their General MIDI
+// percussion note numbers. Keys are lower case; lookups through the map
+// ignore the case of the instrument name.
+var DefaultGMDrumMap = map[string]uint8{
+	"subkick":    35,
+	"kick":       36,
+	"rimshot":    37,
+	"snare":      38,
+	"clap":       39,
+	"hh-close":   42,
+	"hh-closed":  42,
+	"hihat":      42,
+	"low-tom":    45,
+	"hh-open":    46,
+	"mid-tom":    47,
+	"crash":      49,
+	"hi-tom":     50,
+	"ride":       51,
+	"tambourine": 54,
+	"cowbell":    56,
+	"hi conga":   63,
+	"low conga":  64,
+	"maracas":    70,
+}
+
+// gmNote looks up the note for an instrument name in mapping, ignoring case
+func gmNote(mapping map[string]uint8, name string) (uint8, bool) {
+
+	note, ok := mapping[strings.ToLower(name)]
+	return note, ok
+}
+
+// ByMIDINote returns copies of the pattern's instruments, as Instruments
+// does, sorted by their General MIDI note in DefaultGMDrumMap, lowest
+// first. Instruments whose names aren't in the map come last, and
+// instruments that map to the same note keep their pattern order.
+func (p Pattern) ByMIDINote() []Instrument {
+
+	instruments := p.Instruments()
+
+	sort.SliceStable(instruments, func(a, b int) bool {
+		na, oka := gmNote(DefaultGMDrumMap, instruments[a].name)
+		nb, okb := gmNote(DefaultGMDrumMap, instruments[b].name)
+
+		if oka != okb {
+			return oka
+		}
+		return na < nb
+	})
+	return instruments
+}
+
+// midiEvent is a note event at an absolute tick; note offs sort before note
+// ons at the same tick so back to back hits of one note don't cut each other
+type midiEvent struct {
+	tick     int
+	status   byte
+	note     uint8
+	velocity uint8
+}
+
+// ToMIDI writes the pattern to w as a type 0 Standard MIDI File on the
+// General MIDI percussion channel. Each instrument's name is looked up in
+// mapping, ignoring case, to find the note it plays; a nil mapping uses
+// DefaultGMDrumMap. Steps are played at the pattern's resolution, and every
+// hit lasts one step, at the velocity and offset set by its Expression; a
+// ratcheted or flammed hit plays each of its Strokes until the next begins.
+// Instruments shorter than the loop repeat from their start to fill it, as
+// Encode writes them. The file carries the pattern's tempo and a 4/4 time
+// signature, and the track ends after the last step of the loop so it
+// repeats cleanly. Instruments that aren't Audible are left
+// out. When an audible instrument has a Gain other than 1 the loudest gain
+// is set as the channel volume, and since every instrument shares the
+// channel, the quieter ones' velocities are scaled down relative to it.
+// Silent instruments without a note are ignored, but an
+// error is returned before anything is written if an instrument with hits
+// has no note or the tempo isn't positive.
+func (p Pattern) ToMIDI(w io.Writer, mapping map[string]uint8) error {
+
+	if mapping == nil {
+		mapping = DefaultGMDrumMap
+	}
+	if !(p.tempo > 0) {
+		return fmt.Errorf("cannot write MIDI at a tempo of %v", p.tempo)
+	}
+
+	var events []midiEvent
+	soloing := p.soloing()
+	volume, loudest, setVolume := p.midiVolume(soloing)
+
+	for _, inst := range p.instruments {
+		if !p.audible(inst, soloing) {
+			continue
+		}
+
+		note, ok := gmNote(mapping, inst.name)
+		if !ok {
+			if inst.hits() > 0 {
+				return fmt.Errorf("no MIDI note for instrument %d %q", inst.num, inst.name)
+			}
+			continue
+		}
+		if note > 127 {
+			return fmt.Errorf("MIDI note %d for instrument %d %q is out of range", note, inst.num, inst.name)
+		}
+
+		for s, step := range inst.cycled(p.loopSteps()) {
+			if !isOn(step) {
+				continue
+			}
+
+			e := inst.expressionAt(s % inst.stepCount())
+			length := p.midiTick(s+1) - p.midiTick(s)
+			tick := func(offset float64) int {
+				if on := p.midiTick(s) + int(math.Round(offset*float64(length))); on > 0 {
+					return on
+				}
+				return 0
+			}
+
+			strokes := e.Strokes()
+			for n, stroke := range strokes {
+				// each stroke lasts until the next begins, and the last
+				// until a step after the hit
+				on, off := tick(stroke.Offset), tick(e.Offset)+length
+				if n+1 < len(strokes) {
+					off = tick(strokes[n+1].Offset)
+				}
+				if off <= on {
+					off = on + 1
+				}
+
+				velocity := stroke.Velocity
+				if setVolume {
+					velocity = scaleVelocity(velocity, float64(inst.Gain())/loudest)
+				}
+				events = append(events,
+					midiEvent{tick: on, status: midiNoteOn, note: note, velocity: velocity},
+					midiEvent{tick: off, status: midiNoteOff, note: note, velocity: velocity})
+			}
+		}
+	}
+
+	sort.SliceStable(events, func(a, b int) bool {
+		if events[a].tick != events[b].tick {
+			return events[a].tick < events[b].tick
+		}
+		return events[a].status == midiNoteOff && events[b].status == midiNoteOn
+	})
+
+	var track bytes.Buffer
+
+	// tempo, in microseconds per quarter note, and a 4/4 time signature
+	micros := uint32(60e6/float64(p.tempo) + 0.5)
+	if micros > 0xffffff {
+		micros = 0xffffff
+	}
+	track.Write([]byte{0x00, 0xff, 0x51, 0x03, byte(micros >> 16), byte(micros >> 8), byte(micros)})
+	track.Write([]byte{0x00, 0xff, 0x58, 0x04, 0x04, 0x02, 0x18, 0x08})
+	if setVolume {
+		track.Write([]byte{0x00, midiControl, midiChannelVolume, volume})
+	}
+
+	tick := 0
+	for _, e := range events {
+		writeVarLen(&track, e.tick-tick)
+		track.Write([]byte{e.status, e.note, e.velocity})
+		tick = e.tick
+	}
+
+	end := p.midiTick(p.loopSteps())
+	if end < tick {
+		end = tick
+	}
+	writeVarLen(&track, end-tick)
+	track.Write([]byte{0xff, 0x2f, 0x00})
+
+	var buf bytes.Buffer
+	buf.WriteString("MThd")
+	binary.Write(&buf, binary.BigEndian, []uint32{6})
+	binary.Write(&buf, binary.BigEndian, []uint16{0, 1, midiTicksPerBeat})
+	buf.WriteString("MTrk")
+	binary.Write(&buf, binary.BigEndian, uint32(track.Len()))
+	track.WriteTo(&buf)
+
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// midiVolume returns the channel volume that plays the loudest of the
+// audible instruments at its Gain, as the GM default volume of 100 plays a
+// gain of 1, and that gain, which the others' velocities are scaled
+// relative to. It returns false if every audible instrument plays at a
+// gain of 1, so no volume need be set.
+func (p Pattern) midiVolume(soloing bool) (volume byte, loudest float64, ok bool) {
+
+	for _, inst := range p.instruments {
+		if !p.audible(inst, soloing) {
+			continue
+		}
+		g := float64(inst.Gain())
+		ok = ok || g != 1
+		loudest = math.Max(loudest, g)
+	}
+	if !ok {
+		return 0, 0, false
+	}
+
+	volume = byte(math.Min(127, math.Round(100*loudest)))
+	if loudest == 0 {
+		loudest = 1
+	}
+	return volume, loudest, true
+}
+
+// scaleVelocity scales a note on velocity by gain, keeping it between 1
+// and 127 so the note still sounds
+func scaleVelocity(velocity uint8, gain float64) uint8 {
+
+	v := math.Round(float64(velocity) * gain)
+	return uint8(math.Max(1, math.Min(127, v)))
+}
+
+// midiTick returns the tick step falls on, rounded to the nearest tick at
+// resolutions that don't divide midiTicksPerBeat
+func (p Pattern) midiTick(step int) int {
+
+	res := p.beatSteps()
+	return (step*midiTicksPerBeat + res/2) / res
+}
+
+// writeVarLen writes n as a MIDI variable length quantity: seven bits per
+// byte, most significant first, with the top bit set on all but the last
+func writeVarLen(buf *bytes.Buffer, n int) {
+
+	var out [5]byte
+	i := len(out) - 1
+	out[i] = byte(n & 0x7f)
+
+	for n >>= 7; n > 0; n >>= 7 {
+		i--
+		out[i] = byte(n&0x7f) | 0x80
+	}
+	buf.Write(out[i:])
+}
+
+// ImportOptions control how FromMIDI turns a MIDI file into a pattern.
+type ImportOptions struct {
+	// Channel is the MIDI channel, 1 to 16, whose notes are imported.
+	// Zero means 10, the General MIDI percussion channel.
+	Channel int
+
+	// Steps is the length of the grid the notes are quantized onto. Hits
+	// past the end of the grid wrap around, so a file of several bars is
+	// folded into one. Zero means 16.
+	Steps int
+
+	// Names maps note numbers to instrument names. Notes that aren't in
+	// it are named "note 36" and so on. A nil map names notes after
+	// DefaultGMDrumMap, taking the first name in alphabetical order when
+	// several share a note.
+	Names map[uint8]string
+
+	// Version is the version given to the imported pattern.
+	Version string
+}
+
+// midiNames returns the note names FromMIDI uses when ImportOptions.Names
+// isn't set, the inverse of DefaultGMDrumMap
+func midiNames() map[uint8]string {
+
+	names := make(map[uint8]string, len(DefaultGMDrumMap))
+
+	for name, note := range DefaultGMDrumMap {
+		if other, ok := names[note]; !ok || name < other {
+			names[note] = name
+		}
+	}
+	return names
+}
+
+// FromMIDI reads a Standard MIDI File of type 0 or 1 from r and quantizes
+// the note ons of one channel, on every track, onto a grid of sixteenth
+// note steps. Each note number played becomes an instrument whose id is the
+// note number, in ascending order. The tempo is taken from the file's first
+// tempo event, or is 120 BPM when it has none. Note lengths, velocities and
+// every other event are ignored. Malformed files return an error wrapping
+// ErrInvalidMIDI.
+func FromMIDI(r io.Reader, opts ImportOptions) (Pattern, error) {
+
+	channel := opts.Channel
+	if channel == 0 {
+		channel = 10
+	}
+	if channel < 1 || channel > 16 {
+		return Pattern{}, fmt.Errorf("MIDI channel %d isn't between 1 and 16", channel)
+	}
+
+	steps := opts.Steps
+	if steps == 0 {
+		steps = stepsPerMeasure * measuresPerInstrument
+	}
+	if steps < 0 {
+		return Pattern{}, fmt.Errorf("%w: cannot import onto %d steps", ErrInvalidStep, steps)
+	}
+
+	names := opts.Names
+	if names == nil {
+		names = midiNames()
+	}
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Pattern{}, err
+	}
+
+	chunk, data, err := midiChunk(data, "MThd")
+	if err != nil {
+		return Pattern{}, err
+	}
+	if len(chunk) < 6 {
+		return Pattern{}, fmt.Errorf("%w: header chunk is %d bytes", ErrInvalidMIDI, len(chunk))
+	}
+
+	format := binary.BigEndian.Uint16(chunk[0:2])
+	tracks := int(binary.BigEndian.Uint16(chunk[2:4]))
+	division := int(binary.BigEndian.Uint16(chunk[4:6]))
+
+	if format > 1 {
+		return Pattern{}, fmt.Errorf("%w: format %d isn't supported", ErrInvalidMIDI, format)
+	}
+	if division&0x8000 != 0 || division == 0 {
+		return Pattern{}, fmt.Errorf("%w: only metrical time divisions are supported", ErrInvalidMIDI)
+	}
+
+	var tempo float32
+	hits := make(map[uint8][]byte)
+
+	for t := 0; t < tracks; t++ {
+		chunk, data, err = midiChunk(data, "MTrk")
+		if err != nil {
+			return Pattern{}, err
+		}
+
+		err = readMIDITrack(chunk, func(tick int, status byte, payload []byte) {
+
+			switch {
+			case status == 0xff && payload[0] == 0x51 && len(payload) == 4 && tempo == 0:
+				if micros := int(payload[1])<<16 | int(payload[2])<<8 | int(payload[3]); micros > 0 {
+					tempo = float32(60e6 / float64(micros))
+				}
+			case status&0xf0 == 0x90 && int(status&0x0f)+1 == channel && payload[1] > 0:
+				note := payload[0]
+				if hits[note] == nil {
+					hits[note] = make([]byte, steps)
+				}
+				if steps > 0 {
+					hits[note][(tick*stepsPerBeat+division/2)/division%steps] = StepOn
+				}
+			}
+		})
+		if err != nil {
+			return Pattern{}, fmt.Errorf("track %d: %w", t, err)
+		}
+	}
+
+	if tempo == 0 {
+		tempo = 120
+	}
+
+	notes := make([]int, 0, len(hits))
+	for note := range hits {
+		notes = append(notes, int(note))
+	}
+	sort.Ints(notes)
+
+	p := Pattern{version: opts.Version, tempo: tempo}
+
+	for _, note := range notes {
+		name, ok := names[uint8(note)]
+		if !ok {
+			name = fmt.Sprintf("note %d", note)
+		}
+
+		inst := Instrument{num: uint32(note), name: name}
+		inst.setSteps(hits[uint8(note)])
+		p.instruments = append(p.instruments, inst)
+	}
+	return p, nil
+}
+
+// midiChunk returns the body of the chunk at the start of data, which must
+// have the given type, and the data that follows it
+func midiChunk(data []byte, kind string) (chunk, rest []byte, err error) {
+
+	if len(data) < 8 || string(data[:4]) != kind {
+		return nil, nil, fmt.Errorf("%w: expected a %s chunk", ErrInvalidMIDI, kind)
+	}
+
+	size := binary.BigEndian.Uint32(data[4:8])
+	if uint64(size) > uint64(len(data)-8) {
+		return nil, nil, fmt.Errorf("%w: %s chunk of %d bytes runs past the end of the file", ErrInvalidMIDI, kind, size)
+	}
+	return data[8 : 8+size], data[8+size:], nil
+}
+
+// readMIDITrack walks the events of a track chunk, calling event with the
+// absolute tick, status byte and data bytes of each channel and meta event.
+// A meta event's data starts with its type. System exclusive events are
+// skipped.
+func readMIDITrack(track []byte, event func(tick int, status byte, payload []byte)) error {
+
+	tick := 0
+	var running byte
+
+	for len(track) > 0 {
+		delta, n := readVarLen(track)
+		if n == 0 {
+			return fmt.Errorf("%w: bad delta time", ErrInvalidMIDI)
+		}
+		tick += delta
+		track = track[n:]
+
+		if len(track) == 0 {
+			return fmt.Errorf("%w: event cut short", ErrInvalidMIDI)
+		}
+
+		status := track[0]
+		switch {
+		case status == 0xff, status == 0xf0, status == 0xf7:
+			track = track[1:]
+			head := 0
+			if status == 0xff {
+				if len(track) == 0 {
+					return fmt.Errorf("%w: meta event cut short", ErrInvalidMIDI)
+				}
+				head = 1
+			}
+
+			size, n := readVarLen(track[head:])
+			if n == 0 || size > len(track)-head-n {
+				return fmt.Errorf("%w: event cut short", ErrInvalidMIDI)
+			}
+			if status == 0xff {
+				payload := append([]byte{track[0]}, track[head+n:head+n+size]...)
+				event(tick, status, payload)
+			}
+			track = track[head+n+size:]
+			running = 0
+			continue
+		case status&0x80 != 0:
+			running = status
+			track = track[1:]
+		case running == 0:
+			return fmt.Errorf("%w: data byte without a status", ErrInvalidMIDI)
+		}
+
+		size := 2
+		if kind := running & 0xf0; kind == 0xc0 || kind == 0xd0 {
+			size = 1
+		}
+		if running >= 0xf0 || len(track) < size {
+			return fmt.Errorf("%w: event cut short", ErrInvalidMIDI)
+		}
+
+		event(tick, running, track[:size])
+		track = track[size:]
+	}
+	return nil
+}
+
+// readVarLen reads a MIDI variable length quantity from the start of data,
+// returning its value and the number of bytes it took, or 0 bytes if data
+// doesn't start with one of at most four bytes
+func readVarLen(data []byte) (int, int) {
+
+	value := 0
+
+	for i := 0; i < len(data) && i < 4; i++ {
+		value = value<<7 | int(data[i]&0x7f)
+		if data[i]&0x80 == 0 {
+			return value, i + 1
+		}
+	}
+	return 0, 0
+}
@@ -0,0 +1,181 @@
+package drum
+
+import (
+	"bytes"
+	"path"
+	"testing"
+)
+
+func TestByMIDINote(t *testing.T) {
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_4.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_4.splice - %v", err)
+	}
+	decoded.instruments = append(decoded.instruments, Instrument{num: 7, name: "theremin"}, Instrument{num: 8, name: "hh-open"})
+
+	expected := []string{"SubKick", "Kick", "hh-open", "Low Conga", "Maracas", "theremin"}
+
+	sorted := decoded.ByMIDINote()
+	if len(sorted) != len(expected) {
+		t.Fatalf("expected %d instruments, got %d", len(expected), len(sorted))
+	}
+	for i, name := range expected {
+		if sorted[i].name != name {
+			t.Errorf("position %d: got %s, expected %s", i, sorted[i].name, name)
+		}
+	}
+
+	if decoded.instruments[0].name != "SubKick" || decoded.instruments[4].name != "theremin" {
+		t.Errorf("ByMIDINote reordered the pattern itself")
+	}
+	sorted[0].setStep(0, StepOff)
+	sorted[0].setStep(1, StepOn)
+	if step, _ := decoded.instruments[0].step(1); step != StepOff {
+		t.Errorf("ByMIDINote shares steps with the pattern")
+	}
+}
+
+func TestToMIDI(t *testing.T) {
+
+	p := Pattern{tempo: 120, instruments: []Instrument{
+		{num: 0, name: "Kick", measure: []Step{{1, 0, 0, 0}, {0, 0, 0, 0}, {1, 0, 0, 0}, {0, 0, 0, 0}}},
+		{num: 1, name: "theremin", measure: []Step{{0, 0, 0, 0}, {0, 0, 0, 0}, {0, 0, 0, 0}, {0, 0, 0, 0}}},
+	}}
+
+	expected := []byte{
+		'M', 'T', 'h', 'd', 0, 0, 0, 6, 0, 0, 0, 1, 0, 96,
+		'M', 'T', 'r', 'k', 0, 0, 0, 37,
+		0x00, 0xff, 0x51, 0x03, 0x07, 0xa1, 0x20,
+		0x00, 0xff, 0x58, 0x04, 0x04, 0x02, 0x18, 0x08,
+		0x00, 0x99, 36, 100,
+		0x18, 0x89, 36, 100,
+		0x81, 0x28, 0x99, 36, 100,
+		0x18, 0x89, 36, 100,
+		0x81, 0x28, 0xff, 0x2f, 0x00,
+	}
+
+	var buf bytes.Buffer
+	if err := p.ToMIDI(&buf, nil); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("got\n% x\nexpected\n% x", buf.Bytes(), expected)
+	}
+
+	p.instruments[1].measure[0][0] = StepOn
+	buf.Reset()
+	if err := p.ToMIDI(&buf, nil); err == nil || buf.Len() != 0 {
+		t.Errorf("expected an error for an unmapped instrument with hits, got %v", err)
+	}
+	if err := p.ToMIDI(&buf, map[string]uint8{"kick": 36, "theremin": 81}); err != nil {
+		t.Errorf("unexpected error with a custom mapping %v", err)
+	}
+
+	p.tempo = 0
+	if err := p.ToMIDI(&buf, nil); err == nil {
+		t.Errorf("expected an error for a zero tempo")
+	}
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_1.splice - %v", err)
+	}
+	if err := decoded.ToMIDI(&buf, nil); err != nil {
+		t.Errorf("unexpected error writing pattern_1 %v", err)
+	}
+}
+
+func TestFromMIDI(t *testing.T) {
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_1.splice - %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := decoded.ToMIDI(&buf, nil); err != nil {
+		t.Fatalf("unexpected error writing pattern_1 %v", err)
+	}
+
+	imported, err := FromMIDI(&buf, ImportOptions{Version: "imported"})
+	if err != nil {
+		t.Fatalf("unexpected error reading pattern_1 back %v", err)
+	}
+	if imported.version != "imported" || imported.tempo != decoded.tempo {
+		t.Errorf("got version %q at %v, expected imported at %v", imported.version, imported.tempo, decoded.tempo)
+	}
+
+	expected := []struct {
+		id   uint32
+		name string
+	}{{36, "kick"}, {38, "snare"}, {39, "clap"}, {42, "hh-close"}, {46, "hh-open"}, {56, "cowbell"}}
+	if len(imported.instruments) != len(expected) {
+		t.Fatalf("expected %d instruments, got\n%s", len(expected), imported)
+	}
+	for i, exp := range expected {
+		inst := imported.instruments[i]
+		var original Instrument
+		for _, inst := range decoded.instruments {
+			if inst.name == exp.name {
+				original = inst
+			}
+		}
+		if inst.num != exp.id || inst.name != exp.name || !bytes.Equal(inst.steps(), original.steps()) {
+			t.Errorf("position %d: got (%d) %s %s, expected (%d) %s %s", i, inst.num, inst.name, gridString(inst.steps()), exp.id, exp.name, gridString(original.steps()))
+		}
+	}
+
+	// a type 1 file at 48 ticks per beat with a 100 BPM tempo track and a
+	// two bar drum track using running status: a kick slightly early on
+	// the second beat, a note on channel 1 that's ignored, a zero velocity
+	// note on and a snare in the second bar that folds onto step 12
+	file := []byte{
+		'M', 'T', 'h', 'd', 0, 0, 0, 6, 0, 1, 0, 2, 0, 48,
+		'M', 'T', 'r', 'k', 0, 0, 0, 11,
+		0x00, 0xff, 0x51, 0x03, 0x09, 0x27, 0xc0,
+		0x00, 0xff, 0x2f, 0x00,
+		'M', 'T', 'r', 'k', 0, 0, 0, 26,
+		0x00, 0x99, 36, 100,
+		0x2e, 36, 100,
+		0x01, 0x90, 50, 100,
+		0x00, 0x99, 36, 0,
+		0x82, 0x21, 38, 100,
+		0x0a, 0xc9, 5,
+		0x00, 0xff, 0x2f, 0x00,
+	}
+
+	imported, err = FromMIDI(bytes.NewReader(file), ImportOptions{Names: map[uint8]string{36: "bd"}})
+	if err != nil {
+		t.Fatalf("unexpected error reading a type 1 file %v", err)
+	}
+	if imported.tempo != 100 || len(imported.instruments) != 2 {
+		t.Fatalf("expected two instruments at 100 BPM, got\n%s", imported)
+	}
+	if got := imported.instruments[0]; got.num != 36 || got.name != "bd" || gridString(got.steps()) != "x---x-----------" {
+		t.Errorf("got kick (%d) %s %s", got.num, got.name, gridString(got.steps()))
+	}
+	if got := imported.instruments[1]; got.num != 38 || got.name != "note 38" || gridString(got.steps()) != "------------x---" {
+		t.Errorf("got snare (%d) %s %s", got.num, got.name, gridString(got.steps()))
+	}
+
+	bad := []struct {
+		name string
+		data []byte
+		opts ImportOptions
+	}{
+		{"empty", nil, ImportOptions{}},
+		{"not midi", []byte("SPLICE\x00\x00\x00\x00\x00\x00\x00"), ImportOptions{}},
+		{"format 2", append([]byte{'M', 'T', 'h', 'd', 0, 0, 0, 6, 0, 2}, file[10:]...), ImportOptions{}},
+		{"smpte", append(append([]byte(nil), file[:12]...), append([]byte{0xe7, 0x28}, file[14:]...)...), ImportOptions{}},
+		{"missing track", file[:14+8+11], ImportOptions{}},
+		{"short track", file[:len(file)-1], ImportOptions{}},
+		{"channel", file, ImportOptions{Channel: 17}},
+	}
+
+	for _, exp := range bad {
+		if _, err := FromMIDI(bytes.NewReader(exp.data), exp.opts); err == nil {
+			t.Errorf("%s: expected an error", exp.name)
+		}
+	}
+}
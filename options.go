@@ -0,0 +1,502 @@
+package drum
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// DecodeOptions adjusts how a .splice payload is decoded. The zero value
+// decodes the same way DecodeFile does.
+type DecodeOptions struct {
+	// NameEncoding controls what happens to instrument names that aren't
+	// valid UTF-8.
+	NameEncoding NameEncoding
+
+	// RejectDuplicateIDs fails the decode when two instruments share an id,
+	// which usually means the file is malformed.
+	RejectDuplicateIDs bool
+
+	// MaxInstruments fails the decode when a pattern holds more than this
+	// many instruments. Zero or less means DefaultMaxInstruments.
+	MaxInstruments int
+
+	// LengthFieldSize is the width in bytes of the little-endian payload
+	// length that follows the header: 1, 2, 4 or 8. Zero means 1, the
+	// width of the original format, whose byte is the lowest of a
+	// big-endian length running back into the last two header bytes, so
+	// that payloads over 255 bytes can be declared. Encoding a decoded
+	// pattern writes the length with the same width.
+	LengthFieldSize int
+
+	// MaxPayload fails the decode when the declared payload length is
+	// over this many bytes, before anything is allocated for it. Zero or
+	// less means DefaultMaxPayload.
+	MaxPayload int64
+
+	// KeepRaw keeps each instrument's original bytes alongside its parsed
+	// fields. Encode writes those bytes back verbatim for every instrument
+	// whose steps haven't been changed since, so re-encoding after editing
+	// a few instruments leaves the rest untouched.
+	KeepRaw bool
+
+	// StepPacking is how each instrument's steps are stored. Encoding a
+	// decoded pattern packs its steps the same way.
+	StepPacking StepPacking
+
+	// TempoFormat is how the tempo following the version is stored.
+	// Encoding a decoded pattern writes the tempo the same way.
+	TempoFormat TempoFormat
+
+	// Layout is the order the instruments' steps are stored in. Encoding
+	// a decoded pattern lays its steps out the same way.
+	Layout Layout
+
+	// InstrumentCount is the number of instruments in the payload. It is
+	// needed to find where the steps start in LayoutColumnMajor, and must
+	// be set to a positive count in that layout; LayoutRowMajor ignores it.
+	InstrumentCount int
+
+	// StepsPerInstrument is the number of steps every instrument holds,
+	// which the format doesn't record. Zero means 16, the four measures of
+	// four steps of the original format.
+	StepsPerInstrument int
+
+	// StepsPerBeat is the resolution the steps are played at, which the
+	// format doesn't record either: 4 for sixteenth notes, 3 or 6 for
+	// triplets and so on. Zero means 4.
+	StepsPerBeat int
+
+	// ByteOrder is the byte order of the payload length, the tempo and the
+	// instrument ids. Nil means little-endian, the order of the original
+	// format. Encoding a decoded pattern writes them in the same order.
+	ByteOrder binary.ByteOrder
+
+	// VersionSize is the width in bytes of the null-padded version field.
+	// Zero means 32, the width of the original format. Encoding a decoded
+	// pattern pads its version to the same width.
+	VersionSize int
+
+	// Dialects, if not empty, picks the byte order and version width by
+	// the pattern's version, which is read up to its first null byte to
+	// find the first Dialect it starts with. A matching Dialect replaces
+	// ByteOrder and VersionSize for everything after the payload length,
+	// which is read before the version is known; a pattern matching none
+	// is decoded with them as they are.
+	Dialects []Dialect
+
+	// Versions, if not empty, lists the versions a pattern may have. A
+	// pattern with any other version fails the decode with
+	// ErrUnsupportedVersion.
+	Versions []string
+
+	// KnownVersions fails the decode with ErrUnsupportedVersion for a
+	// pattern whose version isn't one of the SupportedVersions, rather
+	// than reading it as the original format, and checks the instruments
+	// of the others against what their revision can hold. Without
+	// Dialects, the revisions' byte orders and version widths are used.
+	KnownVersions bool
+
+	// Strict fails the decode with ErrTrailingData when anything follows
+	// the declared payload, reading on from r to find out, so r must hold
+	// a single pattern. Without it decoding stops at the declared length,
+	// and DecodeWithWarnings reports whatever was skipped.
+	Strict bool
+}
+
+// DefaultMaxPayload is the payload limit used when DecodeOptions.MaxPayload
+// isn't set
+const DefaultMaxPayload = 1 << 20
+
+// DefaultMaxInstruments is the instrument limit used when
+// DecodeOptions.MaxInstruments isn't set
+const DefaultMaxInstruments = 4096
+
+func (o DecodeOptions) maxPayload() int64 {
+
+	if o.MaxPayload <= 0 {
+		return DefaultMaxPayload
+	}
+	return o.MaxPayload
+}
+
+func (o DecodeOptions) lengthFieldSize() (int, error) {
+
+	switch o.LengthFieldSize {
+	case 0:
+		return 1, nil
+	case 1, 2, 4, 8:
+		return o.LengthFieldSize, nil
+	default:
+		return 0, fmt.Errorf("length field size must be 1, 2, 4 or 8 bytes, got %d", o.LengthFieldSize)
+	}
+}
+
+// byteOrder returns ByteOrder, or little-endian if it isn't set
+func (o DecodeOptions) byteOrder() binary.ByteOrder {
+
+	if o.ByteOrder == nil {
+		return binary.LittleEndian
+	}
+	return o.ByteOrder
+}
+
+func (o DecodeOptions) versionSize() (int, error) {
+
+	switch {
+	case o.VersionSize == 0:
+		return versionSize, nil
+	case o.VersionSize < 0:
+		return 0, fmt.Errorf("version field size must be positive, got %d", o.VersionSize)
+	}
+	return o.VersionSize, nil
+}
+
+// Dialect is the layout a hardware revision writes its patterns in, used by
+// DecodeOptions.Dialects for patterns whose version starts with
+// VersionPrefix. ByteOrder and VersionSize mean what they do in
+// DecodeOptions, nil and zero being the original format's.
+type Dialect struct {
+	VersionPrefix string
+	ByteOrder     binary.ByteOrder
+	VersionSize   int
+}
+
+// withDialect returns the options with the byte order and version width of
+// the first of Dialects that payload's leading version starts with, or the
+// options unchanged if there's none
+func (o DecodeOptions) withDialect(payload []byte) DecodeOptions {
+
+	version := payload
+	if end := bytes.IndexByte(payload, 0); end >= 0 {
+		version = payload[:end]
+	}
+
+	for _, d := range o.Dialects {
+		if bytes.HasPrefix(version, []byte(d.VersionPrefix)) {
+			o.ByteOrder, o.VersionSize = d.ByteOrder, d.VersionSize
+			return o
+		}
+	}
+	return o
+}
+
+// readUint returns the unsigned integer held in b, up to 8 bytes, in order
+func readUint(order binary.ByteOrder, b []byte) uint64 {
+
+	var buf [8]byte
+	if isBigEndian(order) {
+		copy(buf[8-len(b):], b)
+		return binary.BigEndian.Uint64(buf[:])
+	}
+	copy(buf[:], b)
+	return binary.LittleEndian.Uint64(buf[:])
+}
+
+// putUint returns v as size bytes in order, dropping any higher bytes
+func putUint(order binary.ByteOrder, v uint64, size int) []byte {
+
+	var buf [8]byte
+	if isBigEndian(order) {
+		binary.BigEndian.PutUint64(buf[:], v)
+		return buf[8-size:]
+	}
+	binary.LittleEndian.PutUint64(buf[:], v)
+	return buf[:size]
+}
+
+// isBigEndian reports whether order stores the most significant byte first
+func isBigEndian(order binary.ByteOrder) bool {
+
+	return order.Uint16([]byte{0, 1}) == 1
+}
+
+func (o DecodeOptions) stepsPerInstrument() (int, error) {
+
+	switch {
+	case o.StepsPerInstrument == 0:
+		return measuresPerInstrument * stepsPerMeasure, nil
+	case o.StepsPerInstrument < 0:
+		return 0, fmt.Errorf("%w: instruments can't hold %d steps", ErrInvalidStep, o.StepsPerInstrument)
+	}
+	return o.StepsPerInstrument, nil
+}
+
+// checkVersion returns an error wrapping ErrUnsupportedVersion if Versions
+// doesn't allow version, or KnownVersions is set and it's not known
+func (o DecodeOptions) checkVersion(version string) error {
+
+	if !o.supportsVersion(version) {
+		return fmt.Errorf("%w: %q", ErrUnsupportedVersion, version)
+	}
+	if _, ok := lookupVersion(version); o.KnownVersions && !ok {
+		return unknownVersion(version)
+	}
+	return nil
+}
+
+// withKnownVersions returns the options with the known revisions as their
+// Dialects if KnownVersions is set and there are none
+func (o DecodeOptions) withKnownVersions() DecodeOptions {
+
+	if o.KnownVersions && len(o.Dialects) == 0 {
+		o.Dialects = versionDialects()
+	}
+	return o
+}
+
+// checkInstrument returns an error if KnownVersions is set and inst holds
+// what the revision writing version can't
+func (o DecodeOptions) checkInstrument(version string, inst Instrument) error {
+
+	if v, ok := lookupVersion(version); o.KnownVersions && ok {
+		return v.checkInstrument(inst)
+	}
+	return nil
+}
+
+// supportsVersion reports whether Versions allows version
+func (o DecodeOptions) supportsVersion(version string) bool {
+
+	if len(o.Versions) == 0 {
+		return true
+	}
+	for _, v := range o.Versions {
+		if v == version {
+			return true
+		}
+	}
+	return false
+}
+
+func (o DecodeOptions) maxInstruments() int {
+
+	if o.MaxInstruments <= 0 {
+		return DefaultMaxInstruments
+	}
+	return o.MaxInstruments
+}
+
+// StepPacking selects how an instrument's steps are laid out in a payload
+type StepPacking int
+
+const (
+	// PackingBytes stores each step as its own byte, as the original
+	// format does.
+	PackingBytes StepPacking = iota
+	// PackingBits stores the steps as a bit field, eight to a byte, with
+	// step n in the bit with value 1<<(n%8) of byte n/8. The 16 steps of
+	// the original format take 2 bytes, a little-endian uint16 laid out as
+	// in Instrument.Mask. Hits lose any velocity their bytes carry and
+	// decode as StepOn.
+	PackingBits
+)
+
+// stepsSize returns the number of bytes an instrument's steps take up
+// when it has the given number of steps
+func (s StepPacking) stepsSize(steps int) (int, error) {
+
+	switch s {
+	case PackingBytes:
+		return steps, nil
+	case PackingBits:
+		return (steps + 7) / 8, nil
+	default:
+		return 0, fmt.Errorf("unknown step packing %d", s)
+	}
+}
+
+// packSteps returns steps as they're stored with the packing
+func (s StepPacking) packSteps(steps []byte) []byte {
+
+	if s != PackingBits {
+		return steps
+	}
+
+	packed := make([]byte, (len(steps)+7)/8)
+	for n, step := range steps {
+		if isOn(step) {
+			packed[n/8] |= 1 << uint(n%8)
+		}
+	}
+	return packed
+}
+
+// unpackBits returns the count steps held in a PackingBits bit field
+func unpackBits(packed []byte, count int) []byte {
+
+	steps := make([]byte, count)
+	for n := range steps {
+		if packed[n/8]&(1<<uint(n%8)) != 0 {
+			steps[n] = StepOn
+		}
+	}
+	return steps
+}
+
+// Layout selects the order instruments' steps are stored in a payload
+type Layout int
+
+const (
+	// LayoutRowMajor stores each instrument's id, name and steps
+	// together, one instrument after another, as the original format does.
+	LayoutRowMajor Layout = iota
+	// LayoutColumnMajor stores the id and name of every instrument first,
+	// then the first step of every instrument in order, then every second
+	// step and so on. The steps are always one byte each, and the payload
+	// has no instrument count, so DecodeOptions.InstrumentCount must say
+	// how many instruments it holds. KeepRaw has no effect in this layout.
+	LayoutColumnMajor
+)
+
+// checkLayout reports whether the options describe a layout that can be
+// decoded
+func (o DecodeOptions) checkLayout() error {
+
+	switch o.Layout {
+	case LayoutRowMajor:
+		return nil
+	case LayoutColumnMajor:
+		if o.InstrumentCount <= 0 {
+			return fmt.Errorf("a column-major layout needs a positive instrument count, got %d", o.InstrumentCount)
+		}
+		if o.StepPacking != PackingBytes {
+			return fmt.Errorf("a column-major layout stores one byte per step")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown layout %d", o.Layout)
+	}
+}
+
+// TempoFormat selects how the tempo is stored in a payload
+type TempoFormat int
+
+const (
+	// Float32Tempo stores the tempo as a little-endian float32, as the
+	// original format does.
+	Float32Tempo TempoFormat = iota
+	// Int32Tempo stores the tempo as a little-endian int32 of whole beats
+	// per minute. Encoding rounds the tempo to the nearest whole number.
+	Int32Tempo
+	// TextTempo stores the tempo as ASCII decimal text such as "120.5",
+	// null padded to textTempoSize bytes.
+	TextTempo
+)
+
+// textTempoSize is the number of bytes a TextTempo tempo is padded to
+const textTempoSize = 8
+
+// size returns the number of bytes the tempo takes up
+func (f TempoFormat) size() (int, error) {
+
+	switch f {
+	case Float32Tempo, Int32Tempo:
+		return 4, nil
+	case TextTempo:
+		return textTempoSize, nil
+	default:
+		return 0, fmt.Errorf("unknown tempo format %d", f)
+	}
+}
+
+// decode reads a tempo stored in order from the start of b, returning it
+// along with the number of bytes it took up
+func (f TempoFormat) decode(b []byte, order binary.ByteOrder) (float32, int, error) {
+
+	size, err := f.size()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if len(b) < size {
+		err := io.ErrUnexpectedEOF
+		if len(b) == 0 {
+			err = io.EOF
+		}
+		return 0, 0, fmt.Errorf("%w: %w", ErrTruncated, err)
+	}
+
+	switch f {
+	case Int32Tempo:
+		return float32(int32(order.Uint32(b))), size, nil
+	case TextTempo:
+		text := string(bytes.TrimRight(b[:size], "\x00"))
+		tempo, err := strconv.ParseFloat(text, 32)
+		if err != nil {
+			return 0, 0, fmt.Errorf("%q is not a number: %w", text, err)
+		}
+		return float32(tempo), size, nil
+	default:
+		return math.Float32frombits(order.Uint32(b)), size, nil
+	}
+}
+
+// encode returns the bytes the tempo is stored as in order
+func (f TempoFormat) encode(tempo float32, order binary.ByteOrder) ([]byte, error) {
+
+	size, err := f.size()
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, size)
+
+	switch f {
+	case Int32Tempo:
+		order.PutUint32(b, uint32(int32(math.Round(float64(tempo)))))
+	case TextTempo:
+		text := strconv.FormatFloat(float64(tempo), 'f', -1, 32)
+		if len(text) > size {
+			return nil, fmt.Errorf("tempo %s is longer than the %d bytes a text tempo holds", text, size)
+		}
+		copy(b, text)
+	default:
+		order.PutUint32(b, math.Float32bits(tempo))
+	}
+	return b, nil
+}
+
+// NameEncoding selects how instrument names with invalid UTF-8 are handled
+type NameEncoding int
+
+const (
+	// NameRaw keeps the name bytes exactly as they appear in the file.
+	NameRaw NameEncoding = iota
+	// NameReplaceInvalid replaces each run of invalid bytes with the
+	// Unicode replacement character U+FFFD.
+	NameReplaceInvalid
+	// NameRejectInvalid fails the decode when a name isn't valid UTF-8.
+	NameRejectInvalid
+)
+
+func (e NameEncoding) decode(name []byte) (string, error) {
+
+	if utf8.Valid(name) {
+		return intern(name), nil
+	}
+
+	switch e {
+	case NameReplaceInvalid:
+		return strings.ToValidUTF8(string(name), "\uFFFD"), nil
+	case NameRejectInvalid:
+		return "", fmt.Errorf("%w: %q is not valid UTF-8", ErrInvalidName, name)
+	default:
+		return string(name), nil
+	}
+}
+
+// DecodeWithOptions decodes a single pattern from r as adjusted by opts.
+// It reads exactly the header, length byte and payload of the pattern, and
+// then, with opts.Strict, one more byte to make sure there isn't any. As
+// nothing may follow a strict pattern, a reader that can't Peek or Seek is
+// then read through a buffer, so its extension area is read too.
+func DecodeWithOptions(r io.Reader, opts DecodeOptions) (Pattern, error) {
+
+	return decode(context.Background(), r, opts, nil)
+}
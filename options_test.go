@@ -0,0 +1,402 @@
+package drum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestDecodeNameEncoding(t *testing.T) {
+	tData := []struct {
+		encoding NameEncoding
+		name     string
+		fail     bool
+	}{
+		{NameRaw, "caf\xe9 bell", false},
+		{NameReplaceInvalid, "caf\uFFFD bell", false},
+		{NameRejectInvalid, "", true},
+	}
+
+	for _, exp := range tData {
+
+		f, err := os.Open(path.Join("fixtures", "name_high_bytes.splice"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p, err := DecodeWithOptions(f, DecodeOptions{NameEncoding: exp.encoding})
+		f.Close()
+
+		if exp.fail {
+			if err == nil {
+				t.Errorf("encoding %d: expected an error", exp.encoding)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("encoding %d: unexpected error %v", exp.encoding, err)
+		}
+		if p.instruments[0].name != "kick" || p.instruments[1].name != exp.name {
+			t.Errorf("encoding %d: got names %q and %q", exp.encoding, p.instruments[0].name, p.instruments[1].name)
+		}
+	}
+}
+
+func TestDecodeRejectDuplicateIDs(t *testing.T) {
+
+	for _, reject := range []bool{false, true} {
+
+		f, err := os.Open(path.Join("fixtures", "duplicate_ids.splice"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p, err := DecodeWithOptions(f, DecodeOptions{RejectDuplicateIDs: reject})
+		f.Close()
+
+		if reject {
+			if err == nil {
+				t.Errorf("expected an error for the duplicated id")
+			}
+			continue
+		}
+		if err != nil || len(p.instruments) != 3 {
+			t.Errorf("expected all 3 instruments without the option, got %d, %v", len(p.instruments), err)
+		}
+	}
+}
+
+func TestDecodeMaxInstruments(t *testing.T) {
+	tData := []struct {
+		max  int
+		fail bool
+	}{
+		{0, false},
+		{10, false},
+		{9, true},
+		{3, true},
+	}
+
+	for _, exp := range tData {
+
+		f, err := os.Open(path.Join("fixtures", "many_instruments.splice"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p, err := DecodeWithOptions(f, DecodeOptions{MaxInstruments: exp.max})
+		f.Close()
+
+		if exp.fail {
+			if err == nil {
+				t.Errorf("max %d: expected an error", exp.max)
+			}
+			continue
+		}
+		if err != nil || len(p.instruments) != 10 {
+			t.Errorf("max %d: expected 10 instruments, got %d, %v", exp.max, len(p.instruments), err)
+		}
+	}
+}
+
+func TestDecodeLengthFieldSize(t *testing.T) {
+
+	data, err := ioutil.ReadFile(path.Join("fixtures", "wide_length.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := DecodeWithOptions(bytes.NewReader(data), DecodeOptions{LengthFieldSize: 2})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(p.instruments) != 12 || p.instruments[11].name != "instrument-11" || p.tempo != 128 {
+		t.Fatalf("wide_length.splice wasn't decoded as expected:\n%s", p)
+	}
+
+	var buf bytes.Buffer
+	if err := p.Encode(&buf); err != nil {
+		t.Fatalf("unexpected error encoding %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("re-encoding didn't keep the 2 byte length field:\n%x\nExpected:\n%x", buf.Bytes(), data)
+	}
+
+	if _, err := DecodeWithOptions(bytes.NewReader(data), DecodeOptions{}); err == nil {
+		t.Errorf("expected an error decoding a 2 byte length as 1 byte")
+	}
+	if _, err := DecodeWithOptions(bytes.NewReader(data), DecodeOptions{LengthFieldSize: 3}); err == nil {
+		t.Errorf("expected an error for a 3 byte length field")
+	}
+	if _, err := DecodeWithOptions(bytes.NewReader(data), DecodeOptions{LengthFieldSize: 2, MaxPayload: 255}); !errors.Is(err, ErrPayloadTooLarge) {
+		t.Errorf("expected %v, got %v", ErrPayloadTooLarge, err)
+	}
+}
+
+func TestDecodeKeepRaw(t *testing.T) {
+
+	fixturePath := path.Join("fixtures", "pattern_1.splice")
+	original, err := ioutil.ReadFile(fixturePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := DecodeWithOptions(bytes.NewReader(original), DecodeOptions{KeepRaw: true})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	edited := p.instruments[0]
+	if err := p.ToggleStep(edited.num, 0); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if p.instruments[0].raw != nil {
+		t.Errorf("instrument %d still has its raw bytes after being edited", edited.num)
+	}
+	for _, inst := range p.instruments[1:] {
+		if inst.raw == nil {
+			t.Errorf("instrument %d didn't keep its raw bytes", inst.num)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := p.Encode(&buf); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// only the first step of the first instrument should differ: it follows
+	// the header, length byte, version, tempo, id, name length and name
+	expected := append([]byte(nil), original...)
+	expected[headerSize+1+versionSize+4+4+1+len(edited.name)] ^= StepOn
+
+	if !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("re-encoding changed more than the edited step.\nGot:\n%x\nExpected:\n%x", buf.Bytes(), expected)
+	}
+}
+
+func TestDecodeStepPacking(t *testing.T) {
+
+	packed, err := ioutil.ReadFile(path.Join("fixtures", "bits_packed.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	unpacked, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_1.splice - %v", err)
+	}
+
+	p, err := DecodeWithOptions(bytes.NewReader(packed), DecodeOptions{StepPacking: PackingBits})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if p.String() != unpacked.String() {
+		t.Errorf("bits_packed.splice should hold pattern_1.\nGot:\n%s\nExpected:\n%s", p, unpacked)
+	}
+
+	var buf bytes.Buffer
+	if err := p.Encode(&buf); err != nil {
+		t.Fatalf("unexpected error encoding %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), packed) {
+		t.Errorf("re-encoding didn't repack the steps:\n%x\nExpected:\n%x", buf.Bytes(), packed)
+	}
+
+	if _, err := DecodeWithOptions(bytes.NewReader(packed), DecodeOptions{StepPacking: 7}); err == nil {
+		t.Errorf("expected an error for an unknown step packing")
+	}
+}
+
+func TestDecodeTextTempo(t *testing.T) {
+
+	data, err := ioutil.ReadFile(path.Join("fixtures", "text_tempo.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	float, err := DecodeFile(path.Join("fixtures", "pattern_2.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_2.splice - %v", err)
+	}
+
+	p, err := DecodeWithOptions(bytes.NewReader(data), DecodeOptions{TempoFormat: TextTempo})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if p.String() != float.String() {
+		t.Errorf("text_tempo.splice should hold pattern_2.\nGot:\n%s\nExpected:\n%s", p, float)
+	}
+
+	var buf bytes.Buffer
+	if err := p.Encode(&buf); err != nil {
+		t.Fatalf("unexpected error encoding %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("re-encoding didn't keep the text tempo:\n%x\nExpected:\n%x", buf.Bytes(), data)
+	}
+
+	p.SetTempo(120.5)
+	buf.Reset()
+	if err := p.Encode(&buf); err != nil {
+		t.Fatalf("unexpected error encoding %v", err)
+	}
+	if got := buf.Bytes()[headerSize+1+versionSize : headerSize+1+versionSize+textTempoSize]; string(got) != "120.5\x00\x00\x00" {
+		t.Errorf("expected the new tempo written as text, got %q", got)
+	}
+	p.SetTempo(1.0 / 3)
+	if err := p.Encode(&buf); err == nil {
+		t.Errorf("expected an error for a tempo too long to write as text")
+	}
+
+	bad := append([]byte(nil), data...)
+	copy(bad[headerSize+1+versionSize:], "fast")
+	if _, err := DecodeWithOptions(bytes.NewReader(bad), DecodeOptions{TempoFormat: TextTempo}); err == nil || !strings.Contains(err.Error(), `"fast"`) {
+		t.Errorf("expected an error naming the unparseable tempo, got %v", err)
+	}
+}
+
+func TestDecodeInt32Tempo(t *testing.T) {
+
+	p := Pattern{tempo: 97.6, tempoFormat: Int32Tempo, instruments: []Instrument{
+		{num: 1, name: "kick", measure: []Step{{1, 0, 0, 0}, {1, 0, 0, 0}, {1, 0, 0, 0}, {1, 0, 0, 0}}},
+	}}
+
+	var buf bytes.Buffer
+	if err := p.Encode(&buf); err != nil {
+		t.Fatalf("unexpected error encoding %v", err)
+	}
+
+	decoded, err := DecodeWithOptions(&buf, DecodeOptions{TempoFormat: Int32Tempo})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if decoded.tempo != 98 {
+		t.Errorf("expected the tempo rounded to 98, got %v", decoded.tempo)
+	}
+}
+
+func TestDecodeColumnMajor(t *testing.T) {
+
+	data, err := ioutil.ReadFile(path.Join("fixtures", "column_major.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_1.splice - %v", err)
+	}
+
+	opts := DecodeOptions{Layout: LayoutColumnMajor, InstrumentCount: 6}
+
+	p, err := DecodeWithOptions(bytes.NewReader(data), opts)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if p.String() != rows.String() {
+		t.Errorf("column_major.splice should hold pattern_1.\nGot:\n%s\nExpected:\n%s", p, rows)
+	}
+
+	var buf bytes.Buffer
+	if err := p.Encode(&buf); err != nil {
+		t.Fatalf("unexpected error encoding %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("re-encoding didn't interleave the steps:\n%x\nExpected:\n%x", buf.Bytes(), data)
+	}
+
+	for _, count := range []int{0, 5, 7} {
+		opts.InstrumentCount = count
+		if _, err := DecodeWithOptions(bytes.NewReader(data), opts); err == nil {
+			t.Errorf("expected an error decoding with an instrument count of %d", count)
+		}
+	}
+}
+
+func TestDecodeDialects(t *testing.T) {
+
+	p := Pattern{version: "0.909-beta", tempo: 97.5, instruments: []Instrument{
+		{num: 0x0102, name: "kick", measure: []Step{{1, 0, 0, 0}, {1, 0, 0, 0}, {1, 0, 0, 0}, {1, 0, 0, 0}}},
+		{num: 7, name: "snare", measure: []Step{{0, 0, 1, 0}, {0, 0, 1, 0}, {0, 0, 1, 0}, {0, 0, 1, 0}}},
+	}}
+
+	dialects := []Dialect{
+		{VersionPrefix: "0.909", ByteOrder: binary.BigEndian, VersionSize: 48},
+		{VersionPrefix: "0.808", ByteOrder: binary.LittleEndian},
+	}
+
+	tData := []struct {
+		name        string
+		byteOrder   binary.ByteOrder
+		versionSize int
+		lengthSize  int
+		opts        DecodeOptions
+		tempoAt     int
+		tempo       []byte
+	}{
+		{"little-endian", nil, 0, 0, DecodeOptions{}, 32, []byte{0x00, 0x00, 0xc3, 0x42}},
+		{"big-endian", binary.BigEndian, 0, 0, DecodeOptions{ByteOrder: binary.BigEndian}, 32, []byte{0x42, 0xc3, 0x00, 0x00}},
+		{"long version", nil, 40, 0, DecodeOptions{VersionSize: 40}, 40, []byte{0x00, 0x00, 0xc3, 0x42}},
+		{"big-endian length", binary.BigEndian, 0, 2, DecodeOptions{ByteOrder: binary.BigEndian, LengthFieldSize: 2}, 32, []byte{0x42, 0xc3, 0x00, 0x00}},
+		{"detected", binary.BigEndian, 48, 0, DecodeOptions{Dialects: dialects}, 48, []byte{0x42, 0xc3, 0x00, 0x00}},
+	}
+
+	for _, exp := range tData {
+		written := p
+		written.byteOrder, written.versionSize, written.lengthSize = exp.byteOrder, exp.versionSize, exp.lengthSize
+
+		var buf bytes.Buffer
+		if err := written.Encode(&buf); err != nil {
+			t.Fatalf("%s: unexpected error encoding %v", exp.name, err)
+		}
+		encoded := buf.Bytes()
+
+		lengthSize := exp.lengthSize
+		if lengthSize == 0 {
+			lengthSize = 1
+		}
+		at := headerSize + lengthSize + exp.tempoAt
+		if tempo := encoded[at : at+4]; !bytes.Equal(tempo, exp.tempo) {
+			t.Errorf("%s: got tempo bytes % x, expected % x", exp.name, tempo, exp.tempo)
+		}
+
+		decoded, err := DecodeWithOptions(bytes.NewReader(encoded), exp.opts)
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", exp.name, err)
+		}
+		if !decoded.Equal(p) {
+			t.Errorf("%s: decoded\n%s\nexpected\n%s", exp.name, decoded, p)
+		}
+
+		var again bytes.Buffer
+		if err := decoded.Encode(&again); err != nil || !bytes.Equal(again.Bytes(), encoded) {
+			t.Errorf("%s: expected re-encoding to keep the dialect, got %v", exp.name, err)
+		}
+
+		d := NewDecoder(bytes.NewReader(encoded))
+		d.SetOptions(exp.opts)
+		d.OnInstrument(func(Instrument) error { return nil })
+		if streamed, err := d.NextPattern(); err != nil || streamed.tempo != p.tempo || streamed.version != p.version {
+			t.Errorf("%s: streaming got version %q at %v, %v", exp.name, streamed.version, streamed.tempo, err)
+		}
+	}
+
+	// a pattern matching no dialect decodes with the options as given
+	var buf bytes.Buffer
+	plain := p
+	plain.version = "0.606"
+	if err := plain.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if decoded, err := DecodeWithOptions(&buf, DecodeOptions{Dialects: dialects}); err != nil || !decoded.Equal(plain) {
+		t.Errorf("expected a pattern matching no dialect to decode as usual, got %v", err)
+	}
+
+	plain.Encode(&buf)
+	if _, err := DecodeWithOptions(&buf, DecodeOptions{VersionSize: -1}); err == nil {
+		t.Errorf("expected an error for a negative version size")
+	}
+}
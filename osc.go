@@ -0,0 +1,81 @@
+package drum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// DefaultOSCAddress is the address template SendOSC uses when given none
+const DefaultOSCAddress = "/drum/{instrument}"
+
+// SendOSC sends an OSC message over UDP to addr, such as "127.0.0.1:57120",
+// for every hit the sequencer plays, alongside the events sent on Events.
+// Each message has one int32 argument, the hit's velocity, and is sent to
+// the OSC address made from addressTemplate by replacing {instrument} with
+// the instrument's name and {id} with its id. Characters OSC doesn't allow
+// in an address, such as spaces, become underscores in the name. An empty
+// template means DefaultOSCAddress. Messages are sent as hits come due,
+// without waiting for a reply, and any that can't be sent are dropped. The
+// connection stays open until Close.
+func (s *Sequencer) SendOSC(addr, addressTemplate string) error {
+
+	if addressTemplate == "" {
+		addressTemplate = DefaultOSCAddress
+	}
+	if !strings.HasPrefix(addressTemplate, "/") {
+		return fmt.Errorf("OSC address %q doesn't start with /", addressTemplate)
+	}
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return err
+	}
+
+	s.addOutput(func(e StepEvent) {
+
+		address := strings.NewReplacer(
+			"{instrument}", oscName(e.Instrument.name),
+			"{id}", strconv.FormatUint(uint64(e.Instrument.num), 10),
+		).Replace(addressTemplate)
+
+		conn.Write(oscMessage(address, int32(e.Velocity)))
+	}, conn)
+	return nil
+}
+
+// oscName returns name with the characters OSC reserves in addresses, and
+// any whitespace or control characters, replaced by underscores
+func oscName(name string) string {
+
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f || strings.ContainsRune("#*,/?[]{}", r) {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+// oscMessage encodes an OSC message to address with int32 arguments
+func oscMessage(address string, args ...int32) []byte {
+
+	var buf bytes.Buffer
+
+	writeOSCString(&buf, address)
+	writeOSCString(&buf, ","+strings.Repeat("i", len(args)))
+	for _, arg := range args {
+		binary.Write(&buf, binary.BigEndian, arg)
+	}
+	return buf.Bytes()
+}
+
+// writeOSCString writes s as an OSC string: null terminated and padded with
+// nulls to a multiple of four bytes
+func writeOSCString(buf *bytes.Buffer, s string) {
+
+	buf.WriteString(s)
+	buf.Write(make([]byte, 4-len(s)%4))
+}
@@ -0,0 +1,69 @@
+package drum
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestOSCMessage(t *testing.T) {
+
+	expected := []byte{
+		'/', 'd', 'r', 'u', 'm', '/', 'k', 'i', 'c', 'k', 0, 0,
+		',', 'i', 0, 0,
+		0, 0, 0, 100,
+	}
+	if got := oscMessage("/drum/kick", 100); !bytes.Equal(got, expected) {
+		t.Errorf("got\n% x\nexpected\n% x", got, expected)
+	}
+
+	// a string filling four bytes still gets a whole word of padding
+	if got := oscMessage("/hat"); !bytes.Equal(got, []byte{'/', 'h', 'a', 't', 0, 0, 0, 0, ',', 0, 0, 0}) {
+		t.Errorf("got % x", got)
+	}
+
+	if got := oscName("hh open/close #2"); got != "hh_open_close__2" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestSendOSC(t *testing.T) {
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("can't listen for UDP: %v", err)
+	}
+	defer conn.Close()
+
+	p := NewPattern("osc", 6000)
+	p.AddInstrument(3, "low tom").SetSteps("x---------------")
+	p.SetVelocity(3, 0, 64)
+
+	s := NewSequencer(*p)
+	if err := s.SendOSC(conn.LocalAddr().String(), "/kit/{id}/{instrument}"); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := s.SendOSC(conn.LocalAddr().String(), "kit"); err == nil {
+		t.Errorf("expected an error for an address without a leading /")
+	}
+
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	<-s.Events()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 512)
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatalf("no OSC message: %v", err)
+	}
+	if expected := oscMessage("/kit/3/low_tom", 64); !bytes.Equal(buf[:n], expected) {
+		t.Errorf("got\n% x\nexpected\n% x", buf[:n], expected)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Errorf("unexpected error closing %v", err)
+	}
+}
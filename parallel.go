@@ -0,0 +1,136 @@
+package drum
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// PatternSpan is where one pattern lies in a stream of patterns written
+// back to back: the byte Offset it starts at and its Size, counting any
+// extension area following its payload
+type PatternSpan struct {
+	Offset int64
+	Size   int64
+}
+
+// ScanPatterns maps out the patterns in the first size bytes of r, written
+// back to back as EncodeAll writes them, by reading only each pattern's
+// header, payload length and the framing of any extension area. It
+// returns the spans found before the first pattern that can't be framed,
+// with an error naming it.
+func ScanPatterns(r io.ReaderAt, size int64) ([]PatternSpan, error) {
+
+	var spans []PatternSpan
+	var opts DecodeOptions
+	buf := make([]byte, headerSize+1)
+	ext := make([]byte, len(extensionMagic)+4)
+
+	for offset := int64(0); offset < size; {
+		span, err := scanPattern(r, size, offset, buf, ext, opts)
+		if err != nil {
+			return spans, fmt.Errorf("pattern %d at byte %d: %w", len(spans), offset, err)
+		}
+		spans = append(spans, span)
+		offset += span.Size
+	}
+	return spans, nil
+}
+
+// scanPattern returns the span of the pattern starting at offset, reading
+// its framing into buf and ext
+func scanPattern(r io.ReaderAt, size, offset int64, buf, ext []byte, opts DecodeOptions) (PatternSpan, error) {
+
+	if n, err := r.ReadAt(buf, offset); n < len(buf) {
+		if err == nil || err == io.EOF {
+			err = ErrTruncated
+		}
+		return PatternSpan{}, err
+	}
+	if _, err := parseHeader(buf[:headerSize]); err != nil {
+		return PatternSpan{}, err
+	}
+
+	length := payloadLength(buf[:headerSize], buf[headerSize:], binary.LittleEndian)
+	if length > uint64(opts.maxPayload()) {
+		return PatternSpan{}, fmt.Errorf("%w: declared payload of %d bytes is over the %d byte limit",
+			ErrPayloadTooLarge, length, opts.maxPayload())
+	}
+	end := offset + int64(len(buf)) + int64(length)
+	if end > size {
+		return PatternSpan{}, fmt.Errorf("%w: payload runs past the end", ErrTruncated)
+	}
+
+	if end+int64(len(ext)) <= size {
+		if _, err := r.ReadAt(ext, end); err != nil && err != io.EOF {
+			return PatternSpan{}, err
+		}
+		if string(ext[:len(extensionMagic)]) == extensionMagic {
+			end += int64(len(ext)) + int64(binary.LittleEndian.Uint32(ext[len(extensionMagic):]))
+			if end > size {
+				return PatternSpan{}, fmt.Errorf("%w: extension runs past the end", ErrTruncated)
+			}
+		}
+	}
+	return PatternSpan{Offset: offset, Size: end - offset}, nil
+}
+
+// DecodeAllAt decodes the patterns in the first size bytes of r, written
+// back to back, as DecodeAll does, using up to workers goroutines, or one
+// per CPU if workers isn't positive. Once ScanPatterns has mapped out where
+// each pattern lies, each goroutine reads its share of the patterns with
+// one ReadAt and decodes them in place as DecodeBytes does, so large
+// multi-pattern files decode in parallel with few allocations. The
+// patterns returned alias those reads but nothing else; they're in order,
+// and like DecodeAll it stops at the first pattern that fails to decode,
+// returning those before it.
+func DecodeAllAt(r io.ReaderAt, size int64, workers int) ([]Pattern, error) {
+
+	spans, scanErr := ScanPatterns(r, size)
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > len(spans) {
+		workers = len(spans)
+	}
+
+	patterns := make([]Pattern, len(spans))
+	errs := make([]error, len(spans))
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		first, last := w*len(spans)/workers, (w+1)*len(spans)/workers
+		wg.Add(1)
+		go func() {
+
+			defer wg.Done()
+			start := spans[first].Offset
+			data := make([]byte, spans[last-1].Offset+spans[last-1].Size-start)
+			if _, err := r.ReadAt(data, start); err != nil && err != io.EOF {
+				errs[first] = err
+				return
+			}
+
+			for n := first; n < last; n++ {
+				from := spans[n].Offset - start
+				patterns[n], errs[n] = DecodeBytes(data[from : from+spans[n].Size : from+spans[n].Size])
+				if errs[n] != nil {
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for n, err := range errs {
+		if err != nil {
+			return patterns[:n], fmt.Errorf("decoding pattern %d: %w", n, err)
+		}
+	}
+	if scanErr != nil {
+		return patterns, fmt.Errorf("decoding %w", scanErr)
+	}
+	return patterns, nil
+}
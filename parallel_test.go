@@ -0,0 +1,127 @@
+package drum
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path"
+	"testing"
+)
+
+// patternStream returns n patterns written back to back, cycling through
+// the fixtures and a pattern with an extension area
+func patternStream(t testing.TB, n int) ([]byte, []Pattern) {
+
+	var sources []Pattern
+	for _, name := range []string{"pattern_1.splice", "pattern_2.splice", "pattern_3.splice", "pattern_4.splice", "pattern_5.splice"} {
+		p, err := DecodeFile(path.Join("fixtures", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, *p)
+	}
+	extended := NewPattern("0.909", 120)
+	extended.AddInstrument(0, "kick").SetSteps("x---x---x---x---")
+	extended.SetMuted(0, true)
+	extended.SetRatchet(0, 4, 3)
+	sources = append(sources, *extended)
+
+	patterns := make([]Pattern, n)
+	for i := range patterns {
+		patterns[i] = sources[i%len(sources)]
+	}
+	var buf bytes.Buffer
+	if err := EncodeAll(&buf, patterns); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes(), patterns
+}
+
+func TestDecodeAllAt(t *testing.T) {
+
+	data, patterns := patternStream(t, 40)
+
+	spans, err := ScanPatterns(bytes.NewReader(data), int64(len(data)))
+	if err != nil || len(spans) != len(patterns) {
+		t.Fatalf("expected %d spans, got %d and %v", len(patterns), len(spans), err)
+	}
+	if last := spans[len(spans)-1]; last.Offset+last.Size != int64(len(data)) {
+		t.Errorf("expected the spans to cover the stream, ending at %d", last.Offset+last.Size)
+	}
+
+	for _, workers := range []int{0, 1, 3, 64} {
+		decoded, err := DecodeAllAt(bytes.NewReader(data), int64(len(data)), workers)
+		if err != nil || len(decoded) != len(patterns) {
+			t.Fatalf("workers %d: expected %d patterns, got %d and %v", workers, len(patterns), len(decoded), err)
+		}
+		for n := range decoded {
+			if decoded[n].String() != patterns[n].String() || decoded[n].Audible(0) != patterns[n].Audible(0) {
+				t.Errorf("workers %d: pattern %d decoded as\n%s", workers, n, decoded[n])
+			}
+		}
+	}
+
+	// like DecodeAll, a pattern cut short stops the decode after those
+	// before it
+	truncated := data[:spans[7].Offset+spans[7].Size-3]
+	decoded, err := DecodeAllAt(bytes.NewReader(truncated), int64(len(truncated)), 2)
+	if len(decoded) != 7 || !errors.Is(err, ErrTruncated) {
+		t.Errorf("expected 7 patterns and %v, got %d and %v", ErrTruncated, len(decoded), err)
+	}
+	corrupt := append([]byte(nil), data...)
+	copy(corrupt[spans[3].Offset:], "SPLICX")
+	if decoded, err := DecodeAllAt(bytes.NewReader(corrupt), int64(len(corrupt)), 2); len(decoded) != 3 || !errors.Is(err, ErrInvalidHeader) {
+		t.Errorf("expected 3 patterns and %v, got %d and %v", ErrInvalidHeader, len(decoded), err)
+	}
+	if decoded, err := DecodeAllAt(bytes.NewReader(nil), 0, 0); len(decoded) != 0 || err != nil {
+		t.Errorf("expected nothing from an empty stream, got %d patterns and %v", len(decoded), err)
+	}
+}
+
+func BenchmarkDecodeAll(b *testing.B) {
+
+	data, _ := patternStream(b, 10000)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := DecodeAll(bytes.NewReader(data)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeAllAt(b *testing.B) {
+
+	data, _ := patternStream(b, 10000)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := DecodeAllAt(bytes.NewReader(data), int64(len(data)), 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecodeAllAtFile(b *testing.B) {
+
+	data, _ := patternStream(b, 10000)
+	file := path.Join(b.TempDir(), "library.splice")
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		b.Fatal(err)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := DecodeAllAt(f, int64(len(data)), 0); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
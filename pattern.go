@@ -0,0 +1,250 @@
+package drum
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// ConformSteps finds the most common step count among the pattern's
+// instruments and resizes every other instrument to match, padding with
+// silence or truncating as needed. It returns the chosen step count, or 0
+// for a pattern without instruments.
+//
+// When several step counts are equally common the largest one wins, so
+// that ties are resolved by padding rather than by discarding steps.
+func (p *Pattern) ConformSteps() int {
+
+	counts := make(map[int]int)
+	mode := 0
+
+	for _, inst := range p.instruments {
+		n := inst.stepCount()
+		counts[n]++
+
+		if counts[n] > counts[mode] || (counts[n] == counts[mode] && n > mode) {
+			mode = n
+		}
+	}
+
+	for i := range p.instruments {
+		if p.instruments[i].stepCount() != mode {
+			p.instruments[i].resize(mode)
+			p.notify(Change{Kind: ChangeSteps, InstrumentID: p.instruments[i].num})
+		}
+	}
+	return mode
+}
+
+// instrumentIndex returns the index of the first instrument with the given
+// id, or -1 if the pattern has no such instrument.
+func (p Pattern) instrumentIndex(id uint32) int {
+
+	for i, inst := range p.instruments {
+		if inst.num == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// Repeat returns a copy of the pattern in which every instrument's steps are
+// played n times in a row, multiplying the step count by n.
+func (p Pattern) Repeat(n int) (Pattern, error) {
+
+	if n < 1 {
+		return Pattern{}, fmt.Errorf("cannot repeat a pattern %d times", n)
+	}
+
+	result := p.blank()
+
+	for _, inst := range p.instruments {
+		steps := inst.steps()
+		looped := make([]byte, 0, len(steps)*n)
+
+		for i := 0; i < n; i++ {
+			looped = append(looped, steps...)
+		}
+
+		inst.setSteps(looped)
+		result.instruments = append(result.instruments, inst)
+	}
+	return result, nil
+}
+
+// blank returns a pattern without instruments with p's version and tempo,
+// encoded the way p is: with its header, length field, version field size,
+// byte order, packing, layout, resolution and tempo format. Patterns built
+// from others start from it so they keep the format they were decoded in.
+func (p Pattern) blank() Pattern {
+
+	return Pattern{
+		version:     p.version,
+		tempo:       p.tempo,
+		tempoFormat: p.tempoFormat,
+		header:      cloneBytes(p.header),
+		lengthSize:  p.lengthSize,
+		packing:     p.packing,
+		layout:      p.layout,
+		resolution:  p.resolution,
+		byteOrder:   p.byteOrder,
+		versionSize: p.versionSize,
+	}
+}
+
+// ConformsTo reports whether every instrument in the pattern is named in kit,
+// along with the names that aren't, in the order they first appear. Names are
+// compared exactly, so "Kick" does not match "kick".
+func (p Pattern) ConformsTo(kit []string) (bool, []string) {
+
+	allowed := make(map[string]bool, len(kit))
+	for _, name := range kit {
+		allowed[name] = true
+	}
+
+	var offending []string
+	seen := make(map[string]bool)
+
+	for _, inst := range p.instruments {
+		if !allowed[inst.name] && !seen[inst.name] {
+			seen[inst.name] = true
+			offending = append(offending, inst.name)
+		}
+	}
+	return len(offending) == 0, offending
+}
+
+// Summary returns a terse single-line description of the pattern for logs,
+// such as "0.808-alpha 120.0bpm 6inst 18hits". Whitespace and control
+// characters in the version are replaced with underscores so the summary
+// never spans more than one line.
+func (p Pattern) Summary() string {
+
+	version := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return '_'
+		}
+		return r
+	}, p.version)
+
+	if version == "" {
+		version = "-"
+	}
+
+	hits := 0
+	for _, inst := range p.instruments {
+		hits += inst.hits()
+	}
+
+	return fmt.Sprintf("%s %.1fbpm %dinst %dhits", version, p.tempo, len(p.instruments), hits)
+}
+
+// PadTo appends silent steps to every instrument until each has totalSteps.
+// It returns an error, leaving the pattern untouched, if any instrument is
+// already longer than totalSteps.
+func (p *Pattern) PadTo(totalSteps int) error {
+
+	for _, inst := range p.instruments {
+		if inst.stepCount() > totalSteps {
+			return fmt.Errorf("instrument %d has %d steps, more than %d", inst.num, inst.stepCount(), totalSteps)
+		}
+	}
+
+	for i := range p.instruments {
+		if p.instruments[i].stepCount() != totalSteps {
+			p.instruments[i].resize(totalSteps)
+			p.notify(Change{Kind: ChangeSteps, InstrumentID: p.instruments[i].num})
+		}
+	}
+	return nil
+}
+
+// Resize truncates or pads with silence every instrument until each has
+// steps steps, dropping the hits past the end of a shorter loop. It returns
+// an error wrapping ErrInvalidStep, leaving the pattern untouched, for a
+// negative step count.
+func (p *Pattern) Resize(steps int) error {
+
+	if steps < 0 {
+		return fmt.Errorf("%w: instruments can't hold %d steps", ErrInvalidStep, steps)
+	}
+
+	for i := range p.instruments {
+		if p.instruments[i].stepCount() != steps {
+			p.instruments[i].resize(steps)
+			p.notify(Change{Kind: ChangeSteps, InstrumentID: p.instruments[i].num})
+		}
+	}
+	return nil
+}
+
+// Equal reports whether p and q have the same version, tempo and
+// instruments, comparing the instruments' ids, names and steps in order.
+// The header and length field bytes the patterns were decoded from are not
+// compared.
+func (p Pattern) Equal(q Pattern) bool {
+
+	if p.version != q.version || p.tempo != q.tempo || len(p.instruments) != len(q.instruments) {
+		return false
+	}
+
+	for i, inst := range p.instruments {
+		other := q.instruments[i]
+		if inst.num != other.num || inst.name != other.name || !bytes.Equal(inst.steps(), other.steps()) {
+			return false
+		}
+	}
+	return true
+}
+
+// DedupPatterns collapses each run of consecutive patterns that are Equal
+// into its first pattern, keeping the order of the rest. Equal is order
+// sensitive and compares tempos, so it only removes exact repeats, unlike
+// grouping by RhythmHash.
+func DedupPatterns(ps []Pattern) []Pattern {
+
+	var deduped []Pattern
+
+	for i, p := range ps {
+		if i > 0 && p.Equal(ps[i-1]) {
+			continue
+		}
+		deduped = append(deduped, p)
+	}
+	return deduped
+}
+
+// Filter returns a copy of the pattern holding only the instruments for which
+// keep returns true, in their original order, with the same version and tempo.
+func (p Pattern) Filter(keep func(Instrument) bool) Pattern {
+
+	result := p.blank()
+
+	for _, inst := range p.instruments {
+		if keep(inst) {
+			inst.setSteps(inst.steps())
+			result.instruments = append(result.instruments, inst)
+		}
+	}
+	return result
+}
+
+// BackboneNames are the instrument names Backbone keeps
+var BackboneNames = []string{"kick", "snare"}
+
+// Backbone returns a copy of the pattern holding only the instruments named
+// in BackboneNames, by default the kick and snare, with the same version and
+// tempo. Names are compared ignoring case, so "Kick" and "SNARE" are kept but
+// "kick 2" is not.
+func (p Pattern) Backbone() Pattern {
+
+	return p.Filter(func(inst Instrument) bool {
+		for _, name := range BackboneNames {
+			if strings.EqualFold(inst.name, name) {
+				return true
+			}
+		}
+		return false
+	})
+}
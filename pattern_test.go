@@ -0,0 +1,209 @@
+package drum
+
+import (
+	"errors"
+	"path"
+	"testing"
+)
+
+func TestConformSteps(t *testing.T) {
+
+	p := Pattern{instruments: []Instrument{
+		{num: 0, name: "kick", measure: []Step{{1, 0, 0, 0}, {1, 0, 0, 0}}},
+		{num: 1, name: "snare", measure: []Step{{0, 0, 1, 0}, {0, 0, 1, 0}}},
+		{num: 2, name: "clap", measure: []Step{{1, 1}}},
+		{num: 3, name: "hh", measure: []Step{{1, 0, 1, 0}, {1, 0, 1, 0}, {1, 1, 1, 1}}},
+	}}
+
+	if n := p.ConformSteps(); n != 8 {
+		t.Fatalf("expected step count 8, got %d", n)
+	}
+
+	for _, inst := range p.instruments {
+		if inst.stepCount() != 8 {
+			t.Errorf("%s has %d steps, expected 8", inst.name, inst.stepCount())
+		}
+	}
+
+	if got := string(p.instruments[2].steps()); got != "\x01\x01\x00\x00\x00\x00\x00\x00" {
+		t.Errorf("clap wasn't padded with silence: %v", []byte(got))
+	}
+	if got := string(p.instruments[3].steps()); got != "\x01\x00\x01\x00\x01\x00\x01\x00" {
+		t.Errorf("hh wasn't truncated: %v", []byte(got))
+	}
+}
+
+func TestConformStepsTie(t *testing.T) {
+
+	p := Pattern{instruments: []Instrument{
+		{num: 0, name: "kick", measure: []Step{{1, 0, 0, 0}}},
+		{num: 1, name: "snare", measure: []Step{{0, 0, 1, 0}, {0, 0, 1, 0}}},
+	}}
+
+	if n := p.ConformSteps(); n != 8 {
+		t.Fatalf("expected tie to resolve to 8 steps, got %d", n)
+	}
+}
+
+func TestRepeat(t *testing.T) {
+
+	p := Pattern{tempo: 120, instruments: []Instrument{
+		{num: 0, name: "kick", measure: []Step{{1, 0, 0, 0}, {0, 0, 1, 0}}},
+	}}
+
+	r, err := p.Repeat(3)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	if n := r.instruments[0].stepCount(); n != 24 {
+		t.Fatalf("expected 24 steps, got %d", n)
+	}
+	if len(r.instruments[0].measure) != 6 {
+		t.Errorf("expected 6 measures, got %d", len(r.instruments[0].measure))
+	}
+	if r.tempo != p.tempo || p.instruments[0].stepCount() != 8 {
+		t.Errorf("Repeat lost the tempo or modified its input")
+	}
+
+	if _, err := p.Repeat(0); err == nil {
+		t.Errorf("expected an error repeating 0 times")
+	}
+}
+
+func TestConformsTo(t *testing.T) {
+
+	p := Pattern{instruments: []Instrument{
+		{num: 0, name: "kick"}, {num: 1, name: "Snare"}, {num: 2, name: "cowbell"}, {num: 3, name: "cowbell"},
+	}}
+
+	ok, offending := p.ConformsTo([]string{"kick", "snare", "hh-open"})
+	if ok {
+		t.Fatalf("expected the pattern not to conform")
+	}
+	if len(offending) != 2 || offending[0] != "Snare" || offending[1] != "cowbell" {
+		t.Errorf("unexpected offending names %q", offending)
+	}
+
+	if ok, offending := p.ConformsTo([]string{"kick", "Snare", "cowbell"}); !ok || len(offending) != 0 {
+		t.Errorf("expected the pattern to conform, got %q", offending)
+	}
+}
+
+func TestSummary(t *testing.T) {
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_1.splice - %v", err)
+	}
+
+	if got := decoded.Summary(); got != "0.808-alpha 120.0bpm 6inst 18hits" {
+		t.Errorf("unexpected summary %q", got)
+	}
+
+	p := Pattern{version: "0.9\nbeta", tempo: 98.4}
+	if got := p.Summary(); got != "0.9_beta 98.4bpm 0inst 0hits" {
+		t.Errorf("unexpected summary %q", got)
+	}
+}
+
+func TestPadTo(t *testing.T) {
+
+	p := Pattern{instruments: []Instrument{
+		{num: 0, name: "kick", measure: []Step{{1, 0, 0, 0}}},
+		{num: 1, name: "snare", measure: []Step{{0, 0, 1, 0}, {0, 0, 1}}},
+	}}
+
+	if err := p.PadTo(12); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got := gridString(p.instruments[0].steps()); got != "x-----------" {
+		t.Errorf("kick got %s", got)
+	}
+	if got := gridString(p.instruments[1].steps()); got != "--x---x-----" {
+		t.Errorf("snare got %s", got)
+	}
+
+	if err := p.PadTo(8); err == nil {
+		t.Errorf("expected an error padding to fewer steps than the pattern has")
+	}
+	if p.instruments[0].stepCount() != 12 {
+		t.Errorf("a failed PadTo modified the pattern")
+	}
+}
+
+func TestResize(t *testing.T) {
+
+	p := Pattern{instruments: []Instrument{
+		{num: 0, name: "kick", measure: []Step{{1, 0, 0, 0}, {1, 0, 0, 0}}},
+		{num: 1, name: "snare", measure: []Step{{0, 0, 1, 0}, {0, 0, 1}}},
+	}}
+
+	if err := p.Resize(6); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got := gridString(p.instruments[0].steps()); got != "x---x-" {
+		t.Errorf("kick got %s", got)
+	}
+	if got := gridString(p.instruments[1].steps()); got != "--x---" {
+		t.Errorf("snare got %s", got)
+	}
+
+	if err := p.Resize(-1); !errors.Is(err, ErrInvalidStep) {
+		t.Errorf("expected ErrInvalidStep for a negative step count, got %v", err)
+	}
+	if p.instruments[0].stepCount() != 6 {
+		t.Errorf("a failed Resize modified the pattern")
+	}
+}
+
+func TestDedupPatterns(t *testing.T) {
+
+	var ps []Pattern
+	for _, name := range []string{"pattern_1.splice", "pattern_1.splice", "pattern_2.splice", "pattern_1.splice", "pattern_2.splice", "pattern_2.splice"} {
+		decoded, err := DecodeFile(path.Join("fixtures", name))
+		if err != nil {
+			t.Fatalf("something went wrong decoding %s - %v", name, err)
+		}
+		ps = append(ps, *decoded)
+	}
+
+	deduped := DedupPatterns(ps)
+	if len(deduped) != 4 {
+		t.Fatalf("expected 4 patterns, got %d", len(deduped))
+	}
+	for i, tempo := range []float32{120, 98.4, 120, 98.4} {
+		if deduped[i].tempo != tempo {
+			t.Errorf("pattern %d: got tempo %v, expected %v", i, deduped[i].tempo, tempo)
+		}
+	}
+
+	retimed := ps[0]
+	retimed.tempo = 121
+	if retimed.Equal(ps[0]) {
+		t.Errorf("expected patterns with different tempos not to be equal")
+	}
+}
+
+func TestBackbone(t *testing.T) {
+
+	p := Pattern{version: "0.808-alpha", tempo: 98, instruments: []Instrument{
+		{num: 0, name: "Kick", measure: []Step{{1, 0, 0, 0}}},
+		{num: 1, name: "hh-open", measure: []Step{{0, 1, 0, 1}}},
+		{num: 2, name: "SNARE", measure: []Step{{0, 0, 1, 0}}},
+		{num: 3, name: "kick 2", measure: []Step{{1, 1, 0, 0}}},
+	}}
+
+	backbone := p.Backbone()
+	if backbone.version != p.version || backbone.tempo != p.tempo {
+		t.Errorf("expected version %q and tempo %v to be kept, got %q and %v", p.version, p.tempo, backbone.version, backbone.tempo)
+	}
+	if len(backbone.instruments) != 2 || backbone.instruments[0].num != 0 || backbone.instruments[1].num != 2 {
+		t.Fatalf("expected the kick and snare, got:\n%s", backbone)
+	}
+
+	backbone.instruments[0].measure[0][1] = StepOn
+	if p.instruments[0].measure[0][1] != StepOff {
+		t.Errorf("changing the backbone changed the original pattern")
+	}
+}
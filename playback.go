@@ -0,0 +1,170 @@
+package drum
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+)
+
+// playbackChunkType is the type of the extension chunk Encode writes for a
+// pattern with an instrument muted, soloed or at a gain other than 1.
+const playbackChunkType = "PLAY"
+
+// The flags of an instrument's record in the playback chunk. Each record
+// is a flags byte followed by the gain as a float32, in the pattern's byte
+// order, and there's one for every instrument, in order.
+const (
+	playbackMuted byte = 1 << iota
+	playbackSolo
+	playbackGain
+
+	playbackRecordSize = 5
+)
+
+// Muted reports whether the instrument is muted, so it isn't played
+func (i Instrument) Muted() bool {
+
+	return i.muted
+}
+
+// Solo reports whether the instrument is soloed, so that only it and the
+// other soloed instruments are played
+func (i Instrument) Solo() bool {
+
+	return i.solo
+}
+
+// Gain returns the gain the instrument's hits are played at, 1 unless it's
+// been set
+func (i Instrument) Gain() float32 {
+
+	if !i.hasGain {
+		return 1
+	}
+	return i.gain
+}
+
+// SetMuted mutes or unmutes the instrument with the given id
+func (p *Pattern) SetMuted(id uint32, muted bool) error {
+
+	i := p.instrumentIndex(id)
+	if i < 0 {
+		return fmt.Errorf("no instrument with id %d", id)
+	}
+
+	p.instruments[i].muted = muted
+	p.notify(Change{Kind: ChangePlayback, InstrumentID: id})
+	return nil
+}
+
+// SetSolo solos the instrument with the given id, or stops soloing it
+func (p *Pattern) SetSolo(id uint32, solo bool) error {
+
+	i := p.instrumentIndex(id)
+	if i < 0 {
+		return fmt.Errorf("no instrument with id %d", id)
+	}
+
+	p.instruments[i].solo = solo
+	p.notify(Change{Kind: ChangePlayback, InstrumentID: id})
+	return nil
+}
+
+// SetGain sets the gain the instrument with the given id is played at,
+// where 1 plays it as it is. The gain mustn't be negative.
+func (p *Pattern) SetGain(id uint32, gain float32) error {
+
+	i := p.instrumentIndex(id)
+	if i < 0 {
+		return fmt.Errorf("no instrument with id %d", id)
+	}
+	if !(gain >= 0) || math.IsInf(float64(gain), 1) {
+		return fmt.Errorf("instrument %d can't play at a gain of %v", id, gain)
+	}
+
+	p.instruments[i].gain = gain
+	p.instruments[i].hasGain = gain != 1
+	p.notify(Change{Kind: ChangePlayback, InstrumentID: id})
+	return nil
+}
+
+// Audible reports whether the instrument with the given id is played: it
+// isn't muted and, if any instrument is soloed, it's soloed too. The
+// Sequencer, ToMIDI and the render package leave out instruments that
+// aren't audible.
+func (p Pattern) Audible(id uint32) bool {
+
+	i := p.instrumentIndex(id)
+	return i >= 0 && p.audible(p.instruments[i], p.soloing())
+}
+
+// soloing reports whether any instrument is soloed
+func (p Pattern) soloing() bool {
+
+	for _, inst := range p.instruments {
+		if inst.solo {
+			return true
+		}
+	}
+	return false
+}
+
+// audible reports whether inst is played, given whether any instrument is
+// soloed
+func (p Pattern) audible(inst Instrument, soloing bool) bool {
+
+	return !inst.muted && (inst.solo || !soloing)
+}
+
+// playbackCodec reads and writes the playback chunk
+type playbackCodec struct{}
+
+// EncodeChunk returns the playback chunk's data, or nil if every instrument
+// plays as it does by default
+func (playbackCodec) EncodeChunk(p Pattern) ([]byte, error) {
+
+	needed := false
+	for _, inst := range p.instruments {
+		if inst.muted || inst.solo || inst.hasGain {
+			needed = true
+		}
+	}
+	if !needed {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	for _, inst := range p.instruments {
+		var flags byte
+		if inst.muted {
+			flags |= playbackMuted
+		}
+		if inst.solo {
+			flags |= playbackSolo
+		}
+		if inst.hasGain {
+			flags |= playbackGain
+		}
+		buf.WriteByte(flags)
+		buf.Write(putUint(p.order(), uint64(math.Float32bits(inst.gain)), 4))
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeChunk sets the instruments' attributes from their records
+func (playbackCodec) DecodeChunk(p *Pattern, data []byte) error {
+
+	if len(data)%playbackRecordSize != 0 {
+		return fmt.Errorf("%w: %d bytes of playback records", ErrTruncated, len(data))
+	}
+
+	for i := 0; i < len(data)/playbackRecordSize && i < len(p.instruments); i++ {
+		record := data[i*playbackRecordSize:]
+		inst := &p.instruments[i]
+		inst.muted = record[0]&playbackMuted != 0
+		inst.solo = record[0]&playbackSolo != 0
+		inst.hasGain = record[0]&playbackGain != 0
+		inst.gain = math.Float32frombits(uint32(readUint(p.order(), record[1:playbackRecordSize])))
+	}
+	return nil
+}
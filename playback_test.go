@@ -0,0 +1,176 @@
+package drum
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"io"
+	"math"
+	"testing"
+)
+
+func playbackPattern(t *testing.T) *Pattern {
+
+	p := NewPattern("0.808-alpha", 120)
+	for id, name := range []string{"kick", "snare", "theremin"} {
+		if err := p.AddInstrument(uint32(id), name).SetSteps("x---x---x---x---"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := p.SetGain(0, 1.2); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetGain(1, 0.5); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetMuted(2, true); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestPlaybackAttributes(t *testing.T) {
+
+	p := playbackPattern(t)
+
+	if !p.Audible(0) || !p.Audible(1) || p.Audible(2) || p.Audible(9) {
+		t.Errorf("expected only the kick and snare to be audible")
+	}
+	p.SetSolo(1, true)
+	if p.Audible(0) || !p.Audible(1) {
+		t.Errorf("expected only the soloed snare to be audible")
+	}
+	p.SetSolo(2, true)
+	if p.Audible(2) {
+		t.Errorf("expected a muted instrument to stay silent when soloed")
+	}
+	p.SetSolo(1, false)
+	p.SetSolo(2, false)
+
+	for _, gain := range []float32{-1, float32(math.NaN()), float32(math.Inf(1))} {
+		if err := p.SetGain(0, gain); err == nil {
+			t.Errorf("expected an error for a gain of %v", gain)
+		}
+	}
+	if err := p.SetMuted(9, true); err == nil {
+		t.Errorf("expected an error muting a missing instrument")
+	}
+	if gain := (Instrument{}).Gain(); gain != 1 {
+		t.Errorf("expected a gain of 1 by default, got %v", gain)
+	}
+}
+
+func TestPlaybackEncoding(t *testing.T) {
+
+	p := playbackPattern(t)
+	p.SetSolo(1, true)
+
+	var plain bytes.Buffer
+	if err := (*NewPattern("0.808-alpha", 120)).Encode(&plain); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := p.Encode(&buf); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	encoded := buf.Bytes()
+	if size, _ := p.EncodedSize(); size != len(encoded) {
+		t.Errorf("EncodedSize reported %d bytes, Encode wrote %d", size, len(encoded))
+	}
+
+	// the chunk follows the payload, so the declared length leaves it out
+	payload := int(encoded[headerSize])
+	if chunk := encoded[headerSize+1+payload:]; string(chunk[:4]) != extensionMagic || string(chunk[8:12]) != playbackChunkType || len(chunk) != 16+3*playbackRecordSize {
+		t.Errorf("expected a playback chunk after the payload, got % x", chunk)
+	}
+
+	check := func(name string, q Pattern) {
+		t.Helper()
+		got := q.Instruments()
+		if got[0].Gain() != 1.2 || got[1].Gain() != 0.5 || !got[1].Solo() || got[0].Solo() || !got[2].Muted() || got[2].Gain() != 1 {
+			t.Errorf("%s: attributes weren't kept: %+v", name, got)
+		}
+	}
+
+	decoded, err := Decode(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	check("Decode", decoded)
+
+	all, err := DecodeAll(bytes.NewReader(append(append([]byte(nil), encoded...), encoded...)))
+	if err != nil || len(all) != 2 {
+		t.Fatalf("expected two patterns, got %d, %v", len(all), err)
+	}
+	check("DecodeAll", all[1])
+
+	// a reader that can't peek or seek leaves the chunk where it is
+	r := io.MultiReader(bytes.NewReader(encoded))
+	if decoded, err = Decode(r); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if rest, _ := io.ReadAll(r); string(rest[:4]) != extensionMagic || decoded.instruments[2].muted {
+		t.Errorf("expected the chunk to be left unread, %q was left", rest)
+	}
+
+	if _, err := DecodeWithOptions(bytes.NewReader(encoded), DecodeOptions{Strict: true}); err != nil {
+		t.Errorf("expected strict decoding to accept the chunk, got %v", err)
+	}
+	if _, err := Decode(bytes.NewReader(encoded[:len(encoded)-2])); !errors.Is(err, ErrTruncated) {
+		t.Errorf("expected %v for a cut short chunk, got %v", ErrTruncated, err)
+	}
+
+	var g bytes.Buffer
+	if err := gob.NewEncoder(&g).Encode(*p); err != nil {
+		t.Fatal(err)
+	}
+	var fromGob Pattern
+	if err := gob.NewDecoder(&g).Decode(&fromGob); err != nil {
+		t.Fatal(err)
+	}
+	check("gob", fromGob)
+}
+
+func TestPlaybackSequencer(t *testing.T) {
+
+	p := NewPattern("seq", 6000)
+	p.AddInstrument(0, "kick").SetSteps("x---x---x---x---")
+	p.AddInstrument(1, "hat").SetSteps("xxxxxxxxxxxxxxxx")
+	p.SetMuted(1, true)
+
+	s := NewSequencer(*p)
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	for n := 0; n < 3; n++ {
+		if e := <-s.Events(); e.Instrument.name != "kick" {
+			t.Fatalf("event %d: expected only the kick, got %s on step %d", n, e.Instrument.name, e.StepIndex)
+		}
+	}
+}
+
+func TestPlaybackMIDI(t *testing.T) {
+
+	p := playbackPattern(t)
+
+	// the muted theremin has no note, but is left out rather than failing
+	var buf bytes.Buffer
+	if err := p.ToMIDI(&buf, nil); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// the kick's gain of 1.2 sets the channel volume, and the snare's
+	// velocity is scaled to its gain relative to that
+	for _, expected := range [][]byte{
+		{0x00, 0xb9, 0x07, 120},
+		{0x00, 0x99, 36, 100, 0x00, 0x99, 38, 42},
+	} {
+		if !bytes.Contains(buf.Bytes(), expected) {
+			t.Errorf("expected % x in\n% x", expected, buf.Bytes())
+		}
+	}
+}
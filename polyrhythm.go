@@ -0,0 +1,121 @@
+package drum
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// loopChunkType is the type of the extension chunk Encode writes for a
+// pattern whose instruments loop at different lengths. It holds each
+// instrument's step count as a uint32, in the pattern's byte order, in
+// order.
+const loopChunkType = "LOOP"
+
+// SetLoopLength gives the instrument with the given id its own loop of
+// steps, truncating it or padding it with rests as Resize does, so that it
+// cycles independently of the others: a Sequencer plays a 12 step hi-hat
+// over a 16 step kick three times every four loops of the kick. A pattern's
+// loop, as its Duration, Sequencer loop events and its exports see it, is
+// as long as its longest instrument. The .splice format holds the same
+// number of steps for every instrument, so Encode extends shorter
+// instruments to the loop by repeating their steps from the start, which
+// readers of the original format play as the pattern's first loop, and
+// records the loop lengths after the payload for the decoders to restore.
+func (p *Pattern) SetLoopLength(id uint32, steps int) error {
+
+	i := p.instrumentIndex(id)
+	if i < 0 {
+		return fmt.Errorf("no instrument with id %d", id)
+	}
+	if steps <= 0 {
+		return fmt.Errorf("%w: instrument %d can't loop over %d steps", ErrInvalidStep, id, steps)
+	}
+
+	if p.instruments[i].stepCount() != steps {
+		p.instruments[i].resize(steps)
+		p.notify(Change{Kind: ChangeSteps, InstrumentID: id})
+	}
+	return nil
+}
+
+// Polyrhythmic reports whether the pattern's instruments loop over
+// different numbers of steps
+func (p Pattern) Polyrhythmic() bool {
+
+	for _, inst := range p.instruments {
+		if inst.stepCount() != p.instruments[0].stepCount() {
+			return true
+		}
+	}
+	return false
+}
+
+// cycled returns the instrument's steps repeated from the start until there
+// are n of them, or its first n steps if it's longer
+func (i Instrument) cycled(n int) []byte {
+
+	steps := i.steps()
+	if len(steps) >= n {
+		return steps[:n]
+	}
+	if len(steps) == 0 {
+		return steps
+	}
+
+	cycled := make([]byte, n)
+	for s := range cycled {
+		cycled[s] = steps[s%len(steps)]
+	}
+	return cycled
+}
+
+// cycleStep returns the step an instrument plays at a point in the
+// pattern, given the step of the loop and the number of steps played since
+// the pattern began: the loop's step for an instrument as long as loop, and
+// its place in its own cycle for one that's shorter
+func (i Instrument) cycleStep(step, played, loop int) int {
+
+	if n := i.stepCount(); n > 0 && n != loop {
+		return played % n
+	}
+	return step
+}
+
+// loopCodec reads and writes the loop chunk
+type loopCodec struct{}
+
+// EncodeChunk returns the loop chunk's data, or nil if every instrument
+// loops over the same steps
+func (loopCodec) EncodeChunk(p Pattern) ([]byte, error) {
+
+	if !p.Polyrhythmic() {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	for _, inst := range p.instruments {
+		buf.Write(putUint(p.order(), uint64(inst.stepCount()), 4))
+	}
+	return buf.Bytes(), nil
+}
+
+// DecodeChunk cuts each instrument decoded at the loop's length back to
+// its own
+func (loopCodec) DecodeChunk(p *Pattern, data []byte) error {
+
+	if len(data)%4 != 0 {
+		return fmt.Errorf("%w: %d bytes of loop lengths", ErrTruncated, len(data))
+	}
+
+	for i := 0; i < len(data)/4 && i < len(p.instruments); i++ {
+		n := readUint(p.order(), data[i*4:i*4+4])
+		inst := &p.instruments[i]
+		if n == 0 || n > uint64(inst.stepCount()) {
+			return fmt.Errorf("%w: instrument %d can't loop over %d of its %d steps", ErrInvalidStep, inst.num, n, inst.stepCount())
+		}
+		if int(n) < inst.stepCount() {
+			inst.resize(int(n))
+		}
+	}
+	return nil
+}
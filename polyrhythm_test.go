@@ -0,0 +1,133 @@
+package drum
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// polyrhythmPattern returns a 16 step kick against a 12 step hi-hat
+func polyrhythmPattern(t *testing.T) *Pattern {
+
+	t.Helper()
+
+	p := NewPattern("0.808-alpha", 120)
+	p.AddInstrument(1, "kick").SetSteps("x---x---x---x---")
+	p.AddInstrument(2, "hh-closed").SetSteps("x-x---x-x--x----")
+	if err := p.SetLoopLength(2, 12); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestSetLoopLength(t *testing.T) {
+
+	p := polyrhythmPattern(t)
+
+	if got := p.Instruments()[1].Steps(); len(got) != 12 || !got[11] {
+		t.Errorf("expected the hi-hat to keep its first 12 steps, got %v", got)
+	}
+	if !p.Polyrhythmic() || p.loopSteps() != 16 {
+		t.Errorf("expected a polyrhythmic pattern with a loop of 16 steps")
+	}
+	if issues := Validate(*p); issues != nil {
+		t.Errorf("expected the pattern to be valid, got %v", issues)
+	}
+
+	if err := p.SetLoopLength(2, 0); !errors.Is(err, ErrInvalidStep) {
+		t.Errorf("expected %v for a loop of no steps, got %v", ErrInvalidStep, err)
+	}
+	if err := p.SetLoopLength(9, 12); err == nil {
+		t.Errorf("expected an error for a missing instrument")
+	}
+
+	if err := p.SetLoopLength(2, 16); err != nil || p.Polyrhythmic() {
+		t.Errorf("expected the hi-hat back at 16 steps, got %v", err)
+	}
+}
+
+func TestPolyrhythmEncoding(t *testing.T) {
+
+	p := polyrhythmPattern(t)
+
+	var buf bytes.Buffer
+	if err := p.Encode(&buf); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	encoded := buf.Bytes()
+
+	// readers that stop at the payload see the hi-hat extended to the loop
+	r := io.MultiReader(bytes.NewReader(encoded))
+	legacy, err := Decode(r)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got, want := legacy.Instruments()[1].steps(), p.Instruments()[1].cycled(16); !bytes.Equal(got, want) {
+		t.Errorf("expected the hi-hat repeated to 16 steps, got %v", got)
+	}
+
+	decoded, err := Decode(bytes.NewReader(encoded))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !decoded.Equal(*p) || !decoded.Polyrhythmic() {
+		t.Errorf("expected the loop lengths back, got\n%v", decoded)
+	}
+
+	// the loop lengths can only shorten instruments
+	if err := (loopCodec{}).DecodeChunk(&decoded, []byte{13, 0, 0, 0, 13, 0, 0, 0}); !errors.Is(err, ErrInvalidStep) {
+		t.Errorf("expected %v for a loop longer than the instrument, got %v", ErrInvalidStep, err)
+	}
+}
+
+func TestPolyrhythmMIDI(t *testing.T) {
+
+	p := NewPattern("0.808-alpha", 120)
+	p.AddInstrument(1, "kick").SetSteps("----------------")
+	p.AddInstrument(2, "hh-closed").SetSteps("x---------------")
+	p.SetLoopLength(2, 6)
+
+	var buf bytes.Buffer
+	if err := p.ToMIDI(&buf, nil); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if n := bytes.Count(buf.Bytes(), []byte{0x99, 42}); n != 3 {
+		t.Errorf("expected the hi-hat to play 3 times in the loop, got %d", n)
+	}
+}
+
+func TestPolyrhythmSequencer(t *testing.T) {
+
+	p := NewPattern("seq", 6000)
+	p.AddInstrument(0, "kick").SetSteps("x---x---x---x---")
+	p.AddInstrument(1, "hat").SetSteps("x---------------")
+	p.SetLoopLength(1, 3)
+
+	// over two loops of the kick, the hat comes round every three steps
+	var expected []string
+	for step := 0; step < 32; step++ {
+		if step%4 == 0 {
+			expected = append(expected, "kick")
+		}
+		if step%3 == 0 {
+			expected = append(expected, "hat")
+		}
+	}
+
+	s := NewSequencer(*p)
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	for n, name := range expected {
+		e := <-s.Events()
+		if e.Instrument.name != name {
+			t.Fatalf("event %d: expected the %s, got the %s on step %d", n, name, e.Instrument.name, e.StepIndex)
+		}
+		if name == "hat" && e.StepIndex != 0 {
+			t.Fatalf("event %d: expected the hat's own step 0, got %d", n, e.StepIndex)
+		}
+	}
+}
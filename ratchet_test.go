@@ -0,0 +1,134 @@
+package drum
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStrokes(t *testing.T) {
+
+	tData := []struct {
+		e        Expression
+		expected []Stroke
+	}{
+		{Expression{}, []Stroke{{0, 100}}},
+		{Expression{Ratchet: 1, Velocity: 80}, []Stroke{{0, 80}}},
+		{Expression{Ratchet: 4, Offset: 0.1}, []Stroke{{0.1, 100}, {0.35, 100}, {0.6, 100}, {0.85, 100}}},
+		{Expression{Flam: 0.25, Velocity: 90}, []Stroke{{-0.25, 54}, {0, 90}}},
+		{Expression{Flam: 0.5, Ratchet: 2, Velocity: 1}, []Stroke{{-0.5, 1}, {0, 1}, {0.5, 1}}},
+	}
+
+	for _, exp := range tData {
+		if got := exp.e.Strokes(); !reflect.DeepEqual(got, exp.expected) {
+			t.Errorf("%+v: got %v, expected %v", exp.e, got, exp.expected)
+		}
+	}
+}
+
+func TestSetRatchet(t *testing.T) {
+
+	p := NewPattern("ratchet", 120)
+	p.AddInstrument(0, "kick").SetSteps("x-------x-------")
+	p.AddInstrument(1, "snare").SetSteps("----x-------x---")
+	p.SetExpression(0, 0, Expression{Velocity: 64, Offset: 0.25})
+
+	var changes []Change
+	p.OnChange(func(c Change) { changes = append(changes, c) })
+
+	if err := p.SetRatchet(0, 0, 3); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := p.SetFlam(1, 12, 0.125); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(changes) != 2 || changes[0].Kind != ChangeExpression || changes[1].InstrumentID != 1 || changes[1].Step != 12 {
+		t.Errorf("expected two expression changes, got %+v", changes)
+	}
+	if e, _ := p.instruments[0].Expression(0); e != (Expression{Velocity: 64, Offset: 0.25, Ratchet: 3}) {
+		t.Errorf("expected the ratchet added to the expression, got %+v", e)
+	}
+
+	tData := []struct {
+		name string
+		err  error
+	}{
+		{"ratchet too many", p.SetRatchet(0, 0, MaxRatchet+1)},
+		{"ratchet negative", p.SetRatchet(0, 0, -1)},
+		{"ratchet past the end", p.SetRatchet(0, 16, 2)},
+		{"ratchet missing instrument", p.SetRatchet(9, 0, 2)},
+		{"flam too far", p.SetFlam(0, 0, 0.75)},
+		{"flam late", p.SetFlam(0, 0, -0.25)},
+	}
+	for _, exp := range tData {
+		if exp.err == nil {
+			t.Errorf("%s: expected an error", exp.name)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := p.Encode(&buf); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if e, _ := decoded.instruments[0].Expression(0); e.Ratchet != 3 || e.Offset != 0 {
+		t.Errorf("expected only the ratchet to be stored, got %+v", e)
+	}
+	if e, _ := decoded.instruments[1].Expression(12); e.Flam != 0.125 {
+		t.Errorf("expected the flam to be stored, got %+v", e)
+	}
+
+	// patterns without ratchets or flams encode as before
+	p.SetRatchet(0, 0, 0)
+	p.SetFlam(1, 12, 0)
+	if data, _ := (ratchetCodec{}).EncodeChunk(*p); data != nil {
+		t.Errorf("expected no ratchet chunk, got % x", data)
+	}
+	if err := (ratchetCodec{}).DecodeChunk(&decoded, []byte{1, 0, 0, 0, 16, 0, 0, 0, 2, 0, 0, 0, 0}); err == nil {
+		t.Errorf("expected an error ratcheting a step out of range")
+	}
+	if err := (ratchetCodec{}).DecodeChunk(&decoded, []byte{2, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0}); err == nil {
+		t.Errorf("expected an error for a truncated chunk")
+	}
+}
+
+func TestRatchetPlayback(t *testing.T) {
+
+	p := NewPattern("ratchet", 120)
+	p.AddInstrument(0, "Kick").SetSteps("x-------x-------")
+	p.SetRatchet(0, 0, 3)
+	p.SetFlam(0, 8, 0.25)
+
+	// the sequencer sends an event for each stroke
+	start := time.Unix(0, 0)
+	interval := 120 * time.Millisecond
+	var times []time.Duration
+	var velocities []uint8
+	for _, step := range []int{0, 8} {
+		for _, early := range []bool{true, false} {
+			for _, e := range stepHits(*p, step, step, start, interval, early) {
+				times = append(times, e.Time.Sub(start))
+				velocities = append(velocities, e.Velocity)
+			}
+		}
+	}
+	if expected := []time.Duration{0, 40 * time.Millisecond, 80 * time.Millisecond, -30 * time.Millisecond, 0}; !reflect.DeepEqual(times, expected) {
+		t.Errorf("got strokes at %v, expected %v", times, expected)
+	}
+	if expected := []uint8{100, 100, 100, 60, 100}; !reflect.DeepEqual(velocities, expected) {
+		t.Errorf("got velocities %v, expected %v", velocities, expected)
+	}
+
+	// and the MIDI file a note for each
+	var buf bytes.Buffer
+	if err := p.ToMIDI(&buf, nil); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if n := bytes.Count(buf.Bytes(), []byte{midiNoteOn, 36}); n != 5 {
+		t.Errorf("expected 5 notes, got %d", n)
+	}
+}
@@ -0,0 +1,360 @@
+// Package render turns drum patterns into audio by mixing a sample for each
+// instrument onto the pattern's steps, from a kit of WAV samples or a
+// SoundFont.
+package render
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	drum "github.com/chrishiestand/golang-challenge-1-drum_machine"
+)
+
+// Format of the audio RenderWAV writes and LoadSample reads
+const (
+	// SampleRate is the number of frames per second.
+	SampleRate = 44100
+	// channels is the number of channels written, left and right
+	channels = 2
+	// bitsPerSample is the width of each sample
+	bitsPerSample = 16
+	// maxFrames is the longest render allowed, ten minutes, to keep a
+	// very slow tempo from exhausting memory
+	maxFrames = SampleRate * 60 * 10
+)
+
+// ErrInvalidWAV means data given to LoadSample isn't a WAV file it can read.
+var ErrInvalidWAV = errors.New("invalid WAV file")
+
+// Sample is a stereo sound played for each hit of an instrument, as 16 bit
+// frames at SampleRate. Left and Right should be the same length; the
+// shorter one is padded with silence.
+type Sample struct {
+	Left  []int16
+	Right []int16
+}
+
+// frames returns the length of the sample in frames
+func (s Sample) frames() int {
+
+	if len(s.Right) > len(s.Left) {
+		return len(s.Right)
+	}
+	return len(s.Left)
+}
+
+// Kit supplies the sounds RenderWAV plays. Sample returns the sample a hit
+// of the named instrument at velocity, from 1 to 127, plays and the gain
+// to mix it at, or false if the kit has no sound for the instrument.
+type Kit interface {
+	Sample(name string, velocity uint8) (s Sample, gain float64, ok bool)
+}
+
+// SampleKit is a Kit holding the sample each instrument plays, keyed by
+// instrument name. A name that isn't in the kit is looked up again ignoring
+// case.
+type SampleKit map[string]Sample
+
+// Sample implements Kit, returning the instrument's sample with a gain
+// that plays it as it is at drum.DefaultVelocity and in proportion to the
+// velocity otherwise
+func (k SampleKit) Sample(name string, velocity uint8) (Sample, float64, bool) {
+
+	s, ok := k.lookup(name)
+	return s, float64(velocity) / drum.DefaultVelocity, ok
+}
+
+// lookup finds the sample for an instrument name
+func (k SampleKit) lookup(name string) (Sample, bool) {
+
+	if s, ok := k[name]; ok {
+		return s, true
+	}
+	for key, s := range k {
+		if strings.EqualFold(key, name) {
+			return s, true
+		}
+	}
+	return Sample{}, false
+}
+
+// LoadSample reads a PCM WAV file of 16 bit samples at SampleRate, in mono
+// or stereo. Mono samples are played in both channels.
+func LoadSample(r io.Reader) (Sample, error) {
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Sample{}, err
+	}
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return Sample{}, fmt.Errorf("%w: no RIFF WAVE header", ErrInvalidWAV)
+	}
+
+	var format struct {
+		Audio, Channels       uint16
+		Rate, ByteRate        uint32
+		BlockAlign, BitsDepth uint16
+	}
+	haveFormat := false
+
+	for chunks := data[12:]; len(chunks) >= 8; {
+		kind := string(chunks[0:4])
+		size := binary.LittleEndian.Uint32(chunks[4:8])
+		if uint64(size) > uint64(len(chunks)-8) {
+			return Sample{}, fmt.Errorf("%w: %s chunk of %d bytes runs past the end of the file", ErrInvalidWAV, kind, size)
+		}
+		body := chunks[8 : 8+size]
+
+		// chunks are padded to an even length
+		chunks = chunks[8+size:]
+		if size%2 == 1 && len(chunks) > 0 {
+			chunks = chunks[1:]
+		}
+
+		switch kind {
+		case "fmt ":
+			if err := binary.Read(bytes.NewReader(body), binary.LittleEndian, &format); err != nil {
+				return Sample{}, fmt.Errorf("%w: short format chunk", ErrInvalidWAV)
+			}
+			haveFormat = true
+		case "data":
+			if !haveFormat {
+				return Sample{}, fmt.Errorf("%w: data chunk before the format chunk", ErrInvalidWAV)
+			}
+			if format.Audio != 1 || format.BitsDepth != bitsPerSample || format.Rate != SampleRate ||
+				(format.Channels != 1 && format.Channels != 2) {
+				return Sample{}, fmt.Errorf("%w: only %d Hz %d bit PCM in mono or stereo is supported, got format %d at %d Hz, %d bits, %d channels",
+					ErrInvalidWAV, SampleRate, bitsPerSample, format.Audio, format.Rate, format.BitsDepth, format.Channels)
+			}
+			return decodeFrames(body, int(format.Channels)), nil
+		}
+	}
+	return Sample{}, fmt.Errorf("%w: no data chunk", ErrInvalidWAV)
+}
+
+// decodeFrames splits interleaved little endian 16 bit samples into channels
+func decodeFrames(body []byte, channels int) Sample {
+
+	frames := len(body) / (2 * channels)
+	s := Sample{Left: make([]int16, frames), Right: make([]int16, frames)}
+
+	for f := 0; f < frames; f++ {
+		at := f * 2 * channels
+		s.Left[f] = int16(binary.LittleEndian.Uint16(body[at:]))
+		s.Right[f] = s.Left[f]
+		if channels == 2 {
+			s.Right[f] = int16(binary.LittleEndian.Uint16(body[at+2:]))
+		}
+	}
+	return s
+}
+
+// RenderWAV mixes the sample kit gives each instrument onto every step the
+// instrument hits, at the pattern's tempo and resolution, and writes the
+// result to w as a 44.1kHz 16 bit stereo WAV file. The audio lasts one loop
+// of the pattern, longer if the last samples ring on past its end. Each hit
+// is moved by its Expression offset, and each of its Strokes, more than one
+// if it's ratcheted or flammed, plays the sample and gain kit gives for its
+// velocity; with a SampleKit a hit at DefaultVelocity plays its sample as
+// it is, and with a SoundFont the velocity also picks the layer. The gain
+// is then scaled by the instrument's Gain, and instruments that aren't
+// Audible are left out. Samples are added together and clipped to 16 bits.
+// Silent instruments without a sample are ignored, but an error is returned
+// before anything is written if an instrument with hits has no sample, the
+// tempo isn't positive or the render would last over ten minutes.
+func RenderWAV(p drum.Pattern, kit Kit, w io.Writer) error {
+
+	return RenderWAVWithOptions(p, kit, w, RenderOptions{})
+}
+
+// RenderOptions adds a metronome to a render, for practicing along to it.
+// CountIn is the number of measures of clicks played before the pattern
+// starts, and Click mixes a click onto every beat of the pattern itself.
+// A measure is four beats, the first of them accented.
+type RenderOptions struct {
+	CountIn int
+	Click   bool
+}
+
+// checkEvery is how many hits RenderWAVContext mixes between checking
+// whether its context is done
+const checkEvery = 64
+
+// beatsPerMeasure is the number of beats in a measure of clicks
+const beatsPerMeasure = 4
+
+// The clicks played on the first beat of a measure and on the others
+var (
+	accentClick = click(1760)
+	beatClick   = click(1320)
+)
+
+// click returns a click of a sine wave at freq Hz, fading out over 30ms
+func click(freq float64) Sample {
+
+	const frames = SampleRate * 30 / 1000
+	s := Sample{Left: make([]int16, frames), Right: make([]int16, frames)}
+	for f := range s.Left {
+		fade := 1 - float64(f)/frames
+		v := int16(math.Round(12000 * fade * fade * math.Sin(2*math.Pi*freq*float64(f)/SampleRate)))
+		s.Left[f], s.Right[f] = v, v
+	}
+	return s
+}
+
+// RenderWAVWithOptions renders p as RenderWAV does, with the count-in and
+// clicks opts asks for. The clicks are at the pattern's tempo and the
+// pattern starts after the count-in, so the audio is that much longer. An
+// error is returned if CountIn is negative.
+func RenderWAVWithOptions(p drum.Pattern, kit Kit, w io.Writer, opts RenderOptions) error {
+
+	return RenderWAVContext(context.Background(), p, kit, w, opts)
+}
+
+// RenderWAVContext renders p as RenderWAVWithOptions does, but checks ctx
+// as it mixes and returns the context's error, writing nothing, as soon as
+// it is done.
+func RenderWAVContext(ctx context.Context, p drum.Pattern, kit Kit, w io.Writer, opts RenderOptions) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	tempo := float64(p.Tempo())
+	if !(tempo > 0) {
+		return fmt.Errorf("cannot render at a tempo of %v", tempo)
+	}
+	if opts.CountIn < 0 {
+		return fmt.Errorf("cannot count in %d measures", opts.CountIn)
+	}
+	framesPerStep := SampleRate * 60 / tempo / float64(p.StepsPerBeat())
+	framesPerBeat := SampleRate * 60 / tempo
+
+	instruments := p.Instruments()
+	steps := 0
+	for _, inst := range instruments {
+		if n := len(inst.Steps()); n > steps {
+			steps = n
+		}
+	}
+
+	countIn := float64(opts.CountIn*beatsPerMeasure) * framesPerBeat
+	length := float64(steps) * framesPerStep
+	if countIn+length > maxFrames {
+		return fmt.Errorf("a loop at %v BPM lasts longer than ten minutes", tempo)
+	}
+	frames := int(math.Round(countIn + length))
+
+	type hit struct {
+		frame  int
+		gain   float64
+		sample Sample
+	}
+	var hits []hit
+
+	beats := opts.CountIn * beatsPerMeasure
+	if opts.Click {
+		beats += (steps + p.StepsPerBeat() - 1) / p.StepsPerBeat()
+	}
+	for b := 0; b < beats; b++ {
+		sample := beatClick
+		if b%beatsPerMeasure == 0 {
+			sample = accentClick
+		}
+		start := int(math.Round(float64(b) * framesPerBeat))
+		hits = append(hits, hit{frame: start, gain: 1, sample: sample})
+		if end := start + sample.frames(); end > frames {
+			frames = end
+		}
+	}
+
+	for _, inst := range instruments {
+		if !p.Audible(inst.ID()) {
+			continue
+		}
+
+		// instruments shorter than the loop cycle round to fill it, as
+		// they do when played
+		own := inst.Steps()
+		for s := 0; s < steps && len(own) > 0; s++ {
+			if !own[s%len(own)] {
+				continue
+			}
+
+			e, _ := inst.Expression(s % len(own))
+			for _, stroke := range e.Strokes() {
+				sample, gain, ok := kit.Sample(inst.Name(), stroke.Velocity)
+				if !ok {
+					return fmt.Errorf("no sample for instrument %d %q", inst.ID(), inst.Name())
+				}
+				gain *= float64(inst.Gain())
+
+				start := int(math.Round(countIn + (float64(s)+stroke.Offset)*framesPerStep))
+				if start < 0 {
+					start = 0
+				}
+
+				hits = append(hits, hit{frame: start, gain: gain, sample: sample})
+				if end := start + sample.frames(); end > frames {
+					frames = end
+				}
+			}
+		}
+	}
+	if frames > maxFrames {
+		return fmt.Errorf("the render would last longer than ten minutes")
+	}
+
+	mix := make([]int32, frames*channels)
+	for n, h := range hits {
+		if n%checkEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+		}
+		for f, v := range h.sample.Left {
+			mix[(h.frame+f)*channels] += int32(math.Round(float64(v) * h.gain))
+		}
+		for f, v := range h.sample.Right {
+			mix[(h.frame+f)*channels+1] += int32(math.Round(float64(v) * h.gain))
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	dataSize := len(mix) * bitsPerSample / 8
+
+	var buf bytes.Buffer
+	buf.Grow(44 + dataSize)
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+dataSize))
+	buf.WriteString("WAVEfmt ")
+	binary.Write(&buf, binary.LittleEndian, []uint32{16})
+	binary.Write(&buf, binary.LittleEndian, []uint16{1, channels})
+	binary.Write(&buf, binary.LittleEndian, []uint32{SampleRate, SampleRate * channels * bitsPerSample / 8})
+	binary.Write(&buf, binary.LittleEndian, []uint16{channels * bitsPerSample / 8, bitsPerSample})
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(dataSize))
+
+	var sample [2]byte
+	for _, v := range mix {
+		if v > math.MaxInt16 {
+			v = math.MaxInt16
+		} else if v < math.MinInt16 {
+			v = math.MinInt16
+		}
+		binary.LittleEndian.PutUint16(sample[:], uint16(int16(v)))
+		buf.Write(sample[:])
+	}
+
+	_, err := buf.WriteTo(w)
+	return err
+}
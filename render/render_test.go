@@ -0,0 +1,291 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path"
+	"testing"
+
+	drum "github.com/chrishiestand/golang-challenge-1-drum_machine"
+)
+
+func TestRenderWAVCycles(t *testing.T) {
+
+	// a 12 step hat plays its first step again at step 12 of a 16 step loop
+	p := drum.NewPattern("render", 150)
+	p.AddInstrument(0, "kick").SetSteps("x---------------")
+	p.AddInstrument(1, "hat").SetSteps("x---------------")
+	if err := p.SetLoopLength(1, 12); err != nil {
+		t.Fatal(err)
+	}
+	kit := SampleKit{"kick": {Left: []int16{100}, Right: []int16{100}}, "hat": {Left: []int16{7}, Right: []int16{7}}}
+
+	var buf bytes.Buffer
+	if err := RenderWAV(*p, kit, &buf); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	rendered, err := LoadSample(&buf)
+	if err != nil {
+		t.Fatalf("couldn't read back the render: %v", err)
+	}
+	if len(rendered.Left) != 16*4410 {
+		t.Fatalf("expected one loop of %d frames, got %d", 16*4410, len(rendered.Left))
+	}
+	for frame, exp := range map[int]int16{0: 107, 12 * 4410: 7, 8 * 4410: 0} {
+		if got := rendered.Left[frame]; got != exp {
+			t.Errorf("frame %d: got %v, expected %v", frame, got, exp)
+		}
+	}
+}
+
+func TestRenderWAV(t *testing.T) {
+
+	// at 150 BPM a sixteenth lasts 4410 frames, a tenth of a second
+	p := drum.NewPattern("render", 150)
+	p.AddInstrument(0, "kick").SetSteps("x-------x-------")
+	p.AddInstrument(1, "snare").SetSteps("----x-------x---")
+	p.AddInstrument(2, "cowbell")
+
+	kit := SampleKit{
+		"Kick":  {Left: []int16{30000, 1000}, Right: []int16{-30000, -1000}},
+		"snare": {Left: []int16{5000, 5000, 5000}, Right: []int16{0}},
+	}
+
+	var buf bytes.Buffer
+	if err := RenderWAV(*p, kit, &buf); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if buf.Len() != 44+16*4410*4 {
+		t.Fatalf("expected one loop of %d frames, got %d bytes", 16*4410, buf.Len())
+	}
+
+	rendered, err := LoadSample(&buf)
+	if err != nil {
+		t.Fatalf("couldn't read back the render: %v", err)
+	}
+
+	expected := map[int][2]int16{
+		0: {30000, -30000}, 1: {1000, -1000}, 2: {0, 0},
+		4 * 4410: {5000, 0}, 4*4410 + 2: {5000, 0},
+		8 * 4410:  {30000, -30000},
+		12 * 4410: {5000, 0}, 12*4410 - 1: {0, 0},
+	}
+	for frame, exp := range expected {
+		if got := [2]int16{rendered.Left[frame], rendered.Right[frame]}; got != exp {
+			t.Errorf("frame %d: got %v, expected %v", frame, got, exp)
+		}
+	}
+
+	// hits playing together are mixed and clipped, and a long last sample
+	// rings on past the end of the loop
+	kit["snare"] = Sample{Left: make([]int16, 5000), Right: make([]int16, 5000)}
+	kit["snare"].Left[0], kit["snare"].Right[0] = 30000, 30000
+	p.SetStep(0, 15, true)
+	p.SetStep(1, 15, true)
+	buf.Reset()
+	if err := RenderWAV(*p, kit, &buf); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if rendered, _ = LoadSample(&buf); len(rendered.Left) != 15*4410+5000 || rendered.Left[15*4410] != 32767 || rendered.Right[15*4410] != 0 {
+		t.Errorf("expected %d frames with a clipped hit on step 15, got %d", 15*4410+5000, len(rendered.Left))
+	}
+
+	p.SetStep(2, 0, true)
+	if err := RenderWAV(*p, kit, &buf); err == nil {
+		t.Errorf("expected an error for an instrument without a sample")
+	}
+
+	slow := drum.NewPattern("slow", 0.01)
+	slow.AddInstrument(0, "kick")
+	if err := RenderWAV(*slow, kit, &buf); err == nil {
+		t.Errorf("expected an error for a render lasting hours")
+	}
+
+	decoded, err := drum.DecodeFile(path.Join("..", "fixtures", "pattern_2.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_2.splice - %v", err)
+	}
+	if err := RenderWAV(*decoded, SampleKit{}, &buf); err == nil {
+		t.Errorf("expected an error rendering pattern_2 with an empty kit")
+	}
+}
+
+func TestLoadSample(t *testing.T) {
+
+	mono := []byte{
+		'R', 'I', 'F', 'F', 42, 0, 0, 0, 'W', 'A', 'V', 'E',
+		'L', 'I', 'S', 'T', 1, 0, 0, 0, 0, 0,
+		'f', 'm', 't', ' ', 16, 0, 0, 0, 1, 0, 1, 0, 0x44, 0xac, 0, 0, 0x88, 0x58, 1, 0, 2, 0, 16, 0,
+		'd', 'a', 't', 'a', 4, 0, 0, 0, 0x10, 0x27, 0xf0, 0xd8,
+	}
+
+	s, err := LoadSample(bytes.NewReader(mono))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(s.Left) != 2 || s.Left[0] != 10000 || s.Left[1] != -10000 || s.Right[1] != -10000 {
+		t.Errorf("unexpected sample %+v", s)
+	}
+
+	eightBit := append([]byte(nil), mono...)
+	eightBit[44] = 8
+	for _, data := range [][]byte{nil, mono[:20], mono[:50], eightBit} {
+		if _, err := LoadSample(bytes.NewReader(data)); !errors.Is(err, ErrInvalidWAV) {
+			t.Errorf("% x: expected %v, got %v", data, ErrInvalidWAV, err)
+		}
+	}
+}
+
+func TestRenderWAVExpression(t *testing.T) {
+
+	// at 150 BPM a sixteenth lasts 4410 frames; the kick on step 4 plays a
+	// quarter step early at half velocity
+	p := drum.NewPattern("render", 150)
+	p.AddInstrument(0, "kick").SetSteps("----x-----------")
+	if err := p.SetExpression(0, 4, drum.Expression{Velocity: drum.DefaultVelocity / 2, Offset: -0.25}); err != nil {
+		t.Fatal(err)
+	}
+
+	kit := SampleKit{"kick": {Left: []int16{30000}, Right: []int16{-30000}}}
+
+	var buf bytes.Buffer
+	if err := RenderWAV(*p, kit, &buf); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	rendered, err := LoadSample(&buf)
+	if err != nil {
+		t.Fatalf("couldn't read back the render: %v", err)
+	}
+
+	at := 4*4410 - 4410/4
+	if rendered.Left[at] != 15000 || rendered.Right[at] != -15000 {
+		t.Errorf("expected the kick at half level on frame %d, got %d, %d", at, rendered.Left[at], rendered.Right[at])
+	}
+	if rendered.Left[4*4410] != 0 {
+		t.Errorf("expected nothing on the kick's step, got %d", rendered.Left[4*4410])
+	}
+}
+
+func TestRenderWAVPlayback(t *testing.T) {
+
+	p := drum.NewPattern("render", 150)
+	p.AddInstrument(0, "kick").SetSteps("x---------------")
+	p.AddInstrument(1, "theremin").SetSteps("x---------------")
+	p.SetGain(0, 0.5)
+	p.SetMuted(1, true)
+
+	// the muted theremin needs no sample
+	kit := SampleKit{"kick": {Left: []int16{30000}, Right: []int16{-30000}}}
+
+	var buf bytes.Buffer
+	if err := RenderWAV(*p, kit, &buf); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	rendered, err := LoadSample(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rendered.Left[0] != 15000 || rendered.Right[0] != -15000 {
+		t.Errorf("expected the kick at half gain, got %d, %d", rendered.Left[0], rendered.Right[0])
+	}
+}
+
+func TestRenderWAVCountIn(t *testing.T) {
+
+	// at 150 BPM a beat lasts 17640 frames and a measure 70560
+	p := drum.NewPattern("render", 150)
+	p.AddInstrument(0, "kick").SetSteps("x---------------")
+	kit := SampleKit{"kick": {Left: []int16{30000}, Right: []int16{-30000}}}
+
+	tData := []struct {
+		name     string
+		opts     RenderOptions
+		frames   int
+		expected map[int]int16
+	}{
+		{"none", RenderOptions{}, 70560, map[int]int16{0: 30000, 10: 0, 17650: 0}},
+		{"count-in", RenderOptions{CountIn: 1}, 2 * 70560, map[int]int16{
+			10: accentClick.Left[10], 17650: beatClick.Left[10], 3*17640 + 10: beatClick.Left[10],
+			70560: 30000, 70570: 0, 70560 + 17650: 0,
+		}},
+		{"count-in and click", RenderOptions{CountIn: 2, Click: true}, 3 * 70560, map[int]int16{
+			10: accentClick.Left[10], 70570: accentClick.Left[10], 2 * 70560: 30000,
+			2*70560 + 10: accentClick.Left[10], 2*70560 + 17650: beatClick.Left[10],
+		}},
+		{"click", RenderOptions{Click: true}, 70560, map[int]int16{0: 30000, 10: accentClick.Left[10], 17650: beatClick.Left[10]}},
+	}
+
+	for _, exp := range tData {
+		var buf bytes.Buffer
+		if err := RenderWAVWithOptions(*p, kit, &buf, exp.opts); err != nil {
+			t.Fatalf("%s: unexpected error %v", exp.name, err)
+		}
+		rendered, err := LoadSample(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rendered.Left) != exp.frames {
+			t.Errorf("%s: expected %d frames, got %d", exp.name, exp.frames, len(rendered.Left))
+		}
+		for frame, v := range exp.expected {
+			if rendered.Left[frame] != v {
+				t.Errorf("%s: frame %d: got %d, expected %d", exp.name, frame, rendered.Left[frame], v)
+			}
+		}
+	}
+
+	if accentClick.Left[10] == 0 || accentClick.Left[10] == beatClick.Left[10] {
+		t.Errorf("expected distinct clicks, got %d and %d", accentClick.Left[10], beatClick.Left[10])
+	}
+	var buf bytes.Buffer
+	if err := RenderWAVWithOptions(*p, kit, &buf, RenderOptions{CountIn: -1}); err == nil || buf.Len() != 0 {
+		t.Errorf("expected an error counting in -1 measures")
+	}
+}
+
+func TestRenderWAVRatchet(t *testing.T) {
+
+	// at 150 BPM a sixteenth lasts 4410 frames
+	p := drum.NewPattern("render", 150)
+	p.AddInstrument(0, "kick").SetSteps("x---x-----------")
+	p.SetRatchet(0, 0, 2)
+	p.SetFlam(0, 4, 0.5)
+	kit := SampleKit{"kick": {Left: []int16{30000}, Right: []int16{30000}}}
+
+	var buf bytes.Buffer
+	if err := RenderWAV(*p, kit, &buf); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	rendered, err := LoadSample(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the flam's grace note plays at 60 of the hit's 100 velocity
+	expected := map[int]int16{0: 30000, 2205: 30000, 2204: 0, 4*4410 - 2205: 18000, 4 * 4410: 30000, 4410: 0}
+	for frame, exp := range expected {
+		if got := rendered.Left[frame]; got != exp {
+			t.Errorf("frame %d: got %d, expected %d", frame, got, exp)
+		}
+	}
+}
+
+func TestRenderWAVContext(t *testing.T) {
+
+	p := drum.NewPattern("render", 150)
+	p.AddInstrument(0, "kick").SetSteps("x-------x-------")
+	kit := SampleKit{"kick": {Left: []int16{1000}, Right: []int16{1000}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var buf bytes.Buffer
+	if err := RenderWAVContext(ctx, *p, kit, &buf, RenderOptions{}); err != nil || buf.Len() != 44+16*4410*4 {
+		t.Fatalf("got %d bytes and %v", buf.Len(), err)
+	}
+
+	cancel()
+	buf.Reset()
+	if err := RenderWAVContext(ctx, *p, kit, &buf, RenderOptions{}); !errors.Is(err, context.Canceled) || buf.Len() != 0 {
+		t.Errorf("expected %v and nothing written, got %v and %d bytes", context.Canceled, err, buf.Len())
+	}
+}
@@ -0,0 +1,533 @@
+package render
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"sync"
+
+	drum "github.com/chrishiestand/golang-challenge-1-drum_machine"
+)
+
+// ErrInvalidSoundFont means data given to LoadSoundFont isn't a SoundFont 2
+// file it can read.
+var ErrInvalidSoundFont = errors.New("invalid SoundFont")
+
+// The SoundFont generators a SoundFont plays its samples with. Others, such
+// as envelopes, filters and loops, are ignored: each sample plays once to
+// its end, as drums do.
+const (
+	genStartOffset        = 0
+	genEndOffset          = 1
+	genStartCoarseOffset  = 4
+	genEndCoarseOffset    = 12
+	genPan                = 17
+	genInstrument         = 41
+	genKeyRange           = 43
+	genVelRange           = 44
+	genInitialAttenuation = 48
+	genCoarseTune         = 51
+	genFineTune           = 52
+	genSampleID           = 53
+	genScaleTuning        = 56
+	genOverridingRootKey  = 58
+)
+
+// The sizes of the records in a SoundFont's pdta chunks
+const (
+	phdrSize = 38
+	bagSize  = 4
+	genSize  = 4
+	instSize = 22
+	shdrSize = 46
+)
+
+// SoundFont is a Kit playing a preset of a SoundFont 2 file, the standard
+// drum kit by default. Each instrument plays the key its name maps to in
+// Notes, and each hit the samples of the preset's zones for that key and
+// its velocity, so a kit with velocity layers plays a harder sample for a
+// harder hit. Samples are resampled to SampleRate, tuned and panned as the
+// file says. A SoundFont is safe for use by several goroutines.
+type SoundFont struct {
+	// Notes maps instrument names to the keys they play, looked up ignoring
+	// case. Nil means drum.DefaultGMDrumMap, which suits General MIDI drum
+	// kits.
+	Notes map[string]uint8
+
+	data    []int16
+	samples []sfSample
+	presets []sfPreset
+
+	mu     sync.Mutex
+	preset int
+	// cache holds the samples played so far, by key and the voices of the
+	// preset mixed into them, so velocities in the same layer share one
+	cache map[string]Sample
+}
+
+// sfSample is a sample header: where the sample lies in the sample data,
+// the rate it was recorded at and the key it plays unchanged
+type sfSample struct {
+	start, end uint32
+	rate       uint32
+	pitch      uint8
+	correction int8
+}
+
+// sfPreset is a preset of a SoundFont, with the voices its zones play
+type sfPreset struct {
+	name   string
+	bank   uint16
+	number uint16
+	voices []sfVoice
+}
+
+// sfVoice is a sample a preset plays over a range of keys and velocities,
+// with the generators of the instrument zone it comes from and the preset
+// zone that chose the instrument added together
+type sfVoice struct {
+	keyLo, keyHi uint8
+	velLo, velHi uint8
+	sample       int
+	gens         map[uint16]int
+}
+
+// gen returns the value of a generator for the voice, or its default
+func (v sfVoice) gen(op uint16) int {
+
+	if value, ok := v.gens[op]; ok {
+		return value
+	}
+	return sfDefault(op)
+}
+
+// sfDefault returns the value of a generator that isn't given
+func sfDefault(op uint16) int {
+
+	switch op {
+	case genScaleTuning:
+		return 100
+	case genOverridingRootKey:
+		return -1
+	}
+	return 0
+}
+
+// LoadSoundFont reads a SoundFont 2 file, playing its first preset in the
+// percussion bank 128, or its first preset if it has none there.
+func LoadSoundFont(r io.Reader) (*SoundFont, error) {
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "sfbk" {
+		return nil, fmt.Errorf("%w: no RIFF sfbk header", ErrInvalidSoundFont)
+	}
+
+	chunks := make(map[string][]byte)
+	err = forChunks(data[12:], func(kind string, body []byte) error {
+		if kind != "LIST" || len(body) < 4 {
+			return nil
+		}
+		return forChunks(body[4:], func(kind string, body []byte) error {
+			chunks[kind] = body
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	f := &SoundFont{cache: make(map[string]Sample)}
+
+	smpl := chunks["smpl"]
+	f.data = make([]int16, len(smpl)/2)
+	for i := range f.data {
+		f.data[i] = int16(binary.LittleEndian.Uint16(smpl[2*i:]))
+	}
+
+	shdr, err := records(chunks, "shdr", shdrSize)
+	if err != nil {
+		return nil, err
+	}
+	for _, h := range shdr[:len(shdr)-1] {
+		f.samples = append(f.samples, sfSample{
+			start:      binary.LittleEndian.Uint32(h[20:]),
+			end:        binary.LittleEndian.Uint32(h[24:]),
+			rate:       binary.LittleEndian.Uint32(h[36:]),
+			pitch:      h[40],
+			correction: int8(h[41]),
+		})
+	}
+
+	// an instrument header's bag index follows its name, and a preset's
+	// its name, number and bank
+	instruments, err := zones(chunks, "inst", instSize, 20, "ibag", "igen", genSampleID)
+	if err != nil {
+		return nil, err
+	}
+	presets, err := zones(chunks, "phdr", phdrSize, 24, "pbag", "pgen", genInstrument)
+	if err != nil {
+		return nil, err
+	}
+	phdr, _ := records(chunks, "phdr", phdrSize)
+
+	for i, zs := range presets {
+		h := phdr[i]
+		preset := sfPreset{
+			name:   strings.TrimRight(string(h[:20]), "\x00"),
+			number: binary.LittleEndian.Uint16(h[20:]),
+			bank:   binary.LittleEndian.Uint16(h[22:]),
+		}
+		for _, pz := range zs {
+			inst := pz.gens[genInstrument]
+			if inst < 0 || inst >= len(instruments) {
+				return nil, fmt.Errorf("%w: preset %q plays instrument %d of %d", ErrInvalidSoundFont, preset.name, inst, len(instruments))
+			}
+			for _, iz := range instruments[inst] {
+				if s := iz.gens[genSampleID]; s < 0 || s >= len(f.samples) {
+					return nil, fmt.Errorf("%w: instrument %d plays sample %d of %d", ErrInvalidSoundFont, inst, s, len(f.samples))
+				}
+				if v, ok := voice(pz, iz); ok {
+					preset.voices = append(preset.voices, v)
+				}
+			}
+		}
+		f.presets = append(f.presets, preset)
+	}
+	if len(f.presets) == 0 {
+		return nil, fmt.Errorf("%w: no presets", ErrInvalidSoundFont)
+	}
+
+	for i, p := range f.presets {
+		if p.bank == 128 && (f.presets[f.preset].bank != 128 || p.number < f.presets[f.preset].number) {
+			f.preset = i
+		}
+	}
+	return f, nil
+}
+
+// UsePreset has the SoundFont play the preset with the given bank and
+// number, returning an error if the file has no such preset
+func (f *SoundFont) UsePreset(bank, number uint16) error {
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for i, p := range f.presets {
+		if p.bank == bank && p.number == number {
+			f.preset = i
+			f.cache = make(map[string]Sample)
+			return nil
+		}
+	}
+	return fmt.Errorf("no preset %d in bank %d", number, bank)
+}
+
+// Sample implements Kit, returning the sample a hit of the named instrument
+// at velocity plays and, as SoundFont players do by default, a gain falling
+// with the square of the velocity below 127
+func (f *SoundFont) Sample(name string, velocity uint8) (Sample, float64, bool) {
+
+	notes := f.Notes
+	if notes == nil {
+		notes = drum.DefaultGMDrumMap
+	}
+	key, ok := notes[strings.ToLower(name)]
+	if !ok || velocity == 0 {
+		return Sample{}, 0, false
+	}
+	if velocity > 127 {
+		velocity = 127
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var voices []int
+	for i, v := range f.presets[f.preset].voices {
+		if key >= v.keyLo && key <= v.keyHi && velocity >= v.velLo && velocity <= v.velHi {
+			voices = append(voices, i)
+		}
+	}
+	if len(voices) == 0 {
+		return Sample{}, 0, false
+	}
+
+	id := fmt.Sprint(key, voices)
+	s, ok := f.cache[id]
+	if !ok {
+		s = f.play(key, voices)
+		f.cache[id] = s
+	}
+
+	gain := float64(velocity) / 127
+	return s, gain * gain, true
+}
+
+// play mixes the samples of the preset's voices at the given indexes,
+// tuned for key. It's called with mu held.
+func (f *SoundFont) play(key uint8, voices []int) Sample {
+
+	var left, right []float64
+
+	for _, i := range voices {
+		l, r := f.render(f.presets[f.preset].voices[i], key)
+		for len(left) < len(l) {
+			left, right = append(left, 0), append(right, 0)
+		}
+		for i := range l {
+			left[i] += l[i]
+			right[i] += r[i]
+		}
+	}
+
+	s := Sample{Left: make([]int16, len(left)), Right: make([]int16, len(right))}
+	for i := range left {
+		s.Left[i], s.Right[i] = clip(left[i]), clip(right[i])
+	}
+	return s
+}
+
+// render resamples a voice's sample to SampleRate, tuned for key, and pans
+// and attenuates it into the left and right channels
+func (f *SoundFont) render(v sfVoice, key uint8) (left, right []float64) {
+
+	h := f.samples[v.sample]
+
+	start := int(h.start) + v.gen(genStartOffset) + 32768*v.gen(genStartCoarseOffset)
+	end := int(h.end) + v.gen(genEndOffset) + 32768*v.gen(genEndCoarseOffset)
+	if end > len(f.data) {
+		end = len(f.data)
+	}
+	if start < 0 {
+		start = 0
+	}
+	if start >= end {
+		return nil, nil
+	}
+	source := f.data[start:end]
+
+	root := int(h.pitch)
+	if r := v.gen(genOverridingRootKey); r >= 0 {
+		root = r
+	}
+	cents := (int(key)-root)*v.gen(genScaleTuning) + 100*v.gen(genCoarseTune) + v.gen(genFineTune) + int(h.correction)
+	rate := float64(h.rate)
+	if rate == 0 {
+		rate = SampleRate
+	}
+	step := math.Pow(2, float64(cents)/1200) * rate / SampleRate
+
+	frames := int(float64(len(source)) / step)
+	if frames > maxFrames {
+		frames = maxFrames
+	}
+
+	// attenuation is in centibels, and pan from -500 for hard left to 500
+	// for hard right
+	gain := math.Pow(10, -float64(v.gen(genInitialAttenuation))/200)
+	pan := math.Max(-500, math.Min(500, float64(v.gen(genPan))))
+	leftGain := gain * math.Min(1, (500-pan)/500)
+	rightGain := gain * math.Min(1, (500+pan)/500)
+
+	left, right = make([]float64, frames), make([]float64, frames)
+	for i := range left {
+		at := float64(i) * step
+		j := int(at)
+		value := float64(source[j])
+		if j+1 < len(source) {
+			value += (float64(source[j+1]) - value) * (at - float64(j))
+		}
+		left[i], right[i] = value*leftGain, value*rightGain
+	}
+	return left, right
+}
+
+// sfZone is a zone of a preset or instrument: its generators, with those
+// of the global zone it inherits from
+type sfZone struct {
+	gens map[uint16]int
+}
+
+// keys returns the range of keys the zone covers
+func (z sfZone) keys() (lo, hi uint8) {
+
+	return z.span(genKeyRange)
+}
+
+// velocities returns the range of velocities the zone covers
+func (z sfZone) velocities() (lo, hi uint8) {
+
+	return z.span(genVelRange)
+}
+
+// span returns the range a range generator holds, or all of 0 to 127
+func (z sfZone) span(op uint16) (lo, hi uint8) {
+
+	value, ok := z.gens[op]
+	if !ok {
+		return 0, 127
+	}
+	return uint8(value), uint8(value >> 8)
+}
+
+// voice combines an instrument zone with the preset zone that plays it,
+// reporting false if their ranges don't overlap. Range generators are
+// intersected and the preset's others added to the instrument's.
+func voice(pz, iz sfZone) (sfVoice, bool) {
+
+	v := sfVoice{sample: iz.gens[genSampleID], gens: make(map[uint16]int)}
+
+	pkLo, pkHi := pz.keys()
+	ikLo, ikHi := iz.keys()
+	pvLo, pvHi := pz.velocities()
+	ivLo, ivHi := iz.velocities()
+	v.keyLo, v.keyHi = maxByte(pkLo, ikLo), minByte(pkHi, ikHi)
+	v.velLo, v.velHi = maxByte(pvLo, ivLo), minByte(pvHi, ivHi)
+	if v.keyLo > v.keyHi || v.velLo > v.velHi {
+		return sfVoice{}, false
+	}
+
+	for op, value := range iz.gens {
+		v.gens[op] = value
+	}
+	for op, value := range pz.gens {
+		switch op {
+		case genKeyRange, genVelRange, genInstrument:
+			continue
+		}
+		v.gens[op] = v.gen(op) + value
+	}
+	return v, true
+}
+
+// zones reads the zones of each preset or instrument from the header
+// chunk, whose records hold their first bag's index at bagAt, and its bag
+// and generator chunks. A first zone that doesn't end
+// with the terminal generator, which chooses the instrument or sample it
+// plays, is a global zone whose generators every other zone inherits.
+func zones(chunks map[string][]byte, header string, size, bagAt int, bag, gen string, terminal uint16) ([][]sfZone, error) {
+
+	headers, err := records(chunks, header, size)
+	if err != nil {
+		return nil, err
+	}
+	bags, err := records(chunks, bag, bagSize)
+	if err != nil {
+		return nil, err
+	}
+	gens, err := records(chunks, gen, genSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var all [][]sfZone
+	for h := 0; h < len(headers)-1; h++ {
+		first := int(binary.LittleEndian.Uint16(headers[h][bagAt:]))
+		last := int(binary.LittleEndian.Uint16(headers[h+1][bagAt:]))
+		if first > last || last >= len(bags) {
+			return nil, fmt.Errorf("%w: %s %d has bags %d to %d of %d", ErrInvalidSoundFont, header, h, first, last, len(bags)-1)
+		}
+
+		var zs []sfZone
+		global := map[uint16]int{}
+		for b := first; b < last; b++ {
+			from := int(binary.LittleEndian.Uint16(bags[b]))
+			to := int(binary.LittleEndian.Uint16(bags[b+1]))
+			if from > to || to >= len(gens) {
+				return nil, fmt.Errorf("%w: %s %d has generators %d to %d of %d", ErrInvalidSoundFont, bag, b, from, to, len(gens)-1)
+			}
+
+			z := sfZone{gens: make(map[uint16]int)}
+			for op, value := range global {
+				z.gens[op] = value
+			}
+			ended := false
+			for _, g := range gens[from:to] {
+				op := binary.LittleEndian.Uint16(g)
+				switch op {
+				case genKeyRange, genVelRange, genInstrument, genSampleID:
+					z.gens[op] = int(binary.LittleEndian.Uint16(g[2:]))
+				default:
+					z.gens[op] = int(int16(binary.LittleEndian.Uint16(g[2:])))
+				}
+				ended = op == terminal
+			}
+
+			switch {
+			case ended:
+				zs = append(zs, z)
+			case b == first:
+				global = z.gens
+			}
+		}
+		all = append(all, zs)
+	}
+	return all, nil
+}
+
+// records splits the named chunk into records of size bytes, making sure
+// it holds at least the terminal record that ends every pdta chunk
+func records(chunks map[string][]byte, kind string, size int) ([][]byte, error) {
+
+	body := chunks[kind]
+	if len(body) < size || len(body)%size != 0 {
+		return nil, fmt.Errorf("%w: %s chunk of %d bytes doesn't hold %d byte records", ErrInvalidSoundFont, kind, len(body), size)
+	}
+
+	var rs [][]byte
+	for at := 0; at < len(body); at += size {
+		rs = append(rs, body[at:at+size])
+	}
+	return rs, nil
+}
+
+// forChunks calls fn with the kind and body of each RIFF chunk in data
+func forChunks(data []byte, fn func(kind string, body []byte) error) error {
+
+	for len(data) >= 8 {
+		kind := string(data[0:4])
+		size := binary.LittleEndian.Uint32(data[4:8])
+		if uint64(size) > uint64(len(data)-8) {
+			return fmt.Errorf("%w: %s chunk of %d bytes runs past the end of the file", ErrInvalidSoundFont, kind, size)
+		}
+		if err := fn(kind, data[8:8+size]); err != nil {
+			return err
+		}
+
+		// chunks are padded to an even length
+		data = data[8+size:]
+		if size%2 == 1 && len(data) > 0 {
+			data = data[1:]
+		}
+	}
+	return nil
+}
+
+// clip rounds a mixed value to the nearest 16 bit sample, clipping it to
+// the range one can hold
+func clip(v float64) int16 {
+
+	return int16(math.Max(math.MinInt16, math.Min(math.MaxInt16, math.Round(v))))
+}
+
+func minByte(a, b uint8) uint8 {
+
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxByte(a, b uint8) uint8 {
+
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,207 @@
+package render
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	drum "github.com/chrishiestand/golang-challenge-1-drum_machine"
+)
+
+// chunk returns a RIFF chunk of the given kind holding the fields, written
+// little endian
+func chunk(kind string, fields ...interface{}) []byte {
+
+	var body bytes.Buffer
+	for _, f := range fields {
+		binary.Write(&body, binary.LittleEndian, f)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(kind)
+	binary.Write(&buf, binary.LittleEndian, uint32(body.Len()))
+	buf.Write(body.Bytes())
+	return buf.Bytes()
+}
+
+// name returns a 20 byte SoundFont name field
+func name(s string) [20]byte {
+
+	var b [20]byte
+	copy(b[:], s)
+	return b
+}
+
+type sfGen struct {
+	Op, Amount uint16
+}
+
+type sfHeader struct {
+	Name                        [20]byte
+	Start, End, LoopStart, Loop uint32
+	Rate                        uint32
+	Pitch                       uint8
+	Correction                  int8
+	Link, Type                  uint16
+}
+
+type sfPresetHeader struct {
+	Name                  [20]byte
+	Number, Bank, Bag     uint16
+	Library, Genre, Morph uint32
+}
+
+type sfInstHeader struct {
+	Name [20]byte
+	Bag  uint16
+}
+
+// testSoundFont returns a SoundFont whose one instrument plays the kick's
+// key 36 with a soft sample recorded at half SampleRate, panned left by the
+// instrument's global zone, and a hard one panned right. A piano preset in
+// bank 0 plays it an octave up, and a drums preset in bank 128 as it is.
+func testSoundFont(t *testing.T, instrument uint16) []byte {
+
+	t.Helper()
+
+	pan := func(amount int16) sfGen { return sfGen{genPan, uint16(amount)} }
+	keys := sfGen{genKeyRange, 36 | 36<<8}
+
+	pdta := bytes.Join([][]byte{
+		[]byte("pdta"),
+		chunk("phdr",
+			sfPresetHeader{Name: name("piano"), Bag: 0},
+			sfPresetHeader{Name: name("drums"), Bank: 128, Bag: 1},
+			sfPresetHeader{Name: name("EOP"), Bag: 2}),
+		chunk("pbag", []uint16{0, 0, 2, 0, 3, 0}),
+		chunk("pgen", []sfGen{{genCoarseTune, 12}, {genInstrument, instrument}, {genInstrument, instrument}, {}}),
+		chunk("inst", sfInstHeader{name("kit"), 0}, sfInstHeader{name("EOI"), 3}),
+		chunk("ibag", []uint16{0, 0, 1, 0, 4, 0, 8, 0}),
+		chunk("igen", []sfGen{
+			pan(-500),
+			keys, {genVelRange, 0 | 63<<8}, {genSampleID, 0},
+			keys, {genVelRange, 64 | 127<<8}, pan(500), {genSampleID, 1},
+			{},
+		}),
+		chunk("shdr",
+			sfHeader{Name: name("soft"), Start: 0, End: 4, Rate: SampleRate / 2, Pitch: 36},
+			sfHeader{Name: name("hard"), Start: 4, End: 5, Rate: SampleRate, Pitch: 36},
+			sfHeader{Name: name("EOS")}),
+	}, nil)
+
+	sdta := bytes.Join([][]byte{[]byte("sdta"), chunk("smpl", []int16{1000, 2000, 3000, 4000, 20000})}, nil)
+
+	body := bytes.Join([][]byte{[]byte("sfbk"), chunk("LIST", []byte("INFO")), chunk("LIST", sdta), chunk("LIST", pdta)}, nil)
+	return chunk("RIFF", body)
+}
+
+func TestSoundFont(t *testing.T) {
+
+	f, err := LoadSoundFont(bytes.NewReader(testSoundFont(t, 0)))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	tData := []struct {
+		velocity    uint8
+		left, right []int16
+	}{
+		// resampled from half the rate, each sample is stretched to two
+		{40, []int16{1000, 1500, 2000, 2500, 3000, 3500, 4000, 4000}, []int16{0, 0, 0, 0, 0, 0, 0, 0}},
+		{64, []int16{0}, []int16{20000}},
+		{127, []int16{0}, []int16{20000}},
+	}
+
+	for _, exp := range tData {
+		s, gain, ok := f.Sample("Kick", exp.velocity)
+		if !ok {
+			t.Fatalf("velocity %d: expected a sample for the kick", exp.velocity)
+		}
+		if want := float64(exp.velocity) / 127; gain != want*want {
+			t.Errorf("velocity %d: got gain %v, expected %v", exp.velocity, gain, want*want)
+		}
+		if !equalFrames(s.Left, exp.left) || !equalFrames(s.Right, exp.right) {
+			t.Errorf("velocity %d: got %v, %v, expected %v, %v", exp.velocity, s.Left, s.Right, exp.left, exp.right)
+		}
+	}
+
+	if _, _, ok := f.Sample("snare", 100); ok {
+		t.Errorf("expected no sample for the snare's key")
+	}
+	if _, _, ok := f.Sample("theremin", 100); ok {
+		t.Errorf("expected no sample for an instrument without a key")
+	}
+
+	// the piano preset plays an octave up, undoing the stretch
+	if err := f.UsePreset(0, 0); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if s, _, _ := f.Sample("kick", 1); !equalFrames(s.Left, []int16{1000, 2000, 3000, 4000}) {
+		t.Errorf("expected the soft sample an octave up, got %v", s.Left)
+	}
+	if err := f.UsePreset(1, 1); err == nil {
+		t.Errorf("expected an error for a missing preset")
+	}
+}
+
+func TestRenderWAVSoundFont(t *testing.T) {
+
+	f, err := LoadSoundFont(bytes.NewReader(testSoundFont(t, 0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// at 150 BPM a sixteenth lasts 4410 frames; the kick on step 4 plays
+	// softly enough to pick the soft layer
+	p := drum.NewPattern("render", 150)
+	p.AddInstrument(0, "kick").SetSteps("x---x-----------")
+	if err := p.SetExpression(0, 4, drum.Expression{Velocity: 40}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := RenderWAV(*p, f, &buf); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	rendered, err := LoadSample(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rendered.Left[0] != 0 || rendered.Right[0] != 12400 {
+		t.Errorf("expected the hard layer on the right at velocity 100, got %d, %d", rendered.Left[0], rendered.Right[0])
+	}
+	if rendered.Left[4*4410] != 99 || rendered.Right[4*4410] != 0 {
+		t.Errorf("expected the soft layer on the left at velocity 40, got %d, %d", rendered.Left[4*4410], rendered.Right[4*4410])
+	}
+}
+
+func TestLoadSoundFontInvalid(t *testing.T) {
+
+	good := testSoundFont(t, 0)
+
+	for name, data := range map[string][]byte{
+		"empty":              nil,
+		"wave":               append([]byte("RIFF\x04\x00\x00\x00WAVE"), good[12:]...),
+		"truncated":          good[:len(good)-10],
+		"missing instrument": testSoundFont(t, 5),
+	} {
+		if _, err := LoadSoundFont(bytes.NewReader(data)); !errors.Is(err, ErrInvalidSoundFont) {
+			t.Errorf("%s: expected %v, got %v", name, ErrInvalidSoundFont, err)
+		}
+	}
+}
+
+func equalFrames(a, b []int16) bool {
+
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,86 @@
+package drum
+
+import (
+	"fmt"
+	"math"
+)
+
+// beatSteps returns the number of steps the pattern plays in each beat,
+// stepsPerBeat unless it was decoded or resampled with another resolution
+func (p Pattern) beatSteps() int {
+
+	if p.resolution <= 0 {
+		return stepsPerBeat
+	}
+	return p.resolution
+}
+
+// StepsPerBeat returns the pattern's resolution, the number of steps it
+// plays in each beat: 4 for the sixteenth notes of the original format, 3
+// or 6 for triplets and so on.
+func (p Pattern) StepsPerBeat() int {
+
+	return p.beatSteps()
+}
+
+// WithResolution returns a copy of the pattern resampled to stepsPerBeat
+// steps in each beat and beats beats, so every instrument holds
+// stepsPerBeat*beats steps. Each hit keeps its place in time, moved to the
+// nearest step of the new grid; hits that no longer fit in the loop are
+// dropped, and a longer loop is padded with rests. Going to a finer grid and
+// back gives the original pattern, but hits that fall between the steps of
+// a coarser grid are moved for good, and two hits may merge into one.
+//
+// The new steps no longer fit the 16 a .splice file holds by default, so the
+// result has to be decoded with DecodeOptions.StepsPerInstrument and
+// StepsPerBeat after encoding, unless it happens to keep 16 steps.
+func (p Pattern) WithResolution(stepsPerBeat, beats int) (Pattern, error) {
+
+	if stepsPerBeat < 1 || beats < 1 {
+		return Pattern{}, fmt.Errorf("%w: cannot play %d steps a beat for %d beats", ErrInvalidStep, stepsPerBeat, beats)
+	}
+
+	result := p.Clone()
+	result.resolution = stepsPerBeat
+	scale := float64(stepsPerBeat) / float64(p.beatSteps())
+
+	for i, inst := range p.instruments {
+		steps := make([]byte, stepsPerBeat*beats)
+
+		for s, step := range inst.steps() {
+			if !isOn(step) {
+				continue
+			}
+			if at := int(math.Round(float64(s) * scale)); at < len(steps) {
+				steps[at] = StepOn
+			}
+		}
+
+		result.instruments[i].setSteps(steps)
+	}
+	return result, nil
+}
+
+// beatsPerBar is the number of beats in a bar, the four of the original
+// format's 16 steps
+const beatsPerBar = 4
+
+// Requantize returns a copy of p resampled as WithResolution does to
+// newStepsPerMeasure steps in each bar of four beats: 32 doubles the 16
+// steps of the original format, and 12 maps them onto triplets, each hit
+// snapping to the nearest step. The loop keeps its length in beats, rounded
+// up to a whole beat. newStepsPerMeasure must be a positive multiple of 4,
+// so each beat has a whole number of steps, or an error wrapping
+// ErrInvalidStep is returned.
+func Requantize(p Pattern, newStepsPerMeasure int) (Pattern, error) {
+
+	if newStepsPerMeasure < 1 || newStepsPerMeasure%beatsPerBar != 0 {
+		return Pattern{}, fmt.Errorf("%w: a bar of %d beats can't hold %d steps", ErrInvalidStep, beatsPerBar, newStepsPerMeasure)
+	}
+
+	beats := (p.loopSteps() + p.beatSteps() - 1) / p.beatSteps()
+	if beats == 0 {
+		beats = beatsPerBar
+	}
+	return p.WithResolution(newStepsPerMeasure/beatsPerBar, beats)
+}
@@ -0,0 +1,147 @@
+package drum
+
+import (
+	"bytes"
+	"errors"
+	"path"
+	"testing"
+)
+
+func TestWithResolution(t *testing.T) {
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_1.splice - %v", err)
+	}
+
+	fine, err := decoded.WithResolution(8, 4)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if fine.StepsPerBeat() != 8 || fine.loopSteps() != 32 || fine.Duration() != decoded.Duration() {
+		t.Errorf("got %d steps a beat, %d steps lasting %v, expected 8, 32 and %v",
+			fine.StepsPerBeat(), fine.loopSteps(), fine.Duration(), decoded.Duration())
+	}
+	if got := gridString(fine.instruments[0].steps()); got != "x-------x-------x-------x-------" {
+		t.Errorf("got kick %s", got)
+	}
+
+	back, err := fine.WithResolution(4, 4)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !back.Equal(*decoded) || back.StepsPerBeat() != 4 {
+		t.Errorf("resampling and back changed the pattern:\n%s", back)
+	}
+
+	// the snare's hits on the second and fourth beat keep their place in a
+	// triplet grid, and a bar of 3 beats drops the fourth
+	triplet, err := decoded.WithResolution(3, 3)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got := gridString(triplet.instruments[1].steps()); got != "---x-----" {
+		t.Errorf("got triplet snare %s", got)
+	}
+	if got := gridString(decoded.instruments[1].steps()); got != "----x-------x---" {
+		t.Errorf("WithResolution changed the original snare to %s", got)
+	}
+
+	for _, args := range [][2]int{{0, 4}, {4, 0}, {-3, 4}} {
+		if _, err := decoded.WithResolution(args[0], args[1]); !errors.Is(err, ErrInvalidStep) {
+			t.Errorf("%v: expected %v, got %v", args, ErrInvalidStep, err)
+		}
+	}
+}
+
+func TestVariableLengthRoundTrip(t *testing.T) {
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_2.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_2.splice - %v", err)
+	}
+
+	long, _ := decoded.Repeat(2)
+	triplet, _ := decoded.WithResolution(3, 4)
+	minimal := decoded.Minimize()
+
+	tData := []struct {
+		name string
+		p    Pattern
+		opts DecodeOptions
+	}{
+		{"32 steps", long, DecodeOptions{StepsPerInstrument: 32}},
+		{"32 steps packed", long, DecodeOptions{StepsPerInstrument: 32, StepPacking: PackingBits}},
+		{"triplets packed", triplet, DecodeOptions{StepsPerInstrument: 12, StepsPerBeat: 3, StepPacking: PackingBits}},
+		{"triplets column-major", triplet, DecodeOptions{StepsPerInstrument: 12, StepsPerBeat: 3, Layout: LayoutColumnMajor, InstrumentCount: len(triplet.instruments)}},
+		{"minimized", minimal, DecodeOptions{StepsPerInstrument: minimal.loopSteps()}},
+	}
+
+	for _, exp := range tData {
+		exp.p.packing, exp.p.layout = exp.opts.StepPacking, exp.opts.Layout
+
+		var buf bytes.Buffer
+		if err := exp.p.Encode(&buf); err != nil {
+			t.Errorf("%s: unexpected error encoding %v", exp.name, err)
+			continue
+		}
+
+		got, err := DecodeWithOptions(&buf, exp.opts)
+		if err != nil {
+			t.Errorf("%s: unexpected error decoding %v", exp.name, err)
+			continue
+		}
+		if !got.Equal(exp.p) || got.StepsPerBeat() != exp.p.StepsPerBeat() {
+			t.Errorf("%s: round trip changed the pattern.\nGot:\n%s\nExpected:\n%s", exp.name, got, exp.p)
+		}
+	}
+
+	if minimal.loopSteps() == 16 {
+		t.Errorf("expected Minimize to shorten pattern_2")
+	}
+	var buf bytes.Buffer
+	decoded.Encode(&buf)
+	if _, err := DecodeWithOptions(&buf, DecodeOptions{StepsPerInstrument: -1}); !errors.Is(err, ErrInvalidStep) {
+		t.Errorf("expected %v for a negative step count, got %v", ErrInvalidStep, err)
+	}
+}
+
+func TestRequantize(t *testing.T) {
+
+	p := NewPattern("0.808-alpha", 120)
+	p.AddInstrument(0, "kick").SetSteps("x---x---x---x---")
+	p.AddInstrument(1, "hat").SetSteps("--x---x---x---xx")
+
+	tData := []struct {
+		steps int
+		kick  string
+		hat   string
+	}{
+		{32, "x-------x-------x-------x-------", "----x-------x-------x-------x-x-"},
+		{12, "x--x--x--x--", "--x--x--x--x"},
+		{8, "x-x-x-x-", "-x-x-x-x"},
+		{16, "x---x---x---x---", "--x---x---x---xx"},
+	}
+
+	for _, exp := range tData {
+		q, err := Requantize(*p, exp.steps)
+		if err != nil {
+			t.Fatalf("%d: unexpected error %v", exp.steps, err)
+		}
+		if got := gridString(q.instruments[0].steps()); got != exp.kick {
+			t.Errorf("%d: got kick %s, expected %s", exp.steps, got, exp.kick)
+		}
+		if got := gridString(q.instruments[1].steps()); got != exp.hat {
+			t.Errorf("%d: got hat %s, expected %s", exp.steps, got, exp.hat)
+		}
+		if q.Duration() != p.Duration() {
+			t.Errorf("%d: the loop lasts %v, expected %v", exp.steps, q.Duration(), p.Duration())
+		}
+	}
+
+	for _, steps := range []int{0, -4, 10} {
+		if _, err := Requantize(*p, steps); !errors.Is(err, ErrInvalidStep) {
+			t.Errorf("%d: expected %v, got %v", steps, ErrInvalidStep, err)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Package rpc implements the calls of the DrumMachine service defined in
+// drum.proto, a wire protocol for decoding, encoding, rendering and playing
+// patterns from other languages. Service holds the logic, in terms of this
+// package's message types, which mirror the proto messages field for field.
+// No generated bindings or server are included; a server built from
+// drum.proto would convert its messages and call Service.
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	drum "github.com/chrishiestand/golang-challenge-1-drum_machine"
+	"github.com/chrishiestand/golang-challenge-1-drum_machine/render"
+)
+
+// Pattern is the Pattern message
+type Pattern struct {
+	Version     string
+	Tempo       float32
+	Instruments []Instrument
+}
+
+// Instrument is the Instrument message, with the steps in play order and
+// true for a hit
+type Instrument struct {
+	ID    uint32
+	Name  string
+	Steps []bool
+}
+
+// StepEvent is the StepEvent message Sequence streams for each hit
+type StepEvent struct {
+	InstrumentID uint32
+	Instrument   string
+	Step         int32
+	TimeUnixNano int64
+	Velocity     uint32
+}
+
+// Service carries out the DrumMachine calls, rendering with the samples in
+// kit. It's safe for use by several goroutines.
+type Service struct {
+	kit render.SampleKit
+}
+
+// NewService returns a Service rendering with the samples in kit
+func NewService(kit render.SampleKit) *Service {
+
+	return &Service{kit: kit}
+}
+
+// Decode parses the bytes of a .splice file
+func (s *Service) Decode(ctx context.Context, splice []byte) (Pattern, error) {
+
+	p, err := drum.DecodeWithOptions(bytes.NewReader(splice), drum.DecodeOptions{Strict: true})
+	if err != nil {
+		return Pattern{}, err
+	}
+	return FromPattern(p), nil
+}
+
+// Encode writes p as the bytes of a .splice file
+func (s *Service) Encode(ctx context.Context, p Pattern) ([]byte, error) {
+
+	decoded, err := p.Pattern()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := decoded.Encode(&buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Render mixes the service's samples into a WAV file of one loop of p,
+// giving up with ctx's error once ctx is done
+func (s *Service) Render(ctx context.Context, p Pattern) ([]byte, error) {
+
+	decoded, err := p.Pattern()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := render.RenderWAVContext(ctx, decoded, s.kit, &buf, render.RenderOptions{}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Sequence plays p in real time with a drum.Sequencer, at tempo if it's
+// positive, passing each hit to send as it comes due. It returns once loops
+// loops have played, or one if loops is zero, or with ctx's error once ctx
+// is done, or with the error send returns.
+func (s *Service) Sequence(ctx context.Context, p Pattern, tempo float32, loops uint32, send func(StepEvent) error) error {
+
+	decoded, err := p.Pattern()
+	if err != nil {
+		return err
+	}
+	if loops == 0 {
+		loops = 1
+	}
+
+	seq := drum.NewSequencer(decoded)
+	if tempo > 0 {
+		if err := seq.SetTempo(tempo); err != nil {
+			return err
+		}
+	}
+	return seq.PlayLoops(ctx, int(loops), func(e drum.StepEvent) error {
+		return send(fromEvent(e))
+	})
+}
+
+// FromPattern returns the Pattern message for p
+func FromPattern(p drum.Pattern) Pattern {
+
+	m := Pattern{Version: p.Version(), Tempo: p.Tempo(), Instruments: []Instrument{}}
+	for _, inst := range p.Instruments() {
+		m.Instruments = append(m.Instruments, Instrument{ID: inst.ID(), Name: inst.Name(), Steps: inst.Steps()})
+	}
+	return m
+}
+
+// Pattern returns the pattern the message describes. Every instrument must
+// have its own id and the same number of steps.
+func (m Pattern) Pattern() (drum.Pattern, error) {
+
+	p := drum.NewPattern(m.Version, m.Tempo)
+	seen := make(map[uint32]bool)
+
+	for i, inst := range m.Instruments {
+		if seen[inst.ID] {
+			return drum.Pattern{}, fmt.Errorf("instrument %d: %w: %d", i, drum.ErrDuplicateID, inst.ID)
+		}
+		seen[inst.ID] = true
+
+		p.AddInstrument(inst.ID, inst.Name)
+		if i == 0 {
+			if err := p.Resize(len(inst.Steps)); err != nil {
+				return drum.Pattern{}, err
+			}
+		}
+		if err := p.SetSteps(inst.ID, inst.Steps); err != nil {
+			return drum.Pattern{}, fmt.Errorf("instrument %d: %w", i, err)
+		}
+	}
+	return *p, nil
+}
+
+// fromEvent returns the StepEvent message for e
+func fromEvent(e drum.StepEvent) StepEvent {
+
+	return StepEvent{
+		InstrumentID: e.Instrument.ID(),
+		Instrument:   e.Instrument.Name(),
+		Step:         int32(e.StepIndex),
+		TimeUnixNano: e.Time.UnixNano(),
+		Velocity:     uint32(e.Velocity),
+	}
+}
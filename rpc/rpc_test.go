@@ -0,0 +1,112 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	drum "github.com/chrishiestand/golang-challenge-1-drum_machine"
+	"github.com/chrishiestand/golang-challenge-1-drum_machine/render"
+)
+
+func fixture(t *testing.T, name string) []byte {
+
+	data, err := ioutil.ReadFile(filepath.Join("..", "fixtures", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDecodeEncode(t *testing.T) {
+
+	s := NewService(nil)
+	data := fixture(t, "pattern_1.splice")
+
+	p, err := s.Decode(context.Background(), data)
+	if err != nil {
+		t.Fatalf("decode: unexpected error %v", err)
+	}
+	if p.Version != "0.808-alpha" || p.Tempo != 120 || len(p.Instruments) != 6 {
+		t.Errorf("decode: got version %q at %v with %d instruments", p.Version, p.Tempo, len(p.Instruments))
+	}
+	if kick := p.Instruments[0]; kick.Name != "kick" || len(kick.Steps) != 16 || !kick.Steps[0] || kick.Steps[1] {
+		t.Errorf("decode: unexpected first instrument %+v", kick)
+	}
+
+	encoded, err := s.Encode(context.Background(), p)
+	if err != nil {
+		t.Fatalf("encode: unexpected error %v", err)
+	}
+	if string(encoded) != string(data) {
+		t.Errorf("encode: expected the fixture's bytes back")
+	}
+
+	if _, err := s.Decode(context.Background(), data[:20]); !errors.Is(err, drum.ErrTruncated) {
+		t.Errorf("decode: expected ErrTruncated for a cut short file, got %v", err)
+	}
+
+	uneven := Pattern{Version: "x", Tempo: 120, Instruments: []Instrument{{ID: 0, Steps: make([]bool, 16)}, {ID: 1, Steps: make([]bool, 8)}}}
+	if _, err := s.Encode(context.Background(), uneven); err == nil {
+		t.Errorf("encode: expected an error for instruments of different lengths")
+	}
+	shared := Pattern{Version: "x", Tempo: 120, Instruments: []Instrument{{ID: 3, Steps: make([]bool, 16)}, {ID: 3, Steps: make([]bool, 16)}}}
+	if _, err := s.Encode(context.Background(), shared); !errors.Is(err, drum.ErrDuplicateID) {
+		t.Errorf("encode: expected ErrDuplicateID, got %v", err)
+	}
+}
+
+func TestRender(t *testing.T) {
+
+	p := Pattern{Version: "x", Tempo: 120, Instruments: []Instrument{{ID: 0, Name: "kick", Steps: []bool{true, false, false, false}}}}
+
+	kit := render.SampleKit{"kick": render.Sample{Left: []int16{1000, 500}, Right: []int16{1000, 500}}}
+	wav, err := NewService(kit).Render(context.Background(), p)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(wav) < 44 || string(wav[:4]) != "RIFF" {
+		t.Errorf("expected a WAV file, got %d bytes", len(wav))
+	}
+
+	if _, err := NewService(nil).Render(context.Background(), p); err == nil {
+		t.Errorf("expected an error rendering without a kick sample")
+	}
+}
+
+func TestSequence(t *testing.T) {
+
+	p := Pattern{Version: "x", Tempo: 6000, Instruments: []Instrument{
+		{ID: 0, Name: "kick", Steps: []bool{true, false, false, false, true, false, false, false}},
+	}}
+
+	var events []StepEvent
+	err := NewService(nil).Sequence(context.Background(), p, 0, 2, func(e StepEvent) error {
+		events = append(events, e)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	steps := []int32{0, 4, 0, 4}
+	if len(events) != len(steps) {
+		t.Fatalf("expected %d events, got %v", len(steps), events)
+	}
+	for i, step := range steps {
+		if events[i].Step != step || events[i].Instrument != "kick" || events[i].Velocity != 100 {
+			t.Errorf("event %d: got %+v, expected the kick on step %d", i, events[i], step)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err = NewService(nil).Sequence(ctx, p, 0, 1000, func(StepEvent) error {
+		cancel()
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the cancelled context's error, got %v", err)
+	}
+}
@@ -0,0 +1,604 @@
+package drum
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// StepEvent is a hit played by a Sequencer, or one Stroke of a ratcheted or
+// flammed hit: the instrument that plays it, the step of the instrument's
+// loop it belongs to, when it was due, counting its Expression offset, and
+// the velocity it's played at. The instrument's Gain is left for whatever
+// plays the event to apply.
+type StepEvent struct {
+	Instrument Instrument
+	StepIndex  int
+	Time       time.Time
+	Velocity   uint8
+}
+
+// Sequencer plays a pattern in real time, looping it at its tempo and
+// sending a StepEvent for every hit as its step comes due, at the pattern's
+// resolution, leaving out instruments that aren't Audible. One made by
+// NewSongSequencer plays a Song's chain instead. A Sequencer is safe for
+// use by several goroutines, and its pattern can be edited with Update
+// while it plays.
+type Sequencer struct {
+	mu       sync.Mutex
+	pattern  Pattern
+	tempo    float32
+	position int
+	events   chan StepEvent
+	stop     chan struct{}
+	done     chan struct{}
+	// outputs are called with every event before it's sent, and closers
+	// are what Close closes
+	outputs []func(StepEvent)
+	closers []io.Closer
+	// bus passes what's played to its subscribers, and played is the tempo
+	// the last step played at, or 0 before the first
+	bus    EventBus
+	played float32
+	// clock is where MIDI clock messages are written, if anywhere
+	clock io.Writer
+	// editing is held through Update so edits don't overwrite each other
+	editing sync.Mutex
+	// song is the song being played, if any, with the chain entry playing
+	// and the number of times its pattern has looped so far
+	song   *Song
+	entry  int
+	repeat int
+	// loops is the number of loops played since the sequencer was stopped,
+	// and cycle the number of steps played since the pattern playing began,
+	// which instruments shorter than the loop cycle through on their own
+	loops int
+	cycle int
+	// pending is the pattern WatchFile last read, waiting for the loop to
+	// come round before it plays
+	pending *Pattern
+}
+
+// NewSequencer returns a stopped Sequencer for a copy of p, so later changes
+// to p aren't played.
+func NewSequencer(p Pattern) *Sequencer {
+
+	return &Sequencer{pattern: p.Clone(), tempo: p.tempo, events: make(chan StepEvent)}
+}
+
+// NewSongSequencer returns a stopped Sequencer for a copy of s, which plays
+// its chain from the first entry and loops back to it at the end. Each
+// pattern follows on from the last without a gap and plays at its own
+// tempo. It returns an error if the chain is invalid or names a pattern
+// without steps.
+func NewSongSequencer(s Song) (*Sequencer, error) {
+
+	if err := s.check(); err != nil {
+		return nil, err
+	}
+	for i, e := range s.Chain {
+		if s.Patterns[e.Pattern].loopSteps() == 0 {
+			return nil, fmt.Errorf("%w: chain entry %d plays pattern %d, which has no steps", ErrInvalidStep, i, e.Pattern)
+		}
+	}
+
+	song := s.Clone()
+	for i := range song.Patterns {
+		song.Patterns[i].onChange = nil
+	}
+	first := song.Patterns[song.Chain[0].Pattern]
+
+	return &Sequencer{pattern: first, tempo: first.tempo, events: make(chan StepEvent), song: &song}, nil
+}
+
+// Events returns the channel hits are sent on, in the order they're due.
+// Hits due at the same time are sent in instrument order, and a hit with a
+// negative Expression offset is sent before the step it belongs to begins.
+// The sequencer waits for each event to be received, so a slow reader holds
+// playback back, and the channel must be read even when the hits are also
+// sent elsewhere, such as by SendOSC. The channel is never closed, since a
+// stopped sequencer can be started again.
+func (s *Sequencer) Events() <-chan StepEvent {
+
+	return s.events
+}
+
+// Start starts playing from the current step: the first step after Stop,
+// or where playback left off after Pause. Starting a sequencer that's
+// already playing does nothing. It returns an error if the pattern has no
+// steps to play.
+func (s *Sequencer) Start() error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stop != nil {
+		return nil
+	}
+	if s.pattern.loopSteps() == 0 {
+		return fmt.Errorf("%w: the pattern has no steps to play", ErrInvalidStep)
+	}
+	if !(s.tempo > 0) {
+		return fmt.Errorf("cannot play at a tempo of %v", s.tempo)
+	}
+
+	if s.clock != nil {
+		if s.position == 0 {
+			s.clock.Write([]byte{midiStart})
+		} else {
+			s.clock.Write([]byte{midiContinue})
+		}
+	}
+
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.run(s.stop, s.done)
+	return nil
+}
+
+// StartContext starts playing as Start does, and stops playing as Stop
+// does once ctx is done, unless playback has been paused or stopped, and
+// perhaps started again, in the meantime. It returns the context's error
+// without starting if ctx is already done.
+func (s *Sequencer) StartContext(ctx context.Context) error {
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := s.Start(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	stop := s.stop
+	s.mu.Unlock()
+	if stop == nil {
+		return nil
+	}
+
+	go func() {
+
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			playing := s.stop == stop
+			s.mu.Unlock()
+			if playing {
+				s.Stop()
+			}
+		case <-stop:
+		}
+	}()
+	return nil
+}
+
+// PlayLoops starts playing, as StartContext does, and passes each event to
+// fn until the pattern has come round loops times, counting those it
+// comes round to from wherever it starts, then stops playing as Stop
+// does. Loops are counted as they play, with Bus().OnPatternLoop, so muted
+// instruments, ratchets and instruments shorter than the loop are all
+// played as they are and a pattern that sends no events at all still
+// plays for as long. It returns with ctx's error once ctx is done, or with
+// the error fn returns.
+func (s *Sequencer) PlayLoops(ctx context.Context, loops int, fn func(e StepEvent) error) error {
+
+	if loops < 1 {
+		return fmt.Errorf("cannot play %d loops", loops)
+	}
+
+	done := make(chan struct{})
+	played := 0
+	cancel := s.bus.OnPatternLoop(func(LoopEvent) {
+
+		if played++; played == loops {
+			close(done)
+		}
+	})
+	defer cancel()
+
+	if err := s.StartContext(ctx); err != nil {
+		return err
+	}
+	defer s.Stop()
+
+	for {
+		select {
+		case e := <-s.events:
+			if err := fn(e); err != nil {
+				return err
+			}
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Pause stops playing, keeping the current step so that Start carries on
+// from it. It returns once no more events will be sent.
+func (s *Sequencer) Pause() {
+
+	s.mu.Lock()
+	stop, done := s.stop, s.done
+	s.stop, s.done = nil, nil
+	s.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+
+		s.mu.Lock()
+		if s.clock != nil {
+			s.clock.Write([]byte{midiStop})
+		}
+		s.swapPending()
+		s.mu.Unlock()
+	}
+}
+
+// Stop stops playing and rewinds to the first step, and when playing a
+// song to the first entry of its chain, at the tempo of its pattern.
+func (s *Sequencer) Stop() {
+
+	s.Pause()
+
+	s.mu.Lock()
+	s.position = 0
+	s.loops, s.cycle = 0, 0
+	if s.song != nil {
+		s.entry, s.repeat = 0, 0
+		s.pattern = s.song.Patterns[s.song.Chain[0].Pattern]
+		s.tempo = s.pattern.tempo
+	}
+	s.mu.Unlock()
+}
+
+// Close stops playing, as Stop does, and closes the connections opened for
+// the sequencer's outputs, such as by SendOSC, which are then no longer sent
+// to. It returns the first error closing them.
+func (s *Sequencer) Close() error {
+
+	s.Stop()
+
+	s.mu.Lock()
+	closers := s.closers
+	s.outputs, s.closers = nil, nil
+	s.mu.Unlock()
+
+	var first error
+	for _, c := range closers {
+		if err := c.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Pattern returns a copy of the pattern the sequencer plays, with any edits
+// made through it
+func (s *Sequencer) Pattern() Pattern {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pattern.Clone()
+}
+
+// Playing reports whether the sequencer is playing, started and neither
+// paused nor stopped since
+func (s *Sequencer) Playing() bool {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stop != nil
+}
+
+// Tempo returns the tempo the sequencer plays at, as set by SetTempo or
+// the pattern playing
+func (s *Sequencer) Tempo() float32 {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tempo
+}
+
+// Position returns the step of the loop the sequencer plays next
+func (s *Sequencer) Position() int {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.position
+}
+
+// Update edits the pattern the sequencer plays by calling edit with a copy
+// of it, which replaces the pattern if edit returns nil. It's safe to call
+// while playing: the step being played finishes as it was and the edit is
+// heard from the next. If edit returns an error, or leaves the pattern
+// without steps, the pattern is left as it was and the error returned. A
+// pattern made shorter carries on from the same step if it still has it,
+// and from the first step otherwise. The sequencer's tempo is set by
+// SetTempo, not by the pattern's. When playing a song the edit is kept for
+// every later loop of the same pattern; one made to a pattern that
+// finished playing while edit ran is kept for its next turn in the chain.
+func (s *Sequencer) Update(edit func(p *Pattern) error) error {
+
+	s.editing.Lock()
+	defer s.editing.Unlock()
+
+	s.mu.Lock()
+	p := s.pattern.Clone()
+	index := s.songPattern()
+	s.mu.Unlock()
+
+	if err := edit(&p); err != nil {
+		return err
+	}
+	if p.loopSteps() == 0 {
+		return fmt.Errorf("%w: the pattern has no steps to play", ErrInvalidStep)
+	}
+	p.onChange = nil
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.song != nil {
+		s.song.Patterns[index] = p
+		if s.songPattern() != index {
+			return nil
+		}
+	}
+	s.pattern = p
+	if s.position >= p.loopSteps() {
+		s.position = 0
+	}
+	return nil
+}
+
+// songPattern returns the index into the song of the pattern playing, or
+// -1 if the sequencer isn't playing a song. It's called with mu held.
+func (s *Sequencer) songPattern() int {
+
+	if s.song == nil {
+		return -1
+	}
+	return s.song.Chain[s.entry].Pattern
+}
+
+// nextLoop moves on through the song's chain as the pattern playing comes
+// round to its first step, switching to the next entry's pattern and its
+// tempo once the current one has played its repeats. It's called with mu
+// held.
+func (s *Sequencer) nextLoop() {
+
+	s.repeat++
+	if s.repeat < s.song.Chain[s.entry].Repeats {
+		return
+	}
+
+	s.entry = (s.entry + 1) % len(s.song.Chain)
+	s.repeat = 0
+	s.pattern = s.song.Patterns[s.song.Chain[s.entry].Pattern]
+	s.tempo = s.pattern.tempo
+	s.cycle = 0
+}
+
+// swapPending replaces the pattern playing with the one waiting for it, if
+// any, starting it from the beginning of its cycle. It's called with mu
+// held.
+func (s *Sequencer) swapPending() {
+
+	if s.pending == nil {
+		return
+	}
+	s.pattern, s.pending = *s.pending, nil
+	s.cycle = 0
+	if s.position >= s.pattern.loopSteps() {
+		s.position = 0
+	}
+}
+
+// UpdateStep turns a step of the instrument with the given id on or off, as
+// Pattern.SetStep does, while playing or not, as Update does.
+func (s *Sequencer) UpdateStep(id uint32, step int, on bool) error {
+
+	return s.Update(func(p *Pattern) error {
+		return p.SetStep(id, step, on)
+	})
+}
+
+// addOutput registers fn to be called with every event before it's sent,
+// and c, if it isn't nil, to be closed by Close
+func (s *Sequencer) addOutput(fn func(StepEvent), c io.Closer) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.outputs = append(s.outputs, fn)
+	if c != nil {
+		s.closers = append(s.closers, c)
+	}
+}
+
+// OnStep registers fn to be called as each step begins, before any of its
+// hits are sent, with a copy of the pattern being played and the step. It's
+// called on every step, with hits or without, so it suits things that
+// follow the playhead, and it's called from the goroutine playing the
+// steps, so it should return quickly. It's the same as subscribing with
+// Bus().OnStep, without a way to cancel.
+func (s *Sequencer) OnStep(fn func(p Pattern, step int)) {
+
+	s.bus.OnStep(fn)
+}
+
+// Bus returns the EventBus that passes the sequencer's steps, hits, loops
+// and tempo changes to its subscribers
+func (s *Sequencer) Bus() *EventBus {
+
+	return &s.bus
+}
+
+// SetTempo changes the tempo the sequencer plays at, taking effect from the
+// next step, even while playing. The pattern's own tempo is unchanged. When
+// playing a song the tempo lasts until the next entry of the chain begins.
+func (s *Sequencer) SetTempo(bpm float32) error {
+
+	if !(bpm > 0) {
+		return fmt.Errorf("cannot play at a tempo of %v", bpm)
+	}
+
+	s.mu.Lock()
+	s.tempo = bpm
+	s.mu.Unlock()
+	return nil
+}
+
+// run plays steps until stop is closed, then closes done
+func (s *Sequencer) run(stop <-chan struct{}, done chan<- struct{}) {
+
+	defer close(done)
+
+	due := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-timer.C:
+		}
+
+		// edits take effect from the next step, as each plays the pattern
+		// as it was when it began
+		s.mu.Lock()
+		p := s.pattern
+		step := s.position % p.loopSteps()
+		cycle := s.cycle
+		s.cycle++
+		tempo := TempoChange{From: s.played, To: s.tempo}
+		s.played = s.tempo
+		loop := LoopEvent{Pattern: p, Loops: s.loops, Entry: -1}
+		if s.song != nil {
+			loop.Entry = s.entry
+		}
+		interval := time.Duration(float64(time.Minute) / float64(s.tempo) / float64(p.beatSteps()))
+		s.position = (step + 1) % p.loopSteps()
+		if s.position == 0 {
+			s.loops++
+			if s.song != nil {
+				s.nextLoop()
+			}
+			s.swapPending()
+		}
+		next, nextStep, nextCycle := s.pattern, s.position, s.cycle
+		clock := s.clock
+		s.mu.Unlock()
+
+		if tempo.From != 0 {
+			s.bus.publishTempo(tempo)
+		}
+		if step == 0 && loop.Loops > 0 {
+			s.bus.publishLoop(loop)
+		}
+		s.bus.publishStep(p, step)
+
+		// this step's hits that play on or after it, and the next step's
+		// that play early, all fall before the next step begins
+		var cues []cue
+		for _, e := range stepHits(p, step, cycle, due, interval, false) {
+			cues = append(cues, cue{at: e.Time, event: e})
+		}
+		for _, e := range stepHits(next, nextStep, nextCycle, due.Add(interval), interval, true) {
+			cues = append(cues, cue{at: e.Time, event: e})
+		}
+		if clock != nil {
+			cues = append(cues, clockCues(p, step, due, interval)...)
+		}
+		sort.SliceStable(cues, func(a, b int) bool {
+			if cues[a].at.Equal(cues[b].at) {
+				return cues[a].clock && !cues[b].clock
+			}
+			return cues[a].at.Before(cues[b].at)
+		})
+
+		for _, c := range cues {
+			if wait := time.Until(c.at); wait > 0 {
+				timer.Reset(wait)
+				select {
+				case <-stop:
+					return
+				case <-timer.C:
+				}
+			}
+
+			if c.clock {
+				clock.Write([]byte{midiClock})
+				continue
+			}
+
+			s.mu.Lock()
+			outputs := s.outputs
+			s.mu.Unlock()
+			for _, fn := range outputs {
+				fn(c.event)
+			}
+			s.bus.publishHit(c.event)
+
+			select {
+			case s.events <- c.event:
+			case <-stop:
+				return
+			}
+		}
+
+		due = due.Add(interval)
+		timer.Reset(time.Until(due))
+	}
+}
+
+// cue is something the sequencer does at a given time while playing a
+// step: send an event, or write a MIDI clock message
+type cue struct {
+	at    time.Time
+	event StepEvent
+	clock bool
+}
+
+// stepHits returns the events for the strokes of the hits of p's audible
+// instruments on step, which is due at start, whose offsets are negative if
+// early is set and otherwise not. Instruments shorter than the loop play
+// the step of their own cycle that cycle, the steps played since p began,
+// falls on.
+func stepHits(p Pattern, step, cycle int, start time.Time, interval time.Duration, early bool) []StepEvent {
+
+	var events []StepEvent
+	soloing := p.soloing()
+	loop := p.loopSteps()
+
+	for _, inst := range p.instruments {
+		if !p.audible(inst, soloing) {
+			continue
+		}
+		own := inst.cycleStep(step, cycle, loop)
+		if value, err := inst.step(own); err != nil || !isOn(value) {
+			continue
+		}
+
+		for _, stroke := range inst.expressionAt(own).Strokes() {
+			if (stroke.Offset < 0) != early {
+				continue
+			}
+
+			events = append(events, StepEvent{
+				Instrument: inst.clone(),
+				StepIndex:  own,
+				Time:       start.Add(time.Duration(stroke.Offset * float64(interval))),
+				Velocity:   stroke.Velocity,
+			})
+		}
+	}
+	return events
+}
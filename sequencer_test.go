@@ -0,0 +1,211 @@
+package drum
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestSequencer(t *testing.T) {
+
+	p := NewPattern("seq", 6000)
+	p.AddInstrument(0, "kick").SetSteps("x-------x-------")
+	p.AddInstrument(1, "hat").SetSteps("x---x---x---x---")
+
+	s := NewSequencer(*p)
+	p.SetTempo(1)
+
+	if err := s.Start(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	expected := []struct {
+		name string
+		step int
+	}{{"kick", 0}, {"hat", 0}, {"hat", 4}, {"kick", 8}, {"hat", 8}, {"hat", 12}, {"kick", 0}, {"hat", 0}}
+
+	var last time.Time
+	for n, exp := range expected {
+		e := <-s.Events()
+		if e.Instrument.name != exp.name || e.StepIndex != exp.step {
+			t.Fatalf("event %d: got %s on step %d, expected %s on step %d", n, e.Instrument.name, e.StepIndex, exp.name, exp.step)
+		}
+		if e.Time.Before(last) {
+			t.Errorf("event %d is due at %v, before the event before it at %v", n, e.Time, last)
+		}
+		last = e.Time
+	}
+
+	// the next hit is the hat on step 4, a step at 6000 BPM being 2.5ms
+	s.Pause()
+	select {
+	case e := <-s.Events():
+		t.Fatalf("got %+v after pausing", e)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	if err := s.SetTempo(0); err == nil {
+		t.Errorf("expected an error for a zero tempo")
+	}
+	if err := s.SetTempo(12000); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	s.Start()
+	s.Start()
+	if e := <-s.Events(); e.StepIndex != 4 {
+		t.Errorf("expected to resume on step 4, got step %d", e.StepIndex)
+	}
+
+	s.Stop()
+	s.Start()
+	if e := <-s.Events(); e.StepIndex != 0 || e.Instrument.name != "kick" {
+		t.Errorf("expected to restart with the kick on step 0, got %s on step %d", e.Instrument.name, e.StepIndex)
+	}
+	s.Stop()
+
+	if err := NewSequencer(Pattern{tempo: 120}).Start(); err == nil {
+		t.Errorf("expected an error starting a pattern without steps")
+	}
+}
+
+func TestSequencerUpdate(t *testing.T) {
+
+	p := NewPattern("seq", 6000)
+	p.AddInstrument(0, "kick").SetSteps("x---------------")
+	p.AddInstrument(1, "hat").SetSteps("----------------")
+
+	s := NewSequencer(*p)
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	if e := <-s.Events(); e.StepIndex != 0 {
+		t.Fatalf("expected the kick on step 0, got step %d", e.StepIndex)
+	}
+
+	// edit while playing, from several goroutines at once
+	done := make(chan error)
+	for step := 2; step < 16; step += 2 {
+		go func(step int) { done <- s.UpdateStep(1, step, true) }(step)
+	}
+	for step := 2; step < 16; step += 2 {
+		if err := <-done; err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+
+	if got := s.Pattern().Instruments()[1].Line('x', '-'); got != "(1) hat\t|--x-|x-x-|x-x-|x-x-|" {
+		t.Errorf("expected every edit to be kept, got %s", got)
+	}
+
+	hats := 0
+	for hats < 7 {
+		if e := <-s.Events(); e.Instrument.name == "hat" {
+			hats++
+		}
+	}
+
+	if err := s.UpdateStep(9, 0, true); err == nil {
+		t.Errorf("expected an error for an unknown instrument")
+	}
+	if err := s.Update(func(p *Pattern) error { p.instruments = nil; return nil }); err == nil {
+		t.Errorf("expected an error for a pattern without steps")
+	}
+	if len(s.Pattern().Instruments()) != 2 {
+		t.Errorf("expected a failed update to leave the pattern as it was")
+	}
+
+	// a shorter pattern plays from its start
+	shorten := func(p *Pattern) error {
+		for i := range p.instruments {
+			p.instruments[i].resize(4)
+		}
+		return nil
+	}
+	if err := s.Update(shorten); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	for n := 0; n < 8; n++ {
+		if e := <-s.Events(); e.StepIndex >= 4 {
+			t.Fatalf("got step %d of a 4 step pattern", e.StepIndex)
+		}
+	}
+}
+
+func TestSequencerStartContext(t *testing.T) {
+
+	p := NewPattern("seq", 6000)
+	p.AddInstrument(0, "kick").SetSteps("x---x---x---x---")
+	s := NewSequencer(*p)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	if err := s.StartContext(ctx); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	<-s.Events()
+	<-s.Events()
+
+	cancel()
+	deadline := time.After(time.Second)
+	for s.Playing() || s.Position() != 0 {
+		select {
+		case <-s.Events():
+		case <-time.After(time.Millisecond):
+		case <-deadline:
+			t.Fatal("still playing after the context was canceled")
+		}
+	}
+
+	if err := s.StartContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected %v starting with a canceled context, got %v", context.Canceled, err)
+	}
+	if s.Playing() {
+		t.Errorf("expected not to start with a canceled context")
+	}
+}
+
+func TestSequencerPlayLoops(t *testing.T) {
+
+	p := NewPattern("seq", 6000)
+	p.AddInstrument(0, "kick").SetSteps("x---x---x---x---")
+	p.AddInstrument(1, "hat").SetSteps("x-x-x-x-x-x-x-x-")
+	p.SetMuted(1, true)
+	p.SetRatchet(0, 4, 2)
+
+	var hits int
+	if err := NewSequencer(*p).PlayLoops(context.Background(), 3, func(StepEvent) error {
+		hits++
+		return nil
+	}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if hits != 3*5 {
+		t.Errorf("expected 5 strokes a loop over 3 loops, got %d", hits)
+	}
+
+	// a pattern that sends nothing still plays its loops and returns
+	p.SetMuted(0, true)
+	done := make(chan error)
+	go func() {
+
+		done <- NewSequencer(*p).PlayLoops(context.Background(), 2, func(e StepEvent) error {
+			return fmt.Errorf("unexpected event %+v", e)
+		})
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("still playing a silent pattern")
+	}
+
+	if err := NewSequencer(*p).PlayLoops(context.Background(), 0, nil); err == nil {
+		t.Errorf("expected an error playing no loops")
+	}
+}
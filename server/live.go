@@ -0,0 +1,237 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+
+	drum "github.com/chrishiestand/golang-challenge-1-drum_machine"
+)
+
+// sendBuffer is the number of messages queued for a client before more
+// are dropped
+const sendBuffer = 256
+
+// The messages /ws sends
+type (
+	stepMessage struct {
+		Type string `json:"type"`
+		Step int    `json:"step"`
+	}
+
+	hitMessage struct {
+		Type       string `json:"type"`
+		ID         uint32 `json:"id"`
+		Instrument string `json:"instrument"`
+		Step       int    `json:"step"`
+		Velocity   uint8  `json:"velocity"`
+	}
+
+	transportMessage struct {
+		Type     string  `json:"type"`
+		Playing  bool    `json:"playing"`
+		Tempo    float32 `json:"tempo"`
+		Position int     `json:"position"`
+	}
+
+	patternMessage struct {
+		Type    string       `json:"type"`
+		Pattern drum.Pattern `json:"pattern"`
+	}
+
+	errorMessage struct {
+		Type  string `json:"type"`
+		Error string `json:"error"`
+	}
+)
+
+// clientMessage is a message sent to /ws: a "toggle" of the step of the
+// instrument with the given id, which sets it to On if that's given, or a
+// request for the "transport" state
+type clientMessage struct {
+	Type string  `json:"type"`
+	ID   *uint32 `json:"id"`
+	Step *int    `json:"step"`
+	On   *bool   `json:"on"`
+}
+
+// client is a connection to /ws and the messages queued for it
+type client struct {
+	conn *wsConn
+	// mu guards send, which is closed once the client leaves
+	mu     sync.Mutex
+	send   chan []byte
+	closed bool
+}
+
+// Attach has /ws follow seq, which it streams the playback of and edits
+// the pattern of. It should be called before the server handles requests.
+func (s *Server) Attach(seq *drum.Sequencer) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq = seq
+}
+
+// sequencer returns the attached sequencer, or nil
+func (s *Server) sequencer() *drum.Sequencer {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seq
+}
+
+// live streams the attached sequencer over a WebSocket until the client
+// closes it
+func (s *Server) live(w http.ResponseWriter, r *http.Request) {
+
+	seq := s.sequencer()
+	if seq == nil {
+		http.Error(w, "no sequencer is attached", http.StatusNotFound)
+		return
+	}
+
+	conn, err := upgrade(w, r)
+	if err != nil {
+		return
+	}
+	c := &client{conn: conn, send: make(chan []byte, sendBuffer)}
+	go c.write()
+
+	s.clientsMu.Lock()
+	if s.clients == nil {
+		s.clients = make(map[*client]struct{})
+	}
+	s.clients[c] = struct{}{}
+	s.clientsMu.Unlock()
+
+	transport := func() {
+		c.queue(transportMessage{Type: "transport", Playing: seq.Playing(), Tempo: seq.Tempo(), Position: seq.Position()})
+	}
+	bus := seq.Bus()
+	cancels := []func(){
+		bus.OnStep(func(_ drum.Pattern, step int) {
+			c.queue(stepMessage{Type: "step", Step: step})
+		}),
+		bus.OnHit(func(e drum.StepEvent) {
+			c.queue(hitMessage{Type: "hit", ID: e.Instrument.ID(), Instrument: e.Instrument.Name(),
+				Step: e.StepIndex, Velocity: e.Velocity})
+		}),
+		bus.OnTempoChange(func(drum.TempoChange) { transport() }),
+		bus.OnPatternLoop(func(drum.LoopEvent) { transport() }),
+	}
+
+	c.queue(patternMessage{Type: "pattern", Pattern: seq.Pattern()})
+	transport()
+
+	defer func() {
+		for _, cancel := range cancels {
+			cancel()
+		}
+		s.clientsMu.Lock()
+		delete(s.clients, c)
+		s.clientsMu.Unlock()
+		c.close()
+	}()
+
+	for {
+		data, err := conn.readMessage()
+		if err != nil {
+			return
+		}
+
+		var msg clientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.queue(errorMessage{Type: "error", Error: fmt.Sprintf("reading the message: %v", err)})
+			continue
+		}
+
+		switch msg.Type {
+		case "toggle":
+			if err := toggle(seq, msg); err != nil {
+				c.queue(errorMessage{Type: "error", Error: err.Error()})
+				continue
+			}
+			s.broadcast(patternMessage{Type: "pattern", Pattern: seq.Pattern()})
+		case "transport":
+			transport()
+		default:
+			c.queue(errorMessage{Type: "error", Error: fmt.Sprintf("unknown message type %q", msg.Type)})
+		}
+	}
+}
+
+// toggle flips, or sets, the step msg names in the pattern seq plays
+func toggle(seq *drum.Sequencer, msg clientMessage) error {
+
+	if msg.ID == nil || msg.Step == nil {
+		return errors.New("a toggle needs an instrument id and a step")
+	}
+	return seq.Update(func(p *drum.Pattern) error {
+		if msg.On != nil {
+			return p.SetStep(*msg.ID, *msg.Step, *msg.On)
+		}
+		return p.ToggleStep(*msg.ID, *msg.Step)
+	})
+}
+
+// broadcast queues v for every client
+func (s *Server) broadcast(v interface{}) {
+
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+
+	for c := range s.clients {
+		c.queue(v)
+	}
+}
+
+// queue queues v as JSON for the client, dropping it if the client has
+// fallen too far behind or left. It never blocks, so it's safe to call
+// from the sequencer's goroutine.
+func (c *client) queue(v interface{}) {
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		return
+	}
+	select {
+	case c.send <- data:
+	default:
+	}
+}
+
+// write sends the client's queued messages until it leaves, closing the
+// connection if one can't be written
+func (c *client) write() {
+
+	defer c.conn.Close()
+
+	for data := range c.send {
+		if err := c.conn.writeMessage(data); err != nil {
+			return
+		}
+	}
+}
+
+// close stops queueing messages for the client, leaving those already
+// queued to be written before the connection closes
+func (c *client) close() {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.closed {
+		c.closed = true
+		close(c.send)
+	}
+}
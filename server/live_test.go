@@ -0,0 +1,174 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	drum "github.com/chrishiestand/golang-challenge-1-drum_machine"
+	"github.com/chrishiestand/golang-challenge-1-drum_machine/render"
+)
+
+// testClient is the client side of a connection to /ws
+type testClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// dial opens a WebSocket to /ws on the test server
+func dial(t *testing.T, srv *httptest.Server) *testClient {
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	req, _ := http.NewRequest("GET", srv.URL+"/ws", nil)
+	req.Header.Set("Connection", "keep-alive, Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the accept value for the sample key in RFC 6455
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("unexpected handshake response %d %v", resp.StatusCode, resp.Header)
+	}
+	return &testClient{conn: conn, r: r}
+}
+
+// send writes msg to the server as a masked text message
+func (c *testClient) send(t *testing.T, msg string) {
+
+	if _, err := c.conn.Write(frame(opText, []byte(msg), []byte{1, 2, 3, 4})); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// next returns the next message of the given type, skipping others
+func (c *testClient) next(t *testing.T, typ string) map[string]interface{} {
+
+	for {
+		_, op, payload, err := readFrame(c.r, false)
+		if err != nil {
+			t.Fatalf("waiting for a %s message: %v", typ, err)
+		}
+		if op != opText {
+			t.Fatalf("expected a text message, got opcode %#x", op)
+		}
+
+		var msg map[string]interface{}
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg["type"] == typ {
+			return msg
+		}
+	}
+}
+
+func TestLive(t *testing.T) {
+
+	p := drum.NewPattern("live", 6000)
+	p.AddInstrument(0, "kick").SetSteps("x---x---x---x---")
+	seq := drum.NewSequencer(*p)
+	defer seq.Close()
+
+	s := New(t.TempDir(), render.SampleKit{})
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	if resp, err := http.Get(srv.URL + "/ws"); err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected no WebSocket until a sequencer is attached, got %v, %v", resp, err)
+	}
+	s.Attach(seq)
+	if resp, err := http.Get(srv.URL + "/ws"); err != nil || resp.StatusCode != http.StatusUpgradeRequired {
+		t.Fatalf("expected plain requests to be refused, got %v, %v", resp, err)
+	}
+
+	a, b := dial(t, srv), dial(t, srv)
+	defer a.conn.Close()
+	defer b.conn.Close()
+
+	if msg := a.next(t, "pattern"); msg["pattern"] == nil {
+		t.Errorf("expected the pattern on connecting, got %v", msg)
+	}
+	if msg := a.next(t, "transport"); msg["playing"] != false || msg["tempo"] != 6000.0 || msg["position"] != 0.0 {
+		t.Errorf("expected a stopped sequencer at 6000 BPM, got %v", msg)
+	}
+	b.next(t, "transport")
+
+	if err := seq.Start(); err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for range seq.Events() {
+		}
+	}()
+
+	if msg := a.next(t, "hit"); msg["instrument"] != "kick" || msg["id"] != 0.0 || msg["step"].(float64) > 12 {
+		t.Errorf("expected a hit of the kick, got %v", msg)
+	}
+	a.next(t, "step")
+
+	// a toggle from one client is sent to both
+	a.send(t, `{"type":"toggle","id":0,"step":2}`)
+	for _, c := range []*testClient{a, b} {
+		msg := c.next(t, "pattern")
+		data, _ := json.Marshal(msg["pattern"])
+		var got drum.Pattern
+		if err := json.Unmarshal(data, &got); err != nil {
+			t.Fatal(err)
+		}
+		if on, _ := got.Instruments()[0].StepAt(2); !on {
+			t.Errorf("expected step 2 toggled on, got\n%v", got)
+		}
+	}
+	if on, _ := seq.Pattern().Instruments()[0].StepAt(2); !on {
+		t.Errorf("expected the sequencer to play the toggled step")
+	}
+
+	a.send(t, `{"type":"toggle","id":0,"step":2,"on":true}`)
+	if msg := a.next(t, "pattern"); msg["pattern"] == nil {
+		t.Errorf("expected the pattern after setting a step, got %v", msg)
+	}
+
+	for _, msg := range []string{`{"type":"toggle","id":9,"step":0}`, `{"type":"toggle"}`, `{"type":"dance"}`, `not json`} {
+		a.send(t, msg)
+		if e := a.next(t, "error"); e["error"] == "" {
+			t.Errorf("%s: expected an error, got %v", msg, e)
+		}
+	}
+
+	a.send(t, `{"type":"transport"}`)
+	if msg := a.next(t, "transport"); msg["playing"] != true {
+		t.Errorf("expected a playing sequencer, got %v", msg)
+	}
+
+	// the server echoes the close
+	if _, err := a.conn.Write(frame(opClose, []byte{3, 232}, []byte{1, 2, 3, 4})); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		_, op, _, err := readFrame(a.r, false)
+		if err != nil {
+			t.Fatalf("expected the close to be echoed, got %v", err)
+		}
+		if op == opClose {
+			break
+		}
+	}
+}
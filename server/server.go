@@ -0,0 +1,299 @@
+// Package server serves a directory of .splice drum machine patterns over
+// HTTP, for browsing, editing and rendering them:
+//
+//	GET  /patterns                  the patterns, as a JSON array of their
+//	                                ids, versions and tempos
+//	GET  /patterns/{id}             the pattern as JSON, in the form
+//	                                drum.Pattern.MarshalJSON writes
+//	PUT  /patterns/{id}/steps       replace one instrument's steps, given a
+//	                                JSON body such as {"id":0,"steps":[true,...]},
+//	                                and return the updated pattern
+//	POST /patterns/{id}/render.wav  the pattern rendered to a WAV file,
+//	                                after ?count_in= measures of clicks and
+//	                                with a click on every beat if ?click=true
+//	GET  /ws                        a WebSocket following the Sequencer
+//	                                given to Attach
+//
+// A pattern's id is its file name without the .splice extension.
+//
+// The WebSocket sends JSON messages, each with a "type": "pattern" with the
+// pattern playing, when the client connects and whenever a client edits it,
+// "transport" with whether the sequencer is "playing", its "tempo" and the
+// "position" it plays next, when the client connects, as the tempo changes
+// and as the pattern loops, "step" with each "step" as it begins, and "hit"
+// with the "id", "instrument", "step" and "velocity" of each hit played.
+// Clients send {"type":"toggle","id":0,"step":3} to flip a step, with
+// "on":true or false to set it instead, and {"type":"transport"} to ask
+// for the transport state. Bad messages are answered with an "error"
+// message. Messages for a client too slow to keep up are dropped.
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	drum "github.com/chrishiestand/golang-challenge-1-drum_machine"
+	"github.com/chrishiestand/golang-challenge-1-drum_machine/render"
+)
+
+// ext is the extension of the pattern files the server serves
+const ext = ".splice"
+
+// maxBody is the largest request body the server reads
+const maxBody = 1 << 20
+
+// Server is an http.Handler serving the patterns in a directory
+type Server struct {
+	dir string
+	kit render.SampleKit
+	// mu keeps edits to a pattern file from interleaving, and guards seq
+	mu  sync.Mutex
+	seq *drum.Sequencer
+	// clients are the connections to /ws
+	clientsMu sync.Mutex
+	clients   map[*client]struct{}
+}
+
+// Summary is the entry GET /patterns lists for each pattern
+type Summary struct {
+	ID      string  `json:"id"`
+	Version string  `json:"version"`
+	Tempo   float32 `json:"tempo"`
+}
+
+// stepsRequest is the body of PUT /patterns/{id}/steps
+type stepsRequest struct {
+	ID    *uint32 `json:"id"`
+	Steps []bool  `json:"steps"`
+}
+
+// New returns a server for the .splice files in dir, not descending into
+// subdirectories, that renders with the samples in kit
+func New(dir string, kit render.SampleKit) *Server {
+
+	return &Server{dir: dir, kit: kit}
+}
+
+// ServeHTTP implements http.Handler, routing the request to its endpoint
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) == 1 && parts[0] == "ws" {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(w, fmt.Sprintf("%s isn't allowed here, only %s", r.Method, http.MethodGet), http.StatusMethodNotAllowed)
+			return
+		}
+		s.live(w, r)
+		return
+	}
+	if parts[0] != "patterns" || len(parts) > 3 {
+		http.NotFound(w, r)
+		return
+	}
+
+	var handler func(http.ResponseWriter, *http.Request, string)
+	method := http.MethodGet
+
+	switch {
+	case len(parts) == 1:
+		handler = func(w http.ResponseWriter, r *http.Request, _ string) { s.list(w, r) }
+	case len(parts) == 2:
+		handler = s.get
+	case parts[2] == "steps":
+		handler, method = s.putSteps, http.MethodPut
+	case parts[2] == "render.wav":
+		handler, method = s.renderWAV, http.MethodPost
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		http.Error(w, fmt.Sprintf("%s isn't allowed here, only %s", r.Method, method), http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := ""
+	if len(parts) > 1 {
+		id = parts[1]
+	}
+	handler(w, r, id)
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	summaries := []Summary{}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ext {
+			continue
+		}
+
+		id := strings.TrimSuffix(entry.Name(), ext)
+		p, err := drum.DecodeFileContext(r.Context(), filepath.Join(s.dir, entry.Name()))
+		if canceled(w, err) {
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("%s: %v", id, err), http.StatusInternalServerError)
+			return
+		}
+		summaries = append(summaries, Summary{ID: id, Version: p.Version(), Tempo: p.Tempo()})
+	}
+
+	sort.Slice(summaries, func(a, b int) bool { return summaries[a].ID < summaries[b].ID })
+	writeJSON(w, summaries)
+}
+
+func (s *Server) get(w http.ResponseWriter, r *http.Request, id string) {
+
+	p, ok := s.load(w, r, id)
+	if !ok {
+		return
+	}
+	writeJSON(w, p)
+}
+
+func (s *Server) putSteps(w http.ResponseWriter, r *http.Request, id string) {
+
+	var req stepsRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBody)).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("reading the request: %v", err), http.StatusBadRequest)
+		return
+	}
+	if req.ID == nil {
+		http.Error(w, "the request has no instrument id", http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.load(w, r, id)
+	if !ok {
+		return
+	}
+
+	if err := p.SetSteps(*req.ID, req.Steps); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := drum.EncodeFile(*p, s.path(id)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, p)
+}
+
+func (s *Server) renderWAV(w http.ResponseWriter, r *http.Request, id string) {
+
+	p, ok := s.load(w, r, id)
+	if !ok {
+		return
+	}
+
+	var opts render.RenderOptions
+	query := r.URL.Query()
+	if v := query.Get("count_in"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, fmt.Sprintf("%q is not a number of measures to count in", v), http.StatusBadRequest)
+			return
+		}
+		opts.CountIn = n
+	}
+	if v := query.Get("click"); v != "" {
+		click, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("click should be true or false, not %q", v), http.StatusBadRequest)
+			return
+		}
+		opts.Click = click
+	}
+
+	var buf bytes.Buffer
+	err := render.RenderWAVContext(r.Context(), *p, s.kit, &buf, opts)
+	if canceled(w, err) {
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "audio/wav")
+	w.Write(buf.Bytes())
+}
+
+// path returns the file of the pattern with the given id
+func (s *Server) path(id string) string {
+
+	return filepath.Join(s.dir, id+ext)
+}
+
+// load decodes the pattern with the given id, giving up once the request's
+// context is done, writing an error response and returning false if it
+// can't
+func (s *Server) load(w http.ResponseWriter, r *http.Request, id string) (*drum.Pattern, bool) {
+
+	if id == "" || id == "." || id == ".." || filepath.Base(id) != id {
+		http.Error(w, fmt.Sprintf("%q is not a pattern id", id), http.StatusBadRequest)
+		return nil, false
+	}
+
+	p, err := drum.DecodeFileContext(r.Context(), s.path(id))
+	switch {
+	case canceled(w, err):
+		return nil, false
+	case errors.Is(err, fs.ErrNotExist):
+		http.Error(w, fmt.Sprintf("no pattern %q", id), http.StatusNotFound)
+		return nil, false
+	case err != nil:
+		http.Error(w, fmt.Sprintf("%s: %v", id, err), http.StatusInternalServerError)
+		return nil, false
+	}
+	return &p, true
+}
+
+// canceled reports whether err is the error of a request's context that's
+// done, writing a Service Unavailable response if it is, which the client
+// only sees if it's still waiting
+func canceled(w http.ResponseWriter, err error) bool {
+
+	if !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	return true
+}
+
+// writeJSON writes v as the JSON body of the response
+func writeJSON(w http.ResponseWriter, v interface{}) {
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(data, '\n'))
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	drum "github.com/chrishiestand/golang-challenge-1-drum_machine"
+	"github.com/chrishiestand/golang-challenge-1-drum_machine/drumtest"
+	"github.com/chrishiestand/golang-challenge-1-drum_machine/render"
+)
+
+func TestServer(t *testing.T) {
+
+	dir := drumtest.FixtureDir(t, filepath.Join("..", "fixtures"), "pattern_1.splice", "pattern_4.splice")
+	kit := render.SampleKit{}
+	for _, name := range []string{"kick", "snare", "clap", "hh-open", "hh-close", "cowbell"} {
+		kit[name] = render.Sample{Left: []int16{1000}, Right: []int16{1000}}
+	}
+	srv := httptest.NewServer(New(dir, kit))
+	defer srv.Close()
+
+	do := func(method, path, body string) (*http.Response, []byte) {
+
+		req, err := http.NewRequest(method, srv.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp, data
+	}
+
+	resp, data := do("GET", "/patterns", "")
+	var summaries []Summary
+	if err := json.Unmarshal(data, &summaries); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("listing: %d %s", resp.StatusCode, data)
+	}
+	if len(summaries) != 2 || summaries[0] != (Summary{"pattern_1", "0.808-alpha", 120}) || summaries[1].ID != "pattern_4" {
+		t.Errorf("unexpected listing %+v", summaries)
+	}
+
+	resp, data = do("GET", "/patterns/pattern_1", "")
+	var p drum.Pattern
+	if err := json.Unmarshal(data, &p); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("getting pattern_1: %d %s", resp.StatusCode, data)
+	}
+	if resp.Header.Get("Content-Type") != "application/json" || p.Tempo() != 120 {
+		t.Errorf("unexpected pattern_1 %s", data)
+	}
+
+	steps := `{"id":0,"steps":[true,true,false,false,true,false,false,false,true,false,false,false,true,false,false,false]}`
+	resp, data = do("PUT", "/patterns/pattern_1/steps", steps)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("putting steps: %d %s", resp.StatusCode, data)
+	}
+	saved, err := drum.DecodeFile(filepath.Join(dir, "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if on, _ := saved.Instruments()[0].StepAt(1); !on {
+		t.Errorf("expected the new steps to be saved, got\n%s", saved)
+	}
+
+	resp, data = do("POST", "/patterns/pattern_1/render.wav", "")
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "audio/wav" {
+		t.Fatalf("rendering: %d %s", resp.StatusCode, data)
+	}
+	if _, err := render.LoadSample(bytes.NewReader(data)); err != nil {
+		t.Errorf("couldn't read the render back: %v", err)
+	}
+	resp, counted := do("POST", "/patterns/pattern_1/render.wav?count_in=1&click=true", "")
+	if resp.StatusCode != http.StatusOK || len(counted) <= len(data) {
+		t.Errorf("expected a longer render with a count-in, got %d and %d bytes", resp.StatusCode, len(counted))
+	}
+
+	tData := []struct {
+		method, path, body string
+		expected           int
+	}{
+		{"GET", "/patterns/missing", "", http.StatusNotFound},
+		{"GET", "/patterns/.", "", http.StatusBadRequest},
+		{"GET", "/patterns/pattern_1/other", "", http.StatusNotFound},
+		{"PUT", "/patterns/pattern_1/steps", `{"steps":[true]}`, http.StatusBadRequest},
+		{"PUT", "/patterns/pattern_1/steps", `{"id":0,"steps":[true]}`, http.StatusBadRequest},
+		{"PUT", "/patterns/pattern_1/steps", `not json`, http.StatusBadRequest},
+		{"PUT", "/patterns/missing/steps", steps, http.StatusNotFound},
+		{"POST", "/patterns/pattern_4/render.wav", "", http.StatusUnprocessableEntity},
+		{"POST", "/patterns/pattern_1/render.wav?count_in=-1", "", http.StatusBadRequest},
+		{"POST", "/patterns/pattern_1/render.wav?click=loud", "", http.StatusBadRequest},
+		{"DELETE", "/patterns/pattern_1", "", http.StatusMethodNotAllowed},
+	}
+
+	for _, exp := range tData {
+		if resp, data := do(exp.method, exp.path, exp.body); resp.StatusCode != exp.expected {
+			t.Errorf("%s %s: expected %d, got %d %s", exp.method, exp.path, exp.expected, resp.StatusCode, data)
+		}
+	}
+}
+
+func TestServerCanceled(t *testing.T) {
+
+	s := New(drumtest.FixtureDir(t, filepath.Join("..", "fixtures"), "pattern_1.splice"), render.SampleKit{})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodGet, "/patterns", nil),
+		httptest.NewRequest(http.MethodGet, "/patterns/pattern_1", nil),
+		httptest.NewRequest(http.MethodPost, "/patterns/pattern_1/render.wav", nil),
+	} {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req.WithContext(ctx))
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("%s %s: expected %d once the request is canceled, got %d", req.Method, req.URL.Path, http.StatusServiceUnavailable, w.Code)
+		}
+	}
+}
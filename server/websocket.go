@@ -0,0 +1,247 @@
+package server
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// The WebSocket opcodes the server handles, from RFC 6455
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xa
+)
+
+// websocketGUID is appended to a client's key to make the accept header
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// errClosed means the client closed the WebSocket
+var errClosed = errors.New("websocket closed")
+
+// wsConn is a server's side of a WebSocket connection. Its writes are
+// serialized, so it's safe to write from several goroutines, but only one
+// may read.
+type wsConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	// mu keeps frames from interleaving
+	mu sync.Mutex
+}
+
+// upgrade completes the WebSocket opening handshake for r, taking over its
+// connection, or writes an error response and returns an error if r isn't
+// a WebSocket handshake
+func upgrade(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+	switch {
+	case !headerHas(r.Header, "Connection", "upgrade") || !headerHas(r.Header, "Upgrade", "websocket"):
+		http.Error(w, "expected a WebSocket upgrade", http.StatusUpgradeRequired)
+		return nil, errors.New("not a websocket handshake")
+	case r.Header.Get("Sec-WebSocket-Version") != "13" || key == "":
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "only version 13 of the WebSocket protocol is supported", http.StatusBadRequest)
+		return nil, errors.New("unsupported websocket version")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "the connection can't be upgraded", http.StatusInternalServerError)
+		return nil, errors.New("response can't be hijacked")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", acceptKey(key))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, r: rw.Reader}, nil
+}
+
+// headerHas reports whether the comma separated values of the header name
+// include token, ignoring case
+func headerHas(h http.Header, name, token string) bool {
+
+	for _, value := range h.Values(name) {
+		for _, v := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// acceptKey returns the Sec-WebSocket-Accept value answering key
+func acceptKey(key string) string {
+
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// readMessage returns the next text message from the client, answering
+// pings and reassembling fragmented messages on the way. It returns
+// errClosed once the client closes the connection, after echoing its close
+// frame.
+func (c *wsConn) readMessage() ([]byte, error) {
+
+	var message []byte
+	for {
+		fin, op, payload, err := readFrame(c.r, true)
+		if err != nil {
+			return nil, err
+		}
+
+		switch op {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return nil, err
+			}
+		case opPong:
+		case opClose:
+			c.writeFrame(opClose, payload)
+			return nil, errClosed
+		case opText, opBinary, opContinuation:
+			if (op == opContinuation) != (message != nil) {
+				return nil, fmt.Errorf("unexpected websocket opcode %#x", op)
+			}
+			if op == opBinary {
+				return nil, errors.New("binary websocket messages aren't supported")
+			}
+			if len(message)+len(payload) > maxBody {
+				return nil, fmt.Errorf("websocket message longer than %d bytes", maxBody)
+			}
+			if message == nil {
+				message = []byte{}
+			}
+			message = append(message, payload...)
+			if fin {
+				return message, nil
+			}
+		default:
+			return nil, fmt.Errorf("unknown websocket opcode %#x", op)
+		}
+	}
+}
+
+// writeMessage sends data to the client as a text message
+func (c *wsConn) writeMessage(data []byte) error {
+
+	return c.writeFrame(opText, data)
+}
+
+// Close closes the connection without a closing handshake
+func (c *wsConn) Close() error {
+
+	return c.conn.Close()
+}
+
+// writeFrame writes a single unmasked frame, as servers send them
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_, err := c.conn.Write(frame(op, payload, nil))
+	return err
+}
+
+// readFrame reads a frame from r, whose payload must be masked if masked
+// is set, as a client's are, and not otherwise, and returns it unmasked
+func readFrame(r io.Reader, masked bool) (fin bool, op byte, payload []byte, err error) {
+
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin, op = header[0]&0x80 != 0, header[0]&0x0f
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, errors.New("websocket frame uses an extension")
+	}
+	if (header[1]&0x80 != 0) != masked {
+		return false, 0, nil, fmt.Errorf("websocket frame masking should be %v", masked)
+	}
+
+	n := uint64(header[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > maxBody || (op >= opClose && (n > 125 || !fin)) {
+		return false, 0, nil, fmt.Errorf("websocket frame of %d bytes is too long", n)
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(r, mask[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return fin, op, payload, nil
+}
+
+// frame returns a final frame holding payload, masked with mask if it
+// isn't nil
+func frame(op byte, payload, mask []byte) []byte {
+
+	b := []byte{0x80 | op}
+
+	maskBit := byte(0)
+	if mask != nil {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		b = append(b, maskBit|byte(n))
+	case n <= 0xffff:
+		b = append(b, maskBit|126, 0, 0)
+		binary.BigEndian.PutUint16(b[2:], uint16(n))
+	default:
+		b = append(b, maskBit|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(b[2:], uint64(n))
+	}
+
+	if mask == nil {
+		return append(b, payload...)
+	}
+	b = append(b, mask...)
+	for i, v := range payload {
+		b = append(b, v^mask[i%4])
+	}
+	return b
+}
@@ -0,0 +1,74 @@
+package drum
+
+// Clone returns a deep copy of the pattern that shares no memory with it, so
+// changing either leaves the other as it was. A function registered with
+// OnChange is not copied.
+func (p Pattern) Clone() Pattern {
+
+	clone := p
+	clone.onChange = nil
+	clone.header = cloneBytes(p.header)
+	clone.tempoBin = cloneBytes(p.tempoBin)
+	clone.chunks = p.UnknownChunks()
+	if p.meta != nil {
+		meta := p.meta.clone()
+		clone.meta = &meta
+	}
+
+	if p.instruments != nil {
+		clone.instruments = make([]Instrument, len(p.instruments))
+	}
+	for i, inst := range p.instruments {
+		clone.instruments[i] = inst.clone()
+	}
+	return clone
+}
+
+// clone returns a deep copy of the instrument that shares no memory with it
+func (i Instrument) clone() Instrument {
+
+	measures := make([]Step, len(i.measure))
+	for m, measure := range i.measure {
+		measures[m] = Step(cloneBytes(measure))
+	}
+
+	i.measure = measures
+	i.raw = cloneBytes(i.raw)
+	if i.expression != nil {
+		i.expression = append([]Expression(nil), i.expression...)
+	}
+	return i
+}
+
+// cloneBytes returns a copy of b, keeping nil as nil
+func cloneBytes(b []byte) []byte {
+
+	if b == nil {
+		return nil
+	}
+	return append([]byte(nil), b...)
+}
+
+// Snapshot is an immutable copy of a pattern's state taken by
+// Pattern.Snapshot, for undo stacks and the like.
+type Snapshot struct {
+	pattern Pattern
+}
+
+// Snapshot returns a copy of the pattern's current state. The snapshot is
+// independent of the pattern: changes made to the pattern afterwards, or to
+// a pattern it is restored into, never alter it.
+func (p Pattern) Snapshot() Snapshot {
+
+	return Snapshot{pattern: p.Clone()}
+}
+
+// Restore replaces the pattern's state with the one saved in s. The same
+// snapshot can be restored any number of times. A function registered with
+// OnChange stays registered, and is not told about the restore.
+func (p *Pattern) Restore(s Snapshot) {
+
+	onChange := p.onChange
+	*p = s.pattern.Clone()
+	p.onChange = onChange
+}
@@ -0,0 +1,61 @@
+package drum
+
+import (
+	"path"
+	"testing"
+)
+
+func TestClone(t *testing.T) {
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_1.splice - %v", err)
+	}
+	original := decoded.String()
+
+	clone := decoded.Clone()
+	if !clone.Equal(*decoded) {
+		t.Fatalf("clone isn't equal to the original:\n%s", clone)
+	}
+
+	if err := clone.ToggleStep(0, 0); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	clone.header[0] = 'X'
+
+	if decoded.String() != original || decoded.header[0] != 'S' {
+		t.Errorf("changing the clone changed the original:\n%s", decoded)
+	}
+}
+
+func TestSnapshotRestore(t *testing.T) {
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_2.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_2.splice - %v", err)
+	}
+	p := *decoded
+	original := p.String()
+
+	changes := 0
+	p.OnChange(func(Change) { changes++ })
+
+	s := p.Snapshot()
+
+	for i := 0; i < 2; i++ {
+		p.SetTempo(60)
+		if err := p.SetStep(0, 1, true); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		p.Restore(s)
+		if p.String() != original {
+			t.Fatalf("restore %d didn't bring back the snapshot.\nGot:\n%s\nExpected:\n%s", i, p, original)
+		}
+	}
+
+	p.SetTempo(90)
+	if changes != 5 {
+		t.Errorf("expected the observer to stay registered through restores and see 5 changes, saw %d", changes)
+	}
+}
@@ -0,0 +1,154 @@
+package drum
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Song is an ordered set of patterns and the chain they play in, such as
+// pattern 0 four times then pattern 1 twice. The chain loops back to its
+// first entry when it ends.
+type Song struct {
+	Patterns []Pattern
+	Chain    []ChainEntry
+}
+
+// ChainEntry is one link of a Song's chain: the index into Song.Patterns of
+// the pattern to play and how many times to loop it
+type ChainEntry struct {
+	Pattern int
+	Repeats int
+}
+
+// songMagic is the magic string every song file starts with
+const songMagic = "SPLSONG\x00"
+
+// maxChainField is the largest pattern index, repeat count or length a
+// song file can store
+const maxChainField = math.MaxUint16
+
+// Clone returns a deep copy of the song
+func (s Song) Clone() Song {
+
+	c := Song{
+		Patterns: make([]Pattern, len(s.Patterns)),
+		Chain:    append([]ChainEntry(nil), s.Chain...),
+	}
+	for i, p := range s.Patterns {
+		c.Patterns[i] = p.Clone()
+	}
+	return c
+}
+
+// Loops returns the number of pattern loops the chain plays before it
+// starts over
+func (s Song) Loops() int {
+
+	n := 0
+
+	for _, e := range s.Chain {
+		n += e.Repeats
+	}
+	return n
+}
+
+// check reports whether the song has a chain that can be played and
+// stored: at least one entry, each naming one of its patterns and played at
+// least once
+func (s Song) check() error {
+
+	if len(s.Chain) == 0 {
+		return fmt.Errorf("%w: the chain is empty", ErrInvalidSong)
+	}
+	if len(s.Patterns) > maxChainField || len(s.Chain) > maxChainField {
+		return fmt.Errorf("%w: %d patterns and %d chain entries won't fit a song file", ErrInvalidSong, len(s.Patterns), len(s.Chain))
+	}
+
+	for i, e := range s.Chain {
+		if e.Pattern < 0 || e.Pattern >= len(s.Patterns) {
+			return fmt.Errorf("%w: chain entry %d names pattern %d of %d", ErrInvalidSong, i, e.Pattern, len(s.Patterns))
+		}
+		if e.Repeats < 1 || e.Repeats > maxChainField {
+			return fmt.Errorf("%w: chain entry %d repeats %d times", ErrInvalidSong, i, e.Repeats)
+		}
+	}
+	return nil
+}
+
+// EncodeSong writes s to w: the song magic, the number of chain entries as
+// a little-endian uint16 and each entry as a uint16 pattern index and a
+// uint16 repeat count, then the number of patterns as a uint16 followed by
+// the patterns back to back as EncodeAll writes them. Nothing is written
+// for a song whose chain is invalid.
+func EncodeSong(w io.Writer, s Song) error {
+
+	if err := s.check(); err != nil {
+		return err
+	}
+
+	b := make([]byte, 0, len(songMagic)+4+4*len(s.Chain))
+	b = append(b, songMagic...)
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(s.Chain)))
+	for _, e := range s.Chain {
+		b = binary.LittleEndian.AppendUint16(b, uint16(e.Pattern))
+		b = binary.LittleEndian.AppendUint16(b, uint16(e.Repeats))
+	}
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(s.Patterns)))
+
+	if _, err := w.Write(b); err != nil {
+		return err
+	}
+	return EncodeAll(w, s.Patterns)
+}
+
+// DecodeSong decodes a song written by EncodeSong from r. It reads exactly
+// the song's bytes, and returns an error wrapping ErrInvalidSong if they
+// don't start with the song magic or the chain names a pattern the song
+// doesn't hold.
+func DecodeSong(r io.Reader) (Song, error) {
+
+	var s Song
+
+	magic := make([]byte, len(songMagic))
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return s, fmt.Errorf("reading the song magic: %w", err)
+	}
+	if string(magic) != songMagic {
+		return s, fmt.Errorf("%w: missing the song magic", ErrInvalidSong)
+	}
+
+	var entries uint16
+	if err := binary.Read(r, binary.LittleEndian, &entries); err != nil {
+		return s, fmt.Errorf("reading the chain length: %w", err)
+	}
+
+	s.Chain = make([]ChainEntry, entries)
+	for i := range s.Chain {
+		var e [2]uint16
+		if err := binary.Read(r, binary.LittleEndian, &e); err != nil {
+			return s, fmt.Errorf("reading chain entry %d: %w", i, err)
+		}
+		s.Chain[i] = ChainEntry{Pattern: int(e[0]), Repeats: int(e[1])}
+	}
+
+	var patterns uint16
+	if err := binary.Read(r, binary.LittleEndian, &patterns); err != nil {
+		return s, fmt.Errorf("reading the pattern count: %w", err)
+	}
+
+	s.Patterns = make([]Pattern, patterns)
+	for i := range s.Patterns {
+		p, err := Decode(r)
+		if err != nil {
+			return s, fmt.Errorf("decoding pattern %d: %w", i, err)
+		}
+		s.Patterns[i] = p
+	}
+
+	if err := s.check(); err != nil {
+		return s, err
+	}
+	return s, nil
+}
@@ -0,0 +1,143 @@
+package drum
+
+import (
+	"bytes"
+	"errors"
+	"path"
+	"testing"
+)
+
+func TestSongRoundTrip(t *testing.T) {
+
+	var song Song
+	for _, name := range []string{"pattern_1.splice", "pattern_2.splice", "pattern_3.splice"} {
+		p, err := DecodeFile(path.Join("fixtures", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		song.Patterns = append(song.Patterns, *p)
+	}
+	song.Chain = []ChainEntry{{0, 4}, {1, 2}, {0, 1}, {2, 3}}
+
+	var buf bytes.Buffer
+	if err := EncodeSong(&buf, song); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	buf.WriteString("after")
+
+	decoded, err := DecodeSong(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if buf.String() != "after" {
+		t.Errorf("expected DecodeSong to stop at the end of the song, %q was left", buf.String())
+	}
+
+	if len(decoded.Chain) != len(song.Chain) {
+		t.Fatalf("decoded %d chain entries, expected %d", len(decoded.Chain), len(song.Chain))
+	}
+	for i, e := range song.Chain {
+		if decoded.Chain[i] != e {
+			t.Errorf("chain entry %d: got %+v, expected %+v", i, decoded.Chain[i], e)
+		}
+	}
+	if len(decoded.Patterns) != len(song.Patterns) {
+		t.Fatalf("decoded %d patterns, expected %d", len(decoded.Patterns), len(song.Patterns))
+	}
+	for i, p := range song.Patterns {
+		if decoded.Patterns[i].String() != p.String() {
+			t.Errorf("pattern %d: got\n%s\nexpected\n%s", i, decoded.Patterns[i], p)
+		}
+	}
+	if loops := decoded.Loops(); loops != 10 {
+		t.Errorf("expected the chain to play 10 loops, got %d", loops)
+	}
+}
+
+func TestSongInvalid(t *testing.T) {
+
+	p, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tData := []struct {
+		name string
+		song Song
+	}{
+		{"empty chain", Song{Patterns: []Pattern{*p}}},
+		{"missing pattern", Song{Patterns: []Pattern{*p}, Chain: []ChainEntry{{1, 1}}}},
+		{"negative pattern", Song{Patterns: []Pattern{*p}, Chain: []ChainEntry{{-1, 1}}}},
+		{"no repeats", Song{Patterns: []Pattern{*p}, Chain: []ChainEntry{{0, 0}}}},
+	}
+
+	for _, exp := range tData {
+		var buf bytes.Buffer
+		if err := EncodeSong(&buf, exp.song); !errors.Is(err, ErrInvalidSong) {
+			t.Errorf("%s: expected ErrInvalidSong encoding, got %v", exp.name, err)
+		}
+		if buf.Len() != 0 {
+			t.Errorf("%s: expected nothing written, got %d bytes", exp.name, buf.Len())
+		}
+		if _, err := NewSongSequencer(exp.song); !errors.Is(err, ErrInvalidSong) {
+			t.Errorf("%s: expected ErrInvalidSong making a sequencer, got %v", exp.name, err)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := p.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeSong(&buf); !errors.Is(err, ErrInvalidSong) {
+		t.Errorf("expected ErrInvalidSong decoding a plain pattern, got %v", err)
+	}
+
+	buf.Reset()
+	if err := EncodeSong(&buf, Song{Patterns: []Pattern{*p}, Chain: []ChainEntry{{0, 1}}}); err != nil {
+		t.Fatal(err)
+	}
+	truncated := buf.Bytes()[:buf.Len()-10]
+	if _, err := DecodeSong(bytes.NewReader(truncated)); !errors.Is(err, ErrTruncated) {
+		t.Errorf("expected ErrTruncated decoding a cut short song, got %v", err)
+	}
+}
+
+func TestSongSequencer(t *testing.T) {
+
+	a := NewPattern("a", 6000)
+	a.AddInstrument(0, "kick").SetSteps("x---------------")
+	b := NewPattern("b", 12000)
+	b.AddInstrument(1, "snare").SetSteps("--------x-------")
+
+	s, err := NewSongSequencer(Song{Patterns: []Pattern{*a, *b}, Chain: []ChainEntry{{0, 2}, {1, 1}}})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	expected := []struct {
+		name string
+		step int
+	}{{"kick", 0}, {"kick", 0}, {"snare", 8}, {"kick", 0}, {"kick", 0}, {"snare", 8}}
+
+	for n, exp := range expected {
+		e := <-s.Events()
+		if e.Instrument.name != exp.name || e.StepIndex != exp.step {
+			t.Fatalf("event %d: got %s on step %d, expected %s on step %d", n, e.Instrument.name, e.StepIndex, exp.name, exp.step)
+		}
+	}
+
+	s.Stop()
+	if tempo := s.tempo; tempo != 6000 {
+		t.Errorf("expected Stop to rewind to the first pattern's tempo, got %v", tempo)
+	}
+	if p := s.Pattern(); p.version != "a" {
+		t.Errorf("expected Stop to rewind to the first pattern, got %q", p.version)
+	}
+
+	if _, err := NewSongSequencer(Song{Patterns: []Pattern{{tempo: 120}}, Chain: []ChainEntry{{0, 1}}}); !errors.Is(err, ErrInvalidStep) {
+		t.Errorf("expected ErrInvalidStep for a pattern without steps, got %v", err)
+	}
+}
@@ -0,0 +1,348 @@
+package drum
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// Header is the part of a pattern that precedes its instruments
+type Header struct {
+	Version string
+	Tempo   float32
+}
+
+// InstrumentOrError is a value sent by DecodeStream: an instrument that was
+// decoded, or the error that stopped decoding
+type InstrumentOrError struct {
+	Instrument Instrument
+	Err        error
+}
+
+// DecodeStream decodes a single pattern from r like Decode, but returns as
+// soon as the header is read and then sends the instruments over the channel
+// one at a time as they're read, so only one instrument is held in memory at
+// once.
+//
+// The instruments are read by a goroutine that closes the channel once the
+// payload is consumed, after sending an error if one stops it early. The
+// goroutine blocks until each value is received, so the channel must be
+// drained; use DecodeStreamContext to be able to stop reading early.
+func DecodeStream(r io.Reader) (header Header, instruments <-chan InstrumentOrError, err error) {
+
+	return DecodeStreamContext(context.Background(), r)
+}
+
+// DecodeStreamContext is DecodeStream with a context. Once ctx is done the
+// goroutine stops reading and closes the channel without sending anything
+// more, so a reader that stops early must cancel ctx to release it. r must
+// not be used by anything else until the channel is closed.
+func DecodeStreamContext(ctx context.Context, r io.Reader) (Header, <-chan InstrumentOrError, error) {
+
+	var h Header
+
+	prefix := make([]byte, headerSize+1)
+	if _, err := io.ReadFull(r, prefix); err != nil {
+		return h, nil, readError(0, "header", err)
+	}
+	if _, err := parseHeader(prefix[:headerSize]); err != nil {
+		return h, nil, err
+	}
+
+	payload := io.LimitReader(r, int64(payloadLength(prefix[:headerSize], prefix[headerSize:], binary.LittleEndian)))
+
+	versionBin := make([]byte, versionSize)
+	if _, err := io.ReadFull(payload, versionBin); err != nil {
+		return h, nil, readError(headerSize+1, "version", err)
+	}
+	h.Version = string(bytes.Trim(versionBin, "\x00"))
+
+	if err := binary.Read(payload, binary.LittleEndian, &h.Tempo); err != nil {
+		return h, nil, readError(headerSize+1+versionSize, "tempo", err)
+	}
+
+	ch := make(chan InstrumentOrError)
+
+	go func() {
+		defer close(ch)
+
+		offset := headerSize + 1 + versionSize + 4
+
+		for ctx.Err() == nil {
+			inst, n, err := readStreamInstrument(payload, offset, DecodeOptions{})
+			if err == io.EOF {
+				return
+			}
+			offset += n
+
+			select {
+			case ch <- InstrumentOrError{Instrument: inst, Err: err}:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return h, ch, nil
+}
+
+// readStreamInstrument reads the next instrument from r, which is at byte
+// offset of the file, as adjusted by opts, and returns it along with its
+// length in bytes. It returns io.EOF when r ends cleanly before the
+// instrument.
+func readStreamInstrument(r io.Reader, offset int, opts DecodeOptions) (Instrument, int, error) {
+
+	stepCount, err := opts.stepsPerInstrument()
+	if err != nil {
+		return Instrument{}, 0, err
+	}
+	stepsSize, err := opts.StepPacking.stepsSize(stepCount)
+	if err != nil {
+		return Instrument{}, 0, err
+	}
+
+	record := make([]byte, 4+1, 4+1+255+stepsSize)
+
+	if n, err := io.ReadFull(r, record); err != nil {
+		if err == io.EOF {
+			return Instrument{}, 0, err
+		}
+		return Instrument{}, n, decodeError(offset, "instrument",
+			fmt.Errorf("%w: it has only %d bytes", ErrTruncatedInstrument, n))
+	}
+
+	// a long name's length follows its length byte a byte at a time
+	for record[4] == longName {
+		if len(record) > 4+1 && record[len(record)-1] < 0x80 {
+			break
+		}
+		if len(record) >= 4+1+binary.MaxVarintLen64 {
+			return Instrument{}, len(record), decodeError(offset+4, "instrument name length",
+				fmt.Errorf("%w: the name's long length is malformed", ErrInvalidNameLength))
+		}
+		var b [1]byte
+		if _, err := io.ReadFull(r, b[:]); err != nil {
+			return Instrument{}, len(record), decodeError(offset, "instrument",
+				fmt.Errorf("%w: it has only %d bytes", ErrTruncatedInstrument, len(record)))
+		}
+		record = append(record, b[0])
+	}
+	nameLength, _, err := readNameLength(record[4:])
+	if err != nil {
+		return Instrument{}, len(record), decodeError(offset+4, "instrument name length", err)
+	}
+
+	head := len(record)
+	record = append(record, make([]byte, nameLength+stepsSize)...)
+	if n, err := io.ReadFull(r, record[head:]); err != nil {
+		return Instrument{}, head + n, decodeError(offset, "instrument",
+			fmt.Errorf("%w: instrument %d needs %d bytes for its name and steps, %d are left",
+				ErrTruncatedInstrument, opts.byteOrder().Uint32(record), nameLength+stepsSize, n))
+	}
+
+	inst, _, err := readInstrument(record, offset, opts)
+	return inst, len(record), err
+}
+
+// Decoder reads a sequence of patterns, such as a file holding several one
+// after another, from a stream one pattern at a time
+type Decoder struct {
+	r            *bufio.Reader
+	opts         DecodeOptions
+	onInstrument func(Instrument) error
+}
+
+// NewDecoder returns a Decoder reading from r. It buffers r, so may read
+// past the last pattern it decodes.
+func NewDecoder(r io.Reader) *Decoder {
+
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// SetOptions sets how the patterns that follow are decoded, as for
+// DecodeWithOptions. Strict is ignored, since the stream may hold more.
+func (d *Decoder) SetOptions(opts DecodeOptions) {
+
+	d.opts = opts
+	d.opts.Strict = false
+}
+
+// OnInstrument has NextPattern pass each instrument to fn as soon as it's
+// read, rather than collecting them in the pattern it returns, so only one
+// instrument of a pattern is held in memory at a time. If fn returns an
+// error, NextPattern skips the rest of the pattern and returns the error.
+// Column-major patterns can't be read an instrument at a time, so each is
+// decoded whole before its instruments are passed to fn. Passing nil
+// collects the instruments again.
+func (d *Decoder) OnInstrument(fn func(Instrument) error) {
+
+	d.onInstrument = fn
+}
+
+// NextPattern decodes the next pattern in the stream. It returns io.EOF,
+// unwrapped, when the stream ends where a pattern would start, and an error
+// wrapping ErrTruncated if it ends part way through one. After any other
+// error decoding the pattern's payload, the decoder has skipped to the end
+// of the payload, so the next pattern can still be read.
+func (d *Decoder) NextPattern() (Pattern, error) {
+
+	if _, err := d.r.Peek(1); err != nil {
+		return Pattern{}, err
+	}
+
+	if d.onInstrument == nil {
+		return decode(context.Background(), d.r, d.opts, nil)
+	}
+	if d.opts.Layout == LayoutColumnMajor {
+		p, err := decode(context.Background(), d.r, d.opts, nil)
+		if err != nil {
+			return p, err
+		}
+
+		instruments := p.instruments
+		p.instruments = []Instrument{}
+		for _, inst := range instruments {
+			if err := d.onInstrument(inst); err != nil {
+				return p, err
+			}
+		}
+		return p, nil
+	}
+	return d.streamPattern()
+}
+
+// streamPattern decodes the next row-major pattern, passing its instruments
+// to the OnInstrument function as they're read
+func (d *Decoder) streamPattern() (Pattern, error) {
+
+	opts := d.opts
+	p := Pattern{instruments: []Instrument{}, packing: opts.StepPacking, layout: opts.Layout, tempoFormat: opts.TempoFormat}
+
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(d.r, header); err != nil {
+		return p, readError(0, "header", err)
+	}
+	if _, err := parseHeader(header); err != nil {
+		return p, err
+	}
+	p.header = header
+
+	lengthSize, err := opts.lengthFieldSize()
+	if err != nil {
+		return p, err
+	}
+	p.lengthSize = lengthSize
+
+	steps, err := opts.stepsPerInstrument()
+	if err != nil {
+		return p, err
+	}
+	if _, err := opts.StepPacking.stepsSize(steps); err != nil {
+		return p, err
+	}
+	if opts.StepsPerBeat < 0 {
+		return p, fmt.Errorf("%w: steps can't be played %d to a beat", ErrInvalidStep, opts.StepsPerBeat)
+	}
+	p.resolution = opts.StepsPerBeat
+
+	tempoSize, err := opts.TempoFormat.size()
+	if err != nil {
+		return p, err
+	}
+	if _, err := opts.versionSize(); err != nil {
+		return p, err
+	}
+
+	lengthBin := make([]byte, lengthSize)
+	if _, err := io.ReadFull(d.r, lengthBin); err != nil {
+		return p, readError(headerSize, "payload length", err)
+	}
+	length := payloadLength(header, lengthBin, opts.byteOrder())
+	if length > uint64(opts.maxPayload()) {
+		return p, decodeError(headerSize, "payload length", fmt.Errorf("%w: declared payload of %d bytes is over the %d byte limit",
+			ErrPayloadTooLarge, length, opts.maxPayload()))
+	}
+
+	// the version is looked for in what's already buffered, up to the end
+	// of the payload
+	opts = opts.withKnownVersions()
+	if len(opts.Dialects) > 0 {
+		peek := d.r.Size()
+		if length < uint64(peek) {
+			peek = int(length)
+		}
+		head, _ := d.r.Peek(peek)
+		opts = opts.withDialect(head)
+	}
+	versionSize, err := opts.versionSize()
+	if err != nil {
+		return p, err
+	}
+	p.byteOrder = opts.ByteOrder
+	p.versionSize = opts.VersionSize
+
+	// whatever happens, leave the stream at the start of the next pattern,
+	// past any extension area, whose chunks can't be applied to instruments
+	// that have already been passed on
+	payload := io.LimitReader(d.r, int64(length))
+	defer func() {
+		io.Copy(ioutil.Discard, payload)
+		readExtension(d.r, &Pattern{byteOrder: opts.ByteOrder}, headerSize+lengthSize+int(length), opts)
+	}()
+
+	offset := headerSize + lengthSize
+	fields := make([]byte, versionSize+tempoSize)
+	if _, err := io.ReadFull(payload, fields[:versionSize]); err != nil {
+		return p, readError(offset, "version", err)
+	}
+	p.version = string(bytes.Trim(fields[:versionSize], "\x00"))
+	if err := opts.checkVersion(p.version); err != nil {
+		return p, decodeError(offset, "version", err)
+	}
+
+	offset += versionSize
+	if _, err := io.ReadFull(payload, fields[versionSize:]); err != nil {
+		return p, readError(offset, "tempo", err)
+	}
+	if p.tempo, _, err = opts.TempoFormat.decode(fields[versionSize:], opts.byteOrder()); err != nil {
+		return p, decodeError(offset, "tempo", err)
+	}
+	p.tempoBin = fields[versionSize:]
+
+	offset += tempoSize
+	seen := make(map[uint32]bool)
+
+	for count := 0; ; count++ {
+		inst, n, err := readStreamInstrument(payload, offset, opts)
+		if err == io.EOF {
+			return p, nil
+		}
+		if err != nil {
+			return p, err
+		}
+
+		if count >= opts.maxInstruments() {
+			return p, decodeError(offset, "instrument",
+				fmt.Errorf("%w: pattern has more than %d", ErrTooManyInstruments, opts.maxInstruments()))
+		}
+		if opts.RejectDuplicateIDs && seen[inst.num] {
+			return p, decodeError(offset, "instrument id", fmt.Errorf("%w: %d appears more than once", ErrDuplicateID, inst.num))
+		}
+		seen[inst.num] = true
+		if err := opts.checkInstrument(p.version, inst); err != nil {
+			return p, decodeError(offset, "instrument", err)
+		}
+
+		if err := d.onInstrument(inst); err != nil {
+			return p, err
+		}
+		offset += n
+	}
+}
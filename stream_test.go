@@ -0,0 +1,191 @@
+package drum
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeStream(t *testing.T) {
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_1.splice - %v", err)
+	}
+
+	f, err := os.Open(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	header, instruments, err := DecodeStream(f)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if header.Version != decoded.version || header.Tempo != decoded.tempo {
+		t.Errorf("got header %+v, expected version %q and tempo %v", header, decoded.version, decoded.tempo)
+	}
+
+	streamed := Pattern{version: header.Version, tempo: header.Tempo}
+	for next := range instruments {
+		if next.Err != nil {
+			t.Fatalf("unexpected error %v", next.Err)
+		}
+		streamed.instruments = append(streamed.instruments, next.Instrument)
+	}
+	if !streamed.Equal(*decoded) {
+		t.Errorf("streaming gave a different pattern.\nGot:\n%s\nExpected:\n%s", streamed, decoded)
+	}
+}
+
+func TestDecodeStreamTruncated(t *testing.T) {
+
+	f, err := os.Open(path.Join("fixtures", "truncated_payload.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	_, instruments, err := DecodeStream(f)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	var last InstrumentOrError
+	count := 0
+	for next := range instruments {
+		last = next
+		count++
+	}
+	if !errors.Is(last.Err, ErrTruncated) {
+		t.Errorf("expected the last value to be %v, got %v after %d values", ErrTruncated, last.Err, count)
+	}
+}
+
+func TestDecodeStreamContextCancelled(t *testing.T) {
+
+	f, err := os.Open(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, instruments, err := DecodeStreamContext(ctx, f)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	<-instruments
+	cancel()
+
+	// once cancelled the goroutine may send at most the value it was already
+	// sending before closing the channel
+	count := 0
+	for range instruments {
+		count++
+	}
+	if count > 1 {
+		t.Errorf("received %d instruments after cancelling", count)
+	}
+}
+
+func TestDecoder(t *testing.T) {
+
+	names := []string{"pattern_1.splice", "pattern_2.splice", "pattern_4.splice"}
+
+	var stream []byte
+	var expected []*Pattern
+	for _, name := range names {
+		data, err := ioutil.ReadFile(path.Join("fixtures", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		stream = append(stream, data...)
+
+		p, err := DecodeFile(path.Join("fixtures", name))
+		if err != nil {
+			t.Fatalf("something went wrong decoding %s - %v", name, err)
+		}
+		expected = append(expected, p)
+	}
+
+	d := NewDecoder(bytes.NewReader(stream))
+	for n, exp := range expected {
+		p, err := d.NextPattern()
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", names[n], err)
+		}
+		if p.String() != exp.String() {
+			t.Errorf("%s decoded as\n%s", names[n], p)
+		}
+	}
+	if _, err := d.NextPattern(); err != io.EOF {
+		t.Errorf("expected io.EOF after the last pattern, got %v", err)
+	}
+
+	// instruments go to the callback, and an error from it skips the rest
+	// of its pattern
+	var got []string
+	stopped := false
+	d = NewDecoder(bytes.NewReader(stream))
+	d.OnInstrument(func(inst Instrument) error {
+		got = append(got, inst.name)
+		if inst.name == "snare" && !stopped {
+			stopped = true
+			return errors.New("enough")
+		}
+		return nil
+	})
+
+	if _, err := d.NextPattern(); err == nil || err.Error() != "enough" {
+		t.Errorf("expected the callback's error, got %v", err)
+	}
+	if !reflect.DeepEqual(got, []string{"kick", "snare"}) {
+		t.Errorf("expected kick and snare, got %v", got)
+	}
+
+	got = nil
+	p, err := d.NextPattern()
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if p.version != expected[1].version || p.tempo != expected[1].tempo || len(p.instruments) != 0 {
+		t.Errorf("expected pattern_2's header without its instruments, got\n%s", p)
+	}
+	if len(got) != len(expected[1].instruments) || got[0] != expected[1].instruments[0].name {
+		t.Errorf("expected pattern_2's instruments, got %v", got)
+	}
+
+	// a stream cut short part way through a pattern
+	for _, fn := range []func(Instrument) error{nil, func(Instrument) error { return nil }} {
+		d = NewDecoder(bytes.NewReader(stream[:100]))
+		d.OnInstrument(fn)
+		var de *DecodeError
+		if _, err := d.NextPattern(); !errors.Is(err, ErrTruncated) || !errors.As(err, &de) {
+			t.Errorf("expected a truncated pattern, got %v", err)
+		}
+	}
+
+	column, err := ioutil.ReadFile(path.Join("fixtures", "column_major.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = nil
+	d = NewDecoder(bytes.NewReader(column))
+	d.SetOptions(DecodeOptions{Layout: LayoutColumnMajor, InstrumentCount: 6})
+	d.OnInstrument(func(inst Instrument) error { got = append(got, inst.Line('x', '-')); return nil })
+	if _, err := d.NextPattern(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if len(got) != 6 || got[0] != expected[0].instruments[0].Line('x', '-') {
+		t.Errorf("expected pattern_1's instruments, got %v", got)
+	}
+}
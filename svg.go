@@ -0,0 +1,95 @@
+package drum
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// SVGOptions adjusts the image WriteSVG draws. Zero fields take the
+// defaults listed against them.
+type SVGOptions struct {
+	// CellSize is the width and height of each step's cell in pixels.
+	// Zero means 20.
+	CellSize int
+	// LabelWidth is the width in pixels of the column of instrument names
+	// to the left of the grid. Zero means 120.
+	LabelWidth int
+	// OnColor fills the cells of hits. Empty means "#222".
+	OnColor string
+	// OffColor fills the cells of rests. Empty means "#eee".
+	OffColor string
+	// TextColor is the color of the instrument names. Empty means "#000".
+	TextColor string
+}
+
+func (o SVGOptions) withDefaults() SVGOptions {
+
+	if o.CellSize <= 0 {
+		o.CellSize = 20
+	}
+	if o.LabelWidth <= 0 {
+		o.LabelWidth = 120
+	}
+	if o.OnColor == "" {
+		o.OnColor = "#222"
+	}
+	if o.OffColor == "" {
+		o.OffColor = "#eee"
+	}
+	if o.TextColor == "" {
+		o.TextColor = "#000"
+	}
+	return o
+}
+
+// WriteSVG draws the pattern to w as a standalone SVG image: one row of
+// square cells per instrument, filled with opts.OnColor for hits and
+// opts.OffColor for rests, with the instrument's id and name labelled to
+// the left of its row.
+func (p Pattern) WriteSVG(w io.Writer, opts SVGOptions) error {
+
+	opts = opts.withDefaults()
+	cell := opts.CellSize
+
+	columns := p.loopSteps()
+	width := opts.LabelWidth + columns*cell
+	height := len(p.instruments) * cell
+
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	fmt.Fprintf(bw, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" viewBox=\"0 0 %d %d\">\n",
+		width, height, width, height)
+
+	for row, inst := range p.instruments {
+		y := row * cell
+
+		fmt.Fprintf(bw, "<text x=\"0\" y=\"%d\" font-family=\"monospace\" font-size=\"%d\" fill=\"%s\">",
+			y+cell*3/4, cell*3/4, escapeXML(opts.TextColor))
+		xml.EscapeText(bw, []byte(fmt.Sprintf("(%d) %s", inst.num, inst.name)))
+		fmt.Fprintf(bw, "</text>\n")
+
+		for s, step := range inst.steps() {
+			fill := opts.OffColor
+			if isOn(step) {
+				fill = opts.OnColor
+			}
+			fmt.Fprintf(bw, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"%s\" stroke=\"#fff\"/>\n",
+				opts.LabelWidth+s*cell, y, cell, cell, escapeXML(fill))
+		}
+	}
+
+	fmt.Fprintf(bw, "</svg>\n")
+	return bw.Flush()
+}
+
+// escapeXML returns s with the characters XML treats specially escaped
+func escapeXML(s string) string {
+
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
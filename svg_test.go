@@ -0,0 +1,63 @@
+package drum
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"path"
+	"testing"
+)
+
+func TestWriteSVG(t *testing.T) {
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_1.splice - %v", err)
+	}
+	decoded.instruments[0].name = "kick & <bass>"
+
+	var buf bytes.Buffer
+	if err := decoded.WriteSVG(&buf, SVGOptions{OnColor: "red"}); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	var labels []string
+	rects, hits := 0, 0
+
+	dec := xml.NewDecoder(&buf)
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("WriteSVG didn't write well formed XML: %v", err)
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if tok.Name.Local == "rect" {
+				rects++
+				for _, attr := range tok.Attr {
+					if attr.Name.Local == "fill" && attr.Value == "red" {
+						hits++
+					}
+				}
+			}
+		case xml.CharData:
+			if s := string(bytes.TrimSpace(tok)); s != "" {
+				labels = append(labels, s)
+			}
+		}
+	}
+
+	if rects != 6*16 {
+		t.Errorf("expected a cell for each of the 96 steps, got %d", rects)
+	}
+	if hits != 18 {
+		t.Errorf("expected 18 cells filled for hits, got %d", hits)
+	}
+	if len(labels) != 6 || labels[0] != "(0) kick & <bass>" || labels[5] != "(5) cowbell" {
+		t.Errorf("got labels %q", labels)
+	}
+}
@@ -0,0 +1,89 @@
+package drum
+
+import "strings"
+
+// Template describes an archetypal rhythm as a set of hits the pattern must
+// contain. Extra hits beyond those a template requires don't stop a match.
+type Template struct {
+	Name string
+	Hits []TemplateHit
+}
+
+// TemplateHit requires an instrument named one of Names, ignoring case, to
+// have a hit on every step in Steps. Steps index the flat step sequence.
+type TemplateHit struct {
+	Names []string
+	Steps []int
+}
+
+// FourOnTheFloor is a kick on every quarter note of the bar
+func FourOnTheFloor() Template {
+
+	return Template{
+		Name: "four on the floor",
+		Hits: []TemplateHit{{Names: []string{"kick"}, Steps: []int{0, 4, 8, 12}}},
+	}
+}
+
+// Backbeat is a snare or clap on the second and fourth quarter notes
+func Backbeat() Template {
+
+	return Template{
+		Name: "backbeat",
+		Hits: []TemplateHit{{Names: []string{"snare", "clap"}, Steps: []int{4, 12}}},
+	}
+}
+
+// OffbeatHiHat is a hi-hat on every eighth note between the quarter notes
+func OffbeatHiHat() Template {
+
+	return Template{
+		Name: "offbeat hi-hat",
+		Hits: []TemplateHit{{Names: []string{"hh-open", "hh-close", "hh-closed", "hihat"}, Steps: []int{2, 6, 10, 14}}},
+	}
+}
+
+// MatchesTemplate reports whether the pattern has every hit t requires.
+// Each of the template's hits is satisfied when any one instrument with a
+// matching name has all of its steps on.
+func (p Pattern) MatchesTemplate(t Template) bool {
+
+	for _, hit := range t.Hits {
+		if !p.hasTemplateHit(hit) {
+			return false
+		}
+	}
+	return len(t.Hits) > 0
+}
+
+func (p Pattern) hasTemplateHit(hit TemplateHit) bool {
+
+	for _, inst := range p.instruments {
+		if !nameIn(inst.name, hit.Names) {
+			continue
+		}
+
+		matched := true
+		for _, global := range hit.Steps {
+			if step, err := inst.step(global); err != nil || !isOn(step) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// nameIn reports whether name equals any of names, ignoring case
+func nameIn(name string, names []string) bool {
+
+	for _, n := range names {
+		if strings.EqualFold(name, n) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,33 @@
+package drum
+
+import (
+	"path"
+	"testing"
+)
+
+func TestMatchesTemplate(t *testing.T) {
+	tData := []struct {
+		path     string
+		template Template
+		expected bool
+	}{
+		{"pattern_1.splice", FourOnTheFloor(), true},
+		{"pattern_1.splice", Backbeat(), true},
+		{"pattern_1.splice", OffbeatHiHat(), true},
+		{"pattern_2.splice", FourOnTheFloor(), false},
+		{"pattern_3.splice", Backbeat(), true},
+		{"pattern_4.splice", FourOnTheFloor(), false},
+		{"pattern_5.splice", Template{}, false},
+	}
+
+	for _, exp := range tData {
+
+		decoded, err := DecodeFile(path.Join("fixtures", exp.path))
+		if err != nil {
+			t.Fatalf("something went wrong decoding %s - %v", exp.path, err)
+		}
+		if got := decoded.MatchesTemplate(exp.template); got != exp.expected {
+			t.Errorf("%s %q: got %v, expected %v", exp.path, exp.template.Name, got, exp.expected)
+		}
+	}
+}
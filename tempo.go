@@ -0,0 +1,192 @@
+package drum
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// tempoEpsilon is how far apart two tempos can be and still count as equal,
+// absorbing the noise of float32 tempos such as 119.99999
+const tempoEpsilon = 1e-3
+
+// TempoInRange reports whether the pattern's tempo is between min and max
+// BPM inclusive, allowing for float32 noise at either end.
+func (p Pattern) TempoInRange(min, max float32) bool {
+
+	return p.tempo >= min-tempoEpsilon && p.tempo <= max+tempoEpsilon
+}
+
+// Ratio is a musical tempo ratio of Num to Den
+type Ratio struct {
+	Num int
+	Den int
+}
+
+// Common tempo ratios
+var (
+	// HalfTime halves the tempo.
+	HalfTime = Ratio{1, 2}
+	// DoubleTime doubles the tempo.
+	DoubleTime = Ratio{2, 1}
+	// Triplet plays three steps in the time of two.
+	Triplet = Ratio{3, 2}
+)
+
+// ApplyTempoRatio multiplies the pattern's tempo by r.Num / r.Den. It returns
+// an error, leaving the tempo unchanged, if the ratio or the resulting tempo
+// isn't finite and positive.
+func (p *Pattern) ApplyTempoRatio(r Ratio) error {
+
+	if r.Num <= 0 || r.Den <= 0 {
+		return fmt.Errorf("tempo ratio %d/%d must be positive", r.Num, r.Den)
+	}
+
+	bpm := float64(p.tempo) * float64(r.Num) / float64(r.Den)
+	if math.IsNaN(bpm) || bpm <= 0 || bpm > math.MaxFloat32 {
+		return fmt.Errorf("tempo %v scaled by %d/%d gives %v, which isn't a usable tempo", p.tempo, r.Num, r.Den, bpm)
+	}
+
+	p.SetTempo(float32(bpm))
+	return nil
+}
+
+// loopSteps returns the number of steps in one loop of the pattern, the step
+// count of its longest instrument
+func (p Pattern) loopSteps() int {
+
+	steps := 0
+
+	for _, inst := range p.instruments {
+		if n := inst.stepCount(); n > steps {
+			steps = n
+		}
+	}
+	return steps
+}
+
+// Duration returns how long one loop of the pattern plays for at its tempo
+// and resolution. A pattern without a positive tempo has no duration.
+func (p Pattern) Duration() time.Duration {
+
+	if p.tempo <= 0 {
+		return 0
+	}
+
+	beats := float64(p.loopSteps()) / float64(p.beatSteps())
+	return time.Duration(beats * float64(time.Minute) / float64(p.tempo))
+}
+
+// stepNanos returns the length of a step in nanoseconds, unrounded, or 0
+// for a pattern without a positive tempo
+func (p Pattern) stepNanos() float64 {
+
+	if !(p.tempo > 0) {
+		return 0
+	}
+	return float64(time.Minute) / float64(p.tempo) / float64(p.beatSteps())
+}
+
+// StepDuration returns how long each step plays for at the pattern's tempo
+// and resolution, rounded to the nearest nanosecond. A pattern without a
+// positive tempo has steps of no duration.
+func (p Pattern) StepDuration() time.Duration {
+
+	return time.Duration(math.Round(p.stepNanos()))
+}
+
+// TimeOfStep returns when a step begins counting from the start of the
+// loop, given the measure of four steps it's in and its index within the
+// measure, as an instrument's steps are grouped. Steps past the end of the
+// loop count on into the loops after it. The time is worked out from the
+// start rather than by adding up step durations, so fractional tempos don't
+// drift.
+func (p Pattern) TimeOfStep(measure, step int) time.Duration {
+
+	return p.timeOfStep(measure*stepsPerMeasure + step)
+}
+
+// timeOfStep returns when the step at the given index into the flat step
+// sequence begins
+func (p Pattern) timeOfStep(global int) time.Duration {
+
+	return time.Duration(math.Round(float64(global) * p.stepNanos()))
+}
+
+// StepAt returns the measure and the step within it that is playing t into
+// the pattern, as TimeOfStep counts them. The pattern loops, so a t past
+// the end of the loop finds the step in the loop it falls in; a negative t
+// gives the first step, as does a pattern without steps or a positive
+// tempo. A step starts exactly at the time TimeOfStep gives for it.
+func (p Pattern) StepAt(t time.Duration) (measure, step int) {
+
+	nanos, steps := p.stepNanos(), p.loopSteps()
+	if nanos == 0 || steps == 0 || t < 0 {
+		return 0, 0
+	}
+
+	global := int(float64(t) / nanos)
+	// rounding at either end can leave t a nanosecond either side of where
+	// timeOfStep puts the step it should be in
+	for global > 0 && p.timeOfStep(global) > t {
+		global--
+	}
+	for p.timeOfStep(global+1) <= t {
+		global++
+	}
+
+	global %= steps
+	return global / stepsPerMeasure, global % stepsPerMeasure
+}
+
+// FitDuration sets the tempo so that one loop of the pattern plays for d at
+// its resolution, so Duration then returns d. It returns an error, leaving
+// the tempo unchanged, if d isn't positive, the pattern has no steps or the
+// tempo needed isn't usable.
+func (p *Pattern) FitDuration(d time.Duration) error {
+
+	if d <= 0 {
+		return fmt.Errorf("loop duration %v must be positive", d)
+	}
+
+	steps := p.loopSteps()
+	if steps == 0 {
+		return fmt.Errorf("a pattern without steps can't be fitted to %v", d)
+	}
+
+	bpm := float64(steps) / float64(p.beatSteps()) * float64(time.Minute) / float64(d)
+	if bpm > math.MaxFloat32 {
+		return fmt.Errorf("fitting %d steps into %v needs a tempo of %v, which isn't a usable tempo", steps, d, bpm)
+	}
+
+	p.SetTempo(float32(bpm))
+	return nil
+}
+
+// DefaultTempoGranularity is the BPM step SnapTempo rounds to
+const DefaultTempoGranularity = 0.5
+
+// SnapTempo rounds the tempo to the nearest multiple of
+// DefaultTempoGranularity, so noisy tempos such as 119.9998 become 120.
+func (p *Pattern) SnapTempo() {
+
+	p.SnapTempoTo(DefaultTempoGranularity)
+}
+
+// SnapTempoTo rounds the tempo to the nearest multiple of granularity BPM,
+// rounding halves away from zero. It returns an error, leaving the tempo
+// unchanged, if granularity isn't positive. A tempo that is already a
+// multiple is left alone, keeping the exact bytes it was decoded from.
+func (p *Pattern) SnapTempoTo(granularity float32) error {
+
+	if !(granularity > 0) || math.IsInf(float64(granularity), 1) {
+		return fmt.Errorf("tempo granularity %v must be positive", granularity)
+	}
+
+	g := float64(granularity)
+	snapped := float32(math.Round(float64(p.tempo)/g) * g)
+	if snapped != p.tempo {
+		p.SetTempo(snapped)
+	}
+	return nil
+}
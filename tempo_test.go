@@ -0,0 +1,192 @@
+package drum
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTempoInRange(t *testing.T) {
+	tData := []struct {
+		tempo    float32
+		expected bool
+	}{
+		{120, true},
+		{118, true},
+		{124, true},
+		{117.99999, true},
+		{117.9, false},
+		{124.1, false},
+	}
+
+	for _, exp := range tData {
+		if got := (Pattern{tempo: exp.tempo}).TempoInRange(118, 124); got != exp.expected {
+			t.Errorf("%v: got %v, expected %v", exp.tempo, got, exp.expected)
+		}
+	}
+}
+
+func TestApplyTempoRatio(t *testing.T) {
+	tData := []struct {
+		tempo    float32
+		ratio    Ratio
+		expected float32
+		fail     bool
+	}{
+		{120, HalfTime, 60, false},
+		{120, DoubleTime, 240, false},
+		{120, Triplet, 180, false},
+		{98.4, Ratio{3, 4}, 73.8, false},
+		{120, Ratio{1, 0}, 120, true},
+		{120, Ratio{-1, 2}, 120, true},
+		{0, DoubleTime, 0, true},
+	}
+
+	for _, exp := range tData {
+
+		p := Pattern{tempo: exp.tempo}
+		err := p.ApplyTempoRatio(exp.ratio)
+
+		if exp.fail != (err != nil) {
+			t.Errorf("%v * %v: unexpected error result %v", exp.tempo, exp.ratio, err)
+		}
+		if p.tempo != exp.expected {
+			t.Errorf("%v * %v: got %v, expected %v", exp.tempo, exp.ratio, p.tempo, exp.expected)
+		}
+	}
+}
+
+func TestFitDuration(t *testing.T) {
+
+	p := Pattern{tempo: 120, instruments: []Instrument{
+		{num: 0, name: "kick", measure: []Step{{1, 0, 0, 0}, {1, 0, 0, 0}, {1, 0, 0, 0}, {1, 0, 0, 0}}},
+		{num: 1, name: "snare", measure: []Step{{0, 0, 1, 0}}},
+	}}
+
+	if got := p.Duration(); got != 2*time.Second {
+		t.Fatalf("16 steps at 120bpm should last 2s, got %v", got)
+	}
+
+	tData := []struct {
+		d     time.Duration
+		tempo float32
+	}{
+		{4 * time.Second, 60},
+		{time.Second, 240},
+		{1500 * time.Millisecond, 160},
+	}
+
+	for _, exp := range tData {
+		if err := p.FitDuration(exp.d); err != nil {
+			t.Fatalf("%v: unexpected error %v", exp.d, err)
+		}
+		if p.tempo != exp.tempo {
+			t.Errorf("%v: got tempo %v, expected %v", exp.d, p.tempo, exp.tempo)
+		}
+		if got := p.Duration(); got != exp.d {
+			t.Errorf("%v: the fitted pattern lasts %v", exp.d, got)
+		}
+	}
+
+	for _, d := range []time.Duration{0, -time.Second} {
+		if err := p.FitDuration(d); err == nil {
+			t.Errorf("%v: expected an error", d)
+		}
+	}
+	if err := (&Pattern{tempo: 120}).FitDuration(time.Second); err == nil {
+		t.Errorf("expected an error fitting a pattern without steps")
+	}
+}
+
+func TestSnapTempo(t *testing.T) {
+	tData := []struct {
+		tempo       float32
+		granularity float32
+		expected    float32
+	}{
+		{119.9998, DefaultTempoGranularity, 120},
+		{98.4, DefaultTempoGranularity, 98.5},
+		{98.2, DefaultTempoGranularity, 98},
+		{97.75, DefaultTempoGranularity, 98},
+		{98.4, 1, 98},
+		{98.4, 5, 100},
+		{98.4, 0.1, 98.4},
+	}
+
+	for _, exp := range tData {
+		p := Pattern{tempo: exp.tempo}
+		if err := p.SnapTempoTo(exp.granularity); err != nil {
+			t.Fatalf("%v by %v: unexpected error %v", exp.tempo, exp.granularity, err)
+		}
+		if p.tempo != exp.expected {
+			t.Errorf("%v by %v: got %v, expected %v", exp.tempo, exp.granularity, p.tempo, exp.expected)
+		}
+	}
+
+	p := Pattern{tempo: 119.9998}
+	p.SnapTempo()
+	if p.tempo != 120 {
+		t.Errorf("SnapTempo gave %v, expected 120", p.tempo)
+	}
+
+	for _, granularity := range []float32{0, -0.5, float32(math.NaN())} {
+		if err := p.SnapTempoTo(granularity); err == nil {
+			t.Errorf("granularity %v: expected an error", granularity)
+		}
+	}
+}
+
+func TestStepTimes(t *testing.T) {
+
+	p := NewPattern("time", 120)
+	p.AddInstrument(0, "kick").SetSteps("x---x---x---x---")
+
+	if d := p.StepDuration(); d != 125*time.Millisecond {
+		t.Errorf("expected steps of 125ms at 120 BPM, got %v", d)
+	}
+	if d := p.TimeOfStep(2, 1); d != 1125*time.Millisecond {
+		t.Errorf("expected measure 2 step 1 at 1.125s, got %v", d)
+	}
+
+	tData := []struct {
+		at      time.Duration
+		measure int
+		step    int
+	}{
+		{0, 0, 0},
+		{124 * time.Millisecond, 0, 0},
+		{125 * time.Millisecond, 0, 1},
+		{1999 * time.Millisecond, 3, 3},
+		{2 * time.Second, 0, 0},
+		{2625 * time.Millisecond, 1, 1},
+		{-time.Second, 0, 0},
+	}
+	for _, exp := range tData {
+		if m, s := p.StepAt(exp.at); m != exp.measure || s != exp.step {
+			t.Errorf("StepAt(%v): got measure %d step %d, expected measure %d step %d", exp.at, m, s, exp.measure, exp.step)
+		}
+	}
+
+	// at a fractional tempo every step still starts where TimeOfStep says
+	p.SetTempo(98.4)
+	for global := 0; global < 64; global++ {
+		at := p.TimeOfStep(0, global)
+		if m, s := p.StepAt(at); m*4+s != global%16 {
+			t.Errorf("98.4 BPM: step %d starts at %v, where StepAt finds measure %d step %d", global, at, m, s)
+		}
+		if m, s := p.StepAt(at - 1); global > 0 && m*4+s != (global-1)%16 {
+			t.Errorf("98.4 BPM: just before step %d StepAt finds measure %d step %d", global, m, s)
+		}
+	}
+	if d := p.TimeOfStep(16, 0) - 4*p.Duration(); d < 0 || d > 4 {
+		t.Errorf("expected 4 loops to take %v, got %v", 4*p.Duration(), p.TimeOfStep(16, 0))
+	}
+
+	p.SetTempo(0)
+	if d := p.StepDuration(); d != 0 {
+		t.Errorf("expected no step duration without a tempo, got %v", d)
+	}
+	if m, s := p.StepAt(time.Second); m != 0 || s != 0 {
+		t.Errorf("expected the first step without a tempo, got measure %d step %d", m, s)
+	}
+}
@@ -0,0 +1,190 @@
+package drum
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The header lines of the text form of a pattern, as String writes them
+const (
+	versionPrefix = "Saved with HW Version: "
+	tempoPrefix   = "Tempo: "
+)
+
+// ParseText parses a pattern in the text form String writes:
+//
+//	Saved with HW Version: 0.808-alpha
+//	Tempo: 120
+//	(0) kick	|x---|----|x---|----|
+//	(1) snare	|----|x---|----|x---|
+//
+// Each track line is the instrument's id in parentheses, a space, its name,
+// a tab and its steps, where x is a hit and - a rest, in bars between |
+// separators. Blank lines are skipped and the last line needn't end in a
+// newline, but nothing else differs from String: in particular names are
+// kept exactly as written, spaces and all. Parsing the text String returns
+// gives a pattern whose String is the same text, as long as the version
+// and instrument names hold no newlines. Errors name the line, counting
+// from 1, and for a bad step character its column.
+func ParseText(r io.Reader) (Pattern, error) {
+
+	p := Pattern{instruments: []Instrument{}}
+	br := bufio.NewReader(r)
+	headers := 0
+
+	for n := 1; ; n++ {
+		line, err := br.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return Pattern{}, err
+		}
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case line == "":
+		case headers == 0:
+			if !strings.HasPrefix(line, versionPrefix) {
+				return Pattern{}, fmt.Errorf("line %d: expected %q, got %q", n, versionPrefix, line)
+			}
+			p.version = line[len(versionPrefix):]
+			headers++
+		case headers == 1:
+			if !strings.HasPrefix(line, tempoPrefix) {
+				return Pattern{}, fmt.Errorf("line %d: expected %q, got %q", n, tempoPrefix, line)
+			}
+			tempo, perr := strconv.ParseFloat(line[len(tempoPrefix):], 32)
+			if perr != nil {
+				return Pattern{}, fmt.Errorf("line %d: tempo %q is not a number", n, line[len(tempoPrefix):])
+			}
+			p.tempo = float32(tempo)
+			headers++
+		default:
+			inst, perr := parseTextTrack(line)
+			if perr != nil {
+				return Pattern{}, fmt.Errorf("line %d: %w", n, perr)
+			}
+			p.instruments = append(p.instruments, inst)
+		}
+
+		if err != nil {
+			break
+		}
+	}
+
+	if headers < 2 {
+		return Pattern{}, fmt.Errorf("the text has no version and tempo lines")
+	}
+	return p, nil
+}
+
+// parseTextTrack parses a track line of the text form, keeping its bars as
+// the instrument's measures
+func parseTextTrack(line string) (Instrument, error) {
+
+	if !strings.HasPrefix(line, "(") {
+		return Instrument{}, fmt.Errorf("track line %q doesn't start with an (id)", line)
+	}
+	end := strings.Index(line, ") ")
+	if end < 0 {
+		return Instrument{}, fmt.Errorf("track line %q has no ) after its id", line)
+	}
+	id, err := strconv.ParseUint(line[1:end], 10, 32)
+	if err != nil {
+		return Instrument{}, fmt.Errorf("track line %q: id %q is not a 32 bit number", line, line[1:end])
+	}
+
+	// the grid holds no tabs, so the last tab ends the name
+	tab := strings.LastIndex(line, "\t|")
+	if tab < end+2 {
+		return Instrument{}, fmt.Errorf("track line %q has no tab and | before its steps", line)
+	}
+	grid := line[tab+1:]
+	if !strings.HasSuffix(grid, "|") {
+		return Instrument{}, fmt.Errorf("track line %q doesn't end with |", line)
+	}
+
+	inst := Instrument{num: uint32(id), name: line[end+2 : tab], measure: []Step{}}
+	column := len([]rune(line[:tab+2]))
+
+	if grid != "|" {
+		for _, bar := range strings.Split(grid[1:len(grid)-1], "|") {
+
+			if strings.Contains(bar, " ") {
+				return Instrument{}, fmt.Errorf("invalid step character ' ' at column %d", column+strings.Index(bar, " ")+1)
+			}
+			steps, err := parseSteps(bar, column)
+			if err != nil {
+				return Instrument{}, err
+			}
+
+			measure := make(Step, len(steps))
+			for s, on := range steps {
+				if on {
+					measure[s] = StepOn
+				}
+			}
+			inst.measure = append(inst.measure, measure)
+			column += len([]rune(bar)) + 1
+		}
+	}
+	return inst, nil
+}
+
+// ParseTrackLine parses a single track line such as
+//
+//	kick    |x---|x---|x---|x---|
+//
+// into the instrument name and its steps, where x is a hit and - a rest.
+// The name is everything before the first |, with surrounding whitespace
+// and an optional "(id)" prefix as written by String removed. Spaces and
+// | bar separators in the grid are ignored; any other character is an
+// error that reports its column, counting from 1.
+func ParseTrackLine(line string) (name string, steps []bool, err error) {
+
+	bar := strings.Index(line, "|")
+	if bar < 0 {
+		return "", nil, fmt.Errorf("track line %q has no | separated steps", line)
+	}
+
+	name = strings.TrimSpace(line[:bar])
+	if strings.HasPrefix(name, "(") {
+		if end := strings.Index(name, ")"); end > 0 {
+			name = strings.TrimSpace(name[end+1:])
+		}
+	}
+	if name == "" {
+		return "", nil, fmt.Errorf("track line %q has no instrument name", line)
+	}
+
+	steps, err = parseSteps(line[bar:], len([]rune(line[:bar])))
+	if err != nil {
+		return "", nil, err
+	}
+	return name, steps, nil
+}
+
+// parseSteps parses a grid of steps where x is a hit and - a rest, ignoring
+// spaces and | bar separators. Columns in errors count from 1 after the
+// given number of characters that came before the grid.
+func parseSteps(grid string, column int) ([]bool, error) {
+
+	var steps []bool
+
+	for _, r := range grid {
+		column++
+
+		switch r {
+		case 'x':
+			steps = append(steps, true)
+		case '-':
+			steps = append(steps, false)
+		case '|', ' ':
+		default:
+			return nil, fmt.Errorf("invalid step character %q at column %d", r, column)
+		}
+	}
+	return steps, nil
+}
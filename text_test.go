@@ -0,0 +1,131 @@
+package drum
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseTrackLine(t *testing.T) {
+	tData := []struct {
+		line  string
+		name  string
+		steps string
+	}{
+		{"kick    |x---|x---|x---|x---|", "kick", "x---x---x---x---"},
+		{"(255) Low Conga\t|----|x---|----|x---|", "Low Conga", "----x-------x---"},
+		{"hh |x-x- x-x-|", "hh", "x-x-x-x-"},
+	}
+
+	for _, exp := range tData {
+
+		name, steps, err := ParseTrackLine(exp.line)
+		if err != nil {
+			t.Fatalf("%q: unexpected error %v", exp.line, err)
+		}
+
+		var want []bool
+		for _, r := range exp.steps {
+			want = append(want, r == 'x')
+		}
+		if name != exp.name || !reflect.DeepEqual(steps, want) {
+			t.Errorf("%q: got %q %v", exp.line, name, steps)
+		}
+	}
+}
+
+func TestParseTrackLineInvalid(t *testing.T) {
+
+	_, _, err := ParseTrackLine("kick |x--o|")
+	if err == nil || err.Error() != `invalid step character 'o' at column 10` {
+		t.Errorf("expected an error naming column 10, got %v", err)
+	}
+
+	for _, line := range []string{"kick x---", " |x---|"} {
+		if _, _, err := ParseTrackLine(line); err == nil {
+			t.Errorf("%q: expected an error", line)
+		}
+	}
+}
+
+func TestParseText(t *testing.T) {
+
+	for _, name := range []string{"pattern_1.splice", "pattern_2.splice", "pattern_3.splice", "pattern_4.splice", "pattern_5.splice", "quirks.splice"} {
+
+		decoded, err := DecodeFile(path.Join("fixtures", name))
+		if err != nil {
+			t.Fatalf("something went wrong decoding %s - %v", name, err)
+		}
+
+		parsed, err := ParseText(strings.NewReader(decoded.String()))
+		if err != nil {
+			t.Fatalf("%s: unexpected error %v", name, err)
+		}
+		if parsed.String() != decoded.String() {
+			t.Errorf("%s didn't round trip.\nGot:\n%s\nExpected:\n%s", name, parsed, decoded)
+		}
+	}
+
+	// the text of pattern_1, with a blank line and without the last newline,
+	// compiles to the same file
+	p1, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := strings.Replace(strings.TrimSuffix(p1.String(), "\n"), "\n(", "\n\n(", 1)
+	parsed, err := ParseText(strings.NewReader(text))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	var buf bytes.Buffer
+	if err := parsed.Encode(&buf); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	original, err := ioutil.ReadFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), original) {
+		t.Errorf("expected the text to encode as pattern_1.splice, got\n%x", buf.Bytes())
+	}
+
+	odd := NewPattern(" spaced\tversion ", 98.4)
+	odd.AddInstrument(7, "  two  spaces\t|tab ")
+	odd.instruments = append(odd.instruments,
+		Instrument{num: 4294967295, name: "short", measure: []Step{{1, 0}, {}, {0, 0, 0, 1, 1}}},
+		Instrument{num: 3, name: "empty"})
+	parsed, err = ParseText(strings.NewReader(odd.String()))
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if parsed.String() != odd.String() {
+		t.Errorf("didn't round trip.\nGot:\n%q\nExpected:\n%q", parsed, odd)
+	}
+}
+
+func TestParseTextInvalid(t *testing.T) {
+
+	tData := []struct {
+		text     string
+		expected string
+	}{
+		{"", "the text has no version and tempo lines"},
+		{"Saved with HW Version: 1\n", "the text has no version and tempo lines"},
+		{"Tempo: 120\n", `line 1: expected "Saved with HW Version: "`},
+		{"Saved with HW Version: 1\nTempo: fast\n", `line 2: tempo "fast" is not a number`},
+		{"Saved with HW Version: 1\nTempo: 120\nkick\t|x---|\n", "line 3: track line \"kick\\t|x---|\" doesn't start with an (id)"},
+		{"Saved with HW Version: 1\nTempo: 120\n(x) kick\t|x---|\n", `line 3: track line "(x) kick\t|x---|": id "x" is not a 32 bit number`},
+		{"Saved with HW Version: 1\nTempo: 120\n\n(0) kick |x---|\n", "line 4: track line \"(0) kick |x---|\" has no tab and | before its steps"},
+		{"Saved with HW Version: 1\nTempo: 120\n(0) kick\t|x---|x--\n", "line 3: track line \"(0) kick\\t|x---|x--\" doesn't end with |"},
+		{"Saved with HW Version: 1\nTempo: 120\n(0) kick\t|x---|x-o-|\n", "line 3: invalid step character 'o' at column 18"},
+	}
+
+	for _, exp := range tData {
+		if _, err := ParseText(strings.NewReader(exp.text)); err == nil || !strings.HasPrefix(err.Error(), exp.expected) {
+			t.Errorf("%q: expected %s, got %v", exp.text, exp.expected, err)
+		}
+	}
+}
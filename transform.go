@@ -0,0 +1,288 @@
+package drum
+
+import "fmt"
+
+// Upsample multiplies every instrument's resolution by factor, turning each
+// step into factor steps: the first carries the original step and the rest
+// are silent. Upsampling 8 steps by 2 gives 16 steps with every hit on an
+// even step.
+func (p *Pattern) Upsample(factor int) error {
+
+	if factor < 1 {
+		return fmt.Errorf("cannot upsample by a factor of %d", factor)
+	}
+
+	for i := range p.instruments {
+		steps := p.instruments[i].steps()
+		upsampled := make([]byte, len(steps)*factor)
+
+		for s, step := range steps {
+			upsampled[s*factor] = step
+		}
+
+		p.instruments[i].setSteps(upsampled)
+		p.notify(Change{Kind: ChangeSteps, InstrumentID: p.instruments[i].num})
+	}
+	return nil
+}
+
+// Thin returns a copy of the pattern that keeps only every keepEvery-th hit
+// of each instrument, counting from its first hit, and turns the others off:
+// with keepEvery 2 the first, third, fifth... hits remain. A keepEvery below
+// 1 is treated as 1, which keeps every hit.
+func (p Pattern) Thin(keepEvery int) Pattern {
+
+	if keepEvery < 1 {
+		keepEvery = 1
+	}
+
+	result := p.blank()
+
+	for _, inst := range p.instruments {
+		steps := inst.steps()
+		hit := 0
+
+		for s, step := range steps {
+			if !isOn(step) {
+				continue
+			}
+			if hit%keepEvery != 0 {
+				steps[s] = StepOff
+			}
+			hit++
+		}
+
+		inst.setSteps(steps)
+		result.instruments = append(result.instruments, inst)
+	}
+	return result
+}
+
+// Reverse reverses the order of every instrument's steps in place, across
+// measure boundaries, so the last step plays first, as Instrument's Reverse
+// does. Reversing twice gives back the original pattern. It returns p, so
+// transforms can be chained, as in p.Reverse().Rotate(2).
+func (p *Pattern) Reverse() *Pattern {
+
+	return p.apply(Instrument.Reverse)
+}
+
+// Rotate rotates every instrument's steps in place by n steps, as
+// Instrument's Rotate does, and returns p
+func (p *Pattern) Rotate(n int) *Pattern {
+
+	return p.apply(func(i Instrument) Instrument { return i.Rotate(n) })
+}
+
+// Invert swaps every instrument's hits and rests in place, as Instrument's
+// Invert does, and returns p
+func (p *Pattern) Invert() *Pattern {
+
+	return p.apply(Instrument.Invert)
+}
+
+// ShiftMeasure rotates every instrument's steps in place by n measures, as
+// Instrument's ShiftMeasure does, and returns p
+func (p *Pattern) ShiftMeasure(n int) *Pattern {
+
+	return p.apply(func(i Instrument) Instrument { return i.ShiftMeasure(n) })
+}
+
+// MapInstrument replaces the steps of the instrument with the given id
+// with those of fn's result, so that one track can be transformed on its
+// own, as in
+//
+//	p.MapInstrument(2, func(i Instrument) Instrument { return i.Rotate(1).Invert() })
+//
+// The instrument keeps its id, name and playback settings. It returns an
+// error if there's no such instrument or fn leaves it without steps.
+func (p *Pattern) MapInstrument(id uint32, fn func(Instrument) Instrument) error {
+
+	i := p.instrumentIndex(id)
+	if i < 0 {
+		return fmt.Errorf("no instrument with id %d", id)
+	}
+
+	mapped := fn(p.instruments[i].clone())
+	if mapped.stepCount() == 0 {
+		return fmt.Errorf("%w: instrument %d would have no steps", ErrInvalidStep, id)
+	}
+
+	p.instruments[i].measure, p.instruments[i].expression = mapped.measure, mapped.expression
+	p.instruments[i].raw = nil
+	p.notify(Change{Kind: ChangeSteps, InstrumentID: id})
+	return nil
+}
+
+// apply replaces every instrument with fn's result and returns p
+func (p *Pattern) apply(fn func(Instrument) Instrument) *Pattern {
+
+	for i := range p.instruments {
+		p.instruments[i] = fn(p.instruments[i])
+		p.notify(Change{Kind: ChangeSteps, InstrumentID: p.instruments[i].num})
+	}
+	return p
+}
+
+// Rotate returns a copy of the instrument with its steps moved n steps
+// later, those pushed past the end coming round to the start, so rotating
+// "x---x-------" by 1 gives "-x---x------". A negative n moves the steps
+// earlier. Velocities and expressions move with their steps.
+func (i Instrument) Rotate(n int) Instrument {
+
+	count := i.stepCount()
+	if count == 0 {
+		return i.clone()
+	}
+	n %= count
+	return i.permuted(func(s int) int { return (s - n + count) % count })
+}
+
+// ShiftMeasure returns a copy of the instrument rotated by n measures of
+// four steps, as Rotate does by steps
+func (i Instrument) ShiftMeasure(n int) Instrument {
+
+	return i.Rotate(n * stepsPerMeasure)
+}
+
+// Reverse returns a copy of the instrument with its steps in reverse order,
+// the last playing first. Velocities and expressions move with their steps.
+func (i Instrument) Reverse() Instrument {
+
+	count := i.stepCount()
+	return i.permuted(func(s int) int { return count - 1 - s })
+}
+
+// Invert returns a copy of the instrument whose hits are rests and whose
+// rests are hits, at DefaultVelocity and without any Expression
+func (i Instrument) Invert() Instrument {
+
+	steps := i.steps()
+	for s, step := range steps {
+		if isOn(step) {
+			steps[s] = StepOff
+		} else {
+			steps[s] = StepOn
+		}
+	}
+
+	inverted := i.clone()
+	inverted.setSteps(steps)
+	return inverted
+}
+
+// permuted returns a copy of the instrument whose step s is its step
+// from(s), with its expression
+func (i Instrument) permuted(from func(s int) int) Instrument {
+
+	steps := i.steps()
+	moved := make([]byte, len(steps))
+	for s := range moved {
+		moved[s] = steps[from(s)]
+	}
+
+	permuted := i.clone()
+	permuted.setSteps(moved)
+	if i.expression != nil {
+		permuted.expression = make([]Expression, len(moved))
+		for s := range moved {
+			if f := from(s); f < len(i.expression) {
+				permuted.expression[s] = i.expression[f]
+			}
+		}
+	}
+	return permuted
+}
+
+// CallResponse splits the pattern into two complementary halves with all of
+// its instruments, version and tempo: call keeps each instrument's hits in
+// the first half of its steps and silences the rest, and response keeps the
+// hits in the second half. With an odd step count the middle step belongs
+// to the second half. Playing both together gives back the original hits.
+func (p Pattern) CallResponse() (call, response Pattern) {
+
+	call, response = p.blank(), p.blank()
+
+	for _, inst := range p.instruments {
+		first, second := inst.steps(), inst.steps()
+		half := len(first) / 2
+
+		for s := range first {
+			if s < half {
+				second[s] = StepOff
+			} else {
+				first[s] = StepOff
+			}
+		}
+
+		inst.setSteps(first)
+		call.instruments = append(call.instruments, inst)
+		inst.setSteps(second)
+		response.instruments = append(response.instruments, inst)
+	}
+	return call, response
+}
+
+// ActiveSpan returns the range of steps, from start up to but not including
+// end, that runs from the first step any instrument hits to the last. A
+// pattern without hits has the empty span 0, 0.
+func (p Pattern) ActiveSpan() (start, end int) {
+
+	start = -1
+
+	for _, inst := range p.instruments {
+		for s, step := range inst.steps() {
+			if !isOn(step) {
+				continue
+			}
+			if start < 0 || s < start {
+				start = s
+			}
+			if s+1 > end {
+				end = s + 1
+			}
+		}
+	}
+
+	if start < 0 {
+		return 0, 0
+	}
+	return start, end
+}
+
+// TrimSilence cuts every instrument down to the pattern's ActiveSpan,
+// dropping the steps before the first hit and after the last. The same span
+// is cut from every instrument so they stay in time with each other. A
+// pattern without hits is left with no steps.
+func (p *Pattern) TrimSilence() {
+
+	start, end := p.ActiveSpan()
+
+	for i := range p.instruments {
+		steps := p.instruments[i].steps()
+		from, to := start, end
+		if from > len(steps) {
+			from = len(steps)
+		}
+		if to > len(steps) {
+			to = len(steps)
+		}
+
+		p.instruments[i].setSteps(steps[from:to])
+		p.notify(Change{Kind: ChangeSteps, InstrumentID: p.instruments[i].num})
+	}
+}
+
+// Minimize returns a copy of the pattern with its silence dropped: the
+// instruments without hits are removed by RemoveEmptyInstruments and the
+// rest trimmed to their active span by TrimSilence. The version and tempo
+// are kept. Minimizing is lossy: the silent instruments and the rests
+// before the first hit and after the last are gone for good, so where the
+// hits sat in the original loop can't be recovered.
+func (p Pattern) Minimize() Pattern {
+
+	minimal := p.Clone()
+	minimal.RemoveEmptyInstruments()
+	minimal.TrimSilence()
+	return minimal
+}
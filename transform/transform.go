@@ -0,0 +1,88 @@
+// Package transform changes how a drum pattern is played without changing
+// which steps play, by setting the drum.Expression of its hits.
+package transform
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+
+	drum "github.com/chrishiestand/golang-challenge-1-drum_machine"
+)
+
+// Swing returns a copy of p with every odd step pushed late by amount, from
+// 0 for straight time to 1 for the full drum.MaxOffset, which plays each
+// off-beat step halfway to the next. Velocities are kept.
+func Swing(p drum.Pattern, amount float64) (drum.Pattern, error) {
+
+	if math.IsNaN(amount) || amount < 0 || amount > 1 {
+		return drum.Pattern{}, fmt.Errorf("swing amount %v is not between 0 and 1", amount)
+	}
+
+	swung := p.Clone()
+	for _, inst := range swung.Instruments() {
+		for s := 1; s < len(inst.Steps()); s += 2 {
+
+			e, err := inst.Expression(s)
+			if err != nil {
+				return drum.Pattern{}, err
+			}
+
+			e.Offset = amount * drum.MaxOffset
+			if err := swung.SetExpression(inst.ID(), s, e); err != nil {
+				return drum.Pattern{}, err
+			}
+		}
+	}
+	return swung, nil
+}
+
+// Humanize returns a copy of p with every hit's velocity moved at random by
+// up to velocityJitter and its offset by up to timingJitter steps, either
+// way. Velocities are kept between 2 and 127 and stored in the steps'
+// bytes with SetVelocity, so Encode keeps them; offsets are kept within
+// drum.MaxOffset in each step's Expression, which Encode doesn't store.
+// The same seed always gives the same pattern.
+func Humanize(p drum.Pattern, velocityJitter int, timingJitter float64, seed int64) (drum.Pattern, error) {
+
+	if velocityJitter < 0 || velocityJitter > 127 {
+		return drum.Pattern{}, fmt.Errorf("velocity jitter %d is not between 0 and 127", velocityJitter)
+	}
+	if math.IsNaN(timingJitter) || timingJitter < 0 || timingJitter > drum.MaxOffset {
+		return drum.Pattern{}, fmt.Errorf("timing jitter %v is not between 0 and %v", timingJitter, drum.MaxOffset)
+	}
+
+	random := rand.New(rand.NewSource(seed))
+	humanized := p.Clone()
+	for _, inst := range humanized.Instruments() {
+		for s, on := range inst.Steps() {
+
+			if !on {
+				continue
+			}
+
+			e, err := inst.Expression(s)
+			if err != nil {
+				return drum.Pattern{}, err
+			}
+
+			velocity := int(e.EffectiveVelocity()) + random.Intn(2*velocityJitter+1) - velocityJitter
+			e.Velocity = 0
+			e.Offset = clamp(e.Offset+(2*random.Float64()-1)*timingJitter, -drum.MaxOffset, drum.MaxOffset)
+
+			if err := humanized.SetExpression(inst.ID(), s, e); err != nil {
+				return drum.Pattern{}, err
+			}
+			if err := humanized.SetVelocity(inst.ID(), s, uint8(clamp(float64(velocity), 2, 127))); err != nil {
+				return drum.Pattern{}, err
+			}
+		}
+	}
+	return humanized, nil
+}
+
+// clamp limits v to lo..hi
+func clamp(v, lo, hi float64) float64 {
+
+	return math.Max(lo, math.Min(hi, v))
+}
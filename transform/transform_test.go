@@ -0,0 +1,138 @@
+package transform
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	drum "github.com/chrishiestand/golang-challenge-1-drum_machine"
+	"github.com/chrishiestand/golang-challenge-1-drum_machine/drumtest"
+)
+
+// tracks are the instruments of the pattern the transforms are tested on
+var tracks = []drumtest.Track{
+	{ID: 0, Name: "kick", Steps: "x-x-x-x-x-x-x-x-"},
+	{ID: 1, Name: "hat", Steps: "xxxxxxxxxxxxxxxx"},
+}
+
+func TestSwing(t *testing.T) {
+
+	p := drumtest.Pattern(t, "transform", 120, tracks...)
+
+	swung, err := Swing(p, 0.5)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	for _, inst := range swung.Instruments() {
+		for s := range inst.Steps() {
+
+			e, err := inst.Expression(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			expected := 0.0
+			if s%2 == 1 {
+				expected = 0.25
+			}
+			if e.Offset != expected || e.EffectiveVelocity() != drum.DefaultVelocity {
+				t.Errorf("%s step %d: expected offset %v at the default velocity, got %+v", inst.Name(), s, expected, e)
+			}
+		}
+	}
+
+	if e, _ := p.Instruments()[1].Expression(1); e != (drum.Expression{}) {
+		t.Errorf("Swing changed the original pattern: %+v", e)
+	}
+
+	for _, amount := range []float64{-0.1, 1.1} {
+		if _, err := Swing(p, amount); err == nil {
+			t.Errorf("expected an error for swing amount %v", amount)
+		}
+	}
+}
+
+func TestHumanize(t *testing.T) {
+
+	p := drumtest.Pattern(t, "transform", 120, tracks...)
+
+	for n := 0; n < 20; n++ {
+
+		humanized, err := Humanize(p, 40, 0.2, int64(n))
+		if err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+
+		for _, inst := range humanized.Instruments() {
+			for s, on := range inst.Steps() {
+
+				e, err := inst.Expression(s)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !on {
+					if e != (drum.Expression{}) {
+						t.Errorf("%s step %d doesn't play but was given %+v", inst.Name(), s, e)
+					}
+					continue
+				}
+				if v := e.EffectiveVelocity(); v < drum.DefaultVelocity-40 || v > drum.DefaultVelocity+40 {
+					t.Errorf("%s step %d: velocity %d is out of range", inst.Name(), s, v)
+				}
+				if e.Offset < -0.2 || e.Offset > 0.2 {
+					t.Errorf("%s step %d: offset %v is out of range", inst.Name(), s, e.Offset)
+				}
+			}
+		}
+	}
+
+	// the same seed gives the same pattern, and its velocities survive
+	// encoding
+	humanized, err := Humanize(p, 40, 0, 1)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if again, _ := Humanize(p, 40, 0, 1); !reflect.DeepEqual(again.Instruments(), humanized.Instruments()) {
+		t.Errorf("expected the same seed to give the same pattern")
+	}
+	var buf bytes.Buffer
+	if err := humanized.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := drum.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n, inst := range humanized.Instruments() {
+		if want, got := inst.StepValues(), decoded.Instruments()[n].StepValues(); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected steps %v after encoding, got %v", inst.Name(), want, got)
+		}
+	}
+
+	// jitter past the edges is clamped
+	swung, err := Swing(p, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	humanized, err = Humanize(swung, 127, drum.MaxOffset, 1)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	for _, inst := range humanized.Instruments() {
+		for s := range inst.Steps() {
+			e, _ := inst.Expression(s)
+			if e.Offset < -drum.MaxOffset || e.Offset > drum.MaxOffset || e.Velocity > 127 {
+				t.Errorf("%s step %d: %+v is out of range", inst.Name(), s, e)
+			}
+		}
+	}
+
+	if _, err := Humanize(p, -1, 0, 1); err == nil {
+		t.Errorf("expected an error for negative velocity jitter")
+	}
+	if _, err := Humanize(p, 0, 0.6, 1); err == nil {
+		t.Errorf("expected an error for timing jitter over MaxOffset")
+	}
+}
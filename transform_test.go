@@ -0,0 +1,203 @@
+package drum
+
+import (
+	"errors"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestUpsample(t *testing.T) {
+
+	p := Pattern{instruments: []Instrument{
+		{num: 0, name: "kick", measure: []Step{{1, 0, 1, 1}, {0, 0, 0, 1}}},
+	}}
+
+	if err := p.Upsample(2); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got := gridString(p.instruments[0].steps()); got != "x---x-x-------x-" {
+		t.Errorf("got %s, expected x---x-x-------x-", got)
+	}
+
+	if err := p.Upsample(0); err == nil {
+		t.Errorf("expected an error upsampling by 0")
+	}
+}
+
+func TestThin(t *testing.T) {
+
+	p := Pattern{tempo: 120, instruments: []Instrument{
+		{num: 2, name: "HiHat", measure: []Step{{1, 0, 1, 0}, {1, 0, 1, 0}, {1, 0, 1, 0}, {1, 0, 1, 0}}},
+	}}
+
+	tData := []struct {
+		keepEvery int
+		expected  string
+	}{
+		{2, "x---x---x---x---"},
+		{3, "x-----x-----x---"},
+		{1, "x-x-x-x-x-x-x-x-"},
+		{0, "x-x-x-x-x-x-x-x-"},
+	}
+
+	for _, exp := range tData {
+		thinned := p.Thin(exp.keepEvery)
+		if got := gridString(thinned.instruments[0].steps()); got != exp.expected {
+			t.Errorf("Thin(%d): got %s, expected %s", exp.keepEvery, got, exp.expected)
+		}
+	}
+
+	if got := gridString(p.instruments[0].steps()); got != "x-x-x-x-x-x-x-x-" {
+		t.Errorf("Thin modified its input: %s", got)
+	}
+}
+
+func TestReverse(t *testing.T) {
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_1.splice - %v", err)
+	}
+	original := decoded.String()
+
+	decoded.Reverse()
+	if got := gridString(decoded.instruments[4].steps()); got != "x--x-------x---x" {
+		t.Errorf("hh-close reversed to %s, expected x--x-------x---x", got)
+	}
+
+	decoded.Reverse()
+	if decoded.String() != original {
+		t.Errorf("reversing twice changed the pattern:\n%s\nExpected:\n%s", decoded, original)
+	}
+}
+
+func TestInstrumentArithmetic(t *testing.T) {
+
+	inst := Instrument{num: 1, name: "kick", measure: []Step{{1, 0, 0, 0}, {1, 0, 1, 0}, {0, 0, 0, 0}, {0, 0, 0, 1}}}
+
+	tData := []struct {
+		name     string
+		got      Instrument
+		expected string
+	}{
+		{"rotate", inst.Rotate(1), "xx---x-x--------"},
+		{"rotate back", inst.Rotate(-1), "---x-x--------xx"},
+		{"rotate round", inst.Rotate(17), "xx---x-x--------"},
+		{"invert", inst.Invert(), "-xxx-x-xxxxxxxx-"},
+		{"reverse", inst.Reverse(), "x--------x-x---x"},
+		{"shift measure", inst.ShiftMeasure(1), "---xx---x-x-----"},
+		{"chain", inst.Rotate(1).Invert().Reverse(), "xxxxxxxx-x-xxx--"},
+	}
+
+	for _, exp := range tData {
+		if got := gridString(exp.got.steps()); got != exp.expected {
+			t.Errorf("%s: got %s, expected %s", exp.name, got, exp.expected)
+		}
+		if exp.got.num != 1 || exp.got.name != "kick" {
+			t.Errorf("%s: lost the instrument's id and name", exp.name)
+		}
+	}
+	if got := gridString(inst.steps()); got != "x---x-x--------x" {
+		t.Errorf("the transforms modified the instrument: %s", got)
+	}
+
+	// velocities and expressions move with their steps
+	loud := inst.clone()
+	loud.setStep(4, 100)
+	loud.SetExpression(4, Expression{Offset: 0.25})
+	moved := loud.Rotate(2)
+	if v, _ := moved.step(6); v != 100 || moved.expressionAt(6).Offset != 0.25 || moved.expressionAt(4).Offset != 0 {
+		t.Errorf("expected the loud hit and its offset on step 6, got %v and %+v", v, moved.expressionAt(6))
+	}
+	if back := loud.Reverse().Reverse(); !reflect.DeepEqual(back.steps(), loud.steps()) || back.expressionAt(4) != loud.expressionAt(4) {
+		t.Errorf("reversing twice changed the instrument")
+	}
+}
+
+func TestPatternArithmetic(t *testing.T) {
+
+	p := NewPattern("arithmetic", 120)
+	p.AddInstrument(0, "kick").SetSteps("x-------x-------")
+	p.AddInstrument(1, "snare").SetSteps("----x-------x---")
+
+	p.Rotate(2).Invert().ShiftMeasure(-1)
+	if got := gridString(p.instruments[0].steps()); got != "xxxxxx-xxxxxxx-x" {
+		t.Errorf("kick: got %s", got)
+	}
+
+	changes := 0
+	p.OnChange(func(Change) { changes++ })
+	if err := p.MapInstrument(1, func(i Instrument) Instrument { return i.Invert().Reverse() }); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if got := gridString(p.instruments[1].steps()); got != "-----x-------x--" || changes != 1 {
+		t.Errorf("snare: got %s after %d changes", got, changes)
+	}
+
+	if err := p.MapInstrument(9, Instrument.Invert); err == nil {
+		t.Errorf("expected an error mapping a missing instrument")
+	}
+	if err := p.MapInstrument(0, func(Instrument) Instrument { return Instrument{} }); !errors.Is(err, ErrInvalidStep) {
+		t.Errorf("expected %v mapping to no steps, got %v", ErrInvalidStep, err)
+	}
+}
+
+func TestCallResponse(t *testing.T) {
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_2.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_2.splice - %v", err)
+	}
+
+	call, response := decoded.CallResponse()
+
+	if call.version != decoded.version || response.tempo != decoded.tempo {
+		t.Errorf("expected the version and tempo to be kept")
+	}
+	if len(call.instruments) != len(decoded.instruments) || len(response.instruments) != len(decoded.instruments) {
+		t.Fatalf("expected every instrument in both halves")
+	}
+
+	for n, inst := range decoded.instruments {
+		c, r := gridString(call.instruments[n].steps()), gridString(response.instruments[n].steps())
+		original := gridString(inst.steps())
+
+		if c[8:] != "--------" || r[:8] != "--------" {
+			t.Errorf("%s: halves overlap, call %s response %s", inst.name, c, r)
+		}
+		if c[:8]+r[8:] != original {
+			t.Errorf("%s: call %s and response %s don't make up %s", inst.name, c, r, original)
+		}
+	}
+}
+
+func TestMinimize(t *testing.T) {
+
+	p := Pattern{version: "0.808-alpha", tempo: 120, instruments: []Instrument{
+		{num: 0, name: "kick", measure: []Step{{0, 0, 1, 0}, {0, 0, 0, 0}, {1, 0, 0, 0}, {0, 0, 0, 0}}},
+		{num: 1, name: "tom", measure: []Step{{0, 0, 0, 0}, {0, 0, 0, 0}, {0, 0, 0, 0}, {0, 0, 0, 0}}},
+		{num: 2, name: "snare", measure: []Step{{0, 0, 0, 0}, {0, 1, 0, 0}, {0, 0, 0, 0}, {0, 0, 0, 0}}},
+	}}
+
+	if start, end := p.ActiveSpan(); start != 2 || end != 9 {
+		t.Errorf("got active span %d, %d, expected 2, 9", start, end)
+	}
+
+	minimal := p.Minimize()
+
+	expected := "Saved with HW Version: 0.808-alpha\nTempo: 120\n" +
+		"(0) kick\t|x---|--x|\n" +
+		"(2) snare\t|---x|---|\n"
+	if minimal.String() != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", minimal, expected)
+	}
+	if len(p.instruments) != 3 || p.instruments[0].stepCount() != 16 {
+		t.Errorf("minimizing changed the original pattern:\n%s", p)
+	}
+
+	silent := Pattern{instruments: p.instruments[1:2]}
+	if start, end := silent.ActiveSpan(); start != 0 || end != 0 {
+		t.Errorf("expected an empty span without hits, got %d, %d", start, end)
+	}
+}
@@ -0,0 +1,45 @@
+package drum
+
+import "sort"
+
+// stepsPerBeat is the number of steps in each beat unless a pattern has
+// another resolution; every step is a sixteenth note
+const stepsPerBeat = 4
+
+// Trigger is a single hit of an instrument. Step indexes the instrument's
+// steps across measures and BeatTime is when the hit falls, in beats from
+// the start of the pattern, independent of tempo.
+type Trigger struct {
+	InstrumentID uint32
+	Name         string
+	Step         int
+	BeatTime     float64
+}
+
+// Triggers returns every hit in the pattern, ordered by step and then by
+// instrument id.
+func (p Pattern) Triggers() []Trigger {
+
+	var triggers []Trigger
+
+	for _, inst := range p.instruments {
+		for s, step := range inst.steps() {
+			if isOn(step) {
+				triggers = append(triggers, Trigger{
+					InstrumentID: inst.num,
+					Name:         inst.name,
+					Step:         s,
+					BeatTime:     float64(s) / float64(p.beatSteps()),
+				})
+			}
+		}
+	}
+
+	sort.SliceStable(triggers, func(a, b int) bool {
+		if triggers[a].Step != triggers[b].Step {
+			return triggers[a].Step < triggers[b].Step
+		}
+		return triggers[a].InstrumentID < triggers[b].InstrumentID
+	})
+	return triggers
+}
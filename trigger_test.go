@@ -0,0 +1,36 @@
+package drum
+
+import (
+	"path"
+	"testing"
+)
+
+func TestTriggers(t *testing.T) {
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_3.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_3.splice - %v", err)
+	}
+
+	triggers := decoded.Triggers()
+
+	expected := []Trigger{
+		{40, "kick", 0, 0},
+		{3, "hh-open", 2, 0.5},
+		{1, "clap", 4, 1},
+		{3, "hh-open", 6, 1.5},
+		{5, "low-tom", 7, 1.75},
+		{3, "hh-open", 8, 2},
+		{12, "mid-tom", 8, 2},
+		{40, "kick", 8, 2},
+	}
+
+	if len(triggers) < len(expected) {
+		t.Fatalf("expected at least %d triggers, got %v", len(expected), triggers)
+	}
+	for i := range expected {
+		if triggers[i] != expected[i] {
+			t.Errorf("trigger %d: got %+v, expected %+v", i, triggers[i], expected[i])
+		}
+	}
+}
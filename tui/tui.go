@@ -0,0 +1,170 @@
+// Package tui draws drum patterns in a terminal as step grids, with a
+// playhead and flashing instruments that follow a drum.Sequencer as it
+// plays.
+package tui
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	drum "github.com/chrishiestand/golang-challenge-1-drum_machine"
+)
+
+// ANSI escape sequences used to colour a frame
+const (
+	reset   = "\x1b[0m"
+	reverse = "\x1b[7m"
+	hit     = "\x1b[32m"
+	flash   = "\x1b[1;33m"
+)
+
+// Display draws a pattern to a terminal. Each frame shows every instrument
+// as a row of steps grouped into beats, with the playhead on the current
+// step and the instruments that hit on it flashing. With colour the frames
+// use ANSI escape sequences and redraw in place; without it they're plain
+// ASCII, with the playhead marked by a ^ below the grid and flashing
+// instruments by a *, written one after another. A Display is safe for use
+// by several goroutines.
+type Display struct {
+	mu       sync.Mutex
+	w        io.Writer
+	color    bool
+	pattern  drum.Pattern
+	playhead int
+	flashing map[uint32]bool
+	// lines is the number of lines the last frame drawn took up
+	lines int
+}
+
+// New returns a Display drawing p to w, in colour if color is set, with no
+// playhead until the pattern starts playing
+func New(w io.Writer, p drum.Pattern, color bool) *Display {
+
+	return &Display{w: w, color: color, pattern: p.Clone(), playhead: -1, flashing: make(map[uint32]bool)}
+}
+
+// Attach has the display follow s: as each step begins the playhead moves
+// to it, the pattern is redrawn as s plays it and the instruments that
+// flashed on the step before stop. Hits are shown by passing the events s
+// sends to Hit.
+func (d *Display) Attach(s *drum.Sequencer) {
+
+	s.OnStep(func(p drum.Pattern, step int) {
+		d.mu.Lock()
+		d.pattern = p
+		d.playhead = step
+		d.flashing = make(map[uint32]bool)
+		d.mu.Unlock()
+
+		d.Draw()
+	})
+}
+
+// Hit flashes the instrument that plays e until the next step begins
+func (d *Display) Hit(e drum.StepEvent) error {
+
+	d.mu.Lock()
+	d.flashing[e.Instrument.ID()] = true
+	d.mu.Unlock()
+
+	return d.Draw()
+}
+
+// Draw writes the current frame, over the last one when drawing in colour
+func (d *Display) Draw() error {
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	frame := d.frame()
+
+	var b strings.Builder
+	if d.color && d.lines > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA\r", d.lines)
+	}
+	b.WriteString(frame)
+
+	d.lines = strings.Count(frame, "\n")
+	_, err := io.WriteString(d.w, b.String())
+	return err
+}
+
+// Frame returns the current frame as Draw writes it, without moving the
+// cursor back over the last one
+func (d *Display) Frame() string {
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.frame()
+}
+
+// frame returns the current frame. It's called with mu held.
+func (d *Display) frame() string {
+
+	var b strings.Builder
+
+	instruments := d.pattern.Instruments()
+	beat := d.pattern.StepsPerBeat()
+
+	labels := make([]string, len(instruments))
+	width := 0
+	for i, inst := range instruments {
+		labels[i] = fmt.Sprintf("(%d) %s", inst.ID(), inst.Name())
+		if len(labels[i]) > width {
+			width = len(labels[i])
+		}
+	}
+
+	fmt.Fprintf(&b, "Tempo: %v\n", d.pattern.Tempo())
+
+	for i, inst := range instruments {
+		flashing := d.flashing[inst.ID()]
+
+		switch {
+		case flashing && d.color:
+			fmt.Fprintf(&b, "  %s%-*s%s |", flash, width, labels[i], reset)
+		case flashing:
+			fmt.Fprintf(&b, "* %-*s |", width, labels[i])
+		default:
+			fmt.Fprintf(&b, "  %-*s |", width, labels[i])
+		}
+
+		for s, on := range inst.Steps() {
+			if s > 0 && s%beat == 0 {
+				b.WriteByte('|')
+			}
+			b.WriteString(d.step(on, s == d.playhead))
+		}
+		b.WriteString("|\n")
+	}
+
+	if !d.color && d.playhead >= 0 {
+		// the playhead sits under the step, past the label, " |" and the
+		// | of every beat before it
+		column := 2 + width + 2 + d.playhead + d.playhead/beat
+		fmt.Fprintf(&b, "%s^\n", strings.Repeat(" ", column))
+	}
+	return b.String()
+}
+
+// step returns a step's cell of the grid
+func (d *Display) step(on, playing bool) string {
+
+	char := "-"
+	if on {
+		char = "x"
+	}
+
+	switch {
+	case !d.color:
+		return char
+	case playing:
+		return reverse + char + reset
+	case on:
+		return hit + char + reset
+	}
+	return char
+}
@@ -0,0 +1,91 @@
+package tui
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	drum "github.com/chrishiestand/golang-challenge-1-drum_machine"
+	"github.com/chrishiestand/golang-challenge-1-drum_machine/drumtest"
+)
+
+// tracks are the instruments of the pattern the display is tested on
+var tracks = []drumtest.Track{
+	{ID: 0, Name: "kick", Steps: "x---x---x---x---"},
+	{ID: 12, Name: "hat", Steps: "--x---x---x---x-"},
+}
+
+func TestFrame(t *testing.T) {
+
+	d := New(&bytes.Buffer{}, drumtest.Pattern(t, "tui", 120, tracks...), false)
+
+	expected := "Tempo: 120\n" +
+		"  (0) kick |x---|x---|x---|x---|\n" +
+		"  (12) hat |--x-|--x-|--x-|--x-|\n"
+	if got := d.Frame(); got != expected {
+		t.Errorf("got\n%s\nexpected\n%s", got, expected)
+	}
+
+	d.playhead = 6
+	d.Hit(drum.StepEvent{Instrument: d.pattern.Instruments()[1], StepIndex: 6})
+
+	expected = "Tempo: 120\n" +
+		"  (0) kick |x---|x---|x---|x---|\n" +
+		"* (12) hat |--x-|--x-|--x-|--x-|\n" +
+		"                   ^\n"
+	if got := d.Frame(); got != expected {
+		t.Errorf("got\n%s\nexpected\n%s", got, expected)
+	}
+}
+
+func TestDrawColor(t *testing.T) {
+
+	var out bytes.Buffer
+	d := New(&out, drumtest.Pattern(t, "tui", 120, tracks...), true)
+	d.playhead = 0
+
+	if err := d.Draw(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	first := out.String()
+	if !strings.Contains(first, reverse+"x"+reset) {
+		t.Errorf("expected the playhead step in reverse video, got %q", first)
+	}
+	if !strings.Contains(first, hit+"x"+reset) {
+		t.Errorf("expected hits to be coloured, got %q", first)
+	}
+
+	out.Reset()
+	if err := d.Draw(); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "\x1b[3A\r") {
+		t.Errorf("expected the second frame to move back over the first 3 lines, got %q", out.String())
+	}
+}
+
+func TestAttach(t *testing.T) {
+
+	p := drum.NewPattern("tui", 6000)
+	p.AddInstrument(0, "kick").SetSteps("x---------------")
+
+	d := New(&bytes.Buffer{}, *p, false)
+	s := drum.NewSequencer(*p)
+	d.Attach(s)
+
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	d.Hit(<-s.Events())
+	s.Stop()
+
+	// the sequencer plays on to step 1 while the hit is handled at most
+	deadline := time.Now().Add(time.Second)
+	for !strings.Contains(d.Frame(), "^") && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if !strings.Contains(d.Frame(), "^") {
+		t.Errorf("expected the attached display to have a playhead, got\n%s", d.Frame())
+	}
+}
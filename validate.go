@@ -0,0 +1,115 @@
+package drum
+
+import (
+	"fmt"
+	"io"
+)
+
+// The tempo range Validate accepts, in beats per minute
+const (
+	MinTempo = 1
+	MaxTempo = 1000
+)
+
+// IssueKind identifies the kind of problem an Issue reports
+type IssueKind int
+
+const (
+	// IssueVersionTooLong is a version that won't fit the version field.
+	IssueVersionTooLong IssueKind = iota
+	// IssueTempo is a tempo outside MinTempo to MaxTempo.
+	IssueTempo
+	// IssueDuplicateID is an instrument sharing its id with an earlier one.
+	IssueDuplicateID
+	// IssueEmptyName is an instrument without a name.
+	IssueEmptyName
+	// IssueNameTooLong is an instrument name that won't fit its length.
+	IssueNameTooLong
+	// IssueStepCount is an instrument without steps. Any other count can
+	// be written, those shorter than the pattern's loop extended to it,
+	// though a pattern of other than 16 steps has to be decoded with its
+	// count in DecodeOptions.StepsPerInstrument.
+	IssueStepCount
+)
+
+// Issue is a problem Validate found with a pattern. Instrument is the index
+// of the instrument the issue concerns, or -1 for the pattern as a whole.
+type Issue struct {
+	Kind       IssueKind
+	Instrument int
+	Message    string
+}
+
+func (i Issue) Error() string {
+
+	if i.Instrument < 0 {
+		return i.Message
+	}
+	return fmt.Sprintf("instrument %d: %s", i.Instrument, i.Message)
+}
+
+// Validate checks the pattern against the invariants of the .splice format
+// and returns every problem found, or nil if there are none.
+func Validate(p Pattern) []Issue {
+
+	var issues []Issue
+
+	if len(p.version) > p.versionFieldSize() {
+		issues = append(issues, Issue{IssueVersionTooLong, -1,
+			fmt.Sprintf("version %q is longer than %d bytes", p.version, p.versionFieldSize())})
+	}
+
+	if p.tempo < MinTempo || p.tempo > MaxTempo {
+		issues = append(issues, Issue{IssueTempo, -1,
+			fmt.Sprintf("tempo %v is outside %d to %d", p.tempo, MinTempo, MaxTempo)})
+	}
+
+	seen := make(map[uint32]bool)
+
+	for i, inst := range p.instruments {
+		if seen[inst.num] {
+			issues = append(issues, Issue{IssueDuplicateID, i, fmt.Sprintf("id %d is already used", inst.num)})
+		}
+		seen[inst.num] = true
+
+		if inst.name == "" {
+			issues = append(issues, Issue{IssueEmptyName, i, "name is empty"})
+		}
+		if len(inst.name) > maxNameSize {
+			issues = append(issues, Issue{IssueNameTooLong, i, fmt.Sprintf("name is %d bytes, the most is %d", len(inst.name), maxNameSize)})
+		}
+
+		if inst.stepCount() == 0 {
+			issues = append(issues, Issue{IssueStepCount, i, "has no steps"})
+		}
+	}
+	return issues
+}
+
+// DecodeStrict decodes a single pattern from r and validates it, returning
+// the first issue Validate finds as the error. A nil error means the pattern
+// is fully conformant.
+func DecodeStrict(r io.Reader) (Pattern, error) {
+
+	p, err := Decode(r)
+	if err != nil {
+		return p, err
+	}
+
+	if issues := Validate(p); len(issues) > 0 {
+		return p, issues[0]
+	}
+	return p, nil
+}
+
+// EncodeStrict validates the pattern and, if Validate finds no issues,
+// writes it to w as Encode does. Otherwise nothing is written and the
+// first issue is returned as the error, so editors can refuse to save a
+// pattern that isn't fully conformant.
+func (p Pattern) EncodeStrict(w io.Writer) error {
+
+	if issues := Validate(p); len(issues) > 0 {
+		return issues[0]
+	}
+	return p.Encode(w)
+}
@@ -0,0 +1,108 @@
+package drum
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+
+	steps := []Step{{1, 0, 0, 0}, {1, 0, 0, 0}, {1, 0, 0, 0}, {1, 0, 0, 0}}
+
+	p := Pattern{version: strings.Repeat("9", 40), tempo: 0, instruments: []Instrument{
+		{num: 1, name: "kick", measure: steps},
+		{num: 1, name: "", measure: steps},
+		{num: 2, name: strings.Repeat("k", 1<<16), measure: append(steps, Step{0})},
+		{num: 3, name: "hat", measure: steps[:3]},
+		{num: 4, name: "clap"},
+	}}
+
+	expected := []Issue{
+		{IssueVersionTooLong, -1, ""},
+		{IssueTempo, -1, ""},
+		{IssueDuplicateID, 1, ""},
+		{IssueEmptyName, 1, ""},
+		{IssueNameTooLong, 2, ""},
+		{IssueStepCount, 4, ""},
+	}
+
+	issues := Validate(p)
+	if len(issues) != len(expected) {
+		t.Fatalf("expected %d issues, got %v", len(expected), issues)
+	}
+	for i := range expected {
+		if issues[i].Kind != expected[i].Kind || issues[i].Instrument != expected[i].Instrument {
+			t.Errorf("issue %d: got %+v, expected kind %d on instrument %d", i, issues[i], expected[i].Kind, expected[i].Instrument)
+		}
+	}
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issues := Validate(*decoded); issues != nil {
+		t.Errorf("expected pattern_1 to be valid, got %v", issues)
+	}
+}
+
+func TestDecodeStrict(t *testing.T) {
+
+	f, err := os.Open(path.Join("fixtures", "pattern_2.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := DecodeStrict(f); err != nil {
+		t.Errorf("expected pattern_2 to decode strictly, got %v", err)
+	}
+
+	dup, err := os.Open(path.Join("fixtures", "duplicate_ids.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dup.Close()
+
+	var issue Issue
+	if _, err := DecodeStrict(dup); !errors.As(err, &issue) || issue.Kind != IssueDuplicateID {
+		t.Errorf("expected a duplicate id issue, got %v", err)
+	}
+
+	if _, err := DecodeStrict(bytes.NewReader([]byte("SPLICE"))); !errors.Is(err, ErrTruncated) {
+		t.Errorf("expected decode errors to pass through, got %v", err)
+	}
+}
+
+func TestEncodeStrict(t *testing.T) {
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var strict, plain bytes.Buffer
+	if err := decoded.EncodeStrict(&strict); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if err := decoded.Encode(&plain); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(strict.Bytes(), plain.Bytes()) {
+		t.Errorf("expected EncodeStrict to write what Encode does")
+	}
+
+	decoded.SetTempo(0)
+	strict.Reset()
+
+	var issue Issue
+	if err := decoded.EncodeStrict(&strict); !errors.As(err, &issue) || issue.Kind != IssueTempo {
+		t.Errorf("expected a tempo issue, got %v", err)
+	}
+	if strict.Len() != 0 {
+		t.Errorf("expected nothing written for an invalid pattern, got %d bytes", strict.Len())
+	}
+}
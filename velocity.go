@@ -0,0 +1,81 @@
+package drum
+
+import "fmt"
+
+// StepValue is a step as it's played: whether it plays and, if it does, the
+// velocity from 1 to 127 its byte carries
+type StepValue struct {
+	On       bool
+	Velocity uint8
+}
+
+// isOn reports whether a step byte is a hit
+func isOn(step byte) bool {
+
+	return step != StepOff
+}
+
+// stepVelocity returns the velocity a step byte carries: none for StepOff,
+// DefaultVelocity for StepOn and the byte itself, limited to 127, otherwise
+func stepVelocity(step byte) uint8 {
+
+	switch {
+	case step == StepOff:
+		return 0
+	case step == StepOn:
+		return DefaultVelocity
+	case step > 127:
+		return 127
+	}
+	return step
+}
+
+// StepValue returns the step at the given index, indexed across measures as
+// in StepAt.
+func (i Instrument) StepValue(global int) (StepValue, error) {
+
+	step, err := i.step(global)
+	if err != nil {
+		return StepValue{}, err
+	}
+	return StepValue{On: isOn(step), Velocity: stepVelocity(step)}, nil
+}
+
+// StepValues returns every step of the instrument in play order
+func (i Instrument) StepValues() []StepValue {
+
+	values := make([]StepValue, 0, i.stepCount())
+
+	for _, step := range i.steps() {
+		values = append(values, StepValue{On: isOn(step), Velocity: stepVelocity(step)})
+	}
+	return values
+}
+
+// SetVelocity turns on the step at index step of the instrument with the
+// given id, indexed as in SetStep, and stores velocity in its byte so
+// Encode keeps it. DefaultVelocity is stored as StepOn. A velocity of 1
+// can't be stored, as that byte is StepOn, and neither can anything over
+// 127; turn a step off with SetStep.
+func (p *Pattern) SetVelocity(id uint32, step int, velocity uint8) error {
+
+	i := p.instrumentIndex(id)
+	if i < 0 {
+		return fmt.Errorf("no instrument with id %d", id)
+	}
+	if velocity < 2 || velocity > 127 {
+		return fmt.Errorf("%w: velocity %d is not between 2 and 127", ErrInvalidStep, velocity)
+	}
+
+	value := velocity
+	if velocity == DefaultVelocity {
+		value = StepOn
+	}
+
+	if err := p.instruments[i].setStep(step, value); err != nil {
+		return err
+	}
+
+	p.notify(Change{Kind: ChangeStep, InstrumentID: id, Step: step, On: true})
+	return nil
+}
@@ -0,0 +1,78 @@
+package drum
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestStepVelocity(t *testing.T) {
+
+	p := NewPattern("velocity", 120)
+	p.AddInstrument(0, "kick").SetSteps("x---x---x---x---")
+
+	tData := []struct {
+		step     int
+		velocity uint8
+		valid    bool
+	}{
+		{4, 64, true},
+		{8, DefaultVelocity, true},
+		{12, 127, true},
+		{1, 1, false},
+		{1, 128, false},
+		{16, 64, false},
+	}
+
+	for _, exp := range tData {
+		if err := p.SetVelocity(0, exp.step, exp.velocity); (err == nil) != exp.valid {
+			t.Errorf("step %d velocity %d: expected valid %v, got %v", exp.step, exp.velocity, exp.valid, err)
+		}
+	}
+	if err := p.SetVelocity(0, 0, 0); !errors.Is(err, ErrInvalidStep) {
+		t.Errorf("expected %v for a zero velocity, got %v", ErrInvalidStep, err)
+	}
+
+	var buf bytes.Buffer
+	if err := p.Encode(&buf); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	decoded, err := DecodeWithOptions(bytes.NewReader(buf.Bytes()), DecodeOptions{})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	inst := decoded.Instruments()[0]
+	if got := inst.steps(); !bytes.Equal(got, []byte{1, 0, 0, 0, 64, 0, 0, 0, 1, 0, 0, 0, 127, 0, 0, 0}) {
+		t.Errorf("velocities weren't kept through encoding, got % x", got)
+	}
+
+	expected := map[int]StepValue{0: {true, DefaultVelocity}, 1: {false, 0}, 4: {true, 64}, 8: {true, DefaultVelocity}, 12: {true, 127}}
+	values := inst.StepValues()
+	for s, exp := range expected {
+		if got, err := inst.StepValue(s); err != nil || got != exp || values[s] != exp {
+			t.Errorf("step %d: expected %+v, got %+v and %+v (%v)", s, exp, got, values[s], err)
+		}
+	}
+	if v := (Instrument{measure: []Step{{200}}}).StepValues()[0]; v != (StepValue{true, 127}) {
+		t.Errorf("expected byte 200 to play at 127, got %+v", v)
+	}
+
+	if e, _ := inst.Expression(4); e.Velocity != 64 {
+		t.Errorf("expected the step's velocity in its expression, got %+v", e)
+	}
+	decoded.SetExpression(0, 4, Expression{Velocity: 90})
+	if e, _ := decoded.Instruments()[0].Expression(4); e.Velocity != 90 {
+		t.Errorf("expected the expression's velocity to override the step's, got %+v", e)
+	}
+
+	buf.Reset()
+	if err := p.ToMIDI(&buf, nil); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	for _, note := range [][]byte{{0x99, 36, 100}, {0x99, 36, 64}, {0x99, 36, 127}} {
+		if !bytes.Contains(buf.Bytes(), note) {
+			t.Errorf("expected a note on % x in the MIDI file", note)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package drum
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// VersionInfo parses the pattern's HW version string, such as "0.808-alpha",
+// into its numeric major and minor components and the optional label that
+// follows a dash. Versions that don't start with "major.minor" return an
+// error describing what was found.
+func (p Pattern) VersionInfo() (major, minor int, label string, err error) {
+
+	numeric := p.version
+	if i := strings.Index(numeric, "-"); i >= 0 {
+		numeric, label = numeric[:i], numeric[i+1:]
+	}
+
+	parts := strings.Split(numeric, ".")
+	if len(parts) != 2 {
+		return 0, 0, "", fmt.Errorf("version %q is not of the form major.minor[-label]", p.version)
+	}
+
+	if major, err = strconv.Atoi(parts[0]); err != nil {
+		return 0, 0, "", fmt.Errorf("version %q has a non-numeric major component %q", p.version, parts[0])
+	}
+
+	if minor, err = strconv.Atoi(parts[1]); err != nil {
+		return 0, 0, "", fmt.Errorf("version %q has a non-numeric minor component %q", p.version, parts[1])
+	}
+
+	return major, minor, label, nil
+}
+
+// VersionInfo is what a hardware revision's patterns can hold, from the
+// table SupportedVersions returns and DecodeOptions.KnownVersions checks
+// patterns against
+type VersionInfo struct {
+	// Version is the HW version string the revision writes.
+	Version string
+	// Velocity is whether the revision plays steps at the velocity their
+	// bytes carry; one without it only has steps that are off or on.
+	Velocity bool
+	// MaxNameLength is the longest instrument name, in bytes, the
+	// revision stores.
+	MaxNameLength int
+	// ByteOrder and VersionSize are the byte order of the revision's
+	// payload and the width of its version field, as in DecodeOptions.
+	ByteOrder   binary.ByteOrder
+	VersionSize int
+}
+
+// versionTable is the revisions the package knows, in order of version
+var versionTable = []VersionInfo{
+	{Version: "0.708-alpha", MaxNameLength: longName - 1, ByteOrder: binary.LittleEndian, VersionSize: versionSize},
+	{Version: "0.808-alpha", Velocity: true, MaxNameLength: longName - 1, ByteOrder: binary.LittleEndian, VersionSize: versionSize},
+	{Version: "0.909", Velocity: true, MaxNameLength: maxNameSize, ByteOrder: binary.LittleEndian, VersionSize: versionSize},
+}
+
+// SupportedVersions returns the hardware revisions the package knows what
+// patterns can hold for, in order of version
+func SupportedVersions() []VersionInfo {
+
+	return append([]VersionInfo(nil), versionTable...)
+}
+
+// lookupVersion returns the revision writing the given version, if it's
+// one the package knows
+func lookupVersion(version string) (VersionInfo, bool) {
+
+	for _, v := range versionTable {
+		if v.Version == version {
+			return v, true
+		}
+	}
+	return VersionInfo{}, false
+}
+
+// versionDialects returns the Dialects of the known revisions
+func versionDialects() []Dialect {
+
+	dialects := make([]Dialect, len(versionTable))
+	for i, v := range versionTable {
+		dialects[i] = Dialect{VersionPrefix: v.Version, ByteOrder: v.ByteOrder, VersionSize: v.VersionSize}
+	}
+	return dialects
+}
+
+// unknownVersion returns the error for a version that isn't in the table,
+// saying which are and how to decode the pattern anyway
+func unknownVersion(version string) error {
+
+	known := make([]string, len(versionTable))
+	for i, v := range versionTable {
+		known[i] = strconv.Quote(v.Version)
+	}
+	return fmt.Errorf("%w: %q isn't a known hardware revision, which are %s; decode without KnownVersions to read it as the original format",
+		ErrUnsupportedVersion, version, strings.Join(known, ", "))
+}
+
+// checkInstrument returns an error if inst holds what the revision can't:
+// a step at a velocity, wrapping ErrInvalidStep, or a name that's too
+// long, wrapping ErrNameTooLong
+func (v VersionInfo) checkInstrument(inst Instrument) error {
+
+	if len(inst.name) > v.MaxNameLength {
+		return fmt.Errorf("%w: instrument %d name is %d bytes, but version %q stores at most %d",
+			ErrNameTooLong, inst.num, len(inst.name), v.Version, v.MaxNameLength)
+	}
+	if !v.Velocity {
+		for s, step := range inst.steps() {
+			if step != StepOff && step != StepOn {
+				return fmt.Errorf("%w: instrument %d step %d is %#x, but version %q has no velocities",
+					ErrInvalidStep, inst.num, s, step, v.Version)
+			}
+		}
+	}
+	return nil
+}
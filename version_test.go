@@ -0,0 +1,119 @@
+package drum
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestVersionInfo(t *testing.T) {
+	tData := []struct {
+		version string
+		major   int
+		minor   int
+		label   string
+		fail    bool
+	}{
+		{"0.808-alpha", 0, 808, "alpha", false},
+		{"0.909", 0, 909, "", false},
+		{"1.2-rc-1", 1, 2, "rc-1", false},
+		{"", 0, 0, "", true},
+		{"alpha", 0, 0, "", true},
+		{"0.x-beta", 0, 0, "", true},
+		{"1.2.3", 0, 0, "", true},
+	}
+
+	for _, exp := range tData {
+
+		major, minor, label, err := Pattern{version: exp.version}.VersionInfo()
+
+		if exp.fail {
+			if err == nil {
+				t.Errorf("%q: expected an error", exp.version)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", exp.version, err)
+			continue
+		}
+		if major != exp.major || minor != exp.minor || label != exp.label {
+			t.Errorf("%q: got %d, %d, %q", exp.version, major, minor, label)
+		}
+	}
+}
+
+func TestKnownVersions(t *testing.T) {
+
+	versions := SupportedVersions()
+	if len(versions) != 3 || versions[0].Version != "0.708-alpha" || versions[0].Velocity || !versions[2].Velocity {
+		t.Errorf("unexpected version table %+v", versions)
+	}
+	versions[0].Version = "changed"
+	if SupportedVersions()[0].Version != "0.708-alpha" {
+		t.Errorf("expected SupportedVersions to return a copy")
+	}
+
+	opts := DecodeOptions{KnownVersions: true}
+	for _, name := range []string{"pattern_1.splice", "pattern_4.splice", "pattern_5.splice"} {
+		data, err := os.ReadFile("fixtures/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := DecodeWithOptions(bytes.NewReader(data), opts); err != nil {
+			t.Errorf("%s: unexpected error %v", name, err)
+		}
+	}
+
+	encode := func(p *Pattern) []byte {
+
+		var buf bytes.Buffer
+		if err := p.Encode(&buf); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+		return buf.Bytes()
+	}
+
+	unknown := NewPattern("unknown", 120)
+	unknown.SetVersion("0.606")
+	soft := NewPattern("soft", 120)
+	soft.SetVersion("0.708-alpha")
+	soft.AddInstrument(0, "kick")
+	soft.instruments[0].setStep(3, 0x40)
+	long := NewPattern("long", 120)
+	long.SetVersion("0.808-alpha")
+	long.AddInstrument(0, strings.Repeat("k", 300))
+
+	tData := []struct {
+		name     string
+		data     []byte
+		expected error
+	}{
+		{"unknown", encode(unknown), ErrUnsupportedVersion},
+		{"velocity", encode(soft), ErrInvalidStep},
+		{"name", encode(long), ErrNameTooLong},
+	}
+	for _, exp := range tData {
+		if _, err := DecodeWithOptions(bytes.NewReader(exp.data), opts); !errors.Is(err, exp.expected) {
+			t.Errorf("%s: expected %v, got %v", exp.name, exp.expected, err)
+		}
+
+		d := NewDecoder(bytes.NewReader(exp.data))
+		d.SetOptions(opts)
+		if _, err := d.NextPattern(); !errors.Is(err, exp.expected) {
+			t.Errorf("%s: expected %v streaming, got %v", exp.name, exp.expected, err)
+		}
+
+		// without KnownVersions the pattern is read as before
+		if _, err := Decode(bytes.NewReader(exp.data)); err != nil {
+			t.Errorf("%s: unexpected error %v", exp.name, err)
+		}
+	}
+
+	_, err := DecodeWithOptions(bytes.NewReader(encode(unknown)), opts)
+	if err == nil || !strings.Contains(err.Error(), `"0.909"`) || !strings.Contains(err.Error(), "KnownVersions") {
+		t.Errorf("expected the error to list the known versions, got %v", err)
+	}
+}
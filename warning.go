@@ -0,0 +1,124 @@
+package drum
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// WarningCode identifies the kind of quirk a Warning reports
+type WarningCode int
+
+const (
+	// WarningStepNormalized reports a step byte other than StepOff or
+	// StepOn, a hit with a velocity, which was read as a plain StepOn.
+	WarningStepNormalized WarningCode = iota + 1
+	// WarningTrailingBytes reports bytes following the payload, which were
+	// ignored.
+	WarningTrailingBytes
+	// WarningNameTrailingNulls reports an instrument name padded with null
+	// bytes, which were trimmed.
+	WarningNameTrailingNulls
+	// WarningPayloadShort reports a payload that ended before its declared
+	// length, which was decoded as far as it went.
+	WarningPayloadShort
+	// WarningPartialInstrument reports an instrument record cut short at
+	// the end of the payload, which was dropped.
+	WarningPartialInstrument
+	// WarningPayloadLength reports a declared payload length that stops
+	// short of instrument records following it, as VerifyFile finds.
+	WarningPayloadLength
+)
+
+// Warning describes something unusual about a decoded file that didn't stop
+// it from being decoded
+type Warning struct {
+	Code    WarningCode
+	Message string
+}
+
+func (w Warning) String() string {
+
+	return w.Message
+}
+
+// DecodeVerbose decodes a single pattern from r like Decode, but tidies up
+// the quirks of slightly non-standard files and reports each one as a
+// Warning instead of passing it through: step bytes other than StepOff and
+// StepOn are read as StepOn, dropping the velocity they carry, and null
+// bytes padding instrument names are trimmed. It then reads r to the end
+// and reports any bytes after the payload, so r must hold a single pattern.
+// Errors that stop the pattern decoding are returned as they would be by
+// Decode, unlike DecodeWithWarnings, which recovers from a short payload.
+func DecodeVerbose(r io.Reader) (Pattern, []Warning, error) {
+
+	var warnings []Warning
+
+	br := bufio.NewReader(r)
+
+	p, err := Decode(br)
+	if err != nil {
+		return p, nil, err
+	}
+
+	for i := range p.instruments {
+		inst := &p.instruments[i]
+
+		if name := strings.TrimRight(inst.name, "\x00"); name != inst.name {
+			warnings = append(warnings, Warning{WarningNameTrailingNulls,
+				fmt.Sprintf("instrument %d name %q had %d trailing null bytes", inst.num, name, len(inst.name)-len(name))})
+			inst.name = name
+		}
+
+		for s, step := range inst.steps() {
+			if step != StepOff && step != StepOn {
+				warnings = append(warnings, Warning{WarningStepNormalized,
+					fmt.Sprintf("instrument %d step %d has byte %#02x, read as on", inst.num, s, step)})
+				inst.setStep(s, StepOn)
+			}
+		}
+	}
+
+	warnings, err = warnTrailing(br, warnings)
+	return p, warnings, err
+}
+
+// DecodeWithWarnings decodes a single pattern from r as adjusted by opts,
+// then reads r to the end, so r must hold a single pattern. With
+// opts.Strict any missing or extra bytes are an error, as for
+// DecodeWithOptions. Otherwise decoding is lenient: it stops at the declared
+// payload length and reports the bytes after it as a WarningTrailingBytes,
+// and a payload that ends early is decoded as far as its last complete
+// instrument with a WarningPayloadShort and a WarningPartialInstrument for
+// the rest. The header, version and tempo must still be complete.
+func DecodeWithWarnings(r io.Reader, opts DecodeOptions) (Pattern, []Warning, error) {
+
+	var warnings []Warning
+
+	r = peekable(r)
+	p, err := decode(context.Background(), r, opts, &warnings)
+	if err != nil {
+		return p, nil, err
+	}
+
+	warnings, err = warnTrailing(r, warnings)
+	return p, warnings, err
+}
+
+// warnTrailing reads r to the end, appending a WarningTrailingBytes to
+// warnings if anything was left after the payload
+func warnTrailing(r io.Reader, warnings []Warning) ([]Warning, error) {
+
+	trailing, err := io.Copy(ioutil.Discard, r)
+	if err != nil {
+		return warnings, fmt.Errorf("reading past the payload: %w", err)
+	}
+	if trailing > 0 {
+		warnings = append(warnings, Warning{WarningTrailingBytes,
+			fmt.Sprintf("%d bytes after the payload were ignored", trailing)})
+	}
+	return warnings, nil
+}
@@ -0,0 +1,107 @@
+package drum
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestDecodeVerbose(t *testing.T) {
+
+	f, err := os.Open(path.Join("fixtures", "quirks.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	p, warnings, err := DecodeVerbose(f)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	expected := "Saved with HW Version: 0.808-quirks\nTempo: 120\n" +
+		"(0) kick\t|x---|x---|x---|x---|\n" +
+		"(1) snare\t|--x-|--x-|--x-|--x-|\n"
+	if p.String() != expected {
+		t.Errorf("got:\n%s\nexpected:\n%s", p, expected)
+	}
+
+	codes := []WarningCode{WarningNameTrailingNulls, WarningStepNormalized, WarningStepNormalized, WarningTrailingBytes}
+	if len(warnings) != len(codes) {
+		t.Fatalf("expected %d warnings, got %v", len(codes), warnings)
+	}
+	for n, code := range codes {
+		if warnings[n].Code != code || warnings[n].Message == "" {
+			t.Errorf("warning %d: got %+v, expected code %d", n, warnings[n], code)
+		}
+	}
+}
+
+func TestDecodeVerboseClean(t *testing.T) {
+
+	f, err := os.Open(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, warnings, err := DecodeVerbose(f); err != nil || len(warnings) != 0 {
+		t.Errorf("expected pattern_1 to decode without warnings, got %v, %v", warnings, err)
+	}
+}
+
+func TestDecodeWithWarnings(t *testing.T) {
+	tData := []struct {
+		file        string
+		codes       []WarningCode
+		instruments int
+		strict      error
+	}{
+		{"pattern_1.splice", nil, 6, nil},
+		{"pattern_5.splice", []WarningCode{WarningTrailingBytes}, 2, ErrTrailingData},
+		{"truncated_payload.splice", []WarningCode{WarningPayloadShort, WarningPartialInstrument}, 1, ErrTruncated},
+	}
+
+	for _, exp := range tData {
+		data, err := ioutil.ReadFile(path.Join("fixtures", exp.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p, warnings, err := DecodeWithWarnings(bytes.NewReader(data), DecodeOptions{})
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", exp.file, err)
+			continue
+		}
+		if len(p.instruments) != exp.instruments {
+			t.Errorf("%s: got %d instruments, expected %d", exp.file, len(p.instruments), exp.instruments)
+		}
+		if len(warnings) != len(exp.codes) {
+			t.Errorf("%s: got warnings %v, expected codes %v", exp.file, warnings, exp.codes)
+			continue
+		}
+		for n, code := range exp.codes {
+			if warnings[n].Code != code {
+				t.Errorf("%s: warning %d: got %+v, expected code %d", exp.file, n, warnings[n], code)
+			}
+		}
+
+		if _, warnings, err := DecodeWithWarnings(bytes.NewReader(data), DecodeOptions{Strict: true}); !errors.Is(err, exp.strict) || len(warnings) != 0 {
+			t.Errorf("%s: strict: expected %v without warnings, got %v, %v", exp.file, exp.strict, err, warnings)
+		}
+		if _, err := DecodeWithOptions(bytes.NewReader(data), DecodeOptions{Strict: true}); !errors.Is(err, exp.strict) {
+			t.Errorf("%s: DecodeWithOptions strict: expected %v, got %v", exp.file, exp.strict, err)
+		}
+	}
+
+	// without Strict, DecodeWithOptions stops at the declared length and
+	// leaves what follows unread
+	data, _ := ioutil.ReadFile(path.Join("fixtures", "pattern_5.splice"))
+	r := bytes.NewReader(data)
+	if _, err := DecodeWithOptions(r, DecodeOptions{}); err != nil || r.Len() != 31 {
+		t.Errorf("expected 31 bytes left unread, got %d, %v", r.Len(), err)
+	}
+}
@@ -0,0 +1,130 @@
+package drum
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// watchInterval is how often WatchFile checks the file it watches
+var watchInterval = 100 * time.Millisecond
+
+// WatchFile plays the pattern in the file at path, a .splice file, JSON or
+// the text form ParseText reads, and plays it again each time the file is
+// saved, so a pattern can be edited in another program while it plays.
+// Each new version replaces the pattern playing once its loop comes round
+// to the first step, or at once while the sequencer is stopped or paused.
+// As with Update, the sequencer keeps the tempo given to SetTempo. A file
+// that can't be read or decoded after a save, such as one caught half
+// written, leaves the pattern as it was until the file changes again.
+// The file is checked for changes to its size or modification time every
+// tenth of a second until Close. It returns an error if the file can't be
+// read or decoded when first watched, or if the sequencer plays a song.
+func (s *Sequencer) WatchFile(path string) error {
+
+	s.mu.Lock()
+	song := s.song != nil
+	s.mu.Unlock()
+	if song {
+		return errors.New("a sequencer playing a song can't watch a pattern file")
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	p, err := readPatternFile(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	s.reload(p)
+
+	w := &fileWatcher{stop: make(chan struct{}), done: make(chan struct{})}
+	go w.watch(s, path, info)
+
+	s.mu.Lock()
+	s.closers = append(s.closers, w)
+	s.mu.Unlock()
+	return nil
+}
+
+// readPatternFile decodes the pattern in the file at path, in whichever
+// format DecodeAny finds it in
+func readPatternFile(path string) (Pattern, error) {
+
+	f, err := os.Open(path)
+	if err != nil {
+		return Pattern{}, err
+	}
+	defer f.Close()
+
+	p, _, err := DecodeAny(f)
+	if err != nil {
+		return Pattern{}, err
+	}
+	if p.loopSteps() == 0 {
+		return Pattern{}, fmt.Errorf("%w: the pattern has no steps to play", ErrInvalidStep)
+	}
+	return p, nil
+}
+
+// reload replaces the pattern playing with p, at once if the sequencer
+// isn't playing and otherwise from the first step of its next loop
+func (s *Sequencer) reload(p Pattern) {
+
+	p.onChange = nil
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pending = &p
+	if s.stop == nil {
+		s.swapPending()
+	}
+}
+
+// fileWatcher checks a file for changes until it's closed
+type fileWatcher struct {
+	once sync.Once
+	stop chan struct{}
+	done chan struct{}
+}
+
+// watch reloads the file at path into s each time its size or modification
+// time differs from the last seen, starting from info, until w is closed
+func (w *fileWatcher) watch(s *Sequencer, path string, info os.FileInfo) {
+
+	defer close(w.done)
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+
+	size, modified := info.Size(), info.ModTime()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(path)
+		if err != nil || (info.Size() == size && info.ModTime().Equal(modified)) {
+			continue
+		}
+		size, modified = info.Size(), info.ModTime()
+
+		if p, err := readPatternFile(path); err == nil {
+			s.reload(p)
+		}
+	}
+}
+
+// Close stops watching, returning once the file will no longer be read
+func (w *fileWatcher) Close() error {
+
+	w.once.Do(func() { close(w.stop) })
+	<-w.done
+	return nil
+}
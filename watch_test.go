@@ -0,0 +1,94 @@
+package drum
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchFile(t *testing.T) {
+
+	interval := watchInterval
+	watchInterval = time.Millisecond
+	defer func() { watchInterval = interval }()
+
+	first := NewPattern("seq", 6000)
+	first.AddInstrument(0, "kick").SetSteps("x---x---x---x---")
+
+	second := NewPattern("seq", 6000)
+	second.AddInstrument(1, "snare").SetSteps("--x---x-----x---")
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "live.txt")
+	if err := os.WriteFile(path, []byte(first.String()), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSequencer(*second)
+	defer s.Close()
+
+	if err := s.WatchFile(filepath.Join(dir, "missing.txt")); err == nil {
+		t.Errorf("expected an error for a missing file")
+	}
+	if err := s.WatchFile(path); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if p := s.Pattern(); !p.Equal(*first) {
+		t.Fatalf("expected the stopped sequencer to play the file at once, got\n%v", p)
+	}
+
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a half written file leaves the kick playing
+	if err := os.WriteFile(path, []byte("Saved with HW Version: seq\n(1) sn"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var last StepEvent
+	for n := 0; n < 8; n++ {
+		if last = <-s.Events(); last.Instrument.name != "kick" {
+			t.Fatalf("event %d: expected the kick, got the %s", n, last.Instrument.name)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := second.Encode(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the snare takes over as the kick's loop comes round
+	timeout := time.After(5 * time.Second)
+	for last.Instrument.name != "snare" {
+		select {
+		case e := <-s.Events():
+			if e.Instrument.name == "snare" && last.StepIndex != 12 {
+				t.Fatalf("expected the snare after the kick's last hit, got it after step %d", last.StepIndex)
+			}
+			last = e
+		case <-timeout:
+			t.Fatal("the sequencer never reloaded the file")
+		}
+	}
+	if last.StepIndex != 2 {
+		t.Errorf("expected the snare to begin from the start of its loop, got step %d", last.StepIndex)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if p := s.Pattern(); !p.Equal(*second) {
+		t.Errorf("expected the snare to be left playing, got\n%v", p)
+	}
+
+	if ss, err := NewSongSequencer(Song{Patterns: []Pattern{*first}, Chain: []ChainEntry{{Pattern: 0, Repeats: 1}}}); err != nil {
+		t.Fatal(err)
+	} else if err := ss.WatchFile(path); err == nil {
+		t.Errorf("expected an error watching a file from a song")
+	}
+}
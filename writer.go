@@ -0,0 +1,71 @@
+package drum
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// WriteTo writes the text form of the pattern returned by String to w
+// through a buffer, without building the whole string first, and returns
+// the number of bytes written.
+func (p Pattern) WriteTo(w io.Writer) (int64, error) {
+
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+
+	p.render(bw)
+	err := bw.Flush()
+
+	return cw.n, err
+}
+
+// countingWriter counts the bytes successfully written to w
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// Reader reads the text form of a pattern, so it can be the source of
+// io.Copy. Copying from a Reader that hasn't been read from streams the
+// pattern straight to the destination through Pattern.WriteTo.
+type Reader struct {
+	p        Pattern
+	rendered *bytes.Reader
+}
+
+// NewReader returns a Reader of the text form of p
+func NewReader(p Pattern) *Reader {
+
+	return &Reader{p: p}
+}
+
+// Read reads the next part of the text form into b. The text is rendered
+// in full on the first call.
+func (r *Reader) Read(b []byte) (int, error) {
+
+	if r.rendered == nil {
+		var buf bytes.Buffer
+		r.p.render(&buf)
+		r.rendered = bytes.NewReader(buf.Bytes())
+	}
+	return r.rendered.Read(b)
+}
+
+// WriteTo writes the text form not yet read to w and returns the number of
+// bytes written.
+func (r *Reader) WriteTo(w io.Writer) (int64, error) {
+
+	if r.rendered == nil {
+		r.rendered = bytes.NewReader(nil)
+		return r.p.WriteTo(w)
+	}
+	return r.rendered.WriteTo(w)
+}
@@ -0,0 +1,43 @@
+package drum
+
+import (
+	"bytes"
+	"io"
+	"path"
+	"testing"
+)
+
+func TestWriteTo(t *testing.T) {
+
+	decoded, err := DecodeFile(path.Join("fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatalf("something went wrong decoding pattern_1.splice - %v", err)
+	}
+	expected := decoded.String()
+
+	var buf bytes.Buffer
+	n, err := decoded.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if buf.String() != expected || n != int64(len(expected)) {
+		t.Errorf("WriteTo wrote %d bytes:\n%s\nExpected %d bytes:\n%s", n, buf.String(), len(expected), expected)
+	}
+
+	buf.Reset()
+	n, err = io.Copy(&buf, NewReader(*decoded))
+	if err != nil || buf.String() != expected || n != int64(len(expected)) {
+		t.Errorf("io.Copy from a Reader wrote %d bytes, %v:\n%s", n, err, buf.String())
+	}
+
+	r := NewReader(*decoded)
+	head := make([]byte, 10)
+	if _, err := io.ReadFull(r, head); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	io.Copy(&buf, r)
+	if string(head)+buf.String() != expected {
+		t.Errorf("reading then copying from a Reader lost data")
+	}
+}